@@ -5,8 +5,12 @@
 package rpc
 
 import (
+	"context"
 	"crypto/tls"
+	"io"
+	"time"
 
+	"github.com/rpccloud/rpc/internal/adapter"
 	"github.com/rpccloud/rpc/internal/base"
 	"github.com/rpccloud/rpc/internal/client"
 	"github.com/rpccloud/rpc/internal/rpc"
@@ -40,6 +44,86 @@ type Map = rpc.Map
 // Any common Any type
 type Any = rpc.Any
 
+// Error ...
+type Error = base.Error
+
+// ErrorLevel ...
+type ErrorLevel = base.ErrorLevel
+
+const (
+	// ErrorLevelInfo ...
+	ErrorLevelInfo = base.ErrorLevelInfo
+	// ErrorLevelWarn ...
+	ErrorLevelWarn = base.ErrorLevelWarn
+	// ErrorLevelError ...
+	ErrorLevelError = base.ErrorLevelError
+	// ErrorLevelFatal ...
+	ErrorLevelFatal = base.ErrorLevelFatal
+	// ErrorLogAll ...
+	ErrorLogAll = base.ErrorLogAll
+)
+
+// ILogger ...
+type ILogger = base.ILogger
+
+// ILogEncoder ...
+type ILogEncoder = base.ILogEncoder
+
+// LogField ...
+type LogField = base.LogField
+
+// LogRecord ...
+type LogRecord = base.LogRecord
+
+// NewLogField ...
+func NewLogField(key string, value interface{}) LogField {
+	return base.NewLogField(key, value)
+}
+
+// NewLogger ...
+func NewLogger(
+	level ErrorLevel,
+	encoder ILogEncoder,
+	sinks ...io.Writer,
+) ILogger {
+	return base.NewLogger(level, encoder, sinks...)
+}
+
+// NewTextLogEncoder ...
+func NewTextLogEncoder() ILogEncoder {
+	return base.NewTextLogEncoder()
+}
+
+// NewJSONLogEncoder ...
+func NewJSONLogEncoder() ILogEncoder {
+	return base.NewJSONLogEncoder()
+}
+
+// NewLogfmtLogEncoder ...
+func NewLogfmtLogEncoder() ILogEncoder {
+	return base.NewLogfmtLogEncoder()
+}
+
+// NewScreenLogSink ...
+func NewScreenLogSink() io.Writer {
+	return base.NewScreenLogSink()
+}
+
+// NewRotatingFileLogSink ...
+func NewRotatingFileLogSink(
+	path string,
+	maxSize int64,
+	maxAge time.Duration,
+	maxBackups int,
+) (io.WriteCloser, *Error) {
+	sink, err := base.NewRotatingFileSink(path, maxSize, maxAge, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
 // RTValue ...
 type RTValue = rpc.RTValue
 
@@ -64,6 +148,39 @@ type ActionCache = rpc.ActionCache
 // ActionCacheFunc ...
 type ActionCacheFunc = rpc.ActionCacheFunc
 
+// Interceptor ...
+type Interceptor = rpc.Interceptor
+
+// TraceContext ...
+type TraceContext = rpc.TraceContext
+
+// TraceFlagSampled ...
+const TraceFlagSampled = rpc.TraceFlagSampled
+
+// NewTraceContext ...
+func NewTraceContext(sampled bool) TraceContext {
+	return rpc.NewTraceContext(sampled)
+}
+
+// NewRootTraceContext ...
+func NewRootTraceContext(sampleRate float64) TraceContext {
+	return rpc.NewRootTraceContext(sampleRate)
+}
+
+// ParseTraceContext ...
+func ParseTraceContext(traceparent string) (TraceContext, bool) {
+	return rpc.ParseTraceContext(traceparent)
+}
+
+// Span ...
+type Span = rpc.Span
+
+// SpanExporter ...
+type SpanExporter = rpc.SpanExporter
+
+// AccessLogRedactor ...
+type AccessLogRedactor = rpc.AccessLogRedactor
+
 // Service ...
 type Service = rpc.Service
 
@@ -83,6 +200,53 @@ func GetDefaultServerConfig() *ServerConfig {
 	return server.GetDefaultServerConfig()
 }
 
+// SessionConfig ...
+type SessionConfig = server.SessionConfig
+
+// GetDefaultSessionConfig ...
+func GetDefaultSessionConfig() *SessionConfig {
+	return server.GetDefaultSessionConfig()
+}
+
+// SessionStore ...
+type SessionStore = server.SessionStore
+
+// SessionRecord ...
+type SessionRecord = server.SessionRecord
+
+// NewMemorySessionStore ...
+func NewMemorySessionStore() SessionStore {
+	return server.NewMemorySessionStore()
+}
+
+// NewFileSessionStore ...
+func NewFileSessionStore(dir string) SessionStore {
+	return server.NewFileSessionStore(dir)
+}
+
+// Authenticator ...
+type Authenticator = server.Authenticator
+
+// NewTokenAuthenticator ...
+func NewTokenAuthenticator(tokens map[string]Any) Authenticator {
+	return server.NewTokenAuthenticator(tokens)
+}
+
+// NewHMACAuthenticator ...
+func NewHMACAuthenticator(secret []byte) Authenticator {
+	return server.NewHMACAuthenticator(secret)
+}
+
+// NewTLSCertAuthenticator ...
+func NewTLSCertAuthenticator() Authenticator {
+	return server.NewTLSCertAuthenticator()
+}
+
+// MakeHMACTicket ...
+func MakeHMACTicket(secret []byte, identity string, expire time.Time) string {
+	return server.MakeHMACTicket(secret, identity, expire)
+}
+
 // IStreamReceiver ...
 type IStreamReceiver = rpc.IStreamReceiver
 
@@ -109,6 +273,98 @@ func NewClient(
 	)
 }
 
+// NewClientWithCredentials ...
+func NewClientWithCredentials(
+	network string,
+	addr string,
+	path string,
+	tlsConfig *tls.Config,
+	rBufSize int,
+	wBufSize int,
+	credentials Map,
+	onError func(err *base.Error),
+) *Client {
+	return client.NewClientWithCredentials(
+		network,
+		addr,
+		path,
+		tlsConfig,
+		rBufSize,
+		wBufSize,
+		credentials,
+		onError,
+	)
+}
+
+// Endpoint ...
+type Endpoint = adapter.Endpoint
+
+// ConnState ...
+type ConnState = adapter.ConnState
+
+const (
+	// ConnStateConnecting ...
+	ConnStateConnecting = adapter.ConnStateConnecting
+	// ConnStateConnected ...
+	ConnStateConnected = adapter.ConnStateConnected
+	// ConnStateDisconnected ...
+	ConnStateDisconnected = adapter.ConnStateDisconnected
+)
+
+// ReconnectConfig ...
+type ReconnectConfig = adapter.ReconnectConfig
+
+// GetDefaultReconnectConfig ...
+func GetDefaultReconnectConfig() *ReconnectConfig {
+	return adapter.GetDefaultReconnectConfig()
+}
+
+// NewClientWithEndpoints ...
+func NewClientWithEndpoints(
+	endpoints []Endpoint,
+	reconnect *ReconnectConfig,
+	rBufSize int,
+	wBufSize int,
+	credentials Map,
+	onConnState func(endpoint Endpoint, state ConnState),
+	onError func(err *base.Error),
+) *Client {
+	return client.NewClientWithEndpoints(
+		endpoints,
+		reconnect,
+		rBufSize,
+		wBufSize,
+		credentials,
+		onConnState,
+		onError,
+	)
+}
+
+// Pool ...
+type Pool = client.Pool
+
+// PoolStrategy ...
+type PoolStrategy = client.PoolStrategy
+
+const (
+	// PoolStrategyRoundRobin ...
+	PoolStrategyRoundRobin = client.PoolStrategyRoundRobin
+	// PoolStrategyLeastOutstanding ...
+	PoolStrategyLeastOutstanding = client.PoolStrategyLeastOutstanding
+	// PoolStrategyConsistentHash ...
+	PoolStrategyConsistentHash = client.PoolStrategyConsistentHash
+)
+
+// NewPool ...
+func NewPool(strategy PoolStrategy, clients []*Client) *Pool {
+	return client.NewPool(strategy, clients)
+}
+
+// WithTraceContext ...
+func WithTraceContext(ctx context.Context, trace TraceContext) context.Context {
+	return client.WithTraceContext(ctx, trace)
+}
+
 // GetServerTLSConfig ...
 func GetServerTLSConfig(certFile string, keyFile string) (*tls.Config, error) {
 	return base.GetServerTLSConfig(certFile, keyFile)
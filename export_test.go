@@ -1,9 +1,14 @@
 package rpc
 
 import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/client"
 )
 
 func TestNewService(t *testing.T) {
@@ -13,6 +18,68 @@ func TestNewService(t *testing.T) {
 	})
 }
 
+func TestNewLogger(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		buffer := &bytes.Buffer{}
+		v := NewLogger(ErrorLogAll, NewLogfmtLogEncoder(), buffer)
+		v.Log(ErrorLevelWarn, "hello", NewLogField("k", "v"))
+		assert(strings.HasSuffix(
+			buffer.String(),
+			" level=warn msg=hello k=v\n",
+		)).IsTrue()
+		assert(NewTextLogEncoder()).Equals(base.NewTextLogEncoder())
+		assert(NewJSONLogEncoder()).Equals(base.NewJSONLogEncoder())
+		assert(NewScreenLogSink()).Equals(base.NewScreenLogSink())
+		assert(v.Close()).IsNil()
+	})
+}
+
+func TestNewRotatingFileLogSink(t *testing.T) {
+	t.Run("open error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, err := NewRotatingFileLogSink("/", 0, 0, 0)
+		assert(v).IsNil()
+		assert(err.GetCode()).Equals(base.ErrLogOpenFile.GetCode())
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		defer os.RemoveAll("./tmp-export")
+		v, err := NewRotatingFileLogSink("./tmp-export/test.log", 0, 0, 0)
+		assert(v != nil, err).Equals(true, nil)
+		assert(v.Close()).IsNil()
+	})
+}
+
+func TestNewTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewTraceContext(true)
+		assert(v.IsValid(), v.IsSampled()).Equals(true, true)
+		assert(ParseTraceContext(v.String())).Equals(v, true)
+	})
+}
+
+func TestNewRootTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewRootTraceContext(1)
+		assert(v.IsValid(), v.IsSampled()).Equals(true, true)
+		v = NewRootTraceContext(0)
+		assert(v.IsValid(), v.IsSampled()).Equals(true, false)
+	})
+}
+
+func TestWithTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		trace := NewTraceContext(true)
+		assert(WithTraceContext(context.Background(), trace)).
+			Equals(client.WithTraceContext(context.Background(), trace))
+	})
+}
+
 func TestNewServer(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -29,6 +96,32 @@ func TestNewClient(t *testing.T) {
 	})
 }
 
+func TestNewClientWithEndpoints(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewClientWithEndpoints(
+			[]Endpoint{{Network: "ws", Addr: "127.0.0.1"}},
+			GetDefaultReconnectConfig(),
+			1500,
+			1500,
+			nil,
+			nil,
+			nil,
+		)
+		defer v.Close()
+		assert(v).IsNotNil()
+	})
+}
+
+func TestNewPool(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewPool(PoolStrategyRoundRobin, nil)
+		assert(v).IsNotNil()
+		assert(v.Close()).IsTrue()
+	})
+}
+
 func TestGetTLSServerConfig(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -34,20 +34,43 @@ type IReceiver interface {
 	OnConnError(streamConn *StreamConn, err *base.Error)
 }
 
+// Endpoint is an address that the client dials
+type Endpoint struct {
+	Network   string
+	Addr      string
+	Path      string
+	TLSConfig *tls.Config
+}
+
+// ConnState ...
+type ConnState uint8
+
+const (
+	// ConnStateConnecting the client is dialing the endpoint
+	ConnStateConnecting = ConnState(0)
+	// ConnStateConnected the conn to the endpoint is open
+	ConnStateConnected = ConnState(1)
+	// ConnStateDisconnected the dial fails, or the conn is closed
+	ConnStateDisconnected = ConnState(2)
+)
+
 // Adapter ...
 type Adapter struct {
-	isDebug    bool
-	isClient   bool
-	network    string
-	addr       string
-	path       string
-	tlsConfig  *tls.Config
-	fileMap    map[string]http.Handler
-	rBufSize   int
-	wBufSize   int
-	receiver   IReceiver
-	service    base.IORCService
-	orcManager *base.ORCManager
+	isDebug     bool
+	isClient    bool
+	network     string
+	addr        string
+	path        string
+	tlsConfig   *tls.Config
+	fileMap     map[string]http.Handler
+	endpoints   []Endpoint
+	reconnect   *ReconnectConfig
+	onConnState func(endpoint Endpoint, state ConnState)
+	rBufSize    int
+	wBufSize    int
+	receiver    IReceiver
+	service     base.IORCService
+	orcManager  *base.ORCManager
 }
 
 // NewClientAdapter ...
@@ -60,19 +83,61 @@ func NewClientAdapter(
 	wBufSize int,
 	receiver IReceiver,
 ) *Adapter {
+	ret := NewClientAdapterWithEndpoints(
+		[]Endpoint{{
+			Network:   network,
+			Addr:      addr,
+			Path:      path,
+			TLSConfig: tlsConfig,
+		}},
+		nil,
+		nil,
+		rBufSize,
+		wBufSize,
+		receiver,
+	)
+	ret.network = network
+	ret.addr = addr
+	ret.path = path
+	ret.tlsConfig = tlsConfig
+	return ret
+}
+
+// NewClientAdapterWithEndpoints creates a client adapter that dials the
+// endpoints in turn. It fails over to the next endpoint when the dial fails
+// or the conn is closed, and waits the backoff of reconnect after all the
+// endpoints fail. nil reconnect uses GetDefaultReconnectConfig.
+// onConnState is called when the conn state changes, it can be nil.
+func NewClientAdapterWithEndpoints(
+	endpoints []Endpoint,
+	reconnect *ReconnectConfig,
+	onConnState func(endpoint Endpoint, state ConnState),
+	rBufSize int,
+	wBufSize int,
+	receiver IReceiver,
+) *Adapter {
+	if reconnect == nil {
+		reconnect = GetDefaultReconnectConfig()
+	} else {
+		reconnect = reconnect.clone()
+	}
+
 	return &Adapter{
-		isDebug:    false,
-		isClient:   true,
-		network:    network,
-		addr:       addr,
-		path:       path,
-		tlsConfig:  tlsConfig,
-		fileMap:    nil,
-		rBufSize:   rBufSize,
-		wBufSize:   wBufSize,
-		receiver:   receiver,
-		service:    nil,
-		orcManager: base.NewORCManager(),
+		isDebug:     false,
+		isClient:    true,
+		network:     "",
+		addr:        "",
+		path:        "",
+		tlsConfig:   nil,
+		fileMap:     nil,
+		endpoints:   append([]Endpoint(nil), endpoints...),
+		reconnect:   reconnect,
+		onConnState: onConnState,
+		rBufSize:    rBufSize,
+		wBufSize:    wBufSize,
+		receiver:    receiver,
+		service:     nil,
+		orcManager:  base.NewORCManager(),
 	}
 }
 
@@ -89,18 +154,27 @@ func NewServerAdapter(
 	receiver IReceiver,
 ) *Adapter {
 	return &Adapter{
-		isDebug:    isDebug,
-		isClient:   false,
-		network:    network,
-		addr:       addr,
-		path:       path,
-		tlsConfig:  tlsConfig,
-		fileMap:    fileMap,
-		rBufSize:   rBufSize,
-		wBufSize:   wBufSize,
-		receiver:   receiver,
-		service:    nil,
-		orcManager: base.NewORCManager(),
+		isDebug:     isDebug,
+		isClient:    false,
+		network:     network,
+		addr:        addr,
+		path:        path,
+		tlsConfig:   tlsConfig,
+		fileMap:     fileMap,
+		endpoints:   nil,
+		reconnect:   nil,
+		onConnState: nil,
+		rBufSize:    rBufSize,
+		wBufSize:    wBufSize,
+		receiver:    receiver,
+		service:     nil,
+		orcManager:  base.NewORCManager(),
+	}
+}
+
+func (p *Adapter) setConnState(endpoint Endpoint, state ConnState) {
+	if p.onConnState != nil {
+		p.onConnState(endpoint, state)
 	}
 }
 
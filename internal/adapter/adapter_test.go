@@ -233,6 +233,91 @@ func (p *testSingleReceiver) PeekError() *base.Error {
 	}
 }
 
+func TestNewClientAdapter(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		receiver := newTestSingleReceiver()
+		v := NewClientAdapter(
+			"ws", "127.0.0.1:8080", "rpc", nil, 1200, 1200, receiver,
+		)
+		assert(v.isClient).IsTrue()
+		assert(v.network, v.addr, v.path).
+			Equals("ws", "127.0.0.1:8080", "rpc")
+		assert(v.endpoints).Equals([]Endpoint{{
+			Network: "ws",
+			Addr:    "127.0.0.1:8080",
+			Path:    "rpc",
+		}})
+		assert(v.reconnect).Equals(GetDefaultReconnectConfig())
+		assert(v.onConnState).IsNil()
+		assert(v.receiver).Equals(receiver)
+	})
+}
+
+func TestNewClientAdapterWithEndpoints(t *testing.T) {
+	t.Run("reconnect is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewClientAdapterWithEndpoints(
+			nil, nil, nil, 1200, 1200, newTestSingleReceiver(),
+		)
+		assert(v.reconnect).Equals(GetDefaultReconnectConfig())
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		endpoints := []Endpoint{
+			{Network: "tcp", Addr: "127.0.0.1:8080"},
+			{Network: "ws", Addr: "127.0.0.1:8081"},
+		}
+		reconnect := GetDefaultReconnectConfig().SetMinInterval(time.Second)
+		v := NewClientAdapterWithEndpoints(
+			endpoints,
+			reconnect,
+			func(endpoint Endpoint, state ConnState) {},
+			1200,
+			1300,
+			newTestSingleReceiver(),
+		)
+		assert(v.isClient).IsTrue()
+		assert(v.endpoints).Equals(endpoints)
+		assert(&v.endpoints[0] != &endpoints[0]).IsTrue()
+		assert(v.reconnect).Equals(reconnect)
+		assert(v.reconnect != reconnect).IsTrue()
+		assert(v.onConnState).IsNotNil()
+		assert(v.rBufSize, v.wBufSize).Equals(1200, 1300)
+	})
+}
+
+func TestAdapter_setConnState(t *testing.T) {
+	t.Run("onConnState is nil", func(t *testing.T) {
+		v := NewClientAdapterWithEndpoints(
+			nil, nil, nil, 1200, 1200, newTestSingleReceiver(),
+		)
+		v.setConnState(Endpoint{}, ConnStateConnected)
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		states := make([]ConnState, 0)
+		v := NewClientAdapterWithEndpoints(
+			nil,
+			nil,
+			func(endpoint Endpoint, state ConnState) {
+				assert(endpoint.Addr).Equals("127.0.0.1:8080")
+				states = append(states, state)
+			},
+			1200,
+			1200,
+			newTestSingleReceiver(),
+		)
+		endpoint := Endpoint{Addr: "127.0.0.1:8080"}
+		v.setConnState(endpoint, ConnStateConnecting)
+		v.setConnState(endpoint, ConnStateConnected)
+		assert(states).
+			Equals([]ConnState{ConnStateConnecting, ConnStateConnected})
+	})
+}
+
 func TestAdapter(t *testing.T) {
 	type testItem struct {
 		network string
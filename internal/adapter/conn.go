@@ -1,6 +1,7 @@
 package adapter
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
 	"strings"
@@ -90,6 +91,22 @@ func (p *SyncConn) RemoteAddr() net.Addr {
 	return p.conn.RemoteAddr()
 }
 
+// TLSConnectionState returns the TLS state of the connection, or nil if it
+// is not a TLS connection
+func (p *SyncConn) TLSConnectionState() *tls.ConnectionState {
+	conn := p.conn
+	if wsConn, ok := conn.(*syncWSConn); ok {
+		conn = wsConn.conn
+	}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		return &state
+	}
+
+	return nil
+}
+
 // OnReadReady ...
 func (p *SyncConn) OnReadReady() bool {
 	n, e := p.conn.Read(p.rBuf)
@@ -118,6 +135,17 @@ func (p *SyncConn) OnReadReady() bool {
 
 // OnWriteReady ...
 func (p *SyncConn) OnWriteReady() bool {
+	// the error is reported after unlocking, because the receiver may close
+	// the conn, and Close needs the lock
+	err := (*base.Error)(nil)
+	ret := p.writeReady(&err)
+	if err != nil {
+		p.OnError(err)
+	}
+	return ret
+}
+
+func (p *SyncConn) writeReady(err **base.Error) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -137,7 +165,7 @@ func (p *SyncConn) OnWriteReady() bool {
 		start := 0
 		for start < bufLen {
 			if n, e := p.conn.Write(p.wBuf[start:bufLen]); e != nil {
-				p.OnError(base.ErrConnWrite.AddDebug(e.Error()))
+				*err = base.ErrConnWrite.AddDebug(e.Error())
 				return false
 			} else if n == 0 {
 				return false
@@ -174,6 +202,8 @@ type StreamConn struct {
 	readStreamGenerator *rpc.StreamGenerator
 	writePos            int
 	activeTimeNS        int64
+	compressCodec       uint32
+	compressThreshold   int64
 }
 
 // NewStreamConn ...
@@ -188,6 +218,8 @@ func NewStreamConn(isDebug bool, prev IConn, receiver IReceiver) *StreamConn {
 		writeStream:         nil,
 		writePos:            0,
 		activeTimeNS:        base.TimeNow().UnixNano(),
+		compressCodec:       rpc.StreamCodecNone,
+		compressThreshold:   0,
 	}
 	ret.readStreamGenerator = rpc.NewStreamGenerator(ret)
 	return ret
@@ -198,6 +230,21 @@ func (p *StreamConn) SetReceiver(receiver IReceiver) {
 	p.receiver = receiver
 }
 
+// SetCompression sets the codec that is negotiated in the connect request and
+// response, the streams whose body is longer than threshold are compressed
+// before they are written. The compressed streams are read only after it is
+// set, and they can not be decompressed to be longer than transLimit. It is
+// called when the connect stream is read.
+func (p *StreamConn) SetCompression(
+	codec uint8,
+	threshold int,
+	transLimit int,
+) {
+	atomic.StoreInt64(&p.compressThreshold, int64(threshold))
+	atomic.StoreUint32(&p.compressCodec, uint32(codec))
+	p.readStreamGenerator.SetDecompression(codec, transLimit)
+}
+
 // OnOpen ...
 func (p *StreamConn) OnOpen() {
 	p.receiver.OnConnOpen(p)
@@ -289,6 +336,18 @@ func (p *StreamConn) RemoteAddr() net.Addr {
 	return p.prev.RemoteAddr()
 }
 
+// TLSConnectionState returns the TLS state of the underlying connection, or
+// nil if it is not a TLS connection
+func (p *StreamConn) TLSConnectionState() *tls.ConnectionState {
+	if conn, ok := p.prev.(interface {
+		TLSConnectionState() *tls.ConnectionState
+	}); ok {
+		return conn.TLSConnectionState()
+	}
+
+	return nil
+}
+
 // WriteStreamAndRelease ...
 func (p *StreamConn) WriteStreamAndRelease(stream *rpc.Stream) {
 	func() {
@@ -296,6 +355,15 @@ func (p *StreamConn) WriteStreamAndRelease(stream *rpc.Stream) {
 			_ = recover()
 		}()
 
+		codec := uint8(atomic.LoadUint32(&p.compressCodec))
+		if codec != rpc.StreamCodecNone {
+			stream = rpc.CompressStream(
+				stream,
+				codec,
+				int(atomic.LoadInt64(&p.compressThreshold)),
+			)
+		}
+
 		stream.BuildStreamCheck()
 		p.writeCH <- stream
 	}()
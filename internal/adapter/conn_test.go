@@ -1,6 +1,7 @@
 package adapter
 
 import (
+	"crypto/tls"
 	"math/rand"
 	"net"
 	"testing"
@@ -154,6 +155,37 @@ func TestSyncConn_RemoteAddr(t *testing.T) {
 	})
 }
 
+func TestSyncConn_TLSConnectionState(t *testing.T) {
+	t.Run("not tls", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewServerSyncConn(newTestNetConn(nil, 10, 10), 1024, 2048)
+		assert(v.TLSConnectionState()).IsNil()
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewServerSyncConn(
+			tls.Server(newTestNetConn(nil, 10, 10), &tls.Config{}),
+			1024,
+			2048,
+		)
+		assert(v.TLSConnectionState()).IsNotNil()
+		assert(v.TLSConnectionState().HandshakeComplete).IsFalse()
+	})
+
+	t.Run("wss", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewServerSyncConn(
+			newSyncWSServerConn(
+				tls.Server(newTestNetConn(nil, 10, 10), &tls.Config{}),
+			),
+			1024,
+			2048,
+		)
+		assert(v.TLSConnectionState()).IsNotNil()
+	})
+}
+
 func TestSyncConn_OnReadReady(t *testing.T) {
 	t.Run("server error io.EOF", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -227,6 +259,18 @@ func TestSyncConn_OnReadReady(t *testing.T) {
 	})
 }
 
+type testCloseOnErrorReceiver struct {
+	*testSingleReceiver
+}
+
+func (p *testCloseOnErrorReceiver) OnConnError(
+	streamConn *StreamConn,
+	err *base.Error,
+) {
+	p.testSingleReceiver.OnConnError(streamConn, err)
+	streamConn.Close()
+}
+
 func TestSyncConn_OnWriteReady(t *testing.T) {
 	t.Run("nothing to write", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -290,6 +334,23 @@ func TestSyncConn_OnWriteReady(t *testing.T) {
 			Equals(base.ErrConnWrite.AddDebug(base.ErrNetClosingSuffix))
 	})
 
+	t.Run("the receiver closes the conn on write error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		receiver := &testCloseOnErrorReceiver{newTestSingleReceiver()}
+		streamConn := NewStreamConn(false, nil, receiver)
+		streamConn.OnOpen()
+		streamConn.writeCH <- rpc.NewStream()
+		netConn := newTestNetConn(nil, 10, 10)
+		netConn.isRunning = false
+		v := NewClientSyncConn(netConn, 1024, 1024)
+		v.SetNext(streamConn)
+		streamConn.prev = v
+		// it does not dead lock, the closed net conn reports the close error
+		assert(v.OnWriteReady()).IsFalse()
+		assert(receiver.GetOnErrorCount()).Equals(2)
+		assert(v.isRunning).IsFalse()
+	})
+
 	t.Run("write zero", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		stream := rpc.NewStream()
@@ -349,6 +410,24 @@ func TestNewStreamConn(t *testing.T) {
 		assert(v.readStreamGenerator).IsNotNil()
 		assert(v.writeStream).IsNil()
 		assert(v.writePos).Equals(0)
+		assert(v.compressCodec).Equals(uint32(rpc.StreamCodecNone))
+		assert(v.compressThreshold).Equals(int64(0))
+	})
+}
+
+func TestStreamConn_SetCompression(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewStreamConn(false, nil, newTestSingleReceiver())
+		v.SetCompression(rpc.StreamCodecDeflate, 1024, 4096)
+		assert(v.compressCodec).Equals(uint32(rpc.StreamCodecDeflate))
+		assert(v.compressThreshold).Equals(int64(1024))
+		stream := rpc.NewStream()
+		stream.PutBytes(make([]byte, 8192))
+		stream = rpc.CompressStream(stream, rpc.StreamCodecDeflate, 0)
+		stream.BuildStreamCheck()
+		assert(v.readStreamGenerator.OnBytes(stream.GetBuffer())).
+			Equals(base.ErrStream)
 	})
 }
 
@@ -605,6 +684,26 @@ func TestStreamConn_RemoteAddr(t *testing.T) {
 	})
 }
 
+func TestStreamConn_TLSConnectionState(t *testing.T) {
+	t.Run("not tls", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		prev := NewServerSyncConn(newTestNetConn(nil, 10, 10), 1024, 1024)
+		v := NewStreamConn(false, prev, nil)
+		assert(v.TLSConnectionState()).IsNil()
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		prev := NewServerSyncConn(
+			tls.Server(newTestNetConn(nil, 10, 10), &tls.Config{}),
+			1024,
+			1024,
+		)
+		v := NewStreamConn(false, prev, nil)
+		assert(v.TLSConnectionState()).IsNotNil()
+	})
+}
+
 func TestStreamConn_WriteStreamAndRelease(t *testing.T) {
 	t.Run("write ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -620,6 +719,27 @@ func TestStreamConn_WriteStreamAndRelease(t *testing.T) {
 			Equals(retStream.GetBuffer())
 	})
 
+	t.Run("write compressed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		conn := newTestNetConn(nil, 10, 1024)
+		netConn := NewServerSyncConn(conn, 1024, 1024)
+		v := NewStreamConn(false, netConn, newTestSingleReceiver())
+		netConn.SetNext(v)
+		v.SetCompression(rpc.StreamCodecDeflate, 0, 1024*1024)
+		v.OnOpen()
+		stream := rpc.NewStream()
+		stream.PutBytes(make([]byte, 4096))
+		v.WriteStreamAndRelease(stream)
+		retStream := rpc.NewStream()
+		retStream.PutBytesTo(conn.writeBuf[:conn.writePos], 0)
+		assert(retStream.CheckStream()).IsTrue()
+		assert(retStream.HasStatusBitCompressed()).IsTrue()
+		retStream, err := rpc.DecompressStream(retStream, 1024*1024)
+		assert(err).IsNil()
+		assert(retStream.GetBuffer()[rpc.StreamHeadSize:]).
+			Equals(make([]byte, 4096))
+	})
+
 	t.Run("write error", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		conn := newTestNetConn(nil, 10, 10)
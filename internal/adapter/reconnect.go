@@ -0,0 +1,77 @@
+package adapter
+
+import (
+	"math"
+	"time"
+)
+
+// ReconnectConfig ...
+type ReconnectConfig struct {
+	minInterval time.Duration
+	maxInterval time.Duration
+	multiplier  float64
+	jitter      float64
+}
+
+// GetDefaultReconnectConfig ...
+func GetDefaultReconnectConfig() *ReconnectConfig {
+	return &ReconnectConfig{
+		minInterval: 500 * time.Millisecond,
+		maxInterval: 16 * time.Second,
+		multiplier:  2,
+		jitter:      0.2,
+	}
+}
+
+// SetMinInterval sets how long the client waits before it reconnects the
+// first time
+func (p *ReconnectConfig) SetMinInterval(
+	minInterval time.Duration,
+) *ReconnectConfig {
+	p.minInterval = minInterval
+	return p
+}
+
+// SetMaxInterval sets the max time that the client waits before it
+// reconnects
+func (p *ReconnectConfig) SetMaxInterval(
+	maxInterval time.Duration,
+) *ReconnectConfig {
+	p.maxInterval = maxInterval
+	return p
+}
+
+// SetMultiplier sets how fast the interval grows when all the endpoints keep
+// failing
+func (p *ReconnectConfig) SetMultiplier(multiplier float64) *ReconnectConfig {
+	p.multiplier = multiplier
+	return p
+}
+
+// SetJitter sets the ratio of the interval that is cut randomly, so the
+// clients of a restarted server do not reconnect at the same time
+func (p *ReconnectConfig) SetJitter(jitter float64) *ReconnectConfig {
+	p.jitter = jitter
+	return p
+}
+
+// getInterval returns the interval after the failed rounds, r is a random
+// number in [0, 1)
+func (p *ReconnectConfig) getInterval(failures int, r float64) time.Duration {
+	interval := float64(p.minInterval) *
+		math.Pow(p.multiplier, float64(failures))
+	if maxInterval := float64(p.maxInterval); interval > maxInterval {
+		interval = maxInterval
+	}
+
+	return time.Duration(interval * (1 - p.jitter*r))
+}
+
+func (p *ReconnectConfig) clone() *ReconnectConfig {
+	return &ReconnectConfig{
+		minInterval: p.minInterval,
+		maxInterval: p.maxInterval,
+		multiplier:  p.multiplier,
+		jitter:      p.jitter,
+	}
+}
@@ -0,0 +1,83 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+func TestGetDefaultReconnectConfig(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultReconnectConfig()
+		assert(v.minInterval).Equals(500 * time.Millisecond)
+		assert(v.maxInterval).Equals(16 * time.Second)
+		assert(v.multiplier).Equals(float64(2))
+		assert(v.jitter).Equals(0.2)
+	})
+}
+
+func TestReconnectConfig_SetMinInterval(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultReconnectConfig()
+		assert(v.SetMinInterval(time.Second)).Equals(v)
+		assert(v.minInterval).Equals(time.Second)
+	})
+}
+
+func TestReconnectConfig_SetMaxInterval(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultReconnectConfig()
+		assert(v.SetMaxInterval(time.Second)).Equals(v)
+		assert(v.maxInterval).Equals(time.Second)
+	})
+}
+
+func TestReconnectConfig_SetMultiplier(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultReconnectConfig()
+		assert(v.SetMultiplier(1.5)).Equals(v)
+		assert(v.multiplier).Equals(1.5)
+	})
+}
+
+func TestReconnectConfig_SetJitter(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultReconnectConfig()
+		assert(v.SetJitter(0.5)).Equals(v)
+		assert(v.jitter).Equals(0.5)
+	})
+}
+
+func TestReconnectConfig_getInterval(t *testing.T) {
+	t.Run("backoff", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultReconnectConfig()
+		assert(v.getInterval(0, 0)).Equals(500 * time.Millisecond)
+		assert(v.getInterval(1, 0)).Equals(time.Second)
+		assert(v.getInterval(2, 0)).Equals(2 * time.Second)
+		assert(v.getInterval(5, 0)).Equals(16 * time.Second)
+		assert(v.getInterval(10000, 0)).Equals(16 * time.Second)
+	})
+
+	t.Run("jitter", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultReconnectConfig()
+		assert(v.getInterval(0, 0.5)).Equals(450 * time.Millisecond)
+		assert(v.getInterval(5, 0.5)).Equals(14400 * time.Millisecond)
+	})
+}
+
+func TestReconnectConfig_clone(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultReconnectConfig().SetJitter(0)
+		assert(v.clone()).Equals(v)
+		assert(v.clone() != v).IsTrue()
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -17,30 +18,40 @@ import (
 
 // NewSyncClientService ...
 func NewSyncClientService(adapter *Adapter) base.IORCService {
-	switch adapter.network {
-	case "tcp4":
-		fallthrough
-	case "tcp6":
-		fallthrough
-	case "tcp":
-		fallthrough
-	case "ws":
-		fallthrough
-	case "wss":
-		return &syncClientService{
-			adapter:    adapter,
-			conn:       nil,
-			orcManager: base.NewORCManager(),
-		}
-	default:
-		adapter.receiver.OnConnError(
-			nil,
-			base.ErrUnsupportedProtocol.AddDebug(
-				fmt.Sprintf("unsupported protocol %s", adapter.network),
-			),
-		)
+	if len(adapter.endpoints) == 0 {
+		adapter.receiver.OnConnError(nil, base.ErrSyncClientServiceNoEndpoints)
 		return nil
 	}
+
+	for _, endpoint := range adapter.endpoints {
+		switch endpoint.Network {
+		case "tcp4":
+			fallthrough
+		case "tcp6":
+			fallthrough
+		case "tcp":
+			fallthrough
+		case "ws":
+			fallthrough
+		case "wss":
+			continue
+		default:
+			adapter.receiver.OnConnError(
+				nil,
+				base.ErrUnsupportedProtocol.AddDebug(
+					fmt.Sprintf("unsupported protocol %s", endpoint.Network),
+				),
+			)
+			return nil
+		}
+	}
+
+	return &syncClientService{
+		adapter:       adapter,
+		conn:          nil,
+		endpointIndex: 0,
+		orcManager:    base.NewORCManager(),
+	}
 }
 
 // NewSyncServerService ...
@@ -285,13 +296,14 @@ func (p *syncWSServerService) Close() bool {
 // syncClientService
 // -----------------------------------------------------------------------------
 type syncClientService struct {
-	adapter    *Adapter
-	conn       *SyncConn
-	orcManager *base.ORCManager
-	mu         sync.Mutex
+	adapter       *Adapter
+	conn          *SyncConn
+	endpointIndex int
+	orcManager    *base.ORCManager
+	mu            sync.Mutex
 }
 
-func (p *syncClientService) openConn() bool {
+func (p *syncClientService) openConn(endpoint Endpoint) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -300,33 +312,37 @@ func (p *syncClientService) openConn() bool {
 	var wsRawConn net.Conn
 
 	adapter := p.adapter
-	switch adapter.network {
+	switch endpoint.Network {
 	case "tcp4":
 		fallthrough
 	case "tcp6":
 		fallthrough
 	case "tcp":
-		if adapter.tlsConfig == nil {
-			conn, e = net.Dial(adapter.network, adapter.addr)
+		if endpoint.TLSConfig == nil {
+			conn, e = net.Dial(endpoint.Network, endpoint.Addr)
 		} else {
-			conn, e = tls.Dial(adapter.network, adapter.addr, adapter.tlsConfig)
+			conn, e = tls.Dial(
+				endpoint.Network,
+				endpoint.Addr,
+				endpoint.TLSConfig,
+			)
 		}
 	case "ws":
 		fallthrough
 	case "wss":
-		path := adapter.path
+		path := endpoint.Path
 		if !strings.HasPrefix(path, "/") {
 			path = "/" + path
 		}
-		dialer := &ws.Dialer{TLSConfig: adapter.tlsConfig}
-		u := url.URL{Scheme: adapter.network, Host: adapter.addr, Path: path}
+		dialer := &ws.Dialer{TLSConfig: endpoint.TLSConfig}
+		u := url.URL{Scheme: endpoint.Network, Host: endpoint.Addr, Path: path}
 		wsRawConn, _, _, e = dialer.Dial(context.Background(), u.String())
 		conn = newSyncWSClientConn(wsRawConn)
 	default:
 		adapter.receiver.OnConnError(
 			nil,
 			base.ErrUnsupportedProtocol.AddDebug(
-				fmt.Sprintf("unsupported protocol %s", adapter.network),
+				fmt.Sprintf("unsupported protocol %s", endpoint.Network),
 			),
 		)
 		return false
@@ -361,22 +377,51 @@ func (p *syncClientService) Open() bool {
 	})
 }
 
+// runEndpoint runs the conn to the endpoint until it is closed, it returns
+// false if the dial fails
+func (p *syncClientService) runEndpoint(endpoint Endpoint) bool {
+	p.adapter.setConnState(endpoint, ConnStateConnecting)
+	if !p.openConn(endpoint) {
+		p.adapter.setConnState(endpoint, ConnStateDisconnected)
+		return false
+	}
+
+	p.adapter.setConnState(endpoint, ConnStateConnected)
+	runIConn(p.conn)
+	p.closeConn()
+	p.adapter.setConnState(endpoint, ConnStateDisconnected)
+	return true
+}
+
 // Run ...
 func (p *syncClientService) Run() {
 	p.orcManager.Run(func(isRunning func() bool) {
+		endpoints := p.adapter.endpoints
+		failures := 0
+
 		for isRunning() {
-			startNS := base.TimeNow().UnixNano()
+			// fail over to the next endpoint, the backoff only grows when all
+			// the endpoints fail
+			connected := false
+			for i := 0; i < len(endpoints) && !connected && isRunning(); i++ {
+				endpoint := endpoints[p.endpointIndex]
+				p.endpointIndex = (p.endpointIndex + 1) % len(endpoints)
+				connected = p.runEndpoint(endpoint)
+			}
 
-			if p.openConn() {
-				runIConn(p.conn)
-				p.closeConn()
+			if connected {
+				failures = 0
 			}
 
 			base.WaitWhileRunning(
-				startNS,
+				base.TimeNow().UnixNano(),
 				isRunning,
-				3*time.Second,
+				p.adapter.reconnect.getInterval(failures, rand.Float64()),
 			)
+
+			if !connected {
+				failures++
+			}
 		}
 	})
 }
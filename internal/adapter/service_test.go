@@ -2,6 +2,7 @@ package adapter
 
 import (
 	"crypto/tls"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -363,6 +364,40 @@ func TestNewSyncClientService(t *testing.T) {
 				"unsupported protocol err",
 			))
 	})
+
+	t.Run("protocol error in the endpoints", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		receiver := newTestSingleReceiver()
+		adapter := NewClientAdapterWithEndpoints(
+			[]Endpoint{
+				{Network: "tcp", Addr: "localhost"},
+				{Network: "err", Addr: "localhost"},
+			},
+			nil, nil, 1200, 1200, receiver,
+		)
+
+		service := NewSyncClientService(adapter)
+		assert(service).IsNil()
+		assert(receiver.GetError()).
+			Equals(base.ErrUnsupportedProtocol.AddDebug(
+				"unsupported protocol err",
+			))
+	})
+
+	t.Run("endpoints are empty", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		receiver := newTestSingleReceiver()
+		adapter := NewClientAdapterWithEndpoints(
+			nil, nil, nil, 1200, 1200, receiver,
+		)
+
+		service := NewSyncClientService(adapter)
+		assert(service).IsNil()
+		assert(receiver.GetError()).
+			Equals(base.ErrSyncClientServiceNoEndpoints)
+	})
 }
 
 func TestNewSyncServerService(t *testing.T) {
@@ -718,4 +753,106 @@ func TestSyncClientService(t *testing.T) {
 			assert(client.conn).IsNil()
 		}
 	})
+	t.Run("fail over to the next endpoint", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		server := NewSyncServerService(NewServerAdapter(
+			false, "tcp", "127.0.0.1:65438", "", nil, nil,
+			1200, 1200, newTestSingleReceiver(),
+		))
+		server.Open()
+		defer server.Close()
+		go func() {
+			server.Run()
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+
+		mu := &sync.Mutex{}
+		states := make([]string, 0)
+		receiver := newTestSingleReceiver()
+		client := NewSyncClientService(NewClientAdapterWithEndpoints(
+			[]Endpoint{
+				{Network: "tcp", Addr: "addr-error"},
+				{Network: "tcp", Addr: "127.0.0.1:65438"},
+			},
+			nil,
+			func(endpoint Endpoint, state ConnState) {
+				mu.Lock()
+				defer mu.Unlock()
+				states = append(
+					states,
+					fmt.Sprintf("%s:%d", endpoint.Addr, state),
+				)
+			},
+			1200,
+			1200,
+			receiver,
+		))
+		client.Open()
+		go func() {
+			client.Run()
+		}()
+
+		for receiver.GetOnOpenCount() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		client.Close()
+
+		// the failed endpoint does not delay the next one
+		assert(receiver.GetOnErrorCount()).Equals(1)
+		mu.Lock()
+		defer mu.Unlock()
+		assert(states).Equals([]string{
+			"addr-error:0",
+			"addr-error:2",
+			"127.0.0.1:65438:0",
+			"127.0.0.1:65438:1",
+			"127.0.0.1:65438:2",
+		})
+	})
+
+	t.Run("backoff after all the endpoints fail", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		mu := &sync.Mutex{}
+		times := make([]time.Time, 0)
+		receiver := newTestSingleReceiver()
+		client := NewSyncClientService(NewClientAdapterWithEndpoints(
+			[]Endpoint{
+				{Network: "tcp", Addr: "addr-error"},
+				{Network: "tcp", Addr: "addr-error"},
+			},
+			GetDefaultReconnectConfig().
+				SetMinInterval(100*time.Millisecond).
+				SetJitter(0),
+			func(endpoint Endpoint, state ConnState) {
+				mu.Lock()
+				defer mu.Unlock()
+				if state == ConnStateConnecting {
+					times = append(times, base.TimeNow())
+				}
+			},
+			1200,
+			1200,
+			receiver,
+		))
+		client.Open()
+		go func() {
+			client.Run()
+		}()
+
+		for receiver.GetOnErrorCount() < 6 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		client.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+		// the endpoints of a round are dialed at once, the rounds wait
+		// 100ms, 200ms, ...
+		assert(times[1].Sub(times[0]) < 50*time.Millisecond).IsTrue()
+		assert(times[2].Sub(times[1]) >= 100*time.Millisecond).IsTrue()
+		assert(times[4].Sub(times[3]) >= 200*time.Millisecond).IsTrue()
+	})
 }
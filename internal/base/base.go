@@ -359,7 +359,7 @@ func DecryptSessionEndpoint(sessionEndpoint string) (uint64, uint64, bool) {
 		return 0, 0, false
 	} else if sArr := strings.Split(string(sessionBytes), "-"); len(sArr) != 2 {
 		return 0, 0, false
-	} else if gatewayID, e := strconv.ParseUint(sArr[0], 10, 32); e != nil {
+	} else if gatewayID, e := strconv.ParseUint(sArr[0], 10, 64); e != nil {
 		return 0, 0, false
 	} else if sessionID, e := strconv.ParseUint(sArr[1], 10, 64); e != nil {
 		return 0, 0, false
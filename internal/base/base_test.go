@@ -518,7 +518,7 @@ func TestDecryptSessionEndpoint(t *testing.T) {
 		errString := base64.StdEncoding.EncodeToString(aesCipher.Seal(
 			nil,
 			aesNonce,
-			[]byte("9876543210-32"),
+			[]byte("98765432109876543210-32"),
 			nil,
 		))
 		assert(DecryptSessionEndpoint(errString)).
@@ -170,6 +170,20 @@ var (
 		ErrorLevelFatal,
 		"write to file error",
 	)
+
+	// ErrRuntimeTimeout ...
+	ErrRuntimeTimeout = DefineActionError(
+		generalErrorSeg|25,
+		ErrorLevelWarn,
+		"timeout",
+	)
+
+	// ErrRuntimePushNotSupported ...
+	ErrRuntimePushNotSupported = DefineDevelopError(
+		generalErrorSeg|26,
+		ErrorLevelError,
+		"Runtime.Push is not supported in nested call",
+	)
 )
 
 const coreErrorSeg = 1 << 8
@@ -237,6 +251,13 @@ var (
 		ErrorLevelError,
 		"",
 	)
+
+	// ErrClientStubDuplicateName ... *
+	ErrClientStubDuplicateName = DefineDevelopError(
+		coreErrorSeg|12,
+		ErrorLevelFatal,
+		"",
+	)
 )
 
 const serverErrorSeg = 3 << 8
@@ -276,6 +297,69 @@ var (
 		ErrorLevelWarn,
 		"server session seed overflows",
 	)
+
+	// ErrServerRouterAddrIsEmpty ...
+	ErrServerRouterAddrIsEmpty = DefineConfigError(
+		serverErrorSeg|6,
+		ErrorLevelFatal,
+		"router address is empty",
+	)
+
+	// ErrServerAuthenticate ...
+	ErrServerAuthenticate = DefineSecurityError(
+		serverErrorSeg|7,
+		ErrorLevelWarn,
+		"authentication failed",
+	)
+
+	// ErrServerSessionStore ...
+	ErrServerSessionStore = DefineKernelError(
+		serverErrorSeg|8,
+		ErrorLevelError,
+		"session store error",
+	)
+
+	// ErrServerRouterUnavailable ...
+	ErrServerRouterUnavailable = DefineNetError(
+		serverErrorSeg|9,
+		ErrorLevelWarn,
+		"router is unavailable",
+	)
+
+	// ErrServerDraining ...
+	ErrServerDraining = DefineNetError(
+		serverErrorSeg|10,
+		ErrorLevelWarn,
+		"server is draining",
+	)
+
+	// ErrServerRateLimited ...
+	ErrServerRateLimited = DefineNetError(
+		serverErrorSeg|11,
+		ErrorLevelWarn,
+		"too many requests",
+	)
+
+	// ErrServerBusy the request is not evaluated, so it can be retried
+	ErrServerBusy = DefineNetError(
+		serverErrorSeg|12,
+		ErrorLevelWarn,
+		"server is busy",
+	)
+
+	// ErrServerGatewayRequest ...
+	ErrServerGatewayRequest = DefineSecurityError(
+		serverErrorSeg|13,
+		ErrorLevelWarn,
+		"gateway request is invalid",
+	)
+
+	// ErrServerGatewayTimeout ...
+	ErrServerGatewayTimeout = DefineNetError(
+		serverErrorSeg|14,
+		ErrorLevelWarn,
+		"gateway timeout",
+	)
 )
 
 const clientErrorSeg = 4 << 8
@@ -294,6 +378,34 @@ var (
 		ErrorLevelWarn,
 		"client config error",
 	)
+
+	// ErrClientCanceled ...
+	ErrClientCanceled = DefineNetError(
+		clientErrorSeg|3,
+		ErrorLevelWarn,
+		"canceled",
+	)
+
+	// ErrClientItemsLost ...
+	ErrClientItemsLost = DefineNetError(
+		clientErrorSeg|4,
+		ErrorLevelWarn,
+		"stream items are lost",
+	)
+
+	// ErrClientItemsOverflow ...
+	ErrClientItemsOverflow = DefineNetError(
+		clientErrorSeg|5,
+		ErrorLevelWarn,
+		"too many stream items are not read",
+	)
+
+	// ErrClientPoolEmpty ...
+	ErrClientPoolEmpty = DefineConfigError(
+		clientErrorSeg|6,
+		ErrorLevelFatal,
+		"the pool has no client",
+	)
 )
 
 const routerErrorSeg = 5 << 8
@@ -354,6 +466,13 @@ var (
 		ErrorLevelFatal,
 		"",
 	)
+
+	// ErrRouterSlotNotFound ...
+	ErrRouterSlotNotFound = DefineNetError(
+		routerErrorSeg|9,
+		ErrorLevelWarn,
+		"router slot not found",
+	)
 )
 
 const goAdapterErrorSeg = 101 << 8
@@ -449,4 +568,11 @@ var (
 		ErrorLevelFatal,
 		"kernel error",
 	)
+
+	// ErrSyncClientServiceNoEndpoints ...
+	ErrSyncClientServiceNoEndpoints = DefineConfigError(
+		goAdapterErrorSeg|14,
+		ErrorLevelFatal,
+		"endpoints are empty",
+	)
 )
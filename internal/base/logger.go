@@ -1,79 +1,441 @@
 package base
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
-// Logger ...
-type Logger struct {
-	isLogToScreen bool
-	file          *os.File
-	mu            sync.Mutex
+const (
+	// LogKeyErrorCode ...
+	LogKeyErrorCode = "errorCode"
+	// LogKeyMachineID ...
+	LogKeyMachineID = "machineID"
+	// LogKeySessionID ...
+	LogKeySessionID = "sessionID"
+	// LogKeyActionPath ...
+	LogKeyActionPath = "actionPath"
+	// LogKeyRemoteAddr ...
+	LogKeyRemoteAddr = "remoteAddr"
+	// LogKeyDepth ...
+	LogKeyDepth = "depth"
+	// LogKeyFrom ...
+	LogKeyFrom = "from"
+	// LogKeyDurationMS ...
+	LogKeyDurationMS = "durationMS"
+	// LogKeyArgs ...
+	LogKeyArgs = "args"
+
+	logRotateTimeLayout = "20060102T150405.000"
+)
+
+// LogField is a key value pair that is attached to the log record
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// NewLogField ...
+func NewLogField(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
+
+// LogRecord ...
+type LogRecord struct {
+	Time    time.Time
+	Level   ErrorLevel
+	Message string
+	Fields  []LogField
 }
 
-// NewLogger ...
-func NewLogger(isLogToScreen bool, outFile string) (*Logger, *Error) {
-	file, e := func() (*os.File, error) {
-		if outFile == "" {
-			return nil, nil
+// ILogEncoder encodes the record to one line that ends with '\n'
+type ILogEncoder interface {
+	Encode(record *LogRecord) []byte
+}
+
+// ILogger is the structured and leveled logger. The loggers that are made by
+// With share the sinks of their parent.
+type ILogger interface {
+	Log(level ErrorLevel, message string, fields ...LogField)
+	With(fields ...LogField) ILogger
+	Close() *Error
+}
+
+func getLogLevelString(level ErrorLevel) string {
+	switch level {
+	case ErrorLevelInfo:
+		return "info"
+	case ErrorLevelWarn:
+		return "warn"
+	case ErrorLevelError:
+		return "error"
+	case ErrorLevelFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+func getLogValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// TextLogEncoder encodes the record like "<time> <key:value> ... message"
+type TextLogEncoder struct{}
+
+// NewTextLogEncoder ...
+func NewTextLogEncoder() *TextLogEncoder {
+	return &TextLogEncoder{}
+}
+
+// Encode ...
+func (p *TextLogEncoder) Encode(record *LogRecord) []byte {
+	sb := NewStringBuilder()
+	defer sb.Release()
+
+	sb.AppendString(ConvertToIsoDateString(record.Time))
+	sb.AppendByte(' ')
+	for _, field := range record.Fields {
+		sb.AppendByte('<')
+		sb.AppendString(field.Key)
+		sb.AppendByte(':')
+		sb.AppendString(getLogValueString(field.Value))
+		sb.AppendString("> ")
+	}
+	sb.AppendString(record.Message)
+	sb.AppendByte('\n')
+
+	return []byte(sb.String())
+}
+
+// JSONLogEncoder encodes the record to a JSON object
+type JSONLogEncoder struct{}
+
+// NewJSONLogEncoder ...
+func NewJSONLogEncoder() *JSONLogEncoder {
+	return &JSONLogEncoder{}
+}
+
+// Encode ...
+func (p *JSONLogEncoder) Encode(record *LogRecord) []byte {
+	sb := NewStringBuilder()
+	defer sb.Release()
+
+	writeJSON := func(v interface{}) {
+		if _, ok := v.(error); ok {
+			v = getLogValueString(v)
 		}
 
-		// make sure the dir of outFile is exist
-		dirName := filepath.Dir(outFile)
+		if buf, e := json.Marshal(v); e == nil {
+			sb.AppendBytes(buf)
+		} else {
+			buf, _ = json.Marshal(getLogValueString(v))
+			sb.AppendBytes(buf)
+		}
+	}
 
-		if e := os.Mkdir(dirName, os.ModeDir|0755); e != nil {
-			if !os.IsExist(e) {
-				return nil, e
-			}
+	sb.AppendString("{\"time\":")
+	writeJSON(ConvertToIsoDateString(record.Time))
+	sb.AppendString(",\"level\":")
+	writeJSON(getLogLevelString(record.Level))
+	sb.AppendString(",\"msg\":")
+	writeJSON(record.Message)
+	for _, field := range record.Fields {
+		sb.AppendByte(',')
+		writeJSON(field.Key)
+		sb.AppendByte(':')
+		writeJSON(field.Value)
+	}
+	sb.AppendString("}\n")
 
-			if info, e := os.Stat(dirName); e != nil || !info.IsDir() {
-				return nil, fmt.Errorf("path %s is not a directory", dirName)
-			}
+	return []byte(sb.String())
+}
+
+// LogfmtLogEncoder encodes the record to the logfmt line like
+// "time=... level=... msg=... key=value"
+type LogfmtLogEncoder struct{}
+
+// NewLogfmtLogEncoder ...
+func NewLogfmtLogEncoder() *LogfmtLogEncoder {
+	return &LogfmtLogEncoder{}
+}
+
+// Encode ...
+func (p *LogfmtLogEncoder) Encode(record *LogRecord) []byte {
+	sb := NewStringBuilder()
+	defer sb.Release()
+
+	writeValue := func(v string) {
+		if v == "" || strings.IndexFunc(v, func(r rune) bool {
+			return r <= ' ' || r == '=' || r == '"' || r == 0x7F
+		}) >= 0 {
+			sb.AppendString(strconv.Quote(v))
+		} else {
+			sb.AppendString(v)
+		}
+	}
+
+	sb.AppendString("time=")
+	writeValue(ConvertToIsoDateString(record.Time))
+	sb.AppendString(" level=")
+	writeValue(getLogLevelString(record.Level))
+	sb.AppendString(" msg=")
+	writeValue(record.Message)
+	for _, field := range record.Fields {
+		sb.AppendByte(' ')
+		sb.AppendString(field.Key)
+		sb.AppendByte('=')
+		writeValue(getLogValueString(field.Value))
+	}
+	sb.AppendByte('\n')
+
+	return []byte(sb.String())
+}
+
+// ScreenLogSink writes the log to os.Stdout, it is not closed by the logger
+type ScreenLogSink struct{}
+
+// NewScreenLogSink ...
+func NewScreenLogSink() *ScreenLogSink {
+	return &ScreenLogSink{}
+}
+
+// Write ...
+func (p *ScreenLogSink) Write(b []byte) (int, error) {
+	return os.Stdout.Write(b)
+}
+
+// RotatingFileSink writes the log to a file. The file is renamed with the
+// time suffix and a new one is opened when it is larger than maxSize or it is
+// older than maxAge. Only the newest maxBackups renamed files are kept. 0
+// disables each of the limits.
+type RotatingFileSink struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	file       *os.File
+	size       int64
+	openTime   time.Time
+	mu         sync.Mutex
+}
+
+// NewRotatingFileSink ...
+func NewRotatingFileSink(
+	path string,
+	maxSize int64,
+	maxAge time.Duration,
+	maxBackups int,
+) (*RotatingFileSink, *Error) {
+	// make sure the dir of path is exist
+	dirName := filepath.Dir(path)
+
+	if e := os.Mkdir(dirName, os.ModeDir|0755); e != nil {
+		if !os.IsExist(e) {
+			return nil, ErrLogOpenFile.AddDebug(e.Error())
 		}
 
-		return os.OpenFile(outFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	}()
+		if info, e := os.Stat(dirName); e != nil || !info.IsDir() {
+			return nil, ErrLogOpenFile.AddDebug(
+				fmt.Sprintf("path %s is not a directory", dirName),
+			)
+		}
+	}
 
+	ret := &RotatingFileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+
+	if e := ret.open(); e != nil {
+		return nil, ErrLogOpenFile.AddDebug(e.Error())
+	}
+
+	return ret, nil
+}
+
+func (p *RotatingFileSink) open() error {
+	file, e := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if e != nil {
+		return e
+	}
+
+	info, e := file.Stat()
 	if e != nil {
-		return &Logger{
-			isLogToScreen: isLogToScreen,
-			file:          nil,
-		}, ErrLogOpenFile.AddDebug(e.Error())
+		_ = file.Close()
+		return e
+	}
+
+	p.file = file
+	p.size = info.Size()
+	p.openTime = TimeNow()
+	return nil
+}
+
+func (p *RotatingFileSink) rotate() error {
+	if e := p.file.Close(); e != nil {
+		return e
+	}
+	p.file = nil
+
+	backup := ConcatString(
+		p.path,
+		".",
+		TimeNow().Format(logRotateTimeLayout),
+	)
+	// the file is reopened even if it is not renamed, so the log goes on
+	if e := os.Rename(p.path, backup); e == nil && p.maxBackups > 0 {
+		if backups, e := filepath.Glob(ConcatString(p.path, ".*")); e == nil &&
+			len(backups) > p.maxBackups {
+			// the time suffix makes the names sorted by the rotated time
+			sort.Strings(backups)
+			for _, name := range backups[:len(backups)-p.maxBackups] {
+				_ = os.Remove(name)
+			}
+		}
+	}
+
+	return p.open()
+}
+
+// Write ...
+func (p *RotatingFileSink) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if p.size > 0 &&
+		((p.maxSize > 0 && p.size+int64(len(b)) > p.maxSize) ||
+			(p.maxAge > 0 && TimeNow().Sub(p.openTime) >= p.maxAge)) {
+		if e := p.rotate(); e != nil {
+			return 0, e
+		}
+	}
+
+	n, e := p.file.Write(b)
+	p.size += int64(n)
+	return n, e
+}
+
+// Close ...
+func (p *RotatingFileSink) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.file != nil {
+		file := p.file
+		p.file = nil
+		return file.Close()
+	}
+
+	return nil
+}
+
+// Logger is the default ILogger, it encodes the records with the encoder and
+// writes them to all the sinks. The sinks that implement io.Closer are closed
+// when the logger is closed.
+type Logger struct {
+	level   ErrorLevel
+	encoder ILogEncoder
+	sinks   []io.Writer
+	fields  []LogField
+	mu      *sync.Mutex
+}
+
+// NewLogger makes a logger that only logs the records whose level is in
+// level. If encoder is nil, the TextLogEncoder is used.
+func NewLogger(
+	level ErrorLevel,
+	encoder ILogEncoder,
+	sinks ...io.Writer,
+) *Logger {
+	if encoder == nil {
+		encoder = NewTextLogEncoder()
 	}
 
 	return &Logger{
-		isLogToScreen: isLogToScreen,
-		file:          file,
-	}, nil
+		level:   level,
+		encoder: encoder,
+		sinks:   sinks,
+		fields:  nil,
+		mu:      &sync.Mutex{},
+	}
 }
 
 // Log ...
-func (p *Logger) Log(str string) {
-	if p.file != nil {
-		_, _ = p.file.WriteString(ConcatString(str, "\n"))
+func (p *Logger) Log(level ErrorLevel, message string, fields ...LogField) {
+	if level&p.level == 0 {
+		return
 	}
 
-	if p.isLogToScreen {
-		_, _ = os.Stdout.WriteString(ConcatString(str, "\n"))
+	record := &LogRecord{
+		Time:    TimeNow(),
+		Level:   level,
+		Message: message,
+		Fields:  p.fields,
+	}
+
+	if len(fields) > 0 {
+		record.Fields = make([]LogField, 0, len(p.fields)+len(fields))
+		record.Fields = append(record.Fields, p.fields...)
+		record.Fields = append(record.Fields, fields...)
+	}
+
+	buf := p.encoder.Encode(record)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, sink := range p.sinks {
+		_, _ = sink.Write(buf)
 	}
 }
 
+// With returns a logger that attaches fields to all of its records
+func (p *Logger) With(fields ...LogField) ILogger {
+	ret := &Logger{
+		level:   p.level,
+		encoder: p.encoder,
+		sinks:   p.sinks,
+		fields:  make([]LogField, 0, len(p.fields)+len(fields)),
+		mu:      p.mu,
+	}
+	ret.fields = append(ret.fields, p.fields...)
+	ret.fields = append(ret.fields, fields...)
+	return ret
+}
+
 // Close ...
 func (p *Logger) Close() *Error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.file != nil {
-		if e := p.file.Close(); e != nil {
-			return ErrLogCloseFile.AddDebug(e.Error())
+	ret := (*Error)(nil)
+	for _, sink := range p.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if e := closer.Close(); e != nil && ret == nil {
+				ret = ErrLogCloseFile.AddDebug(e.Error())
+			}
 		}
-
-		p.file = nil
-		return nil
 	}
 
-	return nil
+	return ret
 }
@@ -2,9 +2,14 @@ package base
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func captureStdout(fn func()) string {
@@ -34,12 +39,111 @@ func captureStdout(fn func()) string {
 	return ret
 }
 
-func TestNewLogger(t *testing.T) {
+type testLogSink struct {
+	bytes.Buffer
+	closeError error
+}
+
+func (p *testLogSink) Close() error {
+	return p.closeError
+}
+
+func getTestLogRecord() *LogRecord {
+	return &LogRecord{
+		Time:    time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC),
+		Level:   ErrorLevelWarn,
+		Message: "hello world",
+		Fields: []LogField{
+			NewLogField(LogKeySessionID, uint64(17)),
+			NewLogField(LogKeyActionPath, "#.user:login"),
+			NewLogField("error", errors.New("a=\"b\"")),
+		},
+	}
+}
+
+func TestNewLogField(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		assert(NewLogField("key", 1)).Equals(LogField{Key: "key", Value: 1})
+	})
+}
+
+func TestGetLogLevelString(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		assert(getLogLevelString(ErrorLevelInfo)).Equals("info")
+		assert(getLogLevelString(ErrorLevelWarn)).Equals("warn")
+		assert(getLogLevelString(ErrorLevelError)).Equals("error")
+		assert(getLogLevelString(ErrorLevelFatal)).Equals("fatal")
+		assert(getLogLevelString(ErrorLogAll)).Equals("unknown")
+	})
+}
+
+func TestGetLogValueString(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		assert(getLogValueString("hello")).Equals("hello")
+		assert(getLogValueString(ErrStream)).Equals(ErrStream.Error())
+		assert(getLogValueString(uint64(17))).Equals("17")
+		assert(getLogValueString(nil)).Equals("<nil>")
+	})
+}
+
+func TestTextLogEncoder_Encode(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		record := getTestLogRecord()
+		assert(string(NewTextLogEncoder().Encode(record))).Equals(
+			ConvertToIsoDateString(record.Time) +
+				" <sessionID:17> <actionPath:#.user:login> <error:a=\"b\">" +
+				" hello world\n",
+		)
+	})
+}
+
+func TestJSONLogEncoder_Encode(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		record := getTestLogRecord()
+		record.Fields = append(record.Fields, NewLogField("fn", func() {}))
+		assert(string(NewJSONLogEncoder().Encode(record))).Equals(
+			"{\"time\":\"" + ConvertToIsoDateString(record.Time) + "\"," +
+				"\"level\":\"warn\",\"msg\":\"hello world\"," +
+				"\"sessionID\":17,\"actionPath\":\"#.user:login\"," +
+				"\"error\":\"a=\\\"b\\\"\",\"fn\":\"" +
+				getLogValueString(record.Fields[3].Value) + "\"}\n",
+		)
+	})
+}
+
+func TestLogfmtLogEncoder_Encode(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		record := getTestLogRecord()
+		record.Fields = append(record.Fields, NewLogField("empty", ""))
+		assert(string(NewLogfmtLogEncoder().Encode(record))).Equals(
+			"time=" + ConvertToIsoDateString(record.Time) +
+				" level=warn msg=\"hello world\" sessionID=17" +
+				" actionPath=#.user:login error=\"a=\\\"b\\\"\" empty=\"\"\n",
+		)
+	})
+}
+
+func TestScreenLogSink_Write(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		assert(captureStdout(func() {
+			_, _ = NewScreenLogSink().Write([]byte("hello\n"))
+		})).Equals("hello\n")
+	})
+}
+
+func TestNewRotatingFileSink(t *testing.T) {
 	t.Run("open file error", func(t *testing.T) {
 		assert := NewAssert(t)
-		v, e := NewLogger(false, "/")
-		assert(v.file).IsNil()
-		assert(e.GetCode()).Equals(ErrLogOpenFile.GetCode())
+		v, err := NewRotatingFileSink("/", 0, 0, 0)
+		assert(v).IsNil()
+		assert(err.GetCode()).Equals(ErrLogOpenFile.GetCode())
 	})
 
 	t.Run("create dir error", func(t *testing.T) {
@@ -47,85 +151,241 @@ func TestNewLogger(t *testing.T) {
 		f, _ := os.Create("tmp")
 		f.Close()
 		defer os.Remove("tmp")
-		v, e := NewLogger(false, "./tmp/test.log")
-		assert(v.file).IsNil()
-		assert(e).Equals(
+		v, err := NewRotatingFileSink("./tmp/test.log", 0, 0, 0)
+		assert(v).IsNil()
+		assert(err).Equals(
 			ErrLogOpenFile.AddDebug("path tmp is not a directory"),
 		)
 	})
 
-	t.Run("file is empty", func(t *testing.T) {
+	t.Run("mkdir error", func(t *testing.T) {
 		assert := NewAssert(t)
-		assert(NewLogger(false, "")).Equals(&Logger{
-			isLogToScreen: false,
-			file:          nil,
-		}, nil)
+		v, err := NewRotatingFileSink("./tmp-none/tmp/test.log", 0, 0, 0)
+		assert(v).IsNil()
+		assert(err.GetCode()).Equals(ErrLogOpenFile.GetCode())
 	})
 
 	t.Run("ok", func(t *testing.T) {
 		assert := NewAssert(t)
-		v, err := NewLogger(false, "test.log")
+		defer os.RemoveAll("./tmp-log")
+		_ = os.Mkdir("./tmp-log", 0755)
+		_ = ioutil.WriteFile("./tmp-log/test.log", []byte("hello"), 0644)
+		v, err := NewRotatingFileSink("./tmp-log/test.log", 1, 2, 3)
 		assert(err).IsNil()
-		assert(v.isLogToScreen).IsFalse()
+		assert(v.path, v.maxSize, v.maxAge, v.maxBackups).
+			Equals("./tmp-log/test.log", int64(1), time.Duration(2), 3)
 		assert(v.file).IsNotNil()
-		v.Close()
-		_ = os.Remove("test.log")
+		assert(v.size).Equals(int64(5))
+		assert(TimeNow().Sub(v.openTime) < time.Second).IsTrue()
+		assert(v.Close()).IsNil()
 	})
 }
 
-func TestLogger_Log(t *testing.T) {
-	getFileContent := func(fileName string) string {
-		ret, _ := ReadFromFile(fileName)
+func TestRotatingFileSink_Write(t *testing.T) {
+	getBackups := func(path string) []string {
+		ret, _ := filepath.Glob(path + ".*")
 		return ret
 	}
 
-	t.Run("isLogToScreen == true, file is empty", func(t *testing.T) {
+	t.Run("sink is closed", func(t *testing.T) {
 		assert := NewAssert(t)
-		v, _ := NewLogger(true, "")
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 0, 0, 0)
+		_ = v.Close()
+		assert(v.Write([]byte("hello"))).Equals(0, os.ErrClosed)
+	})
 
-		assert(captureStdout(func() {
-			v.Log("hello")
-		})).Equals("hello\n")
+	t.Run("no limits", func(t *testing.T) {
+		assert := NewAssert(t)
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 0, 0, 0)
+		for i := 0; i < 10; i++ {
+			assert(v.Write([]byte("hello\n"))).Equals(6, nil)
+		}
+		assert(v.size).Equals(int64(60))
+		assert(len(getBackups("./tmp-log/test.log"))).Equals(0)
+		_ = v.Close()
+	})
 
-		v.Close()
+	t.Run("rotate by size", func(t *testing.T) {
+		assert := NewAssert(t)
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 10, 0, 0)
+		assert(v.Write([]byte("hello\n"))).Equals(6, nil)
+		assert(v.Write([]byte("world\n"))).Equals(6, nil)
+		assert(v.size).Equals(int64(6))
+		backups := getBackups("./tmp-log/test.log")
+		assert(len(backups)).Equals(1)
+		assert(ReadFromFile(backups[0])).Equals("hello\n", nil)
+		assert(ReadFromFile("./tmp-log/test.log")).Equals("world\n", nil)
+		_ = v.Close()
 	})
 
-	t.Run("isLogToScreen == false, file is not", func(t *testing.T) {
+	t.Run("rotate by age", func(t *testing.T) {
 		assert := NewAssert(t)
-		v, _ := NewLogger(false, "test.log")
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 0, time.Hour, 0)
+		assert(v.Write([]byte("hello\n"))).Equals(6, nil)
+		assert(v.Write([]byte("hello\n"))).Equals(6, nil)
+		assert(len(getBackups("./tmp-log/test.log"))).Equals(0)
+		v.openTime = v.openTime.Add(-time.Hour)
+		assert(v.Write([]byte("world\n"))).Equals(6, nil)
+		assert(len(getBackups("./tmp-log/test.log"))).Equals(1)
+		assert(ReadFromFile("./tmp-log/test.log")).Equals("world\n", nil)
+		_ = v.Close()
+	})
 
-		assert(captureStdout(func() {
-			v.Log("hello")
-		})).Equals("")
+	t.Run("keep maxBackups", func(t *testing.T) {
+		assert := NewAssert(t)
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 1, 0, 2)
+		for i := 0; i < 5; i++ {
+			assert(v.Write([]byte{byte('0' + i)})).Equals(1, nil)
+			time.Sleep(2 * time.Millisecond)
+		}
+		backups := getBackups("./tmp-log/test.log")
+		assert(len(backups)).Equals(2)
+		assert(ReadFromFile(backups[0])).Equals("2", nil)
+		assert(ReadFromFile(backups[1])).Equals("3", nil)
+		assert(ReadFromFile("./tmp-log/test.log")).Equals("4", nil)
+		_ = v.Close()
+	})
 
-		assert(getFileContent("test.log")).Equals("hello\n")
+	t.Run("rotate error", func(t *testing.T) {
+		assert := NewAssert(t)
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 1, 0, 0)
+		assert(v.Write([]byte("hello\n"))).Equals(6, nil)
+		_ = v.file.Close()
+		n, e := v.Write([]byte("world\n"))
+		assert(n, e != nil).Equals(0, true)
+	})
 
-		v.Close()
-		_ = os.Remove("test.log")
+	t.Run("rename error", func(t *testing.T) {
+		assert := NewAssert(t)
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 1, 0, 0)
+		assert(v.Write([]byte("hello\n"))).Equals(6, nil)
+		_ = os.Remove("./tmp-log/test.log")
+		assert(v.Write([]byte("world\n"))).Equals(6, nil)
+		assert(len(getBackups("./tmp-log/test.log"))).Equals(0)
+		assert(ReadFromFile("./tmp-log/test.log")).Equals("world\n", nil)
+		_ = v.Close()
 	})
 }
 
-func TestLogger_Close(t *testing.T) {
-	t.Run("ok, file is nil", func(t *testing.T) {
+func TestRotatingFileSink_Close(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
 		assert := NewAssert(t)
-		v, _ := NewLogger(true, "")
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 0, 0, 0)
+		assert(v.Close()).IsNil()
+		assert(v.file).IsNil()
 		assert(v.Close()).IsNil()
 	})
 
-	t.Run("ok, file is not nil", func(t *testing.T) {
+	t.Run("file close error", func(t *testing.T) {
 		assert := NewAssert(t)
+		defer os.RemoveAll("./tmp-log")
+		v, _ := NewRotatingFileSink("./tmp-log/test.log", 0, 0, 0)
+		_ = v.file.Close()
+		assert(v.Close()).IsNotNil()
+	})
+}
 
-		v, _ := NewLogger(true, "test.log")
-		assert(v.Close()).IsNil()
-		_ = os.Remove("test.log")
+func TestNewLogger(t *testing.T) {
+	t.Run("encoder is nil", func(t *testing.T) {
+		assert := NewAssert(t)
+		v := NewLogger(ErrorLogAll, nil)
+		assert(v.level).Equals(ErrorLogAll)
+		assert(v.encoder).Equals(NewTextLogEncoder())
+		assert(len(v.sinks), len(v.fields)).Equals(0, 0)
+		assert(v.mu).IsNotNil()
 	})
 
-	t.Run("file close error", func(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
 		assert := NewAssert(t)
+		sink := &testLogSink{}
+		v := NewLogger(ErrorLevelError, NewJSONLogEncoder(), sink)
+		assert(v.level).Equals(ErrorLevelError)
+		assert(v.encoder).Equals(NewJSONLogEncoder())
+		assert(v.sinks).Equals([]io.Writer{sink})
+	})
+}
 
-		v, _ := NewLogger(true, "test.log")
-		v.file.Close()
-		assert(v.Close().GetCode()).Equals(ErrLogCloseFile.GetCode())
-		_ = os.Remove("test.log")
+func TestLogger_Log(t *testing.T) {
+	t.Run("level is filtered", func(t *testing.T) {
+		assert := NewAssert(t)
+		sink := &testLogSink{}
+		v := NewLogger(ErrorLevelError, NewLogfmtLogEncoder(), sink)
+		v.Log(ErrorLevelWarn, "hello")
+		assert(sink.String()).Equals("")
+	})
+
+	t.Run("write to all the sinks", func(t *testing.T) {
+		assert := NewAssert(t)
+		sink1 := &testLogSink{}
+		sink2 := &testLogSink{}
+		v := NewLogger(ErrorLogAll, NewLogfmtLogEncoder(), sink1, sink2)
+		assert(captureStdout(func() {
+			v.With(NewLogField("a", 1)).Log(
+				ErrorLevelWarn,
+				"hello",
+				NewLogField("b", 2),
+			)
+			v.Log(ErrorLevelError, "world")
+		})).Equals("")
+		lines := strings.Split(sink1.String(), "\n")
+		assert(len(lines)).Equals(3)
+		assert(strings.HasSuffix(lines[0], " level=warn msg=hello a=1 b=2")).
+			IsTrue()
+		assert(strings.HasSuffix(lines[1], " level=error msg=world")).IsTrue()
+		assert(sink2.String()).Equals(sink1.String())
+	})
+
+	t.Run("screen sink", func(t *testing.T) {
+		assert := NewAssert(t)
+		v := NewLogger(ErrorLogAll, nil, NewScreenLogSink())
+		assert(strings.HasSuffix(captureStdout(func() {
+			v.Log(ErrorLevelInfo, "hello")
+		}), " hello\n")).IsTrue()
+	})
+}
+
+func TestLogger_With(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		sink := &testLogSink{}
+		v := NewLogger(ErrorLogAll, nil, sink)
+		child := v.With(NewLogField("a", 1)).(*Logger)
+		grandChild := child.With(NewLogField("b", 2)).(*Logger)
+		assert(v.fields).IsNil()
+		assert(child.fields).Equals([]LogField{NewLogField("a", 1)})
+		assert(grandChild.fields).Equals(
+			[]LogField{NewLogField("a", 1), NewLogField("b", 2)},
+		)
+		assert(grandChild.level).Equals(v.level)
+		assert(grandChild.encoder == v.encoder).IsTrue()
+		assert(grandChild.sinks).Equals(v.sinks)
+		assert(grandChild.mu == v.mu).IsTrue()
+	})
+}
+
+func TestLogger_Close(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		assert := NewAssert(t)
+		v := NewLogger(ErrorLogAll, nil, NewScreenLogSink(), &testLogSink{})
+		assert(v.Close()).IsNil()
+	})
+
+	t.Run("close error", func(t *testing.T) {
+		assert := NewAssert(t)
+		v := NewLogger(
+			ErrorLogAll,
+			nil,
+			&testLogSink{closeError: errors.New("error1")},
+			&testLogSink{closeError: errors.New("error2")},
+		)
+		assert(v.Close()).Equals(ErrLogCloseFile.AddDebug("error1"))
 	})
 }
@@ -6,10 +6,23 @@ import (
 	"time"
 )
 
+// PerformanceBuckets are the inclusive upper bounds of the first 7 latency
+// buckets of PerformanceIndicator, the last bucket has no upper bound.
+var PerformanceBuckets = [7]time.Duration{
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	1000 * time.Millisecond,
+}
+
 // PerformanceIndicator ...
 type PerformanceIndicator struct {
 	failArray    [8]int64
 	successArray [8]int64
+	durationNS   int64
 	lastTotal    int64
 	lastTime     time.Time
 	mu           sync.Mutex
@@ -20,6 +33,7 @@ func NewPerformanceIndicator() *PerformanceIndicator {
 	return &PerformanceIndicator{
 		failArray:    [8]int64{},
 		successArray: [8]int64{},
+		durationNS:   0,
 		lastTotal:    0,
 		lastTime:     TimeNow(),
 	}
@@ -27,24 +41,13 @@ func NewPerformanceIndicator() *PerformanceIndicator {
 
 // Count ...
 func (p *PerformanceIndicator) Count(duration time.Duration, success bool) {
-	idx := 0
+	idx := len(PerformanceBuckets)
 
-	if duration < 10*time.Millisecond {
-		idx = 0
-	} else if duration < 20*time.Millisecond {
-		idx = 1
-	} else if duration < 50*time.Millisecond {
-		idx = 2
-	} else if duration < 100*time.Millisecond {
-		idx = 3
-	} else if duration < 200*time.Millisecond {
-		idx = 4
-	} else if duration < 500*time.Millisecond {
-		idx = 5
-	} else if duration < 1000*time.Millisecond {
-		idx = 6
-	} else {
-		idx = 7
+	for i, bucket := range PerformanceBuckets {
+		if duration <= bucket {
+			idx = i
+			break
+		}
 	}
 
 	if success {
@@ -52,6 +55,8 @@ func (p *PerformanceIndicator) Count(duration time.Duration, success bool) {
 	} else {
 		atomic.AddInt64(&p.failArray[idx], 1)
 	}
+
+	atomic.AddInt64(&p.durationNS, int64(duration))
 }
 
 // Calculate ...
@@ -80,3 +85,23 @@ func (p *PerformanceIndicator) Calculate(now time.Time) (int64, time.Duration) {
 		return (deltaCount * int64(time.Second)) / int64(deltaTime), deltaTime
 	}
 }
+
+// GetCounts returns the success and fail counts of each latency bucket
+func (p *PerformanceIndicator) GetCounts() ([8]int64, [8]int64) {
+	successArray := [8]int64{}
+	failArray := [8]int64{}
+
+	for i := 0; i < len(p.successArray); i++ {
+		successArray[i] = atomic.LoadInt64(&p.successArray[i])
+	}
+	for i := 0; i < len(p.failArray); i++ {
+		failArray[i] = atomic.LoadInt64(&p.failArray[i])
+	}
+
+	return successArray, failArray
+}
+
+// GetTotalDuration returns the sum of the durations of all the counted calls
+func (p *PerformanceIndicator) GetTotalDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.durationNS))
+}
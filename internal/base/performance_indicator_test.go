@@ -5,6 +5,21 @@ import (
 	"time"
 )
 
+func TestPerformanceBuckets(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := NewAssert(t)
+		assert(PerformanceBuckets).Equals([7]time.Duration{
+			10 * time.Millisecond,
+			20 * time.Millisecond,
+			50 * time.Millisecond,
+			100 * time.Millisecond,
+			200 * time.Millisecond,
+			500 * time.Millisecond,
+			1000 * time.Millisecond,
+		})
+	})
+}
+
 func TestNewPerformanceIndicator(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := NewAssert(t)
@@ -17,6 +32,7 @@ func TestNewPerformanceIndicator(t *testing.T) {
 		for i := 0; i < len(v1.failArray); i++ {
 			assert(v1.failArray[i]).Equals(int64(0))
 		}
+		assert(v1.durationNS).Equals(int64(0))
 		assert(v1.lastTotal).Equals(int64(0))
 		assert(IsTimeApproximatelyEqual(TimeNow(), v1.lastTime)).IsTrue()
 	})
@@ -31,9 +47,19 @@ func TestPerformanceIndicator_Count(t *testing.T) {
 			v1.Count(time.Duration(i)*time.Millisecond, false)
 		}
 		assert(v1.successArray).
-			Equals([8]int64{10, 10, 30, 50, 100, 300, 500, 1000})
+			Equals([8]int64{11, 10, 30, 50, 100, 300, 500, 999})
 		assert(v1.failArray).
-			Equals([8]int64{10, 10, 30, 50, 100, 300, 500, 1000})
+			Equals([8]int64{11, 10, 30, 50, 100, 300, 500, 999})
+		assert(v1.durationNS).Equals(int64(2 * 1999 * 1000 * time.Millisecond))
+	})
+
+	t.Run("the upper bound is inclusive", func(t *testing.T) {
+		assert := NewAssert(t)
+		v1 := NewPerformanceIndicator()
+		for _, bucket := range PerformanceBuckets {
+			v1.Count(bucket, true)
+		}
+		assert(v1.successArray).Equals([8]int64{1, 1, 1, 1, 1, 1, 1, 0})
 	})
 }
 
@@ -73,3 +99,29 @@ func TestPerformanceIndicator_Calculate(t *testing.T) {
 			Equals(int64(2000), time.Second)
 	})
 }
+
+func TestPerformanceIndicator_GetCounts(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := NewAssert(t)
+		v1 := NewPerformanceIndicator()
+		assert(v1.GetCounts()).Equals([8]int64{}, [8]int64{})
+		for i := 0; i < 2000; i++ {
+			v1.Count(time.Duration(i)*time.Millisecond, i%2 == 0)
+		}
+		assert(v1.GetCounts()).Equals(
+			[8]int64{6, 5, 15, 25, 50, 150, 250, 499},
+			[8]int64{5, 5, 15, 25, 50, 150, 250, 500},
+		)
+	})
+}
+
+func TestPerformanceIndicator_GetTotalDuration(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := NewAssert(t)
+		v1 := NewPerformanceIndicator()
+		assert(v1.GetTotalDuration()).Equals(time.Duration(0))
+		v1.Count(10*time.Millisecond, true)
+		v1.Count(20*time.Millisecond, false)
+		assert(v1.GetTotalDuration()).Equals(30 * time.Millisecond)
+	})
+}
@@ -2,8 +2,11 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rpccloud/rpc/internal/adapter"
@@ -36,10 +39,16 @@ func (p *Subscription) Close() {
 	}
 }
 
+// maxIteratorItems is the max number of the items that are received but not
+// read by ResponseIterator. The iterator fails with ErrClientItemsOverflow
+// when more items arrive, so a slow reader can not use up the memory.
+const maxIteratorItems = 1024
+
 var sendItemCache = &sync.Pool{
 	New: func() interface{} {
 		return &SendItem{
 			returnCH:   make(chan *rpc.Stream, 1),
+			itemCH:     make(chan bool, 1),
 			sendStream: rpc.NewStream(),
 		}
 	},
@@ -52,6 +61,13 @@ type SendItem struct {
 	sendTimeNS  int64
 	timeoutNS   int64
 	returnCH    chan *rpc.Stream
+	future      *Future
+	isStream    bool
+	itemSeq     uint64
+	itemStreams []*rpc.Stream
+	itemErr     *base.Error
+	itemCH      chan bool
+	itemMu      sync.Mutex
 	sendStream  *rpc.Stream
 	next        *SendItem
 }
@@ -63,6 +79,10 @@ func NewSendItem(timeoutNS int64) *SendItem {
 	ret.startTimeNS = base.TimeNow().UnixNano()
 	ret.sendTimeNS = 0
 	ret.timeoutNS = timeoutNS
+	ret.future = nil
+	ret.isStream = false
+	ret.itemSeq = 0
+	ret.itemErr = nil
 	ret.next = nil
 	return ret
 }
@@ -73,34 +93,282 @@ func (p *SendItem) Back(stream *rpc.Stream) bool {
 		return false
 	}
 
-	p.returnCH <- stream
+	p.back(stream)
 	return true
 }
 
+func (p *SendItem) back(stream *rpc.Stream) {
+	if future := p.future; future != nil {
+		future.finish(stream)
+	} else {
+		p.returnCH <- stream
+	}
+}
+
+// BackItem ...
+func (p *SendItem) BackItem(stream *rpc.Stream) bool {
+	if stream == nil || !p.isRunning || !p.isStream {
+		return false
+	}
+
+	// the server resends all the items after reconnecting, so the items
+	// that have been received must be ignored
+	seq, err := stream.ReadUint64()
+	if err != nil || seq < p.itemSeq {
+		return false
+	}
+
+	p.itemMu.Lock()
+	if p.itemErr == nil {
+		if seq > p.itemSeq {
+			// the server drops the items that exceed its cache
+			p.itemErr = base.ErrClientItemsLost
+		} else if len(p.itemStreams) >= maxIteratorItems {
+			p.itemErr = base.ErrClientItemsOverflow
+		}
+	}
+	ret := p.itemErr == nil
+	if ret {
+		p.itemSeq++
+		p.itemStreams = append(p.itemStreams, stream)
+	}
+	p.itemMu.Unlock()
+
+	select {
+	case p.itemCH <- true:
+	default:
+	}
+
+	return ret
+}
+
+func (p *SendItem) getItemErr() *base.Error {
+	p.itemMu.Lock()
+	defer p.itemMu.Unlock()
+	return p.itemErr
+}
+
+func (p *SendItem) popItem() *rpc.Stream {
+	p.itemMu.Lock()
+	defer p.itemMu.Unlock()
+
+	if len(p.itemStreams) == 0 {
+		return nil
+	}
+
+	ret := p.itemStreams[0]
+	p.itemStreams[0] = nil
+	p.itemStreams = p.itemStreams[1:]
+	return ret
+}
+
 // CheckTime ...
 func (p *SendItem) CheckTime(nowNS int64) bool {
 	if nowNS-p.startTimeNS > p.timeoutNS && p.isRunning {
-		p.isRunning = false
-
-		// return timeout stream
-		stream := rpc.NewStream()
-		stream.SetKind(rpc.StreamKindRPCResponseError)
-		stream.SetCallbackID(p.sendStream.GetCallbackID())
-		stream.WriteUint64(uint64(base.ErrClientTimeout.GetCode()))
-		stream.WriteString(base.ErrClientTimeout.GetMessage())
-		p.returnCH <- stream
+		p.timeout()
 		return true
 	}
 
 	return false
 }
 
+func (p *SendItem) timeout() {
+	p.isRunning = false
+
+	// return timeout stream
+	stream := rpc.NewStream()
+	stream.SetKind(rpc.StreamKindRPCResponseError)
+	stream.SetCallbackID(p.sendStream.GetCallbackID())
+	stream.WriteUint64(uint64(base.ErrClientTimeout.GetCode()))
+	stream.WriteString(base.ErrClientTimeout.GetMessage())
+	p.back(stream)
+}
+
 // Release ...
 func (p *SendItem) Release() {
+	for stream := p.popItem(); stream != nil; stream = p.popItem() {
+		stream.Release()
+	}
+	p.itemStreams = nil
+
+	select {
+	case <-p.itemCH:
+	default:
+	}
+
+	p.future = nil
 	p.sendStream.Reset()
 	sendItemCache.Put(p)
 }
 
+// Future is the pending result of an asynchronous call.
+type Future struct {
+	item   *SendItem
+	doneCH chan struct{}
+	value  rpc.Any
+	err    *base.Error
+	once   sync.Once
+}
+
+func newFuture(item *SendItem) *Future {
+	ret := &Future{
+		item:   item,
+		doneCH: make(chan struct{}),
+	}
+
+	if item != nil {
+		item.future = ret
+	}
+
+	return ret
+}
+
+func (p *Future) finish(stream *rpc.Stream) {
+	p.value, p.err = rpc.ParseResponseStream(stream)
+	stream.Release()
+	close(p.doneCH)
+}
+
+func (p *Future) fail(err *base.Error) {
+	p.value, p.err = nil, err
+	close(p.doneCH)
+}
+
+// Done returns a channel that is closed when the result is ready.
+func (p *Future) Done() <-chan struct{} {
+	return p.doneCH
+}
+
+// Wait blocks until the result is ready and returns it.
+func (p *Future) Wait() (rpc.Any, *base.Error) {
+	<-p.doneCH
+
+	// the item is not used by the client anymore, put it back to the pool
+	p.once.Do(func() {
+		if p.item != nil {
+			p.item.Release()
+			p.item = nil
+		}
+	})
+
+	return p.value, p.err
+}
+
+// Call describes a request of Client.SendBatch.
+type Call struct {
+	target string
+	args   []interface{}
+}
+
+// NewCall ...
+func NewCall(target string, args ...interface{}) *Call {
+	return &Call{
+		target: target,
+		args:   args,
+	}
+}
+
+// ResponseIterator iterates the items of a server streaming response. Next
+// must be called until it returns false, or Close must be called.
+type ResponseIterator struct {
+	client     *Client
+	item       *SendItem
+	backStream *rpc.Stream
+	value      rpc.Any
+	result     rpc.Any
+	err        *base.Error
+}
+
+// Next waits for the next item. It returns false when the final response
+// is received or an error occurs.
+func (p *ResponseIterator) Next() bool {
+	for p.item != nil {
+		if stream := p.item.popItem(); stream != nil {
+			value, err := stream.Read()
+			if err == nil && !stream.IsReadFinish() {
+				err = base.ErrStream
+			}
+			stream.Release()
+
+			if p.err != nil {
+				// ignore the items after the error
+				continue
+			} else if err != nil {
+				p.err = err
+			} else {
+				p.value = value
+				return true
+			}
+		} else if err := p.item.getItemErr(); err != nil {
+			// the rest items can not be received any more
+			if p.err == nil {
+				p.err = err
+			}
+			p.Close()
+		} else if p.backStream != nil {
+			// all the items are received before the final response
+			result, err := rpc.ParseResponseStream(p.backStream)
+			if p.err == nil {
+				p.result = result
+				p.err = err
+			}
+
+			p.backStream.Release()
+			p.backStream = nil
+			p.item.Release()
+			p.item = nil
+		} else {
+			select {
+			case <-p.item.itemCH:
+			case p.backStream = <-p.item.returnCH:
+			}
+		}
+	}
+
+	p.value = nil
+	return false
+}
+
+// Close stops the iteration and frees the channel of the request, the items
+// that are not read are dropped. The server drops the rest of the response,
+// but the running action is not interrupted.
+func (p *ResponseIterator) Close() {
+	if p.item != nil {
+		p.client.cancelItem(p.item)
+
+		// the final response may be received before the item is canceled
+		if p.backStream == nil {
+			select {
+			case p.backStream = <-p.item.returnCH:
+			default:
+			}
+		}
+
+		if p.backStream != nil {
+			p.backStream.Release()
+			p.backStream = nil
+		}
+
+		p.item.Release()
+		p.item = nil
+	}
+}
+
+// Value returns the current item.
+func (p *ResponseIterator) Value() rpc.Any {
+	return p.value
+}
+
+// Result returns the final reply after Next returns false.
+func (p *ResponseIterator) Result() rpc.Any {
+	return p.result
+}
+
+// Err returns the error after Next returns false.
+func (p *ResponseIterator) Err() *base.Error {
+	return p.err
+}
+
 // Channel ...
 type Channel struct {
 	sequence uint64
@@ -130,6 +398,15 @@ func (p *Channel) Free(stream *rpc.Stream) bool {
 	return false
 }
 
+// BackItem ...
+func (p *Channel) BackItem(stream *rpc.Stream) bool {
+	if item := p.item; item != nil {
+		return item.BackItem(stream)
+	}
+
+	return false
+}
+
 // CheckTime ...
 func (p *Channel) CheckTime(nowNS int64) bool {
 	if p.item != nil && p.item.CheckTime(nowNS) {
@@ -144,12 +421,17 @@ func (p *Channel) CheckTime(nowNS int64) bool {
 type Client struct {
 	config          *Config
 	sessionString   string
+	credentials     rpc.Map
 	adapter         *adapter.Adapter
 	conn            *adapter.StreamConn
 	preSendHead     *SendItem
 	preSendTail     *SendItem
 	channels        []Channel
 	lastPingTimeNS  int64
+	draining        bool
+	drainCloses     int
+	numOfEndpoints  int
+	traceSampleRate uint64
 	orcManager      *base.ORCManager
 	onError         func(err *base.Error)
 	subscriptionMap map[string][]*Subscription
@@ -165,24 +447,76 @@ func NewClient(
 	rBufSize int,
 	wBufSize int,
 	onError func(err *base.Error),
+) *Client {
+	return NewClientWithCredentials(
+		network, addr, path, tlsConfig, rBufSize, wBufSize, nil, onError,
+	)
+}
+
+// NewClientWithCredentials creates a client that sends credentials in the
+// connect request, the authenticator of the server checks them.
+func NewClientWithCredentials(
+	network string,
+	addr string,
+	path string,
+	tlsConfig *tls.Config,
+	rBufSize int,
+	wBufSize int,
+	credentials rpc.Map,
+	onError func(err *base.Error),
+) *Client {
+	return NewClientWithEndpoints(
+		[]adapter.Endpoint{{
+			Network:   network,
+			Addr:      addr,
+			Path:      path,
+			TLSConfig: tlsConfig,
+		}},
+		nil,
+		rBufSize,
+		wBufSize,
+		credentials,
+		nil,
+		onError,
+	)
+}
+
+// NewClientWithEndpoints creates a client that dials the endpoints in turn.
+// It fails over to the next endpoint when the dial fails or the conn is
+// closed, and the session is resumed if the endpoints share the sessions.
+// reconnect sets the backoff after all the endpoints fail, nil uses the
+// default. onConnState is called when the conn state changes, it can be nil.
+func NewClientWithEndpoints(
+	endpoints []adapter.Endpoint,
+	reconnect *adapter.ReconnectConfig,
+	rBufSize int,
+	wBufSize int,
+	credentials rpc.Map,
+	onConnState func(endpoint adapter.Endpoint, state adapter.ConnState),
+	onError func(err *base.Error),
 ) *Client {
 	ret := &Client{
 		config:          &Config{},
 		sessionString:   "",
+		credentials:     credentials,
 		adapter:         nil,
 		conn:            nil,
 		preSendHead:     nil,
 		preSendTail:     nil,
 		channels:        nil,
 		lastPingTimeNS:  0,
+		draining:        false,
+		drainCloses:     0,
+		numOfEndpoints:  len(endpoints),
+		traceSampleRate: 0,
 		orcManager:      base.NewORCManager(),
 		subscriptionMap: make(map[string][]*Subscription),
 		onError:         onError,
 	}
 
 	// init adapter
-	clientAdapter := adapter.NewClientAdapter(
-		network, addr, path, tlsConfig, rBufSize, wBufSize, ret,
+	clientAdapter := adapter.NewClientAdapterWithEndpoints(
+		endpoints, reconnect, onConnState, rBufSize, wBufSize, ret,
 	)
 	clientAdapter.Open()
 	go func() {
@@ -211,6 +545,14 @@ func NewClient(
 	return ret
 }
 
+// SetTraceSampleRate samples sampleRate (0 to 1) of the traces that the
+// requests start, the requests that join a trace follow it. It is 0 by
+// default, so the spans of the requests are not exported by the server.
+func (p *Client) SetTraceSampleRate(sampleRate float64) *Client {
+	atomic.StoreUint64(&p.traceSampleRate, math.Float64bits(sampleRate))
+	return p
+}
+
 func (p *Client) initChannel(size int) {
 	p.channels = make([]Channel, size)
 	for i := 0; i < len(p.channels); i++ {
@@ -220,7 +562,11 @@ func (p *Client) initChannel(size int) {
 }
 
 func (p *Client) initConn(stream *rpc.Stream) {
-	if kind := stream.GetKind(); kind != rpc.StreamKindConnectResponse {
+	if kind := stream.GetKind(); kind == rpc.StreamKindSystemErrorReport {
+		// the connection is rejected by the server
+		_, err := rpc.ParseResponseStream(stream)
+		p.OnConnError(p.conn, err)
+	} else if kind != rpc.StreamKindConnectResponse {
 		p.OnConnError(p.conn, base.ErrStream)
 	} else if sessionString, err := stream.ReadString(); err != nil {
 		p.OnConnError(p.conn, err)
@@ -240,33 +586,78 @@ func (p *Client) initConn(stream *rpc.Stream) {
 		p.OnConnError(p.conn, err)
 	} else if heartbeatTimeout <= 0 {
 		p.OnConnError(p.conn, base.ErrClientConfig)
+	} else if codec, threshold, err := readConnectCompression(
+		stream,
+	); err != nil {
+		p.OnConnError(p.conn, err)
 	} else if !stream.IsReadFinish() {
 		p.OnConnError(p.conn, base.ErrStream)
-	} else if sessionString != p.sessionString {
-		// new session
-		p.sessionString = sessionString
-
-		// update config
-		p.config.numOfChannels = int(numOfChannels)
-		p.config.transLimit = int(transLimit)
-		p.config.heartbeat = time.Duration(heartbeat) * time.Millisecond
-		p.config.heartbeatTimeout =
-			time.Duration(heartbeatTimeout) * time.Millisecond
-
-		// init channel
-		p.initChannel(p.config.numOfChannels)
 	} else {
-		// try to resend channel message
-		for i := 0; i < len(p.channels); i++ {
-			if item := (&p.channels[i]).item; item != nil {
-				p.conn.WriteStreamAndRelease(item.sendStream.Clone())
+		// the resent requests are compressed too
+		p.conn.SetCompression(codec, threshold, int(transLimit))
+
+		if sessionString != p.sessionString {
+			// new session
+			p.sessionString = sessionString
+
+			// update config
+			p.config.numOfChannels = int(numOfChannels)
+			p.config.transLimit = int(transLimit)
+			p.config.heartbeat = time.Duration(heartbeat) * time.Millisecond
+			p.config.heartbeatTimeout =
+				time.Duration(heartbeatTimeout) * time.Millisecond
+
+			// init channel
+			p.initChannel(p.config.numOfChannels)
+		} else {
+			// try to resend channel message
+			for i := 0; i < len(p.channels); i++ {
+				if item := (&p.channels[i]).item; item != nil {
+					p.conn.WriteStreamAndRelease(item.sendStream.Clone())
+				}
 			}
 		}
 	}
 
+	// restore the subscriptions. the server keeps them in the session, but
+	// the session may be new, or they may be made when the conn is closed
+	if p.conn != nil {
+		for topic := range p.subscriptionMap {
+			p.sendTopicStream(rpc.StreamKindSubscribe, topic)
+		}
+	}
+
 	p.lastPingTimeNS = base.TimeNow().UnixNano()
 }
 
+// readConnectCompression reads the codec and the threshold that the server
+// selects, the old servers do not send them
+func readConnectCompression(stream *rpc.Stream) (uint8, int, *base.Error) {
+	if stream.IsReadFinish() {
+		return rpc.StreamCodecNone, 0, nil
+	}
+
+	if codec, err := stream.ReadInt64(); err != nil {
+		return rpc.StreamCodecNone, 0, err
+	} else if codec != rpc.StreamCodecNone && codec != rpc.StreamCodecDeflate {
+		return rpc.StreamCodecNone, 0, base.ErrClientConfig
+	} else if threshold, err := stream.ReadInt64(); err != nil {
+		return rpc.StreamCodecNone, 0, err
+	} else {
+		return uint8(codec), int(threshold), nil
+	}
+}
+
+func (p *Client) sendTopicStream(kind uint8, topic string) {
+	if p.conn != nil {
+		stream := rpc.NewStream()
+		stream.SetKind(kind)
+		stream.SetCallbackID(0)
+		stream.WriteString(topic)
+		p.conn.WriteStreamAndRelease(stream)
+	}
+}
+
 func (p *Client) tryToSendPing(nowNS int64) {
 	if p.conn == nil || nowNS-p.lastPingTimeNS < int64(p.config.heartbeat) {
 		return
@@ -319,8 +710,47 @@ func (p *Client) tryToTimeout(nowNS int64) {
 	}
 }
 
+// tryToCloseDrainingConn closes the conn of the draining server after all the
+// sent requests are replied, the pending requests are sent after reconnecting.
+// The conn is kept if the other endpoints are draining too, or the client
+// would reconnect to the same draining server again and again. The pending
+// requests wait until the server closes the conn.
+func (p *Client) tryToCloseDrainingConn() {
+	if !p.draining || p.conn == nil || p.drainCloses >= p.numOfEndpoints-1 {
+		return
+	}
+
+	for i := 0; i < len(p.channels); i++ {
+		if p.channels[i].item != nil {
+			return
+		}
+	}
+
+	p.drainCloses++
+	p.conn.Close()
+}
+
+// resetDrainCloses is called when the server of the conn works, the server
+// sends the drain stream at once after the connect response if it is draining
+func (p *Client) resetDrainCloses() {
+	if !p.draining {
+		p.drainCloses = 0
+	}
+}
+
+// isHealthy returns true if the conn is open, the server is not draining and
+// the conn is read in the heartbeat timeout
+func (p *Client) isHealthy(nowNS int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.conn != nil &&
+		!p.draining &&
+		p.conn.IsActive(nowNS, p.config.heartbeatTimeout)
+}
+
 func (p *Client) tryToDeliverPreSendMessages() {
-	if p.conn == nil || p.channels == nil {
+	if p.conn == nil || p.channels == nil || p.draining {
 		return
 	}
 
@@ -344,8 +774,20 @@ func (p *Client) tryToDeliverPreSendMessages() {
 			}
 			item.next = nil
 
-			(&p.channels[findFree]).Use(item, channelSize)
-			p.conn.WriteStreamAndRelease(item.sendStream.Clone())
+			channel := &p.channels[findFree]
+			channel.Use(item, channelSize)
+
+			// tell the server how much time is left. the server runs the
+			// request with timeout 0 without deadline, so the expired request
+			// fails here
+			remainNS := item.timeoutNS - (item.sendTimeNS - item.startTimeNS)
+			if remainNS > 0 {
+				item.sendStream.SetTimeout(uint64(remainNS))
+				p.conn.WriteStreamAndRelease(item.sendStream.Clone())
+			} else {
+				channel.item = nil
+				item.timeout()
+			}
 		}
 	}
 }
@@ -368,6 +810,8 @@ func (p *Client) Subscribe(
 	list, ok := p.subscriptionMap[path]
 	if !ok {
 		list = make([]*Subscription, 0)
+		// the server only sends the boardcasts of the subscribed topics
+		p.sendTopicStream(rpc.StreamKindSubscribe, path)
 	}
 	list = append(list, ret)
 
@@ -396,22 +840,42 @@ func (p *Client) unsubscribe(id int64) {
 			p.subscriptionMap[key] = list
 		} else {
 			delete(p.subscriptionMap, key)
+			p.sendTopicStream(rpc.StreamKindUnsubscribe, key)
 		}
 	}
 }
 
-// Send ...
-func (p *Client) Send(
-	timeout time.Duration,
+func (p *Client) sendItem(
+	item *SendItem,
 	target string,
-	args ...interface{},
-) (interface{}, *base.Error) {
-	item := NewSendItem(int64(timeout))
-	defer item.Release()
+	args []interface{},
+) *base.Error {
+	if err := p.prepareItem(item, target, args); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.addItem(item)
+	p.tryToDeliverPreSendMessages()
+	p.mu.Unlock()
 
+	return nil
+}
+
+func (p *Client) prepareItem(
+	item *SendItem,
+	target string,
+	args []interface{},
+) *base.Error {
 	item.sendStream.SetKind(rpc.StreamKindRPCRequest)
 	// set depth
 	item.sendStream.SetDepth(0)
+	// start a new trace if the request does not join one
+	if !item.sendStream.GetTraceContext().IsValid() {
+		item.sendStream.SetTraceContext(rpc.NewRootTraceContext(
+			math.Float64frombits(atomic.LoadUint64(&p.traceSampleRate)),
+		))
+	}
 	// write target
 	item.sendStream.WriteString(target)
 	// write from
@@ -419,12 +883,16 @@ func (p *Client) Send(
 	// write args
 	for i := 0; i < len(args); i++ {
 		if eStr := item.sendStream.Write(args[i]); eStr != rpc.StreamWriteOK {
-			return nil, base.ErrUnsupportedValue.AddDebug(eStr)
+			return base.ErrUnsupportedValue.AddDebug(eStr)
 		}
 	}
 
-	// add item to the list tail
-	p.mu.Lock()
+	return nil
+}
+
+// addItem adds the item to the tail of the pre send list, it must be called
+// with p.mu locked.
+func (p *Client) addItem(item *SendItem) {
 	if p.preSendTail == nil {
 		p.preSendHead = item
 		p.preSendTail = item
@@ -432,8 +900,77 @@ func (p *Client) Send(
 		p.preSendTail.next = item
 		p.preSendTail = item
 	}
-	p.tryToDeliverPreSendMessages()
-	p.mu.Unlock()
+}
+
+// cancelItem removes the item from the pre send list or from its channel, so
+// the channel can be used by the other requests. The reply of the item is
+// ignored after it is canceled, and the server is told to drop it.
+func (p *Client) cancelItem(item *SendItem) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	item.isRunning = false
+
+	preItem := (*SendItem)(nil)
+	for node := p.preSendHead; node != nil; node = node.next {
+		if node == item {
+			if preItem == nil {
+				p.preSendHead = node.next
+			} else {
+				preItem.next = node.next
+			}
+
+			if node == p.preSendTail {
+				p.preSendTail = preItem
+			}
+
+			node.next = nil
+			return
+		}
+		preItem = node
+	}
+
+	for i := 0; i < len(p.channels); i++ {
+		if channel := &p.channels[i]; channel.item == item {
+			channel.item = nil
+			if p.conn != nil {
+				stream := rpc.NewStream()
+				stream.SetKind(rpc.StreamKindRPCCancel)
+				stream.SetCallbackID(item.sendStream.GetCallbackID())
+				p.conn.WriteStreamAndRelease(stream)
+			}
+			p.tryToDeliverPreSendMessages()
+			return
+		}
+	}
+}
+
+// Send ...
+func (p *Client) Send(
+	timeout time.Duration,
+	target string,
+	args ...interface{},
+) (interface{}, *base.Error) {
+	return p.SendWithPriority(0, timeout, target, args...)
+}
+
+// SendWithPriority is the same as Send, but the request is sent with the
+// priority. When all the threads of the server are busy, the requests with
+// higher priority are evaluated first. 0 is the lowest priority, the other
+// calls use it.
+func (p *Client) SendWithPriority(
+	priority uint8,
+	timeout time.Duration,
+	target string,
+	args ...interface{},
+) (interface{}, *base.Error) {
+	item := NewSendItem(int64(timeout))
+	defer item.Release()
+
+	item.sendStream.SetPriority(priority)
+	if err := p.sendItem(item, target, args); err != nil {
+		return nil, err
+	}
 
 	// wait for response
 	backStream := <-item.returnCH
@@ -442,6 +979,130 @@ func (p *Client) Send(
 	return rpc.ParseResponseStream(backStream)
 }
 
+// SendAsync sends a request without blocking the caller. The result is read
+// from the returned future.
+func (p *Client) SendAsync(
+	timeout time.Duration,
+	target string,
+	args ...interface{},
+) *Future {
+	item := NewSendItem(int64(timeout))
+	ret := newFuture(item)
+
+	if err := p.sendItem(item, target, args); err != nil {
+		ret.fail(err)
+	}
+
+	return ret
+}
+
+type traceContextKey struct{}
+
+// WithTraceContext returns a copy of ctx that carries trace. The request of
+// SendContext with it joins the trace, trace.SpanID is the parent span.
+func WithTraceContext(
+	ctx context.Context,
+	trace rpc.TraceContext,
+) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+// SendContext is the same as Send, but it returns base.ErrClientCanceled as
+// soon as ctx is done. The timeout of the request is the deadline of ctx. If
+// ctx carries a trace context of WithTraceContext, the request joins it.
+func (p *Client) SendContext(
+	ctx context.Context,
+	target string,
+	args ...interface{},
+) (rpc.Any, *base.Error) {
+	if ctx.Err() != nil {
+		return nil, base.ErrClientCanceled
+	}
+
+	// without deadline the request never timeout
+	timeout := time.Duration(math.MaxInt64)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = deadline.Sub(base.TimeNow())
+	}
+
+	item := NewSendItem(int64(timeout))
+	if trace, ok := ctx.Value(traceContextKey{}).(rpc.TraceContext); ok {
+		item.sendStream.SetTraceContext(trace)
+	}
+	future := newFuture(item)
+	if err := p.sendItem(item, target, args); err != nil {
+		future.fail(err)
+	}
+
+	select {
+	case <-future.Done():
+		return future.Wait()
+	case <-ctx.Done():
+		// the item can not get the response after it is canceled, so finish
+		// the future here if it has not got one, then Wait releases the item
+		p.cancelItem(item)
+		select {
+		case <-future.Done():
+		default:
+			future.fail(base.ErrClientCanceled)
+		}
+		_, _ = future.Wait()
+		return nil, base.ErrClientCanceled
+	}
+}
+
+// SendBatch sends all the calls at once without creating goroutines. At most
+// numOfChannels calls are running at the same time, the others wait in the
+// pre send list. The futures are in the same order as the calls.
+func (p *Client) SendBatch(timeout time.Duration, calls []*Call) []*Future {
+	ret := make([]*Future, len(calls))
+	items := make([]*SendItem, 0, len(calls))
+
+	for i := 0; i < len(calls); i++ {
+		item := NewSendItem(int64(timeout))
+		ret[i] = newFuture(item)
+
+		if calls[i] == nil {
+			ret[i].fail(base.ErrUnsupportedValue.AddDebug("call is nil"))
+		} else if err := p.prepareItem(
+			item,
+			calls[i].target,
+			calls[i].args,
+		); err != nil {
+			ret[i].fail(err)
+		} else {
+			items = append(items, item)
+		}
+	}
+
+	p.mu.Lock()
+	for i := 0; i < len(items); i++ {
+		p.addItem(items[i])
+	}
+	p.tryToDeliverPreSendMessages()
+	p.mu.Unlock()
+
+	return ret
+}
+
+// Iterate sends a request to a server streaming action, the items that the
+// action pushes are read from the returned iterator.
+func (p *Client) Iterate(
+	timeout time.Duration,
+	target string,
+	args ...interface{},
+) *ResponseIterator {
+	item := NewSendItem(int64(timeout))
+	item.isStream = true
+
+	if err := p.sendItem(item, target, args); err != nil {
+		item.Release()
+		return &ResponseIterator{err: err}
+	}
+
+	return &ResponseIterator{client: p, item: item}
+}
+
 // Close ...
 func (p *Client) Close() bool {
 	return p.orcManager.Close(func() {
@@ -460,6 +1121,20 @@ func (p *Client) OnConnOpen(streamConn *adapter.StreamConn) {
 	stream.SetKind(rpc.StreamKindConnectRequest)
 	stream.SetCallbackID(0)
 	stream.WriteString(p.sessionString)
+	if p.credentials == nil {
+		stream.WriteNil()
+	} else if reason := stream.Write(
+		p.credentials,
+	); reason != rpc.StreamWriteOK {
+		stream.Release()
+		p.OnConnError(
+			streamConn,
+			base.ErrClientConfig.AddDebug("credentials "+reason),
+		)
+		return
+	}
+	// the codecs that the client supports, the server selects one of them
+	stream.WriteBytes(rpc.Bytes{rpc.StreamCodecDeflate})
 	streamConn.WriteStreamAndRelease(stream)
 }
 
@@ -491,10 +1166,17 @@ func (p *Client) OnConnReadStream(
 			channel := &p.channels[callbackID%uint64(len(p.channels))]
 			if channel.sequence == callbackID {
 				channel.Free(stream)
+				p.resetDrainCloses()
+				p.tryToCloseDrainingConn()
 				p.tryToDeliverPreSendMessages()
 			} else {
 				stream.Release()
 			}
+		case rpc.StreamKindRPCResponseItem:
+			channel := &p.channels[callbackID%uint64(len(p.channels))]
+			if channel.sequence != callbackID || !channel.BackItem(stream) {
+				stream.Release()
+			}
 		case rpc.StreamKindRPCBoardCast:
 			if actionPath, err := stream.ReadString(); err != nil {
 				p.OnConnError(streamConn, err)
@@ -513,6 +1195,16 @@ func (p *Client) OnConnReadStream(
 		case rpc.StreamKindPong:
 			if !stream.IsReadFinish() {
 				p.OnConnError(streamConn, base.ErrStream)
+			} else {
+				p.resetDrainCloses()
+			}
+			stream.Release()
+		case rpc.StreamKindDrain:
+			if !stream.IsReadFinish() {
+				p.OnConnError(streamConn, base.ErrStream)
+			} else {
+				p.draining = true
+				p.tryToCloseDrainingConn()
 			}
 			stream.Release()
 		default:
@@ -538,4 +1230,5 @@ func (p *Client) OnConnClose(_ *adapter.StreamConn) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.conn = nil
+	p.draining = false
 }
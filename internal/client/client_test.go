@@ -1,10 +1,13 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"math"
 	"math/rand"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -78,6 +81,17 @@ func getTestServer() *server.Server {
 			return rt.Reply(
 				rt.Post(rt.GetPostEndPoint(), "@Post", rpc.Array{true, timeNS}),
 			)
+		}).
+		On("Publish", func(rt rpc.Runtime, message rpc.String) rpc.Return {
+			return rt.Reply(rt.Publish("@Publish", message))
+		}).
+		On("Count", func(rt rpc.Runtime, n int64) rpc.Return {
+			for i := int64(0); i < n; i++ {
+				if err := rt.Push(i); err != nil {
+					return rt.Reply(err)
+				}
+			}
+			return rt.Reply(n)
 		})
 
 	rpcServer := server.NewServer(
@@ -117,18 +131,21 @@ func checkClientPreSendList(c *Client, arr []*SendItem) bool {
 }
 
 type TestAdapter struct {
-	isDebug    bool
-	isClient   bool
-	network    string
-	addr       string
-	path       string
-	tlsConfig  *tls.Config
-	fileMap    map[string]string
-	rBufSize   int
-	wBufSize   int
-	receiver   adapter.IReceiver
-	service    base.IORCService
-	orcManager *base.ORCManager
+	isDebug     bool
+	isClient    bool
+	network     string
+	addr        string
+	path        string
+	tlsConfig   *tls.Config
+	fileMap     map[string]string
+	endpoints   []adapter.Endpoint
+	reconnect   *adapter.ReconnectConfig
+	onConnState func(endpoint adapter.Endpoint, state adapter.ConnState)
+	rBufSize    int
+	wBufSize    int
+	receiver    adapter.IReceiver
+	service     base.IORCService
+	orcManager  *base.ORCManager
 }
 
 func TestSubscription_Close(t *testing.T) {
@@ -193,6 +210,108 @@ func TestSendItem_Back(t *testing.T) {
 		assert(len(v.returnCH)).Equals(1)
 		assert(<-v.returnCH).Equals(stream)
 	})
+
+	t.Run("test future", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		future := newFuture(v)
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCResponseOK)
+		stream.Write("hello")
+		assert(v.Back(stream)).IsTrue()
+		assert(len(v.returnCH)).Equals(0)
+		assert(future.Wait()).Equals("hello", nil)
+	})
+}
+
+func TestSendItem_BackItem(t *testing.T) {
+	fnItemStream := func(seq uint64) *rpc.Stream {
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCResponseItem)
+		stream.WriteUint64(seq)
+		stream.Write("hello")
+		return stream
+	}
+
+	t.Run("stream is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		v.isStream = true
+		assert(v.BackItem(nil)).IsFalse()
+		assert(len(v.itemStreams)).Equals(0)
+	})
+
+	t.Run("item is not running", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		v.isStream = true
+		v.isRunning = false
+		assert(v.BackItem(fnItemStream(0))).IsFalse()
+		assert(len(v.itemStreams)).Equals(0)
+	})
+
+	t.Run("item is not stream", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		assert(v.BackItem(fnItemStream(0))).IsFalse()
+		assert(len(v.itemStreams)).Equals(0)
+	})
+
+	t.Run("read sequence error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		v.isStream = true
+		assert(v.BackItem(rpc.NewStream())).IsFalse()
+		assert(len(v.itemStreams)).Equals(0)
+	})
+
+	t.Run("sequence has been received", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		v.isStream = true
+		v.itemSeq = 1
+		assert(v.BackItem(fnItemStream(0))).IsFalse()
+		assert(len(v.itemStreams)).Equals(0)
+	})
+
+	t.Run("items are lost", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		v.isStream = true
+		assert(v.BackItem(fnItemStream(1))).IsFalse()
+		assert(v.getItemErr()).Equals(base.ErrClientItemsLost)
+		assert(len(v.itemCH)).Equals(1)
+		// the items after the error are ignored
+		assert(v.BackItem(fnItemStream(0))).IsFalse()
+		assert(len(v.itemStreams)).Equals(0)
+	})
+
+	t.Run("items overflow", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		v.isStream = true
+		for i := 0; i < maxIteratorItems; i++ {
+			assert(v.BackItem(fnItemStream(uint64(i)))).IsTrue()
+		}
+		assert(v.BackItem(fnItemStream(maxIteratorItems))).IsFalse()
+		assert(v.getItemErr()).Equals(base.ErrClientItemsOverflow)
+		assert(len(v.itemStreams)).Equals(maxIteratorItems)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		v.isStream = true
+		stream0 := fnItemStream(0)
+		stream1 := fnItemStream(1)
+		assert(v.BackItem(stream0)).IsTrue()
+		assert(v.BackItem(stream1)).IsTrue()
+		assert(v.itemSeq).Equals(uint64(2))
+		assert(len(v.itemCH)).Equals(1)
+		assert(v.popItem()).Equals(stream0)
+		assert(v.popItem()).Equals(stream1)
+		assert(v.popItem()).IsNil()
+	})
 }
 
 func TestSendItem_CheckTime(t *testing.T) {
@@ -247,6 +366,19 @@ func TestSendItem_Release(t *testing.T) {
 		assert(v.sendStream.GetWritePos()).Equals(rpc.StreamHeadSize)
 	})
 
+	t.Run("test release items", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSendItem(0)
+		v.isStream = true
+		stream := rpc.NewStream()
+		stream.WriteUint64(0)
+		assert(v.BackItem(stream)).IsTrue()
+
+		v.Release()
+		assert(v.itemStreams).IsNil()
+		assert(len(v.itemCH)).Equals(0)
+	})
+
 	t.Run("test put back", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		mp := map[string]bool{}
@@ -259,6 +391,186 @@ func TestSendItem_Release(t *testing.T) {
 	})
 }
 
+func TestFuture_Done(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := newFuture(nil)
+		select {
+		case <-v.Done():
+			assert().Fail("future is not done")
+		default:
+		}
+		v.fail(base.ErrStream)
+		_, ok := <-v.Done()
+		assert(ok).IsFalse()
+	})
+}
+
+func TestFuture_Wait(t *testing.T) {
+	t.Run("test fail", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := newFuture(nil)
+		v.fail(base.ErrStream)
+		assert(v.Wait()).Equals(nil, base.ErrStream)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		item := NewSendItem(0)
+		v := newFuture(item)
+		assert(item.future).Equals(v)
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			stream := rpc.NewStream()
+			stream.SetKind(rpc.StreamKindRPCResponseOK)
+			stream.Write(int64(3))
+			item.Back(stream)
+		}()
+
+		assert(v.Wait()).Equals(int64(3), nil)
+		assert(v.Wait()).Equals(int64(3), nil)
+		assert(v.item, item.future).IsNil()
+	})
+}
+
+func TestNewCall(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(NewCall("#.user:SayHello", "kitty", 3)).Equals(&Call{
+			target: "#.user:SayHello",
+			args:   []interface{}{"kitty", 3},
+		})
+	})
+}
+
+func TestResponseIterator_Next(t *testing.T) {
+	fnItemStream := func(seq uint64, value interface{}) *rpc.Stream {
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCResponseItem)
+		stream.WriteUint64(seq)
+		stream.Write(value)
+		return stream
+	}
+
+	t.Run("item is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &ResponseIterator{err: base.ErrStream}
+		assert(v.Next()).IsFalse()
+		assert(v.Value(), v.Result(), v.Err()).Equals(nil, nil, base.ErrStream)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		item := NewSendItem(0)
+		item.isStream = true
+		v := &ResponseIterator{item: item}
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			item.BackItem(fnItemStream(0, "a"))
+			item.BackItem(fnItemStream(1, "b"))
+			time.Sleep(20 * time.Millisecond)
+			stream := rpc.NewStream()
+			stream.SetKind(rpc.StreamKindRPCResponseOK)
+			stream.Write(int64(2))
+			item.Back(stream)
+		}()
+
+		assert(v.Next()).IsTrue()
+		assert(v.Value()).Equals("a")
+		assert(v.Next()).IsTrue()
+		assert(v.Value()).Equals("b")
+		assert(v.Next()).IsFalse()
+		assert(v.Value(), v.Result(), v.Err()).Equals(nil, int64(2), nil)
+		assert(v.item, v.backStream).IsNil()
+	})
+
+	t.Run("final response is error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		item := NewSendItem(0)
+		item.isStream = true
+		v := &ResponseIterator{item: item}
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCResponseError)
+		stream.WriteUint64(uint64(base.ErrStream.GetCode()))
+		stream.WriteString(base.ErrStream.GetMessage())
+		item.Back(stream)
+		assert(v.Next()).IsFalse()
+		assert(v.Result(), v.Err()).Equals(nil, base.ErrStream)
+	})
+
+	t.Run("item is not finish", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		item := NewSendItem(0)
+		item.isStream = true
+		v := &ResponseIterator{item: item}
+		stream := fnItemStream(0, "a")
+		stream.Write(true)
+		item.BackItem(stream)
+		item.BackItem(fnItemStream(1, "b"))
+		okStream := rpc.NewStream()
+		okStream.SetKind(rpc.StreamKindRPCResponseOK)
+		okStream.Write(int64(2))
+		item.Back(okStream)
+		assert(v.Next()).IsFalse()
+		assert(v.Value(), v.Result(), v.Err()).Equals(nil, nil, base.ErrStream)
+	})
+}
+
+func TestResponseIterator_Close(t *testing.T) {
+	t.Run("item is nil", func(t *testing.T) {
+		v := &ResponseIterator{err: base.ErrStream}
+		v.Close()
+	})
+
+	t.Run("items are lost", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		client := &Client{channels: make([]Channel, 1)}
+		item := NewSendItem(0)
+		item.isStream = true
+		client.channels[0].item = item
+		v := &ResponseIterator{client: client, item: item}
+		stream := rpc.NewStream()
+		stream.WriteUint64(0)
+		stream.Write("a")
+		item.BackItem(stream)
+		stream = rpc.NewStream()
+		stream.WriteUint64(2)
+		item.BackItem(stream)
+		assert(v.Next()).IsTrue()
+		assert(v.Value()).Equals("a")
+		assert(v.Next()).IsFalse()
+		assert(v.Err()).Equals(base.ErrClientItemsLost)
+		assert(v.item).IsNil()
+		assert(client.channels[0].item).IsNil()
+	})
+
+	t.Run("the final response has been received", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		client := &Client{channels: make([]Channel, 1)}
+		item := NewSendItem(0)
+		item.isStream = true
+		v := &ResponseIterator{client: client, item: item}
+		item.Back(rpc.NewStream())
+		v.Close()
+		assert(v.item, v.backStream).IsNil()
+		assert(v.Next()).IsFalse()
+	})
+
+	t.Run("the request is running", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		client := &Client{channels: make([]Channel, 2)}
+		item := NewSendItem(0)
+		item.isStream = true
+		client.channels[1].item = item
+		v := &ResponseIterator{client: client, item: item}
+		v.Close()
+		assert(v.item).IsNil()
+		assert(client.channels[1].item).IsNil()
+	})
+}
+
 func TestChannel_Use(t *testing.T) {
 	t.Run("p.item != nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -300,6 +612,27 @@ func TestChannel_Free(t *testing.T) {
 	})
 }
 
+func TestChannel_BackItem(t *testing.T) {
+	t.Run("p.item == nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{}
+		assert(v.BackItem(rpc.NewStream())).IsFalse()
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{}
+		item := NewSendItem(0)
+		item.isStream = true
+		v.Use(item, 32)
+		stream := rpc.NewStream()
+		stream.WriteUint64(0)
+		assert(v.BackItem(stream)).IsTrue()
+		assert(v.item).Equals(item)
+		assert(item.popItem()).Equals(stream)
+	})
+}
+
 func TestChannel_CheckTime(t *testing.T) {
 	t.Run("p.item == nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -362,13 +695,16 @@ func TestNewClient(t *testing.T) {
 			heartbeatTimeout: 8 * time.Second,
 		})
 		assert(len(v.sessionString) >= 34).IsTrue()
+		assert(v.credentials).IsNil()
 		testAdapter := (*TestAdapter)(unsafe.Pointer(v.adapter))
 		assert(testAdapter.isDebug).IsFalse()
 		assert(testAdapter.isClient).IsTrue()
-		assert(testAdapter.network).Equals("ws")
-		assert(testAdapter.addr).Equals("127.0.0.1:8765")
-		assert(testAdapter.path).Equals("")
-		assert(testAdapter.tlsConfig).Equals(nil)
+		assert(testAdapter.endpoints).Equals([]adapter.Endpoint{{
+			Network:   "ws",
+			Addr:      "127.0.0.1:8765",
+			Path:      "",
+			TLSConfig: nil,
+		}})
 		assert(testAdapter.fileMap).Equals(nil)
 		assert(testAdapter.rBufSize).Equals(1024)
 		assert(testAdapter.wBufSize).Equals(2048)
@@ -404,6 +740,68 @@ func TestNewClient(t *testing.T) {
 	})
 }
 
+func TestNewClientWithCredentials(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		testServer := getTestServer()
+		defer testServer.Close()
+
+		assert := base.NewAssert(t)
+		v := NewClientWithCredentials(
+			"ws",
+			"127.0.0.1:8765",
+			"",
+			nil,
+			1024,
+			2048,
+			rpc.Map{"token": "pass"},
+			func(_ *base.Error) {},
+		)
+		defer v.Close()
+
+		assert(v.credentials).Equals(rpc.Map{"token": "pass"})
+		assert(v.Send(3*time.Second, "#.user:SayHello", "kitty")).
+			Equals("hello kitty", nil)
+	})
+}
+
+func TestNewClientWithEndpoints(t *testing.T) {
+	t.Run("fail over to the next endpoint", func(t *testing.T) {
+		testServer := getTestServer()
+		defer testServer.Close()
+
+		assert := base.NewAssert(t)
+		mu := &sync.Mutex{}
+		states := make([]adapter.ConnState, 0)
+		v := NewClientWithEndpoints(
+			[]adapter.Endpoint{
+				{Network: "tcp", Addr: "127.0.0.1:65437"},
+				{Network: "ws", Addr: "127.0.0.1:8765"},
+			},
+			adapter.GetDefaultReconnectConfig().SetMinInterval(time.Millisecond),
+			1024,
+			2048,
+			nil,
+			func(endpoint adapter.Endpoint, state adapter.ConnState) {
+				mu.Lock()
+				defer mu.Unlock()
+				if endpoint.Network == "ws" {
+					states = append(states, state)
+				}
+			},
+			func(_ *base.Error) {},
+		)
+		defer v.Close()
+
+		assert(v.Send(3*time.Second, "#.user:SayHello", "kitty")).
+			Equals("hello kitty", nil)
+		mu.Lock()
+		assert(len(states) >= 2).IsTrue()
+		assert(states[0], states[1]).
+			Equals(adapter.ConnStateConnecting, adapter.ConnStateConnected)
+		mu.Unlock()
+	})
+}
+
 func TestClient_tryToSendPing(t *testing.T) {
 	t.Run("p.conn == nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -634,6 +1032,46 @@ func TestClient_tryToDeliverPreSendMessages(t *testing.T) {
 		assert(v.preSendHead).IsNotNil()
 	})
 
+	t.Run("p.draining", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			lastPingTimeNS: 10000,
+			config:         &Config{heartbeatTimeout: 9 * time.Millisecond},
+			conn:           adapter.NewStreamConn(false, nil, nil),
+			channels:       make([]Channel, 1),
+			preSendHead:    NewSendItem(0),
+			draining:       true,
+		}
+		v.tryToDeliverPreSendMessages()
+		assert(v.preSendHead).IsNotNil()
+		assert(v.channels[0].item).IsNil()
+	})
+
+	t.Run("item has expired", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			lastPingTimeNS: 10000,
+			config:         &Config{heartbeatTimeout: 9 * time.Millisecond},
+			channels:       make([]Channel, 1),
+		}
+		netConn := newTestNetConn()
+		syncConn := adapter.NewClientSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, v)
+		syncConn.SetNext(streamConn)
+		v.conn = streamConn
+
+		item := NewSendItem(0)
+		v.preSendHead = item
+		v.preSendTail = item
+		v.tryToDeliverPreSendMessages()
+		assert(v.preSendHead).IsNil()
+		assert(v.channels[0].item).IsNil()
+		assert(len(netConn.writeCH)).Equals(0)
+		assert(item.isRunning).IsFalse()
+		assert(rpc.ParseResponseStream(<-item.returnCH)).
+			Equals(nil, base.ErrClientTimeout)
+	})
+
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		for n := 16; n <= 32; n++ {
@@ -646,6 +1084,55 @@ func TestClient_tryToDeliverPreSendMessages(t *testing.T) {
 	})
 }
 
+func TestClient_cancelItem(t *testing.T) {
+	t.Run("item is in the pre send list", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{}
+		items := []*SendItem{NewSendItem(0), NewSendItem(0), NewSendItem(0)}
+		for _, item := range items {
+			v.addItem(item)
+		}
+		v.cancelItem(items[2])
+		assert(checkClientPreSendList(v, items[:2])).IsTrue()
+		v.cancelItem(items[0])
+		assert(checkClientPreSendList(v, items[1:2])).IsTrue()
+		v.cancelItem(items[1])
+		assert(v.preSendHead, v.preSendTail).IsNil()
+		assert(items[1].isRunning).IsFalse()
+	})
+
+	t.Run("item is in a channel", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{channels: make([]Channel, 2)}
+		item := NewSendItem(0)
+		v.channels[1].item = item
+		v.cancelItem(item)
+		assert(v.channels[1].item).IsNil()
+		assert(item.isRunning).IsFalse()
+	})
+
+	t.Run("tell the server", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{channels: make([]Channel, 2)}
+		netConn := newTestNetConn()
+		syncConn := adapter.NewClientSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, v)
+		syncConn.SetNext(streamConn)
+		v.conn = streamConn
+
+		item := NewSendItem(0)
+		item.sendStream.SetCallbackID(33)
+		v.channels[1].item = item
+		v.cancelItem(item)
+		assert(len(netConn.writeCH)).Equals(1)
+		stream := rpc.NewStream()
+		stream.PutBytesTo(<-netConn.writeCH, 0)
+		assert(stream.GetKind()).Equals(uint8(rpc.StreamKindRPCCancel))
+		assert(stream.GetCallbackID()).Equals(uint64(33))
+		assert(stream.IsReadFinish()).IsTrue()
+	})
+}
+
 func TestClient_Subscribe(t *testing.T) {
 	t.Run("test basic", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -665,6 +1152,62 @@ func TestClient_Subscribe(t *testing.T) {
 		})
 	})
 
+	t.Run("send the topic if the conn is open", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{subscriptionMap: map[string][]*Subscription{}}
+		netConn := newTestNetConn()
+		syncConn := adapter.NewClientSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, v)
+		syncConn.SetNext(streamConn)
+		v.conn = streamConn
+
+		sub1 := v.Subscribe("#.test", "Message", func(value rpc.Any) {})
+		sub2 := v.Subscribe("#.test", "Message", func(value rpc.Any) {})
+		assert(len(netConn.writeCH)).Equals(1)
+		stream := rpc.NewStream()
+		stream.PutBytesTo(<-netConn.writeCH, 0)
+		assert(stream.GetKind()).Equals(uint8(rpc.StreamKindSubscribe))
+		assert(stream.ReadString()).Equals("#.test%Message", nil)
+		assert(stream.IsReadFinish()).IsTrue()
+
+		sub1.Close()
+		assert(len(netConn.writeCH)).Equals(0)
+		sub2.Close()
+		stream = rpc.NewStream()
+		stream.PutBytesTo(<-netConn.writeCH, 0)
+		assert(stream.GetKind()).Equals(uint8(rpc.StreamKindUnsubscribe))
+		assert(stream.ReadString()).Equals("#.test%Message", nil)
+		assert(stream.IsReadFinish()).IsTrue()
+	})
+
+	t.Run("test publish", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		rpcServer := getTestServer()
+		defer rpcServer.Close()
+
+		subscriber := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer subscriber.Close()
+
+		publisher := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer publisher.Close()
+
+		waitCH := make(chan rpc.Any, 1)
+		subscriber.Subscribe("#.user", "@Publish", func(value rpc.Any) {
+			waitCH <- value
+		})
+		// make sure the subscribe stream has arrived
+		assert(subscriber.Send(5*time.Second, "#.user:SayHello", "kitty")).
+			Equals("hello kitty", nil)
+		assert(publisher.Send(5*time.Second, "#.user:Publish", "news")).
+			Equals(nil, nil)
+		assert(<-waitCH).Equals("news")
+	})
+
 	t.Run("test message", func(t *testing.T) {
 		assert := base.NewAssert(t)
 
@@ -753,13 +1296,375 @@ func TestClient_Send(t *testing.T) {
 			assert(<-waitCH...).Equals("hello kitty", nil)
 		}
 	})
-}
 
-func TestClient_Close(t *testing.T) {
-	t.Run("test", func(t *testing.T) {
+	t.Run("large stream is compressed", func(t *testing.T) {
 		assert := base.NewAssert(t)
-		v := NewClient(
-			"ws", "127.0.0.1:1234", "", nil, 1200, 1200, func(b *base.Error) {},
+		rpcServer := getTestServer()
+		defer rpcServer.Close()
+
+		rpcClient := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer rpcClient.Close()
+
+		name := strings.Repeat("kitty", 4096)
+		assert(rpcClient.Send(6*time.Second, "#.user:SayHello", name)).
+			Equals("hello "+name, nil)
+	})
+}
+
+func TestClient_SendWithPriority(t *testing.T) {
+	t.Run("the priority is set to the stream", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewClient(
+			"ws", "127.0.0.1:65432", "", nil, 1200, 1200, func(_ *base.Error) {},
+		)
+		defer v.Close()
+
+		waitCH := make(chan []interface{})
+		go func() {
+			ret, err := v.SendWithPriority(200, time.Second, "#.user:SayHello")
+			waitCH <- []interface{}{ret, err}
+		}()
+
+		for {
+			v.mu.Lock()
+			item := v.preSendHead
+			if item != nil {
+				assert(item.sendStream.GetPriority()).Equals(uint8(200))
+			}
+			v.mu.Unlock()
+			if item != nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		assert(<-waitCH...).Equals(nil, base.ErrClientTimeout)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		rpcServer := getTestServer()
+		defer rpcServer.Close()
+
+		rpcClient := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer rpcClient.Close()
+
+		assert(rpcClient.SendWithPriority(
+			255,
+			3*time.Second,
+			"#.user:SayHello",
+			"kitty",
+		)).Equals("hello kitty", nil)
+	})
+}
+
+func TestClient_SendAsync(t *testing.T) {
+	t.Run("args error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			channels: make([]Channel, 0),
+		}
+
+		assert(v.SendAsync(time.Second, "#.user:SayHello", make(chan bool)).
+			Wait()).Equals(nil, base.ErrUnsupportedValue.AddDebug(
+			"value type(chan bool) is not supported",
+		))
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		rpcServer := getTestServer()
+		defer rpcServer.Close()
+
+		rpcClient := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer rpcClient.Close()
+
+		futures := make([]*Future, 0)
+		for i := 0; i < 100; i++ {
+			futures = append(futures, rpcClient.SendAsync(
+				6*time.Second,
+				"#.user:SayHello",
+				fmt.Sprintf("kitty%d", i),
+			))
+		}
+
+		for i := 0; i < 100; i++ {
+			assert(futures[i].Wait()).Equals(fmt.Sprintf("hello kitty%d", i), nil)
+		}
+	})
+}
+
+func TestClient_SendContext(t *testing.T) {
+	t.Run("context is canceled", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			channels: make([]Channel, 0),
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert(v.SendContext(ctx, "#.user:SayHello", "kitty")).
+			Equals(nil, base.ErrClientCanceled)
+	})
+
+	t.Run("args error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			channels: make([]Channel, 0),
+		}
+
+		assert(v.SendContext(
+			context.Background(),
+			"#.user:SayHello",
+			make(chan bool),
+		)).Equals(nil, base.ErrUnsupportedValue.AddDebug(
+			"value type(chan bool) is not supported",
+		))
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		rpcServer := getTestServer()
+		defer rpcServer.Close()
+
+		rpcClient := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer rpcClient.Close()
+
+		assert(rpcClient.SendContext(
+			context.Background(),
+			"#.user:SayHello",
+			"kitty",
+		)).Equals("hello kitty", nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+		defer cancel()
+		assert(rpcClient.SendContext(ctx, "#.user:SayHello", "doggy")).
+			Equals("hello doggy", nil)
+	})
+
+	t.Run("join the trace of ctx", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			channels: make([]Channel, 0),
+		}
+
+		trace := rpc.NewTraceContext(true)
+		ctx, cancel := context.WithCancel(
+			WithTraceContext(context.Background(), trace),
+		)
+		traceCH := make(chan rpc.TraceContext, 1)
+		go func() {
+			for {
+				v.mu.Lock()
+				item := v.preSendHead
+				v.mu.Unlock()
+
+				if item != nil {
+					traceCH <- item.sendStream.GetTraceContext()
+					cancel()
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+
+		assert(v.SendContext(ctx, "#.user:SayHello", "kitty")).
+			Equals(nil, base.ErrClientCanceled)
+		assert(<-traceCH).Equals(trace)
+	})
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		rpcServer := getTestServer()
+		defer rpcServer.Close()
+
+		rpcClient := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer rpcClient.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+
+		start := base.TimeNow()
+		assert(rpcClient.SendContext(
+			ctx,
+			"#.user:Sleep",
+			int64(2*time.Second),
+		)).Equals(nil, base.ErrClientCanceled)
+		assert(base.TimeNow().Sub(start) < time.Second).IsTrue()
+
+		// the channel is free for the next request
+		rpcClient.mu.Lock()
+		for i := 0; i < len(rpcClient.channels); i++ {
+			assert(rpcClient.channels[i].item).IsNil()
+		}
+		rpcClient.mu.Unlock()
+	})
+}
+
+func TestWithTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		trace := rpc.NewTraceContext(true)
+		ctx := WithTraceContext(context.Background(), trace)
+		assert(ctx.Value(traceContextKey{})).Equals(trace)
+	})
+}
+
+func TestClient_SetTraceSampleRate(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{}
+		assert(v.SetTraceSampleRate(0.5)).Equals(v)
+		assert(math.Float64frombits(v.traceSampleRate)).Equals(0.5)
+	})
+}
+
+func TestClient_prepareItem(t *testing.T) {
+	t.Run("start a new trace", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{}
+		item := NewSendItem(0)
+		defer item.Release()
+		assert(v.prepareItem(item, "#.user:SayHello", nil)).IsNil()
+		trace := item.sendStream.GetTraceContext()
+		assert(trace.IsValid(), trace.IsSampled()).Equals(true, false)
+	})
+
+	t.Run("start a new sampled trace", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := (&Client{}).SetTraceSampleRate(1)
+		item := NewSendItem(0)
+		defer item.Release()
+		assert(v.prepareItem(item, "#.user:SayHello", nil)).IsNil()
+		trace := item.sendStream.GetTraceContext()
+		assert(trace.IsValid(), trace.IsSampled()).Equals(true, true)
+	})
+
+	t.Run("join the trace", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{}
+		item := NewSendItem(0)
+		defer item.Release()
+		trace := rpc.NewTraceContext(false)
+		item.sendStream.SetTraceContext(trace)
+		assert(v.prepareItem(item, "#.user:SayHello", nil)).IsNil()
+		assert(item.sendStream.GetTraceContext()).Equals(trace)
+	})
+}
+
+func TestClient_SendBatch(t *testing.T) {
+	t.Run("call error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			channels: make([]Channel, 0),
+		}
+
+		futures := v.SendBatch(time.Second, []*Call{
+			nil,
+			NewCall("#.user:SayHello", make(chan bool)),
+		})
+		assert(len(futures)).Equals(2)
+		assert(futures[0].Wait()).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug("call is nil"),
+		)
+		assert(futures[1].Wait()).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug(
+				"value type(chan bool) is not supported",
+			),
+		)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		rpcServer := getTestServer()
+		defer rpcServer.Close()
+
+		rpcClient := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer rpcClient.Close()
+
+		calls := make([]*Call, 0)
+		for i := 0; i < 300; i++ {
+			calls = append(calls, NewCall(
+				"#.user:SayHello",
+				fmt.Sprintf("kitty%d", i),
+			))
+		}
+
+		futures := rpcClient.SendBatch(6*time.Second, calls)
+		for i := 0; i < 300; i++ {
+			assert(futures[i].Wait()).Equals(fmt.Sprintf("hello kitty%d", i), nil)
+		}
+	})
+}
+
+func TestClient_Iterate(t *testing.T) {
+	t.Run("args error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			channels: make([]Channel, 0),
+		}
+
+		iter := v.Iterate(time.Second, "#.user:Count", make(chan bool))
+		assert(iter.Next()).IsFalse()
+		assert(iter.Err()).Equals(base.ErrUnsupportedValue.AddDebug(
+			"value type(chan bool) is not supported",
+		))
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		rpcServer := getTestServer()
+		defer rpcServer.Close()
+
+		rpcClient := NewClient(
+			"ws", "0.0.0.0:8765", "", nil, 1200, 1200, func(b *base.Error) {},
+		)
+		defer rpcClient.Close()
+
+		waitCH := make(chan bool)
+		for i := 0; i < 20; i++ {
+			go func(n int64) {
+				iter := rpcClient.Iterate(6*time.Second, "#.user:Count", n)
+				count := int64(0)
+				for iter.Next() {
+					if iter.Value() != count {
+						waitCH <- false
+						return
+					}
+					count++
+				}
+				waitCH <- count == n && iter.Result() == n && iter.Err() == nil
+			}(int64(i * 10))
+		}
+
+		for i := 0; i < 20; i++ {
+			assert(<-waitCH).IsTrue()
+		}
+	})
+}
+
+func TestClient_Close(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewClient(
+			"ws", "127.0.0.1:1234", "", nil, 1200, 1200, func(b *base.Error) {},
 		)
 		assert(v.adapter).IsNotNil()
 		assert(v.Close()).IsTrue()
@@ -784,6 +1689,55 @@ func TestClient_OnConnOpen(t *testing.T) {
 		assert(stream.GetKind()).
 			Equals(uint8(rpc.StreamKindConnectRequest))
 		assert(stream.ReadString()).Equals("123456", nil)
+		assert(stream.ReadNil()).Equals(nil, nil)
+		assert(stream.ReadBytes()).
+			Equals(rpc.Bytes{rpc.StreamCodecDeflate}, nil)
+		assert(stream.IsReadFinish()).IsTrue()
+	})
+
+	t.Run("with credentials", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Client{
+			sessionString: "123456",
+			credentials:   rpc.Map{"token": "pass"},
+		}
+		netConn := newTestNetConn()
+		syncConn := adapter.NewClientSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, v)
+		syncConn.SetNext(streamConn)
+		v.conn = streamConn
+
+		v.OnConnOpen(streamConn)
+
+		stream := rpc.NewStream()
+		stream.PutBytesTo(<-netConn.writeCH, 0)
+		assert(stream.GetKind()).
+			Equals(uint8(rpc.StreamKindConnectRequest))
+		assert(stream.ReadString()).Equals("123456", nil)
+		assert(stream.ReadMap()).Equals(rpc.Map{"token": "pass"}, nil)
+		assert(stream.ReadBytes()).
+			Equals(rpc.Bytes{rpc.StreamCodecDeflate}, nil)
+		assert(stream.IsReadFinish()).IsTrue()
+	})
+
+	t.Run("write credentials error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		errCH := make(chan *base.Error, 1)
+		v := &Client{
+			sessionString: "123456",
+			credentials:   rpc.Map{"token": make(chan bool)},
+			onError: func(err *base.Error) {
+				errCH <- err
+			},
+		}
+		netConn := newTestNetConn()
+		syncConn := adapter.NewClientSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, v)
+		syncConn.SetNext(streamConn)
+		v.conn = streamConn
+
+		v.OnConnOpen(streamConn)
+		assert((<-errCH).GetCode()).Equals(base.ErrClientConfig.GetCode())
 	})
 }
 
@@ -797,6 +1751,7 @@ func TestClient_OnConnReadStream(t *testing.T) {
 		errCH := make(chan *base.Error, 1024)
 		v := &Client{
 			config:          &Config{},
+			numOfEndpoints:  2,
 			subscriptionMap: map[string][]*Subscription{},
 			onError: func(err *base.Error) {
 				errCH <- err
@@ -827,6 +1782,17 @@ func TestClient_OnConnReadStream(t *testing.T) {
 		assert(<-errCH).Equals(base.ErrStream)
 	})
 
+	t.Run("conn == nil, connection is rejected", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.MakeSystemErrorStream(base.ErrServerAuthenticate)
+		v, streamConn, _, errCH := fnTestClient()
+		v.OnConnReadStream(streamConn, stream)
+		assert(<-errCH).Equals(base.NewError(
+			base.ErrServerAuthenticate.GetCode(),
+			base.ErrServerAuthenticate.GetMessage(),
+		))
+	})
+
 	t.Run("conn == nil, read sessionString error", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		stream := rpc.NewStream()
@@ -957,6 +1923,68 @@ func TestClient_OnConnReadStream(t *testing.T) {
 		assert(<-errCH).Equals(base.ErrStream)
 	})
 
+	t.Run("conn == nil, codec config error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetCallbackID(0)
+		stream.SetKind(rpc.StreamKindConnectResponse)
+		stream.WriteString("12-87654321876543218765432187654321")
+		stream.WriteInt64(32)
+		stream.WriteInt64(4 * 1024 * 1024)
+		stream.WriteInt64(int64(time.Second / time.Millisecond))
+		stream.WriteInt64(int64(2 * time.Second / time.Millisecond))
+		stream.WriteInt64(100)
+		stream.WriteInt64(4096)
+		v, streamConn, _, errCH := fnTestClient()
+		v.OnConnReadStream(streamConn, stream)
+		assert(<-errCH).Equals(base.ErrClientConfig)
+	})
+
+	t.Run("conn == nil, read threshold error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetCallbackID(0)
+		stream.SetKind(rpc.StreamKindConnectResponse)
+		stream.WriteString("12-87654321876543218765432187654321")
+		stream.WriteInt64(32)
+		stream.WriteInt64(4 * 1024 * 1024)
+		stream.WriteInt64(int64(time.Second / time.Millisecond))
+		stream.WriteInt64(int64(2 * time.Second / time.Millisecond))
+		stream.WriteInt64(int64(rpc.StreamCodecDeflate))
+		v, streamConn, _, errCH := fnTestClient()
+		v.OnConnReadStream(streamConn, stream)
+		assert(<-errCH).Equals(base.ErrStream)
+	})
+
+	t.Run("conn == nil, codec is negotiated", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetCallbackID(0)
+		stream.SetKind(rpc.StreamKindConnectResponse)
+		stream.WriteString("12-87654321876543218765432187654321")
+		stream.WriteInt64(32)
+		stream.WriteInt64(4 * 1024 * 1024)
+		stream.WriteInt64(int64(time.Second / time.Millisecond))
+		stream.WriteInt64(int64(2 * time.Second / time.Millisecond))
+		stream.WriteInt64(int64(rpc.StreamCodecDeflate))
+		stream.WriteInt64(16)
+		v, streamConn, netConn, errCH := fnTestClient()
+		v.subscriptionMap["#.test%"+strings.Repeat("M", 1024)] =
+			[]*Subscription{{id: 1}}
+		v.OnConnReadStream(streamConn, stream)
+		assert(len(errCH)).Equals(0)
+
+		subStream := rpc.NewStream()
+		subStream.PutBytesTo(<-netConn.writeCH, 0)
+		assert(subStream.HasStatusBitCompressed()).IsTrue()
+		subStream, err := rpc.DecompressStream(subStream, 4*1024*1024)
+		assert(err).IsNil()
+		assert(subStream.GetKind()).Equals(uint8(rpc.StreamKindSubscribe))
+		assert(subStream.ReadString()).
+			Equals("#.test%"+strings.Repeat("M", 1024), nil)
+		assert(subStream.IsReadFinish()).IsTrue()
+	})
+
 	t.Run("conn == nil, sessionString != p.sessionString", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		stream := rpc.NewStream()
@@ -983,6 +2011,28 @@ func TestClient_OnConnReadStream(t *testing.T) {
 		assert(v.lastPingTimeNS > 0).IsTrue()
 	})
 
+	t.Run("conn == nil, subscriptions are restored", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetCallbackID(0)
+		stream.SetKind(rpc.StreamKindConnectResponse)
+		stream.WriteString("12-87654321876543218765432187654321")
+		stream.WriteInt64(32)
+		stream.WriteInt64(4 * 1024 * 1024)
+		stream.WriteInt64(int64(time.Second / time.Millisecond))
+		stream.WriteInt64(int64(2 * time.Second / time.Millisecond))
+		v, streamConn, netConn, errCH := fnTestClient()
+		v.subscriptionMap["#.test%Message"] = []*Subscription{{id: 1}}
+		v.OnConnReadStream(streamConn, stream)
+		assert(len(errCH)).Equals(0)
+
+		subStream := rpc.NewStream()
+		subStream.PutBytesTo(<-netConn.writeCH, 0)
+		assert(subStream.GetKind()).Equals(uint8(rpc.StreamKindSubscribe))
+		assert(subStream.ReadString()).Equals("#.test%Message", nil)
+		assert(subStream.IsReadFinish()).IsTrue()
+	})
+
 	t.Run("conn == nil, sessionString == p.sessionString", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		stream := rpc.NewStream()
@@ -1041,6 +2091,40 @@ func TestClient_OnConnReadStream(t *testing.T) {
 		assert(v.channels[17].item).IsNil()
 	})
 
+	t.Run("p.conn != nil, StreamKindRPCResponseItem ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetCallbackID(17 + 32)
+		stream.SetKind(rpc.StreamKindRPCResponseItem)
+		stream.WriteUint64(0)
+		v, streamConn, _, _ := fnTestClient()
+		v.conn = streamConn
+		v.channels = make([]Channel, 32)
+		(&v.channels[17]).sequence = 17
+		item := NewSendItem(0)
+		item.isStream = true
+		(&v.channels[17]).Use(item, 32)
+		v.OnConnReadStream(streamConn, stream)
+		assert(item.popItem()).Equals(stream)
+	})
+
+	t.Run("p.conn != nil, StreamKindRPCResponseItem error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetCallbackID(17)
+		stream.SetKind(rpc.StreamKindRPCResponseItem)
+		stream.WriteUint64(0)
+		v, streamConn, _, _ := fnTestClient()
+		v.conn = streamConn
+		v.channels = make([]Channel, 32)
+		(&v.channels[17]).sequence = 17
+		item := NewSendItem(0)
+		item.isStream = true
+		(&v.channels[17]).Use(item, 32)
+		v.OnConnReadStream(streamConn, stream)
+		assert(item.popItem()).IsNil()
+	})
+
 	t.Run("p.conn != nil, StreamKindRPCResponseOK error", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		stream := rpc.NewStream()
@@ -1146,6 +2230,95 @@ func TestClient_OnConnReadStream(t *testing.T) {
 		v.OnConnReadStream(streamConn, stream)
 		assert(ret).Equals("Hello")
 	})
+
+	t.Run("StreamKindDrain is not finish", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindDrain)
+		stream.WriteBool(true)
+		v, streamConn, _, errCH := fnTestClient()
+		v.conn = streamConn
+		v.OnConnReadStream(streamConn, stream)
+		assert(<-errCH).Equals(base.ErrStream)
+		assert(v.draining).IsFalse()
+	})
+
+	t.Run("StreamKindDrain without running requests", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindDrain)
+		v, streamConn, netConn, _ := fnTestClient()
+		v.conn = streamConn
+		v.channels = make([]Channel, 32)
+		v.OnConnReadStream(streamConn, stream)
+		assert(v.draining).IsTrue()
+		assert(netConn.isRunning).IsFalse()
+	})
+
+	t.Run("StreamKindDrain with running requests", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindDrain)
+		v, streamConn, netConn, _ := fnTestClient()
+		v.conn = streamConn
+		v.channels = make([]Channel, 32)
+		(&v.channels[17]).sequence = 17
+		(&v.channels[17]).Use(NewSendItem(0), 32)
+		v.OnConnReadStream(streamConn, stream)
+		assert(v.draining).IsTrue()
+		assert(netConn.isRunning).IsTrue()
+
+		// the conn is closed after the last request is replied
+		callbackID := v.channels[17].sequence
+		response := rpc.NewStream()
+		response.SetCallbackID(callbackID)
+		response.SetKind(rpc.StreamKindRPCResponseOK)
+		response.Write(true)
+		v.OnConnReadStream(streamConn, response)
+		assert(v.channels[17].item).IsNil()
+		assert(netConn.isRunning).IsFalse()
+	})
+
+	t.Run("StreamKindDrain of the only endpoint", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindDrain)
+		v, streamConn, netConn, _ := fnTestClient()
+		v.numOfEndpoints = 1
+		v.conn = streamConn
+		v.channels = make([]Channel, 32)
+		v.OnConnReadStream(streamConn, stream)
+		// the conn is kept until the server closes it
+		assert(v.draining).IsTrue()
+		assert(v.drainCloses).Equals(0)
+		assert(netConn.isRunning).IsTrue()
+	})
+
+	t.Run("StreamKindDrain of all the endpoints", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, _, _, _ := fnTestClient()
+		v.channels = make([]Channel, 32)
+		for i := 0; i < 2; i++ {
+			_, streamConn, netConn, _ := fnTestClient()
+			streamConn.SetReceiver(v)
+			v.conn = streamConn
+			v.draining = false
+			stream := rpc.NewStream()
+			stream.SetKind(rpc.StreamKindDrain)
+			v.OnConnReadStream(streamConn, stream)
+			// the client goes back to the first draining server, so the
+			// second conn is kept
+			assert(netConn.isRunning).Equals(i == 1)
+			assert(v.drainCloses).Equals(1)
+		}
+
+		// the server works, the drain closes are reset
+		v.draining = false
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindPong)
+		v.OnConnReadStream(v.conn, stream)
+		assert(v.drainCloses).Equals(0)
+	})
 }
 
 func TestClient_OnConnError(t *testing.T) {
@@ -1175,7 +2348,9 @@ func TestClient_OnConnClose(t *testing.T) {
 		streamConn := adapter.NewStreamConn(false, syncConn, v)
 		syncConn.SetNext(streamConn)
 		v.conn = streamConn
+		v.draining = true
 		v.OnConnClose(streamConn)
 		assert(v.conn).IsNil()
+		assert(v.draining).IsFalse()
 	})
 }
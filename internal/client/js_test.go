@@ -0,0 +1,377 @@
+package client
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/rpc"
+	"github.com/rpccloud/rpc/internal/server"
+)
+
+// the js client and its golden streams, the streams are the bytes that the
+// Go stream writes, so the js client is checked against them.
+var (
+	testJSDir          = getTestJSDir()
+	testJSFixturesFile = path.Join(testJSDir, "testdata", "streams.json")
+	testJSErrors       = map[string]*base.Error{
+		"ErrStream":           base.ErrStream,
+		"ErrUnsupportedValue": base.ErrUnsupportedValue,
+		"ErrClientTimeout":    base.ErrClientTimeout,
+		"ErrClientConfig":     base.ErrClientConfig,
+		"ErrClientCanceled":   base.ErrClientCanceled,
+	}
+)
+
+type testJSFixtures struct {
+	Errors  []testJSFixtureError  `json:"errors"`
+	Streams []testJSFixtureStream `json:"streams"`
+}
+
+type testJSFixtureError struct {
+	Name    string `json:"name"`
+	Code    uint32 `json:"code"`
+	Message string `json:"message"`
+}
+
+type testJSFixtureHeader struct {
+	Debug      bool   `json:"debug,omitempty"`
+	Kind       uint8  `json:"kind"`
+	Priority   uint8  `json:"priority,omitempty"`
+	ZoneID     uint16 `json:"zoneID,omitempty"`
+	TargetID   uint64 `json:"targetID,string,omitempty"`
+	SourceID   uint64 `json:"sourceID,string,omitempty"`
+	GatewayID  uint64 `json:"gatewayID,string,omitempty"`
+	SessionID  uint64 `json:"sessionID,string,omitempty"`
+	CallbackID uint64 `json:"callbackID,string"`
+	Depth      uint16 `json:"depth,omitempty"`
+	Timeout    uint64 `json:"timeout,string,omitempty"`
+	TraceID    string `json:"traceID,omitempty"`
+	SpanID     string `json:"spanID,omitempty"`
+	TraceFlags uint8  `json:"traceFlags,omitempty"`
+}
+
+// testJSFixtureStream is a golden stream. The values are typed, for example
+// ["uint64", "9"] or ["map", [["name", ["string", "kitty"]]]]. The Maps
+// of the unordered stream have many keys, Go writes them in random order, so
+// only the decoded values and the length are compared.
+type testJSFixtureStream struct {
+	Name      string              `json:"name"`
+	Header    testJSFixtureHeader `json:"header"`
+	Values    []interface{}       `json:"values"`
+	Unordered bool                `json:"unordered,omitempty"`
+	Hex       string              `json:"hex"`
+}
+
+func getTestJSDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return path.Join(path.Dir(file), "..", "..", "js")
+}
+
+func loadTestJSFixtures() (*testJSFixtures, error) {
+	content, e := ioutil.ReadFile(testJSFixturesFile)
+	if e != nil {
+		return nil, e
+	}
+
+	ret := &testJSFixtures{}
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.UseNumber()
+	if e := decoder.Decode(ret); e != nil {
+		return nil, e
+	}
+	return ret, nil
+}
+
+func getTestJSFixtureValue(v interface{}) (rpc.Any, error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, fmt.Errorf("value %v is invalid", v)
+	}
+
+	kind, _ := arr[0].(string)
+	if kind == "nil" {
+		return nil, nil
+	} else if len(arr) != 2 {
+		return nil, fmt.Errorf("value %v is invalid", v)
+	}
+
+	switch kind {
+	case "bool":
+		if ret, ok := arr[1].(bool); ok {
+			return ret, nil
+		}
+	case "int64":
+		if str, ok := arr[1].(string); ok {
+			return strconv.ParseInt(str, 10, 64)
+		}
+	case "uint64":
+		if str, ok := arr[1].(string); ok {
+			return strconv.ParseUint(str, 10, 64)
+		}
+	case "float64":
+		if num, ok := arr[1].(json.Number); ok {
+			return num.Float64()
+		}
+	case "string":
+		if ret, ok := arr[1].(string); ok {
+			return ret, nil
+		}
+	case "bytes":
+		if str, ok := arr[1].(string); ok {
+			ret, e := hex.DecodeString(str)
+			return rpc.Bytes(ret), e
+		}
+	case "array":
+		if items, ok := arr[1].([]interface{}); ok {
+			ret := make(rpc.Array, len(items))
+			for i, item := range items {
+				value, e := getTestJSFixtureValue(item)
+				if e != nil {
+					return nil, e
+				}
+				ret[i] = value
+			}
+			return ret, nil
+		}
+	case "map":
+		if items, ok := arr[1].([]interface{}); ok {
+			ret := make(rpc.Map, len(items))
+			for _, item := range items {
+				pair, ok := item.([]interface{})
+				if !ok || len(pair) != 2 {
+					return nil, fmt.Errorf("map item %v is invalid", item)
+				}
+				key, ok := pair[0].(string)
+				if !ok {
+					return nil, fmt.Errorf("map key %v is invalid", pair[0])
+				}
+				value, e := getTestJSFixtureValue(pair[1])
+				if e != nil {
+					return nil, e
+				}
+				ret[key] = value
+			}
+			return ret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("value %v is invalid", v)
+}
+
+func makeTestJSFixtureStream(
+	fixture *testJSFixtureStream,
+) (*rpc.Stream, rpc.Array, error) {
+	header := fixture.Header
+	trace := rpc.TraceContext{Flags: header.TraceFlags}
+	if header.TraceID != "" {
+		if b, e := hex.DecodeString(header.TraceID); e != nil || len(b) != 16 {
+			return nil, nil, errors.New("traceID is invalid")
+		} else {
+			copy(trace.TraceID[:], b)
+		}
+	}
+	if header.SpanID != "" {
+		if b, e := hex.DecodeString(header.SpanID); e != nil || len(b) != 8 {
+			return nil, nil, errors.New("spanID is invalid")
+		} else {
+			copy(trace.SpanID[:], b)
+		}
+	}
+
+	stream := rpc.NewStream()
+	if header.Debug {
+		stream.SetStatusBitDebug()
+	}
+	stream.SetKind(header.Kind)
+	stream.SetPriority(header.Priority)
+	stream.SetZoneID(header.ZoneID)
+	stream.SetTargetID(header.TargetID)
+	stream.SetSourceID(header.SourceID)
+	stream.SetGatewayID(header.GatewayID)
+	stream.SetSessionID(header.SessionID)
+	stream.SetCallbackID(header.CallbackID)
+	stream.SetDepth(header.Depth)
+	stream.SetTimeout(header.Timeout)
+	stream.SetTraceContext(trace)
+
+	values := make(rpc.Array, len(fixture.Values))
+	for i, v := range fixture.Values {
+		value, e := getTestJSFixtureValue(v)
+		if e != nil {
+			stream.Release()
+			return nil, nil, e
+		}
+		if reason := stream.Write(value); reason != rpc.StreamWriteOK {
+			stream.Release()
+			return nil, nil, errors.New(reason)
+		}
+		values[i] = value
+	}
+
+	stream.BuildStreamCheck()
+	return stream, values, nil
+}
+
+// getTestJSNode returns the command that runs node with the WebSocket, it is
+// nil if node is not installed
+func getTestJSNode() []string {
+	for _, cmd := range [][]string{
+		{"node"},
+		{"node", "--experimental-websocket"},
+	} {
+		args := append(cmd[1:], "-e", "typeof WebSocket === 'function' || "+
+			"process.exit(1)")
+		if exec.Command(cmd[0], args...).Run() == nil {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func runTestJSHarness(args ...string) (string, error) {
+	node := getTestJSNode()
+	if node == nil {
+		return "", errors.New("node is not installed")
+	}
+
+	args = append(
+		append(node[1:], path.Join(testJSDir, "test", "harness.mjs")),
+		args...,
+	)
+	output, e := exec.Command(node[0], args...).CombinedOutput()
+	return string(output), e
+}
+
+func TestJSClient_fixtures(t *testing.T) {
+	t.Run("errors", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fixtures, e := loadTestJSFixtures()
+		assert(e).IsNil()
+		assert(len(fixtures.Errors)).Equals(len(testJSErrors))
+		for _, item := range fixtures.Errors {
+			err, ok := testJSErrors[item.Name]
+			assert(ok).IsTrue()
+			assert(item.Code, item.Message).
+				Equals(err.GetCode(), err.GetMessage())
+		}
+	})
+
+	t.Run("streams", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fixtures, e := loadTestJSFixtures()
+		assert(e).IsNil()
+		assert(len(fixtures.Streams) > 0).IsTrue()
+
+		for i := range fixtures.Streams {
+			fixture := &fixtures.Streams[i]
+			stream, values, e := makeTestJSFixtureStream(fixture)
+			assert(e).IsNil()
+
+			// the bytes of Go are the same as the fixture
+			buffer := stream.GetBuffer()
+			stream.Release()
+			if fixture.Unordered {
+				assert(len(buffer)).Equals(len(fixture.Hex) / 2)
+			} else {
+				assert(hex.EncodeToString(buffer)).Equals(fixture.Hex)
+			}
+
+			// Go reads the fixture
+			receiver := rpc.NewTestStreamReceiver()
+			b, e := hex.DecodeString(fixture.Hex)
+			assert(e).IsNil()
+			assert(rpc.NewStreamGenerator(receiver).OnBytes(b)).IsNil()
+			stream = receiver.GetStream()
+			assert(stream).IsNotNil()
+			assert(stream.HasStatusBitDebug()).Equals(fixture.Header.Debug)
+			assert(stream.GetKind()).Equals(fixture.Header.Kind)
+			assert(stream.GetCallbackID()).Equals(fixture.Header.CallbackID)
+			assert(stream.GetSessionID()).Equals(fixture.Header.SessionID)
+			assert(stream.GetTimeout()).Equals(fixture.Header.Timeout)
+			for _, value := range values {
+				assert(stream.Read()).Equals(value, nil)
+			}
+			assert(stream.IsReadFinish()).IsTrue()
+			stream.Release()
+		}
+	})
+}
+
+func TestJSClient_node(t *testing.T) {
+	if getTestJSNode() == nil {
+		t.Skip("node with WebSocket is not installed")
+	}
+
+	t.Run("fixtures", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		output, e := runTestJSHarness("fixtures", testJSFixturesFile)
+		assert(e, output).Equals(nil, "ok\n")
+	})
+
+	t.Run("server", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		service := rpc.NewService(nil).
+			On("SayHello", func(rt rpc.Runtime, name rpc.String) rpc.Return {
+				return rt.Reply("hello " + name)
+			}).
+			On("Add", func(rt rpc.Runtime, a rpc.Uint64, b rpc.Float64) rpc.Return {
+				return rt.Reply(float64(a) + b)
+			}).
+			On("Neg", func(rt rpc.Runtime, v rpc.Int64) rpc.Return {
+				return rt.Reply(-v)
+			}).
+			On("Echo", func(rt rpc.Runtime, v rpc.Array) rpc.Return {
+				return rt.Reply(v)
+			}).
+			On("GetIdentity", func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply(rt.GetIdentity())
+			}).
+			On("Error", func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply(base.ErrAction.AddDebug("action error"))
+			}).
+			On("Sleep", func(rt rpc.Runtime, timeNS rpc.Int64) rpc.Return {
+				time.Sleep(time.Duration(timeNS))
+				return rt.Reply(nil)
+			}).
+			On("Publish", func(rt rpc.Runtime, message rpc.String) rpc.Return {
+				return rt.Reply(rt.Publish("@Publish", message))
+			})
+
+		rpcServer := server.NewServer(
+			server.GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetAuthenticator(server.NewTokenAuthenticator(
+					map[string]rpc.Any{"abc": "kitty"},
+				)).
+				SetSession(
+					server.GetDefaultSessionConfig().
+						SetNumOfChannels(4).
+						SetHeartbeatInterval(100*time.Millisecond).
+						SetHeartbeatTimeout(500*time.Millisecond),
+				),
+		).Listen("ws", "0.0.0.0:8765", "", nil, nil)
+		rpcServer.AddService("user", service, nil)
+
+		go func() {
+			for !rpcServer.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+			output, e := runTestJSHarness("server", "ws://127.0.0.1:8765/")
+			assert(e, output).Equals(nil, "ok\n")
+			rpcServer.Close()
+		}()
+
+		assert(rpcServer.Open()).IsTrue()
+	})
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+// PoolStrategy ...
+type PoolStrategy uint8
+
+const (
+	// PoolStrategyRoundRobin sends the calls to the clients in turn
+	PoolStrategyRoundRobin = PoolStrategy(0)
+	// PoolStrategyLeastOutstanding sends the call to the client that has the
+	// least calls waiting for the response
+	PoolStrategyLeastOutstanding = PoolStrategy(1)
+	// PoolStrategyConsistentHash sends the calls that have the same key to
+	// the same client, the key is the first argument of the call
+	PoolStrategyConsistentHash = PoolStrategy(2)
+)
+
+const poolVirtualNodes = 64
+
+type poolMember struct {
+	client      *Client
+	outstanding int64
+}
+
+type poolRingNode struct {
+	hash  uint32
+	index int
+}
+
+// Pool spreads the calls across several clients. The clients that are
+// disconnected, draining or miss the pong in the heartbeat timeout are
+// removed from the choice until they are healthy again. If all the clients
+// are unhealthy, the calls wait in the clients as the Client does.
+type Pool struct {
+	strategy PoolStrategy
+	members  []*poolMember
+	ring     []poolRingNode
+	index    uint64
+}
+
+// NewPool ...
+func NewPool(strategy PoolStrategy, clients []*Client) *Pool {
+	ret := &Pool{
+		strategy: strategy,
+		members:  make([]*poolMember, 0, len(clients)),
+		ring:     nil,
+		index:    0,
+	}
+
+	for _, client := range clients {
+		if client != nil {
+			ret.members = append(ret.members, &poolMember{client: client})
+		}
+	}
+
+	if strategy == PoolStrategyConsistentHash {
+		ret.ring = make([]poolRingNode, 0, len(ret.members)*poolVirtualNodes)
+		for i := 0; i < len(ret.members); i++ {
+			for j := 0; j < poolVirtualNodes; j++ {
+				ret.ring = append(ret.ring, poolRingNode{
+					hash: crc32.ChecksumIEEE(
+						[]byte(strconv.Itoa(i) + "#" + strconv.Itoa(j)),
+					),
+					index: i,
+				})
+			}
+		}
+		sort.Slice(ret.ring, func(i, j int) bool {
+			return ret.ring[i].hash < ret.ring[j].hash
+		})
+	}
+
+	return ret
+}
+
+func (p *Pool) healthyList(nowNS int64) []bool {
+	ret := make([]bool, len(p.members))
+	numOfHealthy := 0
+	for i := 0; i < len(p.members); i++ {
+		if p.members[i].client.isHealthy(nowNS) {
+			ret[i] = true
+			numOfHealthy++
+		}
+	}
+
+	// all the clients are unhealthy, choose from all of them
+	if numOfHealthy == 0 {
+		for i := 0; i < len(ret); i++ {
+			ret[i] = true
+		}
+	}
+
+	return ret
+}
+
+func (p *Pool) pick(args []interface{}) *poolMember {
+	if len(p.members) == 0 {
+		return nil
+	}
+
+	healthy := p.healthyList(base.TimeNow().UnixNano())
+
+	switch p.strategy {
+	case PoolStrategyLeastOutstanding:
+		ret := (*poolMember)(nil)
+		minOutstanding := int64(0)
+		for i := 0; i < len(p.members); i++ {
+			if healthy[i] {
+				outstanding := atomic.LoadInt64(&p.members[i].outstanding)
+				if ret == nil || outstanding < minOutstanding {
+					ret = p.members[i]
+					minOutstanding = outstanding
+				}
+			}
+		}
+		return ret
+	case PoolStrategyConsistentHash:
+		key := ""
+		if len(args) > 0 {
+			key = fmt.Sprint(args[0])
+		}
+		hash := crc32.ChecksumIEEE([]byte(key))
+		start := sort.Search(len(p.ring), func(i int) bool {
+			return p.ring[i].hash >= hash
+		})
+		for i := 0; i < len(p.ring); i++ {
+			node := p.ring[(start+i)%len(p.ring)]
+			if healthy[node.index] {
+				return p.members[node.index]
+			}
+		}
+		return nil
+	default:
+		start := atomic.AddUint64(&p.index, 1)
+		for i := 0; i < len(p.members); i++ {
+			index := int((start + uint64(i)) % uint64(len(p.members)))
+			if healthy[index] {
+				return p.members[index]
+			}
+		}
+		return nil
+	}
+}
+
+// Send sends the call to the client that is chosen by the strategy
+func (p *Pool) Send(
+	timeout time.Duration,
+	target string,
+	args ...interface{},
+) (interface{}, *base.Error) {
+	member := p.pick(args)
+	if member == nil {
+		return nil, base.ErrClientPoolEmpty
+	}
+
+	atomic.AddInt64(&member.outstanding, 1)
+	defer atomic.AddInt64(&member.outstanding, -1)
+	return member.client.Send(timeout, target, args...)
+}
+
+// Close closes all the clients
+func (p *Pool) Close() bool {
+	ret := true
+	for i := 0; i < len(p.members); i++ {
+		if !p.members[i].client.Close() {
+			ret = false
+		}
+	}
+	return ret
+}
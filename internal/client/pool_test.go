@@ -0,0 +1,191 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/adapter"
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+func testPoolClient(isHealthy bool) *Client {
+	ret := &Client{config: &Config{heartbeatTimeout: time.Minute}}
+	if isHealthy {
+		ret.conn = adapter.NewStreamConn(false, nil, nil)
+	}
+	return ret
+}
+
+func TestClient_isHealthy(t *testing.T) {
+	t.Run("conn is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := testPoolClient(false)
+		assert(v.isHealthy(base.TimeNow().UnixNano())).IsFalse()
+	})
+
+	t.Run("server is draining", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := testPoolClient(true)
+		v.draining = true
+		assert(v.isHealthy(base.TimeNow().UnixNano())).IsFalse()
+	})
+
+	t.Run("heartbeat timeout", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := testPoolClient(true)
+		nowNS := base.TimeNow().Add(2 * time.Minute).UnixNano()
+		assert(v.isHealthy(nowNS)).IsFalse()
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := testPoolClient(true)
+		assert(v.isHealthy(base.TimeNow().UnixNano())).IsTrue()
+	})
+}
+
+func TestNewPool(t *testing.T) {
+	t.Run("nil clients are ignored", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		c1 := testPoolClient(true)
+		v := NewPool(PoolStrategyRoundRobin, []*Client{nil, c1, nil})
+		assert(v.strategy).Equals(PoolStrategyRoundRobin)
+		assert(len(v.members)).Equals(1)
+		assert(v.members[0].client).Equals(c1)
+		assert(v.ring).IsNil()
+	})
+
+	t.Run("consistent hash", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewPool(PoolStrategyConsistentHash, []*Client{
+			testPoolClient(true),
+			testPoolClient(true),
+		})
+		assert(len(v.ring)).Equals(2 * poolVirtualNodes)
+		for i := 1; i < len(v.ring); i++ {
+			assert(v.ring[i-1].hash <= v.ring[i].hash).IsTrue()
+		}
+	})
+}
+
+func TestPool_pick(t *testing.T) {
+	t.Run("pool is empty", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewPool(PoolStrategyRoundRobin, nil)
+		assert(v.pick(nil)).IsNil()
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		c1 := testPoolClient(true)
+		c2 := testPoolClient(false)
+		c3 := testPoolClient(true)
+		v := NewPool(PoolStrategyRoundRobin, []*Client{c1, c2, c3})
+		assert(v.pick(nil).client).Equals(c3)
+		assert(v.pick(nil).client).Equals(c3)
+		assert(v.pick(nil).client).Equals(c1)
+		assert(v.pick(nil).client).Equals(c3)
+	})
+
+	t.Run("all the clients are unhealthy", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		c1 := testPoolClient(false)
+		c2 := testPoolClient(false)
+		v := NewPool(PoolStrategyRoundRobin, []*Client{c1, c2})
+		assert(v.pick(nil).client).Equals(c2)
+		assert(v.pick(nil).client).Equals(c1)
+	})
+
+	t.Run("least outstanding", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		c1 := testPoolClient(true)
+		c2 := testPoolClient(true)
+		c3 := testPoolClient(false)
+		v := NewPool(PoolStrategyLeastOutstanding, []*Client{c1, c2, c3})
+		assert(v.pick(nil).client).Equals(c1)
+		v.members[0].outstanding = 2
+		v.members[1].outstanding = 1
+		assert(v.pick(nil).client).Equals(c2)
+		v.members[1].outstanding = 3
+		assert(v.pick(nil).client).Equals(c1)
+	})
+
+	t.Run("consistent hash", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		clients := []*Client{
+			testPoolClient(true),
+			testPoolClient(true),
+			testPoolClient(true),
+		}
+		v := NewPool(PoolStrategyConsistentHash, clients)
+		counts := make(map[*Client]int)
+		for i := 0; i < 300; i++ {
+			key := []interface{}{int64(i)}
+			member := v.pick(key)
+			assert(v.pick(key)).Equals(member)
+			counts[member.client]++
+		}
+		assert(len(counts)).Equals(3)
+		assert(v.pick(nil)).Equals(v.pick([]interface{}{""}))
+
+		// the keys of the unhealthy client move, the others stay
+		before := make([]*Client, 300)
+		for i := 0; i < 300; i++ {
+			before[i] = v.pick([]interface{}{int64(i)}).client
+		}
+		clients[1].conn = nil
+		for i := 0; i < 300; i++ {
+			client := v.pick([]interface{}{int64(i)}).client
+			assert(client == clients[1]).IsFalse()
+			if before[i] != clients[1] {
+				assert(client).Equals(before[i])
+			}
+		}
+	})
+}
+
+func TestPool_Send(t *testing.T) {
+	t.Run("pool is empty", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewPool(PoolStrategyRoundRobin, nil)
+		assert(v.Send(time.Second, "#.user:SayHello", "kitty")).
+			Equals(nil, base.ErrClientPoolEmpty)
+	})
+
+	t.Run("test", func(t *testing.T) {
+		testServer := getTestServer()
+		defer testServer.Close()
+
+		assert := base.NewAssert(t)
+		for _, strategy := range []PoolStrategy{
+			PoolStrategyRoundRobin,
+			PoolStrategyLeastOutstanding,
+			PoolStrategyConsistentHash,
+		} {
+			v := NewPool(strategy, []*Client{
+				NewClient("ws", "127.0.0.1:8765", "", nil, 1024, 2048, nil),
+				NewClient("ws", "127.0.0.1:8765", "", nil, 1024, 2048, nil),
+			})
+			for i := 0; i < 4; i++ {
+				assert(v.Send(3*time.Second, "#.user:SayHello", "kitty")).
+					Equals("hello kitty", nil)
+			}
+			for i := 0; i < len(v.members); i++ {
+				assert(v.members[i].outstanding).Equals(int64(0))
+			}
+			assert(v.Close()).IsTrue()
+		}
+	})
+}
+
+func TestPool_Close(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewPool(PoolStrategyRoundRobin, []*Client{
+			NewClient("ws", "127.0.0.1:65432", "", nil, 1024, 2048, nil),
+			NewClient("ws", "127.0.0.1:65432", "", nil, 1024, 2048, nil),
+		})
+		assert(v.Close()).IsTrue()
+		assert(v.Close()).IsFalse()
+	})
+}
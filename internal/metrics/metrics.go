@@ -24,6 +24,11 @@ func GetMetrics(interval time.Duration) *Metrics {
 	}
 }
 
+// GetCPU returns the cpu usage between 0 and 1
+func (p *Metrics) GetCPU() float64 {
+	return p.cpu
+}
+
 type cpuTimesStat struct {
 	User   float64
 	System float64
@@ -88,6 +88,13 @@ func TestCalculateCPUPercent(t *testing.T) {
 	})
 }
 
+func TestMetrics_GetCPU(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert((&Metrics{cpu: 0.5}).GetCPU()).Equals(0.5)
+	})
+}
+
 func TestGetMetrics(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"encoding/binary"
 	"net"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -17,6 +18,12 @@ const (
 	channelActionReset    = 3
 	channelActionData     = 4
 	channelActionTimer    = 5
+
+	channelHeadSize      = 20
+	channelTimerSize     = 12
+	channelTimerInterval = 100 * time.Millisecond
+	channelKeepAlive     = time.Second
+	channelReadTimeout   = 3 * time.Second
 )
 
 // ConnectMeta ...
@@ -24,6 +31,7 @@ type ConnectMeta struct {
 	addr      string
 	tlsConfig *tls.Config
 	id        *base.GlobalID
+	kind      uint8
 }
 
 func connReadBytes(
@@ -43,7 +51,7 @@ func connReadBytes(
 	}
 
 	for pos < length {
-		n, e := conn.Read(b[pos:])
+		n, e := conn.Read(b[pos:length])
 
 		if e != nil {
 			return -1, base.ErrRouterConnRead.AddDebug(e.Error())
@@ -53,7 +61,7 @@ func connReadBytes(
 
 		if length == 2 && pos >= 2 {
 			length = int(binary.LittleEndian.Uint16(b))
-			if length > len(b) {
+			if length > len(b) || length < 4 {
 				return -1, base.ErrRouterConnProtocol
 			}
 		}
@@ -100,8 +108,12 @@ type Channel struct {
 	receiveSequence        uint64
 	receiveBuffer          [bufferSize]byte
 	receiveStreamGenerator *rpc.StreamGenerator
-	closeCH                chan bool
+	makeStream             *rpc.Stream
+	makeStreamPos          int
+	activeTimeNS           int64
 	orcManager             *base.ORCManager
+	runMu                  sync.Mutex
+	connMu                 sync.Mutex
 }
 
 // NewChannel ...
@@ -120,7 +132,9 @@ func NewChannel(
 		sendConfirmSequence:    0,
 		receiveSequence:        0,
 		receiveStreamGenerator: rpc.NewStreamGenerator(streamReceiver),
-		closeCH:                make(chan bool),
+		makeStream:             nil,
+		makeStreamPos:          0,
+		activeTimeNS:           base.TimeNow().UnixNano(),
 		orcManager:             base.NewORCManager(),
 	}
 
@@ -151,6 +165,13 @@ func NewChannel(
 	return ret
 }
 
+// isAvailable returns true if the channel has not been closed. The master
+// channel is running inside orcManager.Run, but the slave channel is only
+// opened, so both of the two status are accepted here.
+func (p *Channel) isAvailable() bool {
+	return !p.orcManager.IsClosing() && !p.orcManager.IsClosed()
+}
+
 func (p *Channel) runMasterThread(
 	index uint16,
 	connMeta *ConnectMeta,
@@ -177,16 +198,19 @@ func (p *Channel) runMasterThread(
 	binary.LittleEndian.PutUint16(buffer[4:], index)
 	binary.LittleEndian.PutUint64(buffer[6:], connMeta.id.GetID())
 	buffer[14] = p.needReset
+	buffer[15] = connMeta.kind
 	binary.LittleEndian.PutUint64(buffer[16:], p.sendConfirmSequence)
 	binary.LittleEndian.PutUint64(buffer[24:], p.receiveSequence)
 
 	// send init frame
 	if err := connWriteBytes(conn, time.Second, buffer); err != nil {
+		_ = conn.Close()
 		return err
 	}
 
 	// read response frame
 	if _, err := connReadBytes(conn, time.Second, buffer); err != nil {
+		_ = conn.Close()
 		return err
 	}
 
@@ -197,18 +221,16 @@ func (p *Channel) runMasterThread(
 		if rReceiveSequence < p.sendConfirmSequence ||
 			rReceiveSequence > p.sendPrepareSequence {
 			p.needReset = 1
+			_ = conn.Close()
 			return base.ErrRouterConnProtocol
 		}
 		sendSequence = rReceiveSequence
 	case channelActionReset:
-		p.needReset = 0
-		p.sendPrepareSequence = 0
-		p.sendConfirmSequence = 0
-		p.receiveSequence = 0
-		p.receiveStreamGenerator.Reset()
+		p.reset()
 		sendSequence = 0
 	default:
 		p.needReset = 1
+		_ = conn.Close()
 		return base.ErrRouterConnProtocol
 	}
 
@@ -221,6 +243,11 @@ func (p *Channel) runSlaveThread(
 	conn net.Conn,
 	initBuffer [32]byte,
 ) *base.Error {
+	// the master has redialed, so the old conn (if exists) is useless. close
+	// it and wait until it stops running before the sequences are touched.
+	p.closeConn()
+	p.runMu.Lock()
+
 	rNeedReset := initBuffer[14]
 	rSendConfirmSequence := binary.LittleEndian.Uint64(initBuffer[16:])
 	rReceiveSequence := binary.LittleEndian.Uint64(initBuffer[24:])
@@ -234,37 +261,66 @@ func (p *Channel) runSlaveThread(
 		binary.LittleEndian.PutUint64(initBuffer[24:], p.receiveSequence)
 		sendSequence = rReceiveSequence
 	} else {
-		p.needReset = 0
-		p.sendPrepareSequence = 0
-		p.sendConfirmSequence = 0
-		p.receiveSequence = 0
-		p.receiveStreamGenerator.Reset()
+		p.reset()
 		binary.LittleEndian.PutUint16(initBuffer[2:], channelActionReset)
 		sendSequence = 0
 	}
 
 	// send response frame
 	if err := connWriteBytes(conn, time.Second, initBuffer[:]); err != nil {
+		p.runMu.Unlock()
+		_ = conn.Close()
 		return err
 	}
 
 	// run async
 	go func() {
+		defer p.runMu.Unlock()
 		p.RunWithConn(sendSequence, conn)
 	}()
 
 	return nil
 }
 
+func (p *Channel) reset() {
+	p.needReset = 0
+	atomic.StoreUint64(&p.sendPrepareSequence, 0)
+	atomic.StoreUint64(&p.sendConfirmSequence, 0)
+	atomic.StoreUint64(&p.receiveSequence, 0)
+	p.receiveStreamGenerator.Reset()
+	p.makeStreamPos = 0
+}
+
+func (p *Channel) setConn(conn net.Conn) {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	p.conn = conn
+}
+
+func (p *Channel) closeConn() {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+}
+
+// IsActive ...
+func (p *Channel) IsActive(nowNS int64, timeout time.Duration) bool {
+	return nowNS-atomic.LoadInt64(&p.activeTimeNS) < int64(timeout)
+}
+
 // RunWithConn ...
 func (p *Channel) RunWithConn(sendSequence uint64, conn net.Conn) {
 	running := uint32(1)
 
 	isRunning := func() bool {
-		return p.orcManager.IsRunning() && atomic.LoadUint32(&running) == 1
+		return p.isAvailable() && atomic.LoadUint32(&running) == 1
 	}
 
-	p.conn = conn
+	p.setConn(conn)
+	atomic.StoreInt64(&p.activeTimeNS, base.TimeNow().UnixNano())
 
 	sendCH := make(chan uint64, numOfCacheBuffer)
 	for id := sendSequence + 1; id <= p.sendPrepareSequence; id++ {
@@ -281,7 +337,7 @@ func (p *Channel) RunWithConn(sendSequence uint64, conn net.Conn) {
 	}()
 
 	go func() {
-		if err := p.runRead(conn, isRunning); err != nil {
+		if err := p.runRead(conn, isRunning); err != nil && isRunning() {
 			p.streamReceiver.OnReceiveStream(rpc.MakeSystemErrorStream(err))
 		}
 		atomic.StoreUint32(&running, 0)
@@ -290,7 +346,7 @@ func (p *Channel) RunWithConn(sendSequence uint64, conn net.Conn) {
 	}()
 
 	go func() {
-		if err := p.runWrite(conn, isRunning, sendCH); err != nil {
+		if err := p.runWrite(conn, isRunning, sendCH); err != nil && isRunning() {
 			p.streamReceiver.OnReceiveStream(rpc.MakeSystemErrorStream(err))
 		}
 		atomic.StoreUint32(&running, 0)
@@ -301,7 +357,7 @@ func (p *Channel) RunWithConn(sendSequence uint64, conn net.Conn) {
 	<-waitCH
 	<-waitCH
 	<-waitCH
-	p.conn = nil
+	p.setConn(nil)
 }
 
 func (p *Channel) canPrepare() bool {
@@ -311,7 +367,8 @@ func (p *Channel) canPrepare() bool {
 }
 
 func (p *Channel) runMakeFrame(isRunning func() bool, sendCH chan uint64) {
-	stream := (*rpc.Stream)(nil)
+	ticker := time.NewTicker(channelTimerInterval)
+	defer ticker.Stop()
 
 	for {
 		// wait for valid frame id
@@ -323,70 +380,91 @@ func (p *Channel) runMakeFrame(isRunning func() bool, sendCH chan uint64) {
 			return
 		}
 
-		frameID := atomic.AddUint64(&p.sendPrepareSequence, 1)
+		// get first stream. the unfinished stream is kept in makeStream, so
+		// it can continue after reconnecting.
+		if p.makeStream == nil {
+			select {
+			case stream := <-p.streamCH:
+				if stream == nil {
+					continue
+				}
+				stream.BuildStreamCheck()
+				p.makeStream = stream
+				p.makeStreamPos = 0
+			case <-ticker.C:
+				continue
+			}
+		}
+
+		frameID := atomic.LoadUint64(&p.sendPrepareSequence) + 1
 
 		// init data frame
-		frameBuffer := p.sendBuffers[frameID%numOfCacheBuffer]
+		frameBuffer := p.sendBuffers[frameID%numOfCacheBuffer][:]
 		binary.LittleEndian.PutUint16(frameBuffer[2:], channelActionData)
 		binary.LittleEndian.PutUint64(frameBuffer[4:], frameID)
 
-		// gat first stream
-		if stream == nil {
-			stream = <-p.streamCH
-		}
-
 		// write stream to buffer
-		bufferPos := 20
-		streamPos := 0
-		for stream != nil && bufferSize-bufferPos >= rpc.StreamBlockSize {
-			peekBuf, finish := stream.PeekBufferSlice(
-				streamPos, bufferSize-bufferPos,
+		bufferPos := channelHeadSize
+		for p.makeStream != nil &&
+			bufferSize-bufferPos >= rpc.StreamBlockSize {
+			peekBuf, finish := p.makeStream.PeekBufferSlice(
+				p.makeStreamPos, bufferSize-bufferPos,
 			)
 			copyLen := copy(frameBuffer[bufferPos:], peekBuf)
-			streamPos += copyLen
+			p.makeStreamPos += copyLen
 			bufferPos += copyLen
 
 			if finish {
-				streamPos = 0
+				p.makeStream.Release()
+				p.makeStream = nil
+				p.makeStreamPos = 0
+
 				select {
-				case stream = <-p.streamCH:
+				case stream := <-p.streamCH:
+					if stream != nil {
+						stream.BuildStreamCheck()
+						p.makeStream = stream
+					}
 				default:
-					stream = nil
 				}
 			}
 		}
-		binary.LittleEndian.PutUint16(frameBuffer[:], uint16(bufferPos))
+		binary.LittleEndian.PutUint16(frameBuffer, uint16(bufferPos))
+		atomic.StoreUint64(&p.sendPrepareSequence, frameID)
 		sendCH <- frameID
 	}
 }
 
 func (p *Channel) runRead(conn net.Conn, isRunning func() bool) *base.Error {
 	for isRunning() {
-		n, err := connReadBytes(conn, 3*time.Second, p.receiveBuffer[:])
-		channelAction := binary.LittleEndian.Uint16(p.receiveBuffer[2:])
+		n, err := connReadBytes(conn, channelReadTimeout, p.receiveBuffer[:])
 
 		if !isRunning() {
 			return nil
 		}
 
-		rReceiveSequence := uint64(0)
-
 		if err != nil {
 			return err
-		} else if n < 20 {
-			return base.ErrRouterConnProtocol
-		} else if channelAction == channelActionData {
+		}
+
+		atomic.StoreInt64(&p.activeTimeNS, base.TimeNow().UnixNano())
+		rReceiveSequence := uint64(0)
+		channelAction := binary.LittleEndian.Uint16(p.receiveBuffer[2:])
+
+		if channelAction == channelActionData && n >= channelHeadSize {
 			rSendSequence := binary.LittleEndian.Uint64(p.receiveBuffer[4:])
 			rReceiveSequence = binary.LittleEndian.Uint64(p.receiveBuffer[12:])
 
 			// check rSendSequence
-			if rSendSequence != p.receiveSequence+1 {
+			if rSendSequence != atomic.LoadUint64(&p.receiveSequence)+1 {
 				p.needReset = 1
 				return base.ErrRouterConnProtocol
 			}
 
 			// process receiveBuffer
-			err = p.receiveStreamGenerator.OnBytes(p.receiveBuffer[20:])
+			err = p.receiveStreamGenerator.OnBytes(
+				p.receiveBuffer[channelHeadSize:n],
+			)
 			if err != nil {
 				p.needReset = 1
 				return err
@@ -394,14 +472,14 @@ func (p *Channel) runRead(conn net.Conn, isRunning func() bool) *base.Error {
 
 			// update receiveSequence
 			atomic.StoreUint64(&p.receiveSequence, rSendSequence)
-		} else if channelAction == channelActionTimer {
+		} else if channelAction == channelActionTimer && n >= channelTimerSize {
 			rReceiveSequence = binary.LittleEndian.Uint64(p.receiveBuffer[4:])
 		} else {
 			return base.ErrRouterConnProtocol
 		}
 
 		// check rReceiveSequence
-		if rReceiveSequence <= atomic.LoadUint64(&p.sendPrepareSequence) {
+		if rReceiveSequence > atomic.LoadUint64(&p.sendPrepareSequence) {
 			p.needReset = 1
 			return base.ErrRouterConnProtocol
 		}
@@ -420,35 +498,42 @@ func (p *Channel) runWrite(
 	isRunning func() bool,
 	sendCH chan uint64,
 ) *base.Error {
-	var timerBuffer [12]byte
-	binary.LittleEndian.PutUint16(timerBuffer[:], 12)
+	var timerBuffer [channelTimerSize]byte
+	binary.LittleEndian.PutUint16(timerBuffer[:], channelTimerSize)
 	binary.LittleEndian.PutUint16(timerBuffer[2:], channelActionTimer)
 	receiveSequence := uint64(0)
+	lastWriteNS := base.TimeNow().UnixNano()
 
-	timer := time.NewTimer(100 * time.Millisecond)
-	defer timer.Stop()
+	ticker := time.NewTicker(channelTimerInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case id := <-sendCH:
 			buffer := p.sendBuffers[id%numOfCacheBuffer][:]
+			buffer = buffer[:binary.LittleEndian.Uint16(buffer)]
 			receiveSequence = atomic.LoadUint64(&p.receiveSequence)
 			binary.LittleEndian.PutUint64(buffer[12:], receiveSequence)
 			if err := connWriteBytes(conn, time.Second, buffer); err != nil {
 				return err
 			}
-		case <-timer.C:
+			lastWriteNS = base.TimeNow().UnixNano()
+		case <-ticker.C:
 			if !isRunning() {
 				return nil
 			}
 
-			if v := atomic.LoadUint64(&p.receiveSequence); v > receiveSequence {
+			nowNS := base.TimeNow().UnixNano()
+			v := atomic.LoadUint64(&p.receiveSequence)
+			if v > receiveSequence || nowNS-lastWriteNS > int64(channelKeepAlive) {
+				receiveSequence = v
 				binary.LittleEndian.PutUint64(timerBuffer[4:], v)
 				if err := connWriteBytes(
 					conn, time.Second, timerBuffer[:],
 				); err != nil {
 					return err
 				}
+				lastWriteNS = nowNS
 			}
 		}
 	}
@@ -456,5 +541,7 @@ func (p *Channel) runWrite(
 
 // Close ...
 func (p *Channel) Close() {
-	p.orcManager.Close(nil, nil)
+	p.orcManager.Close(func() {
+		p.closeConn()
+	}, nil)
 }
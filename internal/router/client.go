@@ -20,6 +20,7 @@ type Client struct {
 func NewClient(
 	addr string,
 	tlsConfig *tls.Config,
+	kind uint8,
 	streamReceiver rpc.IStreamReceiver,
 ) (*Client, *base.Error) {
 	if streamReceiver == nil {
@@ -29,9 +30,6 @@ func NewClient(
 	id := base.NewGlobalID()
 
 	if id == nil {
-		streamReceiver.OnReceiveStream(rpc.MakeSystemErrorStream(
-			base.ErrRouterIDInvalid,
-		))
 		return nil, base.ErrRouterIDInvalid
 	}
 
@@ -43,6 +41,7 @@ func NewClient(
 			addr:      addr,
 			tlsConfig: tlsConfig,
 			id:        id,
+			kind:      kind,
 		}, streamReceiver),
 		orcManager: base.NewORCManager(),
 	}
@@ -54,9 +53,14 @@ func NewClient(
 	return ret, nil
 }
 
+// GetID ...
+func (p *Client) GetID() uint64 {
+	return p.slot.GetID()
+}
+
 // SendStream ...
-func (p *Client) SendStream(s *rpc.Stream) {
-	p.slot.SendStream(s)
+func (p *Client) SendStream(s *rpc.Stream) bool {
+	return p.slot.SendStream(s)
 }
 
 // Close ...
@@ -2,8 +2,11 @@ package router
 
 import (
 	"crypto/tls"
+	"encoding/binary"
+	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -11,6 +14,9 @@ import (
 	"github.com/rpccloud/rpc/internal/rpc"
 )
 
+const slotTimeout = 10 * time.Second
+
+// RouterKind ...
 type RouterKind int
 
 const (
@@ -21,12 +27,17 @@ const (
 
 // Router ...
 type Router struct {
-	kind        RouterKind
-	ln          net.Listener
-	clusterAddr string
-	upLink      string
-	streamHub   *rpc.StreamHub
-	orcManager  *base.ORCManager
+	kind           RouterKind
+	ln             net.Listener
+	clusterAddr    string
+	upLink         string
+	upLinkClient   *Client
+	slotMap        map[uint64]*Slot
+	processorSlots []*Slot
+	processorPos   uint64
+	streamHub      *rpc.StreamHub
+	orcManager     *base.ORCManager
+	mu             sync.Mutex
 }
 
 // NewRouter ...
@@ -38,12 +49,16 @@ func NewRouter(
 	logLevel base.ErrorLevel,
 ) *Router {
 	ret := &Router{
-		kind:        RouterKindRM,
-		ln:          nil,
-		clusterAddr: "",
-		upLink:      "",
-		streamHub:   nil,
-		orcManager:  base.NewORCManager(),
+		kind:           RouterKindRM,
+		ln:             nil,
+		clusterAddr:    "",
+		upLink:         "",
+		upLinkClient:   nil,
+		slotMap:        make(map[uint64]*Slot),
+		processorSlots: nil,
+		processorPos:   0,
+		streamHub:      nil,
+		orcManager:     base.NewORCManager(),
 	}
 
 	ret.streamHub = rpc.NewStreamHub(
@@ -157,21 +172,188 @@ func NewRouter(
 }
 
 func (p *Router) route(stream *rpc.Stream) {
+	switch stream.GetKind() {
+	case rpc.StreamKindRPCRequest:
+		slot := (*Slot)(nil)
+		if targetID := stream.GetTargetID(); targetID != 0 {
+			slot = p.getSlot(targetID)
+		} else {
+			slot = p.getProcessorSlot()
+		}
+
+		if slot != nil && slot.SendStream(stream) {
+			return
+		} else if p.sendToUpLink(stream) {
+			return
+		}
+
+		// the request can not be delivered, so reply an error to the gateway
+		stream.SetWritePosToBodyStart()
+		stream.SetKind(rpc.StreamKindRPCResponseError)
+		stream.WriteUint64(uint64(base.ErrRouterSlotNotFound.GetCode()))
+		stream.WriteString(base.ErrRouterSlotNotFound.GetMessage())
+		p.route(stream)
+	case rpc.StreamKindRPCResponseOK:
+		fallthrough
+	case rpc.StreamKindRPCResponseError:
+		fallthrough
+	case rpc.StreamKindRPCResponseItem:
+		fallthrough
+	case rpc.StreamKindRPCBoardCast:
+		if stream.GetKind() == rpc.StreamKindRPCBoardCast &&
+			stream.GetGatewayID() == 0 {
+			// published by Runtime.Publish, every gateway finds the
+			// subscribers of its own sessions
+			for _, slot := range p.getGatewaySlots() {
+				if gatewayStream := stream.Clone(); !slot.SendStream(
+					gatewayStream,
+				) {
+					gatewayStream.Release()
+				}
+			}
+			stream.Release()
+			return
+		}
 
+		if slot := p.getSlot(stream.GetGatewayID()); slot != nil &&
+			slot.SendStream(stream) {
+			return
+		} else if p.sendToUpLink(stream) {
+			return
+		}
+
+		errStream := rpc.MakeSystemErrorStream(
+			base.ErrRouterSlotNotFound.AddDebug(fmt.Sprintf(
+				"gateway %d not found", stream.GetGatewayID(),
+			)),
+		)
+		errStream.SetSessionID(stream.GetSessionID())
+		p.streamHub.OnReceiveStream(errStream)
+		stream.Release()
+	default:
+		stream.Release()
+	}
+}
+
+func (p *Router) getSlot(id uint64) *Slot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.slotMap[id]
+}
+
+func (p *Router) getGatewaySlots() []*Slot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ret := make([]*Slot, 0)
+	for _, slot := range p.slotMap {
+		if slot.kind == SlotKindGateway {
+			ret = append(ret, slot)
+		}
+	}
+	return ret
+}
+
+func (p *Router) getProcessorSlot() *Slot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if size := uint64(len(p.processorSlots)); size > 0 {
+		p.processorPos++
+		return p.processorSlots[p.processorPos%size]
+	}
+
+	return nil
+}
+
+func (p *Router) sendToUpLink(stream *rpc.Stream) bool {
+	p.mu.Lock()
+	upLinkClient := p.upLinkClient
+	p.mu.Unlock()
+
+	if upLinkClient != nil {
+		return upLinkClient.SendStream(stream)
+	}
+
+	return false
 }
 
 func (p *Router) onTimer(sequence uint64) {
+	// check the slots every second
+	if sequence%10 != 0 {
+		return
+	}
+
+	nowNS := base.TimeNow().UnixNano()
+	closeSlots := make([]*Slot, 0)
 
+	func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		for id, slot := range p.slotMap {
+			if !slot.IsActive(nowNS, slotTimeout) {
+				delete(p.slotMap, id)
+				closeSlots = append(closeSlots, slot)
+			}
+		}
+
+		if len(closeSlots) > 0 {
+			p.updateProcessorSlots()
+		}
+	}()
+
+	for _, slot := range closeSlots {
+		slot.Close()
+	}
 }
 
-func (p *Router) SetUpLink(upLink string) {
+// SetUpLink ...
+func (p *Router) SetUpLink(upLink string, tlsConfig *tls.Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.upLink == upLink {
+		return
+	}
 
+	if p.upLinkClient != nil {
+		p.upLinkClient.Close()
+		p.upLinkClient = nil
+	}
+
+	p.upLink = upLink
+
+	if upLink != "" {
+		// the uplink router sees this router as a gateway, so all the streams
+		// that can not be routed here will go to the uplink router.
+		if client, err := NewClient(
+			upLink, tlsConfig, SlotKindGateway, p,
+		); err != nil {
+			p.streamHub.OnReceiveStream(rpc.MakeSystemErrorStream(
+				err.AddDebug(upLink),
+			))
+		} else {
+			p.upLinkClient = client
+		}
+	}
 }
 
+// SetClusterAddr ...
 func (p *Router) SetClusterAddr(clusterAddr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clusterAddr = clusterAddr
+}
 
+// GetClusterAddr ...
+func (p *Router) GetClusterAddr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.clusterAddr
 }
 
+// Close ...
 func (p *Router) Close() bool {
 	return p.orcManager.Close(
 		func() {
@@ -182,51 +364,70 @@ func (p *Router) Close() bool {
 			}
 		},
 		func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+
+			for id, slot := range p.slotMap {
+				delete(p.slotMap, id)
+				slot.Close()
+			}
+			p.processorSlots = nil
+
+			if p.upLinkClient != nil {
+				p.upLinkClient.Close()
+				p.upLinkClient = nil
+			}
+
 			p.ln = nil
 			p.streamHub.Close()
 		},
 	)
 }
 
-// // OnReceiveStream ...
-// func (p *Router) OnReceiveStream(s *rpc.Stream) {
-// 	p.streamReceiver.OnReceiveStream(s)
-// }
+// OnReceiveStream ...
+func (p *Router) OnReceiveStream(s *rpc.Stream) {
+	p.streamHub.OnReceiveStream(s)
+}
 
 func (p *Router) addConn(conn net.Conn) *base.Error {
-	return nil
-	// var buffer [32]byte
-	// n, err := connReadBytes(conn, time.Second, buffer[:])
-
-	// if err != nil || n != 32 {
-	// 	_ = conn.Close()
-	// 	return err
-	// }
-
-	// if binary.LittleEndian.Uint16(buffer[2:]) != channelActionInit {
-	// 	_ = conn.Close()
-	// 	return base.ErrRouterConnProtocol
-	// }
-
-	// slotID := binary.LittleEndian.Uint64(buffer[6:])
-
-	// p.Lock()
-	// slot, ok := p.slotMap[slotID]
-	// if !ok {
-	// 	slot = NewSlot(nil, p)
-	// 	p.slotMap[slotID] = slot
-	// }
-	// p.Unlock()
-
-	// return slot.addSlaveConn(conn, buffer)
-}
+	var buffer [32]byte
+	n, err := connReadBytes(conn, time.Second, buffer[:])
 
-// func (p *Router) delSlot(id uint64) {
-// 	p.Lock()
-// 	defer p.Unlock()
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
 
-// 	if slot, ok := p.slotMap[id]; ok {
-// 		delete(p.slotMap, id)
-// 		slot.Close()
-// 	}
-// }
+	if n != 32 ||
+		binary.LittleEndian.Uint16(buffer[2:]) != channelActionInit {
+		_ = conn.Close()
+		return base.ErrRouterConnProtocol
+	}
+
+	slotID := binary.LittleEndian.Uint64(buffer[6:])
+	slotKind := buffer[15]
+
+	p.mu.Lock()
+	slot, ok := p.slotMap[slotID]
+	if !ok {
+		slot = NewSlot(nil, p)
+		slot.id = slotID
+		slot.kind = slotKind
+		p.slotMap[slotID] = slot
+		p.updateProcessorSlots()
+	}
+	p.mu.Unlock()
+
+	return slot.AddSlaveConn(conn, buffer)
+}
+
+// updateProcessorSlots must be called with p.mu locked
+func (p *Router) updateProcessorSlots() {
+	processorSlots := make([]*Slot, 0)
+	for _, slot := range p.slotMap {
+		if slot.kind == SlotKindProcessor {
+			processorSlots = append(processorSlots, slot)
+		}
+	}
+	p.processorSlots = processorSlots
+}
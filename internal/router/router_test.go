@@ -3,8 +3,188 @@ package router
 import (
 	"testing"
 	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/rpc"
 )
 
+func testWaitStream(receiver *rpc.TestStreamReceiver) *rpc.Stream {
+	for i := 0; i < 500; i++ {
+		if stream := receiver.GetStream(); stream != nil {
+			return stream
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil
+}
+
+func TestRouter_route(t *testing.T) {
+	t.Run("request and response", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		router := NewRouter("127.0.0.1:28888", nil, false, "", base.ErrorLogAll)
+		defer router.Close()
+
+		gatewayReceiver := rpc.NewTestStreamReceiver()
+		gateway, err := NewClient(
+			"127.0.0.1:28888", nil, SlotKindGateway, gatewayReceiver,
+		)
+		assert(err).IsNil()
+		defer gateway.Close()
+
+		processorReceiver := rpc.NewTestStreamReceiver()
+		processor, err := NewClient(
+			"127.0.0.1:28888", nil, SlotKindProcessor, processorReceiver,
+		)
+		assert(err).IsNil()
+		defer processor.Close()
+
+		// wait for processor slot
+		for i := 0; i < 300 && router.getProcessorSlot() == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		stream, _ := rpc.MakeInternalRequestStream(
+			false, 0, "#.user:SayHello", "@", "world",
+		)
+		stream.SetGatewayID(gateway.GetID())
+		stream.SetSessionID(1234)
+		stream.SetCallbackID(17)
+		assert(gateway.SendStream(stream)).IsTrue()
+
+		request := testWaitStream(processorReceiver)
+		assert(request).IsNotNil()
+		assert(request.GetKind()).Equals(uint8(rpc.StreamKindRPCRequest))
+		assert(request.GetGatewayID()).Equals(gateway.GetID())
+		assert(request.GetSessionID()).Equals(uint64(1234))
+		assert(request.GetCallbackID()).Equals(uint64(17))
+		assert(request.ReadString()).Equals("#.user:SayHello", nil)
+		assert(request.ReadString()).Equals("@", nil)
+		assert(request.ReadString()).Equals("world", nil)
+
+		request.SetWritePosToBodyStart()
+		request.SetKind(rpc.StreamKindRPCResponseOK)
+		request.WriteString("hello world")
+		assert(processor.SendStream(request)).IsTrue()
+
+		response := testWaitStream(gatewayReceiver)
+		assert(response).IsNotNil()
+		assert(response.GetSessionID()).Equals(uint64(1234))
+		assert(response.GetCallbackID()).Equals(uint64(17))
+		assert(rpc.ParseResponseStream(response)).Equals("hello world", nil)
+	})
+
+	t.Run("publish to all gateways", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		router := NewRouter("127.0.0.1:28891", nil, false, "", base.ErrorLogAll)
+		defer router.Close()
+
+		receivers := make([]*rpc.TestStreamReceiver, 2)
+		for i := 0; i < len(receivers); i++ {
+			receivers[i] = rpc.NewTestStreamReceiver()
+			gateway, err := NewClient(
+				"127.0.0.1:28891", nil, SlotKindGateway, receivers[i],
+			)
+			assert(err).IsNil()
+			defer gateway.Close()
+		}
+
+		processor, err := NewClient(
+			"127.0.0.1:28891", nil, SlotKindProcessor, rpc.NewTestStreamReceiver(),
+		)
+		assert(err).IsNil()
+		defer processor.Close()
+
+		// wait for the gateway slots
+		for i := 0; i < 300 && len(router.getGatewaySlots()) < 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCBoardCast)
+		stream.WriteString("#.test%Message")
+		stream.WriteString("hello")
+		assert(processor.SendStream(stream)).IsTrue()
+
+		for _, receiver := range receivers {
+			boardcast := testWaitStream(receiver)
+			assert(boardcast).IsNotNil()
+			assert(boardcast.GetKind()).Equals(uint8(rpc.StreamKindRPCBoardCast))
+			assert(boardcast.ReadString()).Equals("#.test%Message", nil)
+			assert(boardcast.ReadString()).Equals("hello", nil)
+		}
+	})
+
+	t.Run("processor not found", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		router := NewRouter("127.0.0.1:28889", nil, false, "", base.ErrorLogAll)
+		defer router.Close()
+
+		gatewayReceiver := rpc.NewTestStreamReceiver()
+		gateway, err := NewClient(
+			"127.0.0.1:28889", nil, SlotKindGateway, gatewayReceiver,
+		)
+		assert(err).IsNil()
+		defer gateway.Close()
+
+		stream, _ := rpc.MakeInternalRequestStream(
+			false, 0, "#.user:SayHello", "@", "world",
+		)
+		stream.SetGatewayID(gateway.GetID())
+		stream.SetCallbackID(17)
+		assert(gateway.SendStream(stream)).IsTrue()
+
+		response := testWaitStream(gatewayReceiver)
+		assert(response).IsNotNil()
+		assert(response.GetCallbackID()).Equals(uint64(17))
+		assert(rpc.ParseResponseStream(response)).
+			Equals(nil, base.ErrRouterSlotNotFound)
+	})
+
+	t.Run("large stream", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		router := NewRouter("127.0.0.1:28890", nil, false, "", base.ErrorLogAll)
+		defer router.Close()
+
+		gatewayReceiver := rpc.NewTestStreamReceiver()
+		gateway, _ := NewClient(
+			"127.0.0.1:28890", nil, SlotKindGateway, gatewayReceiver,
+		)
+		defer gateway.Close()
+
+		processorReceiver := rpc.NewTestStreamReceiver()
+		processor, _ := NewClient(
+			"127.0.0.1:28890", nil, SlotKindProcessor, processorReceiver,
+		)
+		defer processor.Close()
+
+		for i := 0; i < 300 && router.getProcessorSlot() == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		bytes := make([]byte, 3*bufferSize)
+		for i := 0; i < len(bytes); i++ {
+			bytes[i] = byte(i)
+		}
+
+		for i := 0; i < 16; i++ {
+			stream, _ := rpc.MakeInternalRequestStream(
+				false, 0, "#.user:SayHello", "@", bytes,
+			)
+			stream.SetGatewayID(gateway.GetID())
+			assert(gateway.SendStream(stream)).IsTrue()
+		}
+
+		for i := 0; i < 16; i++ {
+			request := testWaitStream(processorReceiver)
+			assert(request).IsNotNil()
+			_, _ = request.ReadString()
+			_, _ = request.ReadString()
+			assert(request.ReadBytes()).Equals(rpc.Bytes(bytes), nil)
+		}
+	})
+}
+
 func BenchmarkRouter_AddSlot(b *testing.B) {
 	ch := make(chan bool)
 
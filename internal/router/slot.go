@@ -3,6 +3,7 @@ package router
 import (
 	"encoding/binary"
 	"net"
+	"time"
 
 	"github.com/rpccloud/rpc/internal/base"
 	"github.com/rpccloud/rpc/internal/rpc"
@@ -14,8 +15,17 @@ const (
 	bufferSize          = 65536
 )
 
+const (
+	// SlotKindGateway the slot sends requests and receives responses
+	SlotKindGateway = uint8(1)
+	// SlotKindProcessor the slot receives requests and sends responses
+	SlotKindProcessor = uint8(2)
+)
+
 // Slot ...
 type Slot struct {
+	id           uint64
+	kind         uint8
 	dataCH       chan *rpc.Stream
 	dataChannels []*Channel
 }
@@ -26,10 +36,17 @@ func NewSlot(
 	streamReceiver rpc.IStreamReceiver,
 ) *Slot {
 	ret := &Slot{
+		id:           0,
+		kind:         0,
 		dataCH:       make(chan *rpc.Stream, 8192),
 		dataChannels: make([]*Channel, numOfChannelPerSlot),
 	}
 
+	if connectMeta != nil {
+		ret.id = connectMeta.id.GetID()
+		ret.kind = connectMeta.kind
+	}
+
 	for i := 0; i < numOfChannelPerSlot; i++ {
 		ret.dataChannels[i] = NewChannel(
 			uint16(i), connectMeta, ret.dataCH, streamReceiver,
@@ -39,6 +56,7 @@ func NewSlot(
 	return ret
 }
 
+// AddSlaveConn ...
 func (p *Slot) AddSlaveConn(conn net.Conn, initBuffer [32]byte) *base.Error {
 	index := binary.LittleEndian.Uint16(initBuffer[4:])
 	if index < numOfChannelPerSlot && conn != nil {
@@ -53,6 +71,27 @@ func (p *Slot) AddSlaveConn(conn net.Conn, initBuffer [32]byte) *base.Error {
 	return base.ErrRouterConnProtocol
 }
 
+// GetID ...
+func (p *Slot) GetID() uint64 {
+	return p.id
+}
+
+// GetKind ...
+func (p *Slot) GetKind() uint8 {
+	return p.kind
+}
+
+// IsActive ...
+func (p *Slot) IsActive(nowNS int64, timeout time.Duration) bool {
+	for i := 0; i < numOfChannelPerSlot; i++ {
+		if p.dataChannels[i].IsActive(nowNS, timeout) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // SendStream ...
 func (p *Slot) SendStream(s *rpc.Stream) (ret bool) {
 	defer func() {
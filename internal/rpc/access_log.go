@@ -0,0 +1,56 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+const accessLogMessage = "rpc-call"
+
+// AccessLogRedactor returns the args of actionPath that are written to the
+// access log, it can mask or drop the sensitive ones. It should not modify
+// args.
+type AccessLogRedactor func(actionPath string, args Array) Array
+
+type accessLog struct {
+	logger     base.ILogger
+	sampleRate float64
+	redactor   AccessLogRedactor
+}
+
+func (p *accessLog) isSampled() bool {
+	return isSampledAtRate(p.sampleRate)
+}
+
+func (p *accessLog) log(
+	sessionID uint64,
+	remoteAddr string,
+	actionPath string,
+	depth uint16,
+	from string,
+	args Array,
+	duration time.Duration,
+	err *base.Error,
+) {
+	errorCode := uint32(0)
+	if err != nil {
+		errorCode = err.GetCode()
+	}
+
+	fields := []base.LogField{
+		base.NewLogField(base.LogKeySessionID, sessionID),
+		base.NewLogField(base.LogKeyRemoteAddr, remoteAddr),
+		base.NewLogField(base.LogKeyActionPath, actionPath),
+		base.NewLogField(base.LogKeyDepth, depth),
+		base.NewLogField(base.LogKeyFrom, from),
+		base.NewLogField(base.LogKeyErrorCode, errorCode),
+		base.NewLogField(base.LogKeyDurationMS, duration.Seconds()*1000),
+	}
+
+	if p.redactor != nil {
+		fields = append(fields, base.NewLogField(base.LogKeyArgs, args))
+	}
+
+	p.logger.Log(base.ErrorLevelInfo, accessLogMessage, fields...)
+}
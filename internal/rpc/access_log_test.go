@@ -0,0 +1,181 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+func testAccessLog(
+	sampleRate float64,
+	redactor AccessLogRedactor,
+	addrResolver func(gatewayID uint64, sessionID uint64) string,
+	target string,
+	args ...interface{},
+) []map[string]interface{} {
+	helper := newTestProcessorHelper(
+		1,
+		16,
+		16,
+		2048,
+		nil,
+		3*time.Second,
+		[]*ServiceMeta{{
+			name: "test",
+			service: NewService(nil).
+				On("Login", func(rt Runtime, name String, _ String) Return {
+					return rt.Reply(rt.Call("#.test:Hello", name))
+				}).
+				On("Hello", func(rt Runtime, name String) Return {
+					return rt.Reply("Hello " + name)
+				}).
+				On("Error", func(rt Runtime) Return {
+					return rt.Reply(base.ErrAction)
+				}),
+			fileLine: "",
+		}},
+	)
+	defer helper.Close()
+
+	buffer := &bytes.Buffer{}
+	helper.GetProcessor().SetAccessLog(
+		base.NewLogger(base.ErrorLogAll, base.NewJSONLogEncoder(), buffer),
+		sampleRate,
+		redactor,
+	)
+	helper.GetProcessor().SetAddrResolver(addrResolver)
+
+	stream, _ := MakeInternalRequestStream(false, 0, target, "@", args...)
+	stream.SetSessionID(17)
+	helper.GetProcessor().PutStream(stream)
+	(<-helper.streamReceiver.streamCH).Release()
+
+	ret := make([]map[string]interface{}, 0)
+	for _, line := range strings.Split(buffer.String(), "\n") {
+		if line != "" {
+			record := make(map[string]interface{})
+			_ = json.Unmarshal([]byte(line), &record)
+			delete(record, "time")
+			delete(record, base.LogKeyDurationMS)
+			ret = append(ret, record)
+		}
+	}
+	return ret
+}
+
+func TestAccessLog_isSampled(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert((&accessLog{sampleRate: 1}).isSampled()).IsTrue()
+		assert((&accessLog{sampleRate: 2}).isSampled()).IsTrue()
+		assert((&accessLog{sampleRate: 0}).isSampled()).IsFalse()
+		assert((&accessLog{sampleRate: -1}).isSampled()).IsFalse()
+
+		sampled := 0
+		v := &accessLog{sampleRate: 0.5}
+		for i := 0; i < 10000; i++ {
+			if v.isSampled() {
+				sampled++
+			}
+		}
+		assert(sampled > 4000 && sampled < 6000).IsTrue()
+	})
+}
+
+func TestAccessLog_log(t *testing.T) {
+	t.Run("the call is logged", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(testAccessLog(
+			1, nil, nil, "#.test:Login", "kitty", "secret",
+		)).Equals([]map[string]interface{}{{
+			"level":      "info",
+			"msg":        "rpc-call",
+			"sessionID":  float64(0),
+			"remoteAddr": "",
+			"actionPath": "#.test:Hello",
+			"depth":      float64(1),
+			"from":       "@",
+			"errorCode":  float64(0),
+		}, {
+			"level":      "info",
+			"msg":        "rpc-call",
+			"sessionID":  float64(17),
+			"remoteAddr": "",
+			"actionPath": "#.test:Login",
+			"depth":      float64(0),
+			"from":       "@",
+			"errorCode":  float64(0),
+		}})
+	})
+
+	t.Run("the args are redacted", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		records := testAccessLog(
+			1,
+			func(actionPath string, args Array) Array {
+				if actionPath == "#.test:Login" {
+					return Array{args[0], "***"}
+				}
+				return args
+			},
+			func(gatewayID uint64, sessionID uint64) string {
+				if sessionID == 17 {
+					return "127.0.0.1:8080"
+				}
+				return ""
+			},
+			"#.test:Login",
+			"kitty",
+			"secret",
+		)
+		assert(len(records)).Equals(2)
+		assert(records[0]["args"]).Equals([]interface{}{"kitty"})
+		assert(records[1]["args"]).Equals([]interface{}{"kitty", "***"})
+		assert(records[1]["remoteAddr"]).Equals("127.0.0.1:8080")
+	})
+
+	t.Run("the error code is logged", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		records := testAccessLog(1, nil, nil, "#.test:Error")
+		assert(len(records)).Equals(1)
+		assert(records[0]["actionPath"]).Equals("#.test:Error")
+		assert(records[0]["errorCode"]).
+			Equals(float64(base.ErrAction.GetCode()))
+	})
+
+	t.Run("the action does not exist", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		records := testAccessLog(1, nil, nil, "#.test:None")
+		assert(len(records)).Equals(1)
+		assert(records[0]["actionPath"]).Equals("")
+		assert(records[0]["errorCode"]).
+			Equals(float64(base.ErrTargetNotExist.GetCode()))
+	})
+
+	t.Run("the call is not sampled", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(len(testAccessLog(0, nil, nil, "#.test:Hello", "kitty"))).
+			Equals(0)
+	})
+
+	t.Run("the duration is logged", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		buffer := &bytes.Buffer{}
+		v := &accessLog{
+			logger: base.NewLogger(
+				base.ErrorLogAll,
+				base.NewLogfmtLogEncoder(),
+				buffer,
+			),
+		}
+		v.log(17, "", "#.test:Eval", 0, "@", nil, 1500*time.Microsecond, nil)
+		assert(strings.HasSuffix(
+			buffer.String(),
+			" errorCode=0 durationMS=1.5\n",
+		)).IsTrue()
+	})
+}
@@ -0,0 +1,227 @@
+package rpc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+type rpcStubMeta struct {
+	name        string
+	body        string
+	path        string
+	structTypes []reflect.Type
+}
+
+func getStubArgType(reflectType reflect.Type) string {
+	// the runtime types only live on the server, the client sends the
+	// common types instead
+	switch reflectType {
+	case rtValueType:
+		return "rpc.Any"
+	case rtArrayType:
+		return "rpc.Array"
+	case rtMapType:
+		return "rpc.Map"
+	default:
+		// the struct is sent as a Map. The stub imports its package if it
+		// can, otherwise the caller passes the Map directly
+		if reflectType.Kind() == reflect.Struct {
+			if isStructImportable(reflectType) {
+				return getStructTypeString(reflectType)
+			}
+			return "rpc.Map"
+		}
+
+		return convertTypeToString(reflectType)
+	}
+}
+
+func getStubName(actionPath string) string {
+	sb := base.NewStringBuilder()
+	defer sb.Release()
+
+	segments := strings.FieldsFunc(
+		strings.TrimPrefix(actionPath, "#."),
+		func(r rune) bool {
+			return r == '.' || r == ':'
+		},
+	)
+
+	for _, segment := range segments {
+		sb.AppendString(strings.ToUpper(segment[:1]) + segment[1:])
+	}
+
+	ret := sb.String()
+	if c := ret[0]; c < 'A' || c > 'Z' {
+		return "X" + ret
+	}
+	return ret
+}
+
+func getStubStructTypes(action *rpcActionNode) []reflect.Type {
+	ret := make([]reflect.Type, 0)
+	for i := 1; i < len(action.argTypes); i++ {
+		if argType := action.argTypes[i]; argType.Kind() == reflect.Struct &&
+			isStructImportable(argType) {
+			ret = append(ret, argType)
+		}
+	}
+	return ret
+}
+
+// getStubBody returns the stub function of action. The arguments are typed,
+// but the reply stays rpc.Any, because the actions do not declare the type
+// of their replies.
+func getStubBody(name string, action *rpcActionNode) string {
+	sb := base.NewStringBuilder()
+	defer sb.Release()
+
+	argArray := []string{"p.timeout", strconv.Quote(action.path)}
+	paramArray := make([]string, 0)
+	for i := 1; i < len(action.argTypes); i++ {
+		argName := "arg" + strconv.Itoa(i-1)
+		argArray = append(argArray, argName)
+		paramArray = append(paramArray, fmt.Sprintf(
+			"\t%s %s,\n",
+			argName,
+			getStubArgType(action.argTypes[i]),
+		))
+	}
+
+	sb.AppendString(fmt.Sprintf("// %s calls %s\n", name, action.callString))
+	if len(paramArray) == 0 {
+		sb.AppendString(fmt.Sprintf("func (p *RPCClientStub) %s() ", name))
+	} else {
+		sb.AppendString(fmt.Sprintf(
+			"func (p *RPCClientStub) %s(\n%s) ",
+			name,
+			strings.Join(paramArray, ""),
+		))
+	}
+	sb.AppendString("(rpc.Any, *rpc.Error) {\n")
+	sb.AppendString(fmt.Sprintf(
+		"\treturn p.client.Send(%s)\n}",
+		strings.Join(argArray, ", "),
+	))
+
+	return sb.String()
+}
+
+func getStubMetas(actions []*rpcActionNode) ([]*rpcStubMeta, *base.Error) {
+	sortActions := make([]*rpcActionNode, 0, len(actions))
+	for _, action := range actions {
+		// ignore the hooks and the actions of #.$system
+		if !strings.Contains(action.path, "$") {
+			sortActions = append(sortActions, action)
+		}
+	}
+	sort.SliceStable(sortActions, func(i, j int) bool {
+		return strings.Compare(sortActions[i].path, sortActions[j].path) < 0
+	})
+
+	nameMap := make(map[string]string)
+	ret := make([]*rpcStubMeta, 0)
+
+	for _, action := range sortActions {
+		name := getStubName(action.path)
+		if conflict, ok := nameMap[name]; ok {
+			return nil, base.ErrClientStubDuplicateName.AddDebug(fmt.Sprintf(
+				"duplicate stub name %s (%s and %s)",
+				name,
+				conflict,
+				action.path,
+			))
+		}
+
+		nameMap[name] = action.path
+		ret = append(ret, &rpcStubMeta{
+			name:        name,
+			body:        getStubBody(name, action),
+			path:        action.path,
+			structTypes: getStubStructTypes(action),
+		})
+	}
+
+	return ret, nil
+}
+
+func buildClientStub(
+	pkgName string,
+	output string,
+	actions []*rpcActionNode,
+) *base.Error {
+	sb := base.NewStringBuilder()
+	defer sb.Release()
+	if metas, err := getStubMetas(actions); err == nil {
+		sb.AppendString("// Code generated by rpc. DO NOT EDIT.\n\n")
+		sb.AppendString(fmt.Sprintf("package %s\n\n", pkgName))
+		importMap := map[string]string{"github.com/rpccloud/rpc": ""}
+		for _, meta := range metas {
+			for _, structType := range meta.structTypes {
+				pkgPath := structType.PkgPath()
+				importMap[pkgPath] = getStructPkgAlias(pkgPath) + " "
+			}
+		}
+		pkgPaths := make([]string, 0, len(importMap))
+		for pkgPath := range importMap {
+			pkgPaths = append(pkgPaths, pkgPath)
+		}
+		sort.Strings(pkgPaths)
+
+		sb.AppendString("import (\n")
+		sb.AppendString("\t\"time\"\n\n")
+		for _, pkgPath := range pkgPaths {
+			sb.AppendString(fmt.Sprintf(
+				"\t%s\"%s\"\n", importMap[pkgPath], pkgPath,
+			))
+		}
+		sb.AppendString(")\n\n")
+
+		sb.AppendString(
+			"// RPCClientStub calls the actions with typed arguments. " +
+				"The replies\n// are rpc.Any, because the actions do not " +
+				"declare their reply types.\n",
+		)
+		sb.AppendString("type RPCClientStub struct {\n")
+		sb.AppendString("\tclient  *rpc.Client\n")
+		sb.AppendString("\ttimeout time.Duration\n")
+		sb.AppendString("}\n\n")
+
+		sb.AppendString("// NewRPCClientStub ...\n")
+		sb.AppendString("func NewRPCClientStub(\n")
+		sb.AppendString("\tclient *rpc.Client,\n")
+		sb.AppendString("\ttimeout time.Duration,\n")
+		sb.AppendString(") *RPCClientStub {\n")
+		sb.AppendString("\treturn &RPCClientStub{\n")
+		sb.AppendString("\t\tclient:  client,\n")
+		sb.AppendString("\t\ttimeout: timeout,\n")
+		sb.AppendString("\t}\n")
+		sb.AppendString("}\n")
+
+		for _, meta := range metas {
+			sb.AppendString(fmt.Sprintf("\n%s\n", meta.body))
+		}
+	} else {
+		return err
+	}
+
+	if err := os.MkdirAll(path.Dir(output), os.ModePerm); err != nil {
+		return base.ErrCacheMkdirAll
+	} else if err := ioutil.WriteFile(
+		output,
+		[]byte(sb.String()),
+		0666,
+	); err != nil {
+		return base.ErrCacheWriteFile
+	} else {
+		return nil
+	}
+}
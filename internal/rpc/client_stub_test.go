@@ -0,0 +1,186 @@
+package rpc
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+func getTestStubActions(services ...*ServiceMeta) []*rpcActionNode {
+	processor := NewProcessor(
+		1,
+		4,
+		4,
+		2048,
+		nil,
+		0,
+		services,
+		NewTestStreamReceiver(),
+	)
+	defer processor.Close()
+
+	ret := make([]*rpcActionNode, 0)
+	for _, action := range processor.actionsMap {
+		ret = append(ret, action)
+	}
+	return ret
+}
+
+func TestGetStubArgType(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStubArgType(rtValueType)).Equals("rpc.Any")
+		assert(getStubArgType(rtArrayType)).Equals("rpc.Array")
+		assert(getStubArgType(rtMapType)).Equals("rpc.Map")
+		assert(getStubArgType(boolType)).Equals("rpc.Bool")
+		assert(getStubArgType(stringType)).Equals("rpc.String")
+		assert(getStubArgType(reflect.TypeOf(3))).Equals("int")
+		assert(getStubArgType(reflect.TypeOf(StructTestUser{}))).
+			Equals("github_com_rpccloud_rpc_internal_rpc.StructTestUser")
+		assert(getStubArgType(reflect.TypeOf(struct{ Name String }{}))).
+			Equals("rpc.Map")
+	})
+}
+
+func TestGetStubName(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStubName("#.user:login")).Equals("UserLogin")
+		assert(getStubName("#.user.profile:Get")).Equals("UserProfileGet")
+		assert(getStubName("#.a_b:c_d")).Equals("A_bC_d")
+		assert(getStubName("#.0user:login")).Equals("X0userLogin")
+		assert(getStubName("#._user:login")).Equals("X_userLogin")
+	})
+}
+
+func TestGetStubMetas(t *testing.T) {
+	t.Run("system actions are ignored", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		metas, err := getStubMetas(getTestStubActions(&ServiceMeta{
+			name: "test",
+			service: NewService(nil).
+				On("$onMount", func(rt Runtime) Return {
+					return rt.Reply(true)
+				}).
+				On("Eval", func(rt Runtime) Return {
+					return rt.Reply(true)
+				}),
+			fileLine: "",
+		}))
+		assert(err).IsNil()
+		assert(len(metas)).Equals(1)
+		assert(metas[0].name, metas[0].path).Equals("TestEval", "#.test:Eval")
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStubMetas(getTestStubActions(&ServiceMeta{
+			name: "test",
+			service: NewService(nil).
+				On("eval", func(rt Runtime) Return {
+					return rt.Reply(true)
+				}).
+				On("Eval", func(rt Runtime) Return {
+					return rt.Reply(true)
+				}),
+			fileLine: "",
+		}))).Equals(
+			nil,
+			base.ErrClientStubDuplicateName.AddDebug(
+				"duplicate stub name TestEval (#.test:Eval and #.test:eval)",
+			),
+		)
+	})
+}
+
+func TestBuildClientStub(t *testing.T) {
+	_, curFile, _, _ := runtime.Caller(0)
+	curDir := path.Dir(curFile)
+	defer func() {
+		_ = os.RemoveAll(path.Join(path.Dir(curFile), "_tmp_"))
+	}()
+
+	testService := NewService(nil).
+		On("SayHello", func(rt Runtime, name String) Return {
+			return rt.Reply("hello " + name)
+		}).
+		On("Ping", func(rt Runtime) Return {
+			return rt.Reply(true)
+		}).
+		On("SetUser", func(rt Runtime, user StructTestUser) Return {
+			return rt.Reply(true)
+		}).
+		AddChildService("user", NewService(nil).On("Update", func(
+			rt Runtime,
+			id Uint64,
+			values RTMap,
+			tags RTArray,
+			any RTValue,
+		) Return {
+			return rt.Reply(true)
+		}), nil)
+
+	t.Run("duplicate name", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		filePath := path.Join(curDir, "_tmp_/duplicate-name.go")
+		assert(buildClientStub(
+			"pkgName",
+			filePath,
+			getTestStubActions(&ServiceMeta{
+				name: "test",
+				service: NewService(nil).
+					On("eval", func(rt Runtime) Return {
+						return rt.Reply(true)
+					}).
+					On("Eval", func(rt Runtime) Return {
+						return rt.Reply(true)
+					}),
+				fileLine: "",
+			}),
+		)).Equals(base.ErrClientStubDuplicateName.AddDebug(
+			"duplicate stub name TestEval (#.test:Eval and #.test:eval)",
+		))
+	})
+
+	t.Run("mkdir error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		filePath := path.Join(curDir, "client_stub_test.go", "error.go")
+		assert(buildClientStub("pkgName", filePath, nil)).
+			Equals(base.ErrCacheMkdirAll)
+	})
+
+	t.Run("write to file error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		filePath := path.Join(curDir, "_snapshot_")
+		assert(buildClientStub("pkgName", filePath, nil)).
+			Equals(base.ErrCacheWriteFile)
+	})
+
+	t.Run("actions is empty", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		filePath := path.Join(curDir, "_tmp_/test-client-stub-01.go")
+		snapPath := path.Join(curDir, "_snapshot_/test-client-stub-01.snapshot")
+		assert(buildClientStub("pkgName", filePath, nil)).IsNil()
+		assert(base.ReadFromFile(filePath)).Equals(base.ReadFromFile(snapPath))
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		filePath := path.Join(curDir, "_tmp_/test-client-stub-02.go")
+		snapPath := path.Join(curDir, "_snapshot_/test-client-stub-02.snapshot")
+		assert(buildClientStub(
+			"pkgName",
+			filePath,
+			getTestStubActions(&ServiceMeta{
+				name:     "test",
+				service:  testService,
+				fileLine: "",
+			}),
+		)).IsNil()
+		assert(base.ReadFromFile(filePath)).Equals(base.ReadFromFile(snapPath))
+	})
+}
@@ -156,6 +156,15 @@ func getFuncKind(fn reflect.Value) (string, *base.Error) {
 			case rtMapType:
 				sb.AppendByte(vkRTMap)
 			default:
+				// the anonymous structs have no name for the struct kind
+				if argType := fn.Type().In(i); argType.Kind() == reflect.Struct &&
+					argType.Name() != "" {
+					if _, err := getStructFields(argType); err == nil {
+						sb.AppendString(getStructKind(argType))
+						continue
+					}
+				}
+
 				return "", base.ErrActionHandler.AddDebug(
 					base.ConcatString(
 						"handler ",
@@ -231,6 +240,62 @@ func MakeSystemErrorStream(err *base.Error) *Stream {
 	return nil
 }
 
+// MakeRequestErrorStream turns the request stream into its error response,
+// the header is kept, so the response goes back to the caller of the request.
+func MakeRequestErrorStream(stream *Stream, err *base.Error) *Stream {
+	stream.ClearStatusBitIdentity()
+	stream.SetWritePosToBodyStart()
+	stream.SetKind(StreamKindRPCResponseError)
+	stream.WriteUint64(uint64(err.GetCode()))
+	stream.WriteString(err.GetMessage())
+	return stream
+}
+
+// MakeIdentityRequestStream returns a copy of the request stream whose body
+// starts with identity, so the processor behind the router can read it. The
+// identity that the request stream already carries is replaced, because it
+// can not be trusted. The request stream is released. If identity is nil or
+// can not be written, the request stream is returned without identity.
+func MakeIdentityRequestStream(stream *Stream, identity Any) *Stream {
+	hasIdentity := stream.HasStatusBitIdentity()
+	bodyPos := streamPosBody
+	if hasIdentity {
+		stream.SetReadPosToBodyStart()
+		if _, err := stream.Read(); err == nil {
+			bodyPos = stream.GetReadPos()
+		}
+		stream.SetReadPosToBodyStart()
+		stream.ClearStatusBitIdentity()
+	} else if identity == nil {
+		return stream
+	}
+
+	ret := NewStream()
+	copy((*ret.frames[0])[:streamPosBody], (*stream.frames[0])[:streamPosBody])
+	if identity != nil {
+		if ret.Write(identity) == StreamWriteOK {
+			ret.SetStatusBitIdentity()
+		} else if !hasIdentity {
+			ret.Release()
+			return stream
+		} else {
+			ret.SetWritePosToBodyStart()
+		}
+	}
+
+	for pos := bodyPos; ; {
+		buf, finish := stream.PeekBufferSlice(pos, streamBlockSize)
+		ret.PutBytes(buf)
+		pos += len(buf)
+		if finish {
+			break
+		}
+	}
+
+	stream.Release()
+	return ret
+}
+
 // MakeInternalRequestStream ...
 func MakeInternalRequestStream(
 	debug bool,
@@ -333,6 +333,40 @@ func TestGetFuncKind(t *testing.T) {
 		}
 		assert(getFuncKind(reflect.ValueOf(v))).Equals("BIUFSXAMVYZ", nil)
 	})
+
+	t.Run("struct argument", func(t *testing.T) {
+		v := func(rt Runtime, _ String, _ StructTestUser) Return {
+			return rt.Reply(true)
+		}
+		assert(getFuncKind(reflect.ValueOf(v))).Equals(
+			"S{github.com/rpccloud/rpc/internal/rpc.StructTestUser}",
+			nil,
+		)
+	})
+
+	t.Run("anonymous struct argument", func(t *testing.T) {
+		v := func(rt Runtime, _ struct{ Name String }) Return {
+			return rt.Reply(true)
+		}
+		assert(getFuncKind(reflect.ValueOf(v))).Equals(
+			"",
+			base.ErrActionHandler.AddDebug(
+				"handler 2nd argument type struct { Name string } "+
+					"is not supported",
+			))
+	})
+
+	t.Run("struct argument unsupported", func(t *testing.T) {
+		v := func(rt Runtime, _ structTestUnsupported) Return {
+			return rt.Reply(true)
+		}
+		assert(getFuncKind(reflect.ValueOf(v))).Equals(
+			"",
+			base.ErrActionHandler.AddDebug(
+				"handler 2nd argument type rpc.structTestUnsupported "+
+					"is not supported",
+			))
+	})
 }
 
 func TestConvertTypeToString(t *testing.T) {
@@ -382,6 +416,93 @@ func TestMakeSystemErrorStream(t *testing.T) {
 	})
 }
 
+func TestMakeRequestErrorStream(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, _ := MakeInternalRequestStream(false, 0, "#.test:Echo", "", 1)
+		v.SetCallbackID(15)
+		v.SetSessionID(20)
+		assert(MakeRequestErrorStream(v, base.ErrStream)).Equals(v)
+		assert(v.GetKind()).Equals(uint8(StreamKindRPCResponseError))
+		assert(v.GetCallbackID()).Equals(uint64(15))
+		assert(v.GetSessionID()).Equals(uint64(20))
+		assert(ParseResponseStream(v)).Equals(nil, base.ErrStream)
+	})
+
+	t.Run("identity bit is cleared", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, _ := MakeInternalRequestStream(false, 0, "#.test:Echo", "", 1)
+		v = MakeIdentityRequestStream(v, "user")
+		assert(MakeRequestErrorStream(v, base.ErrStream).HasStatusBitIdentity()).
+			IsFalse()
+	})
+}
+
+func TestMakeIdentityRequestStream(t *testing.T) {
+	t.Run("identity is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, _ := MakeInternalRequestStream(false, 0, "#.test:Echo", "", 1)
+		assert(MakeIdentityRequestStream(v, nil)).Equals(v)
+		assert(v.HasStatusBitIdentity()).IsFalse()
+	})
+
+	t.Run("identity is not supported", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, _ := MakeInternalRequestStream(false, 0, "#.test:Echo", "", 1)
+		assert(MakeIdentityRequestStream(v, make(chan bool))).Equals(v)
+		assert(v.HasStatusBitIdentity()).IsFalse()
+	})
+
+	t.Run("identity has been set", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, identity := range []Any{"user", nil, make(chan bool)} {
+			v, _ := MakeInternalRequestStream(false, 0, "#.test:Echo", "", 1)
+			v = MakeIdentityRequestStream(v, "admin")
+			ret := MakeIdentityRequestStream(v, identity)
+			if s, ok := identity.(string); ok {
+				assert(ret.HasStatusBitIdentity()).IsTrue()
+				assert(ret.Read()).Equals(s, nil)
+			} else {
+				assert(ret.HasStatusBitIdentity()).IsFalse()
+			}
+			assert(ret.ReadString()).Equals("#.test:Echo", nil)
+			assert(ret.ReadString()).Equals("", nil)
+			assert(ret.ReadInt64()).Equals(int64(1), nil)
+			assert(ret.IsReadFinish()).IsTrue()
+			ret.Release()
+		}
+	})
+
+	t.Run("identity can not be read", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewStream()
+		v.SetStatusBitIdentity()
+		v.PutBytes([]byte{0xFF})
+		ret := MakeIdentityRequestStream(v, nil)
+		assert(ret.HasStatusBitIdentity()).IsFalse()
+		assert(ret.GetBuffer()[streamPosBody:]).Equals([]byte{0xFF})
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, arg := range []string{"", "hello", base.GetRandString(3000)} {
+			v, _ := MakeInternalRequestStream(false, 0, "#.test:Echo", "@", arg)
+			v.SetCallbackID(15)
+			v.SetSessionID(20)
+			ret := MakeIdentityRequestStream(v, Map{"name": "user"})
+			assert(ret.HasStatusBitIdentity()).IsTrue()
+			assert(ret.GetCallbackID()).Equals(uint64(15))
+			assert(ret.GetSessionID()).Equals(uint64(20))
+			assert(ret.Read()).Equals(Map{"name": "user"}, nil)
+			assert(ret.ReadString()).Equals("#.test:Echo", nil)
+			assert(ret.ReadString()).Equals("@", nil)
+			assert(ret.ReadString()).Equals(arg, nil)
+			assert(ret.IsReadFinish()).IsTrue()
+			ret.Release()
+		}
+	})
+}
+
 func TestMakeInternalRequestStream(t *testing.T) {
 	t.Run("write error", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -30,15 +30,44 @@ func getFuncBodyByKind(name string, kind string) (string, *base.Error) {
 	argArray := []string{"rt"}
 	typeArray := []string{"rpc.Runtime"}
 
+	tokens, ok := parseFuncKind(kind)
+	if !ok {
+		return "", base.ErrFnCacheIllegalKindString.
+			AddDebug(fmt.Sprintf("illegal kind %s", kind))
+	}
+
 	if kind == "" {
 		sb.AppendString("\tif !stream.IsReadFinish() {\n\t\treturn -1\n\t}")
 	} else {
-		for idx, c := range kind {
+		for idx, token := range tokens {
 			argName := "arg" + strconv.Itoa(idx)
 			argArray = append(argArray, argName)
 			callString := ""
 
-			switch c {
+			condString := " else if"
+
+			if idx == 0 {
+				condString = "\tif"
+			}
+
+			if token[0] == vkStructBegin {
+				structType, ok := getStructTypeByKind(token)
+				if !ok {
+					return "", base.ErrFnCacheIllegalKindString.
+						AddDebug(fmt.Sprintf("illegal kind %s", kind))
+				}
+				typeArray = append(typeArray, getStructTypeString(structType))
+				sb.AppendString(fmt.Sprintf(
+					"%s %s, ok := %s(stream); !ok {\n\t\treturn %d\n\t}",
+					condString,
+					argName,
+					getStructFuncName("readStruct", structType),
+					idx+1,
+				))
+				continue
+			}
+
+			switch token[0] {
 			case vkBool:
 				callString = "stream.ReadBool()"
 				typeArray = append(typeArray, "rpc.Bool")
@@ -77,12 +106,6 @@ func getFuncBodyByKind(name string, kind string) (string, *base.Error) {
 					AddDebug(fmt.Sprintf("illegal kind %s", kind))
 			}
 
-			condString := " else if"
-
-			if idx == 0 {
-				condString = "\tif"
-			}
-
 			sb.AppendString(fmt.Sprintf(
 				"%s %s, err := %s; err != nil {\n\t\treturn %d\n\t}",
 				condString,
@@ -147,8 +170,31 @@ func buildFuncCache(pkgName string, output string, kinds []string) *base.Error {
 	sb := base.NewStringBuilder()
 	defer sb.Release()
 	if metas, err := getFuncMetas(kinds); err == nil {
+		structTypes := getStructTypesByKinds(kinds)
+
 		sb.AppendString(fmt.Sprintf("package %s\n\n", pkgName))
-		sb.AppendString("import \"github.com/rpccloud/rpc\"\n\n")
+		if len(structTypes) == 0 {
+			sb.AppendString("import \"github.com/rpccloud/rpc\"\n\n")
+		} else {
+			importMap := map[string]string{"github.com/rpccloud/rpc": ""}
+			for _, structType := range structTypes {
+				pkgPath := structType.PkgPath()
+				importMap[pkgPath] = getStructPkgAlias(pkgPath) + " "
+			}
+			pkgPaths := make([]string, 0, len(importMap))
+			for pkgPath := range importMap {
+				pkgPaths = append(pkgPaths, pkgPath)
+			}
+			sort.Strings(pkgPaths)
+
+			sb.AppendString("import (\n")
+			for _, pkgPath := range pkgPaths {
+				sb.AppendString(fmt.Sprintf(
+					"\t%s\"%s\"\n", importMap[pkgPath], pkgPath,
+				))
+			}
+			sb.AppendString(")\n\n")
+		}
 
 		sb.AppendString("type rpcCache struct{}\n\n")
 
@@ -181,6 +227,12 @@ func buildFuncCache(pkgName string, output string, kinds []string) *base.Error {
 				fmt.Sprintf("%s\n\n", meta.body),
 			)
 		}
+
+		for _, structType := range structTypes {
+			sb.AppendString(
+				fmt.Sprintf("%s\n\n", getStructDecoderBody(structType)),
+			)
+		}
 	} else {
 		return err
 	}
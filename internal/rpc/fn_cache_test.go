@@ -3,6 +3,7 @@ package rpc
 import (
 	"os"
 	"path"
+	"reflect"
 	"runtime"
 	"testing"
 
@@ -31,6 +32,15 @@ func TestBuildFuncCache(t *testing.T) {
 			Equals(base.ErrFnCacheIllegalKindString.AddDebug("illegal kind T"))
 	})
 
+	t.Run("illegal struct kind", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		filePath := path.Join(curDir, "_tmp_/illegal-struct-kind.go")
+		assert(buildFuncCache("pkgName", filePath, []string{"S{a.B}"})).
+			Equals(base.ErrFnCacheIllegalKindString.AddDebug("illegal kind S{a.B}"))
+		assert(buildFuncCache("pkgName", filePath, []string{"S{a.B"})).
+			Equals(base.ErrFnCacheIllegalKindString.AddDebug("illegal kind S{a.B"))
+	})
+
 	t.Run("mkdir error", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		filePath := path.Join(curDir, "fn_cache_test.go", "error.go")
@@ -68,6 +78,17 @@ func TestBuildFuncCache(t *testing.T) {
 		})).IsNil()
 		assert(base.ReadFromFile(filePath)).Equals(base.ReadFromFile(snapPath))
 	})
+
+	t.Run("struct kinds", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		filePath := path.Join(curDir, "_tmp_/test-cache-03.go")
+		snapPath := path.Join(curDir, "_snapshot_/test-cache-03.snapshot")
+		userKind := getStructKind(reflect.TypeOf(StructTestUser{}))
+		assert(buildFuncCache("pkgName", filePath, []string{
+			"S", userKind, "S" + userKind + "I",
+		})).IsNil()
+		assert(base.ReadFromFile(filePath)).Equals(base.ReadFromFile(snapPath))
+	})
 }
 
 type testFuncCache struct{}
@@ -208,7 +229,35 @@ func (p *testFuncCache) Get(fnString string) ActionCacheFunc {
 				return 0
 			}
 		}
+	case "{github.com/rpccloud/rpc/internal/rpc.StructTestUser}":
+		return func(rt Runtime, stream *Stream, fn interface{}) int {
+			if arg0, ok := testReadStructTestUser(stream); !ok {
+				return 1
+			} else if !stream.IsReadFinish() {
+				return -1
+			} else {
+				stream.SetWritePosToBodyStart()
+				fn.(func(Runtime, StructTestUser) Return)(rt, arg0)
+				return 0
+			}
+		}
 	default:
 		return nil
 	}
 }
+
+// testReadStructTestUser is the same as the generated decoder, but only
+// decodes the name of the user
+func testReadStructTestUser(stream *Stream) (StructTestUser, bool) {
+	readPos := stream.GetReadPos()
+	if m, err := stream.ReadMap(); err == nil {
+		ret := StructTestUser{}
+		if v, ok := m["name"]; !ok || v == nil {
+			return ret, true
+		} else if ret.Name, ok = v.(String); ok {
+			return ret, true
+		}
+	}
+	stream.SetReadPos(readPos)
+	return StructTestUser{}, false
+}
@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"container/heap"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -27,26 +28,75 @@ var (
 			`(\$onMount)|(\$onUnmount)|(\$onTimer)$`,
 	)
 	emptyEvalBack   = func(*Stream) {}
-	emptyEvalFinish = func(*rpcThread) {}
+	emptyEvalFinish = func(*rpcThread) *Stream { return nil }
 )
 
+// rpcQueueItem is a stream that waits for a free thread
+type rpcQueueItem struct {
+	stream   *Stream
+	priority uint8
+	seq      uint64
+	timeNS   int64
+	index    int
+}
+
+// rpcStreamQueue is a heap of the queued streams, the stream with the highest
+// priority is the first, and the earlier one is the first if they have the
+// same priority.
+type rpcStreamQueue []*rpcQueueItem
+
+func (p rpcStreamQueue) Len() int {
+	return len(p)
+}
+
+func (p rpcStreamQueue) Less(i, j int) bool {
+	if p[i].priority != p[j].priority {
+		return p[i].priority > p[j].priority
+	}
+	return p[i].seq < p[j].seq
+}
+
+func (p rpcStreamQueue) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+	p[i].index = i
+	p[j].index = j
+}
+
+func (p *rpcStreamQueue) Push(x interface{}) {
+	item := x.(*rpcQueueItem)
+	item.index = len(*p)
+	*p = append(*p, item)
+}
+
+func (p *rpcStreamQueue) Pop() interface{} {
+	old := *p
+	n := len(old)
+	ret := old[n-1]
+	old[n-1] = nil
+	ret.index = -1
+	*p = old[:n-1]
+	return ret
+}
+
 type rpcActionNode struct {
-	path       string
-	meta       *ActionMeta
-	service    *rpcServiceNode
-	cacheFN    ActionCacheFunc
-	reflectFn  reflect.Value
-	callString string
-	argTypes   []reflect.Type
-	indicator  *base.PerformanceIndicator
+	path         string
+	meta         *ActionMeta
+	service      *rpcServiceNode
+	cacheFN      ActionCacheFunc
+	reflectFn    reflect.Value
+	callString   string
+	argTypes     []reflect.Type
+	indicator    *base.PerformanceIndicator
+	interceptors []Interceptor
 }
 
 type rpcServiceNode struct {
-	path    string
-	addMeta *ServiceMeta
-	depth   uint16
-	isMount bool
-	config  Map
+	path         string
+	addMeta      *ServiceMeta
+	depth        uint16
+	isMount      bool
+	config       Map
+	interceptors []Interceptor
 }
 
 func (p *rpcServiceNode) GetConfig(key string) (Any, bool) {
@@ -75,8 +125,24 @@ type Processor struct {
 	freeCHArray       []chan *rpcThread
 	readThreadPos     uint64
 	writeThreadPos    uint64
+	runningCount      int64
+	freeCount         int
+	waitQueue         rpcStreamQueue
+	waitSeq           uint64
+	maxQueueSize      int
+	queueTimeout      time.Duration
+	rejectedCount     int64
+	waitMu            sync.Mutex
 	panicSubscription *base.PanicSubscription
 	streamReceiver    IStreamReceiver
+	systemServices    Array
+	systemActions     Array
+	identityResolver  func(gatewayID uint64, sessionID uint64) Any
+	interceptors      []Interceptor
+	spanExporter      SpanExporter
+	traceSampleRate   float64
+	accessLog         *accessLog
+	addrResolver      func(gatewayID uint64, sessionID uint64) string
 	closeCH           chan string
 	mu                sync.Mutex
 	muSystemInvoke    sync.Mutex
@@ -124,6 +190,13 @@ func NewProcessor(
 			freeCHArray:    nil,
 			readThreadPos:  0,
 			writeThreadPos: 0,
+			runningCount:   0,
+			freeCount:      size,
+			waitQueue:      nil,
+			waitSeq:        0,
+			maxQueueSize:   0,
+			queueTimeout:   0,
+			rejectedCount:  0,
 			streamReceiver: streamReceiver,
 			closeCH:        make(chan string),
 		}
@@ -159,12 +232,17 @@ func NewProcessor(
 			}
 		}
 
+		// describe the mounted services for #.$system
+		ret.systemServices = buildSystemServices(ret.servicesMap)
+		ret.systemActions = buildSystemActions(ret.actionsMap)
+
 		// start config update
 		go func() {
 			counter := uint64(0)
 			evalTime := base.TimeNow()
 			for atomic.LoadInt32(&ret.status) == processorStatusRunning {
 				time.Sleep(50 * time.Millisecond)
+				ret.rejectTimeoutStreams()
 				timeNow := base.TimeNow()
 				if timeNow.Sub(evalTime) > time.Second {
 					evalTime = timeNow
@@ -187,14 +265,12 @@ func NewProcessor(
 				ret,
 				closeTimeout,
 				threadBufferSize,
-				func(thread *rpcThread) {
+				func(thread *rpcThread) *Stream {
 					defer func() {
 						_ = recover()
 					}()
-					freeCHArray[atomic.AddUint64(
-						&ret.writeThreadPos,
-						1,
-					)%freeGroups] <- thread
+					atomic.AddInt64(&ret.runningCount, -1)
+					return ret.releaseThread(thread)
 				},
 			)
 			ret.threads[i] = thread
@@ -205,6 +281,123 @@ func NewProcessor(
 	}
 }
 
+// SetIdentityResolver sets the function that finds the identity of the
+// session, Runtime.GetIdentity uses it. It should be called before the
+// processor receives the streams.
+func (p *Processor) SetIdentityResolver(
+	identityResolver func(gatewayID uint64, sessionID uint64) Any,
+) {
+	p.identityResolver = identityResolver
+}
+
+// GetActionArgTypes returns the types of the args of the action, the
+// rpc.Runtime is not included. ok is false if the action does not exist.
+func (p *Processor) GetActionArgTypes(actionPath string) ([]string, bool) {
+	actionNode, ok := p.actionsMap[actionPath]
+	if !ok {
+		return nil, false
+	}
+
+	ret := make([]string, 0, len(actionNode.argTypes))
+	for i := 1; i < len(actionNode.argTypes); i++ {
+		ret = append(ret, convertTypeToString(actionNode.argTypes[i]))
+	}
+	return ret, true
+}
+
+// SetInterceptors sets the interceptors that run before all the actions, they
+// run before the interceptors of the services. It should be called before the
+// processor receives the streams.
+func (p *Processor) SetInterceptors(interceptors []Interceptor) {
+	p.interceptors = interceptors
+}
+
+// SetSpanExporter sets the exporter of the spans of the actions, nil disables
+// it. sampleRate (0 to 1) of the traces that start in the processor are
+// sampled, the requests that join a trace follow it. It should be called
+// before the processor receives the streams.
+func (p *Processor) SetSpanExporter(
+	exporter SpanExporter,
+	sampleRate float64,
+) {
+	p.spanExporter = exporter
+	p.traceSampleRate = sampleRate
+}
+
+// SetAccessLog logs sampleRate (0 to 1) of the calls to logger, nil disables
+// it. The args are logged only if redactor is not nil. It should be called
+// before the processor receives the streams.
+func (p *Processor) SetAccessLog(
+	logger base.ILogger,
+	sampleRate float64,
+	redactor AccessLogRedactor,
+) {
+	if logger == nil {
+		p.accessLog = nil
+	} else {
+		p.accessLog = &accessLog{
+			logger:     logger,
+			sampleRate: sampleRate,
+			redactor:   redactor,
+		}
+	}
+}
+
+// SetAddrResolver sets the function that finds the remote address of the
+// session for the access log. It should be called before the processor
+// receives the streams.
+func (p *Processor) SetAddrResolver(
+	addrResolver func(gatewayID uint64, sessionID uint64) string,
+) {
+	p.addrResolver = addrResolver
+}
+
+// SetQueue sets the queue of the streams that wait for a free thread. The
+// stream is replied base.ErrServerBusy at once if the queue has maxQueueSize
+// streams, or after it waits longer than queueTimeout. 0 does not limit them.
+// It should be called before the processor receives the streams.
+func (p *Processor) SetQueue(maxQueueSize int, queueTimeout time.Duration) {
+	p.waitMu.Lock()
+	defer p.waitMu.Unlock()
+
+	p.maxQueueSize = maxQueueSize
+	p.queueTimeout = queueTimeout
+}
+
+// GetQueueDepth returns the number of the streams that wait for a free thread
+func (p *Processor) GetQueueDepth() int {
+	p.waitMu.Lock()
+	defer p.waitMu.Unlock()
+
+	return p.waitQueue.Len()
+}
+
+// GetRejectedCount returns the number of the streams that are replied
+// base.ErrServerBusy
+func (p *Processor) GetRejectedCount() int64 {
+	return atomic.LoadInt64(&p.rejectedCount)
+}
+
+// GetActionIndicators returns the performance indicators of the callable
+// actions, keyed by the action path. It returns nil if p is closed.
+func (p *Processor) GetActionIndicators() map[string]*base.PerformanceIndicator {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if atomic.LoadInt32(&p.status) != processorStatusRunning {
+		return nil
+	}
+
+	ret := make(map[string]*base.PerformanceIndicator)
+	for path, action := range p.actionsMap {
+		// the hooks can not be called by the clients
+		if !strings.Contains(path, ":$") {
+			ret[path] = action.indicator
+		}
+	}
+	return ret
+}
+
 // Close ...
 func (p *Processor) Close() bool {
 	p.mu.Lock()
@@ -268,6 +461,14 @@ func (p *Processor) Close() bool {
 		p.unmount("#")
 		p.systemThread.Close()
 
+		// the queued streams are not evaluated
+		p.waitMu.Lock()
+		for _, item := range p.waitQueue {
+			item.stream.Release()
+		}
+		p.waitQueue = nil
+		p.waitMu.Unlock()
+
 		for _, freeCH := range p.freeCHArray {
 			close(freeCH)
 		}
@@ -283,7 +484,143 @@ func (p *Processor) Close() bool {
 	return false
 }
 
-// PutStream ...
+// GetRunningCount returns the number of the streams that are being evaluated
+func (p *Processor) GetRunningCount() int64 {
+	return atomic.LoadInt64(&p.runningCount)
+}
+
+// acquireThread returns a free thread for the stream. If all the threads are
+// busy, the stream is put in the queue and it returns nil thread, the thread
+// that is released evaluates it later, and the streams with higher priority
+// are evaluated first. It does not block. It returns base.ErrServerBusy if
+// the queue is full, and returns false if p is closed.
+func (p *Processor) acquireThread(
+	stream *Stream,
+) (*rpcThread, bool, *base.Error) {
+	p.waitMu.Lock()
+
+	if atomic.LoadInt32(&p.status) != processorStatusRunning {
+		p.waitMu.Unlock()
+		return nil, false, nil
+	}
+
+	if p.freeCount > 0 {
+		p.freeCount--
+		p.waitMu.Unlock()
+		return <-p.freeCHArray[atomic.AddUint64(
+			&p.readThreadPos,
+			1,
+		)%freeGroups], true, nil
+	}
+
+	if p.maxQueueSize > 0 && p.waitQueue.Len() >= p.maxQueueSize {
+		p.waitMu.Unlock()
+		return nil, false, base.ErrServerBusy
+	}
+
+	heap.Push(&p.waitQueue, &rpcQueueItem{
+		stream:   stream,
+		priority: stream.GetPriority(),
+		seq:      p.waitSeq,
+		timeNS:   base.TimeNow().UnixNano(),
+	})
+	p.waitSeq++
+	p.waitMu.Unlock()
+	return nil, true, nil
+}
+
+// releaseThread returns the first queued stream that the thread evaluates
+// next. If there is no queued stream, the thread is put back to the free
+// threads and it returns nil.
+func (p *Processor) releaseThread(thread *rpcThread) *Stream {
+	nowNS := base.TimeNow().UnixNano()
+
+	for {
+		p.waitMu.Lock()
+
+		if p.waitQueue.Len() == 0 ||
+			atomic.LoadInt32(&p.status) != processorStatusRunning {
+			p.waitMu.Unlock()
+			p.freeThread(thread)
+			return nil
+		}
+
+		item := heap.Pop(&p.waitQueue).(*rpcQueueItem)
+		timeout := p.isQueueTimeout(item, nowNS)
+		p.waitMu.Unlock()
+
+		if !timeout {
+			atomic.AddInt64(&p.runningCount, 1)
+			return item.stream
+		}
+
+		p.rejectStream(item.stream)
+	}
+}
+
+// freeThread puts the thread back to the free threads
+func (p *Processor) freeThread(thread *rpcThread) {
+	p.waitMu.Lock()
+	p.freeCount++
+	p.waitMu.Unlock()
+	p.freeCHArray[atomic.AddUint64(
+		&p.writeThreadPos,
+		1,
+	)%freeGroups] <- thread
+}
+
+// isQueueTimeout returns true if the item waits longer than queueTimeout, p
+// must be locked by waitMu
+func (p *Processor) isQueueTimeout(item *rpcQueueItem, nowNS int64) bool {
+	return p.queueTimeout > 0 && nowNS-item.timeNS > int64(p.queueTimeout)
+}
+
+// rejectTimeoutStreams replies base.ErrServerBusy to the queued streams that
+// wait longer than queueTimeout, even if no thread is released
+func (p *Processor) rejectTimeoutStreams() {
+	nowNS := base.TimeNow().UnixNano()
+	timeoutStreams := make([]*Stream, 0)
+
+	p.waitMu.Lock()
+	if p.queueTimeout <= 0 {
+		p.waitMu.Unlock()
+		return
+	}
+	waitQueue := p.waitQueue[:0]
+	for _, item := range p.waitQueue {
+		if p.isQueueTimeout(item, nowNS) {
+			timeoutStreams = append(timeoutStreams, item.stream)
+		} else {
+			item.index = len(waitQueue)
+			waitQueue = append(waitQueue, item)
+		}
+	}
+	for i := len(waitQueue); i < len(p.waitQueue); i++ {
+		p.waitQueue[i] = nil
+	}
+	if len(timeoutStreams) > 0 {
+		p.waitQueue = waitQueue
+		heap.Init(&p.waitQueue)
+	}
+	p.waitMu.Unlock()
+
+	for _, stream := range timeoutStreams {
+		p.rejectStream(stream)
+	}
+}
+
+// rejectStream replies base.ErrServerBusy to the stream
+func (p *Processor) rejectStream(stream *Stream) {
+	atomic.AddInt64(&p.rejectedCount, 1)
+	p.streamReceiver.OnReceiveStream(
+		MakeRequestErrorStream(stream, base.ErrServerBusy),
+	)
+}
+
+// PutStream evaluates the stream in a free thread. If all the threads are
+// busy, the stream waits in the queue, and the streams with higher priority
+// are evaluated first. It does not block the caller. If the queue is full,
+// the stream is replied base.ErrServerBusy at once and it returns false.
 func (p *Processor) PutStream(stream *Stream) (ret bool) {
 	defer func() {
 		if v := recover(); v != nil {
@@ -291,21 +628,28 @@ func (p *Processor) PutStream(stream *Stream) (ret bool) {
 		}
 	}()
 
-	if thread := <-p.freeCHArray[atomic.AddUint64(
-		&p.readThreadPos,
-		1,
-	)%freeGroups]; thread != nil {
+	if stream == nil {
+		return false
+	}
+
+	thread, accepted, err := p.acquireThread(stream)
+	if err != nil {
+		p.rejectStream(stream)
+		return false
+	}
+
+	if thread != nil {
+		atomic.AddInt64(&p.runningCount, 1)
 		success := thread.PutStream(stream)
 		if !success {
-			p.freeCHArray[atomic.AddUint64(
-				&p.writeThreadPos,
-				1,
-			)%freeGroups] <- thread
+			// the thread is closed, so the processor is being closed
+			atomic.AddInt64(&p.runningCount, -1)
+			p.freeThread(thread)
 		}
 		return success
 	}
 
-	return false
+	return accepted
 }
 
 // BuildCache ...
@@ -316,7 +660,11 @@ func (p *Processor) BuildCache(pkgName string, path string) *base.Error {
 	if atomic.LoadInt32(&p.status) == processorStatusRunning {
 		retMap := make(map[string]bool)
 		for _, action := range p.actionsMap {
-			if fnTypeString, err := getFuncKind(action.reflectFn); err == nil {
+			// the struct types that can not be imported are decoded by
+			// reflection, so their kinds are not put in the cache
+			if fnTypeString, err := getFuncKind(
+				action.reflectFn,
+			); err == nil && isFuncKindImportable(fnTypeString) {
 				retMap[fnTypeString] = true
 			}
 		}
@@ -332,6 +680,23 @@ func (p *Processor) BuildCache(pkgName string, path string) *base.Error {
 	return base.ErrProcessorIsNotRunning
 }
 
+// BuildClientStub writes the typed client stubs of the mounted actions
+func (p *Processor) BuildClientStub(pkgName string, path string) *base.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if atomic.LoadInt32(&p.status) == processorStatusRunning {
+		actions := make([]*rpcActionNode, 0, len(p.actionsMap))
+		for _, action := range p.actionsMap {
+			actions = append(actions, action)
+		}
+
+		return buildClientStub(pkgName, path, actions)
+	}
+
+	return base.ErrProcessorIsNotRunning
+}
+
 func (p *Processor) onTimer(sequence uint64) {
 	for key := range p.servicesMap {
 		p.invokeSystemAction(key, "$onTimer", sequence)
@@ -366,7 +731,8 @@ func (p *Processor) mountNode(
 ) *base.Error {
 	if nodeMeta == nil {
 		return base.ErrProcessorNodeMetaIsNil
-	} else if !nodeNameRegex.MatchString(nodeMeta.name) {
+	} else if !nodeNameRegex.MatchString(nodeMeta.name) &&
+		!isSystemServiceMeta(parentServiceNodePath, nodeMeta) {
 		return base.ErrServiceName.
 			AddDebug(fmt.Sprintf("service name %s is illegal", nodeMeta.name)).
 			AddDebug(nodeMeta.fileLine)
@@ -397,11 +763,20 @@ func (p *Processor) mountNode(
 				))
 		} else {
 			node := &rpcServiceNode{
-				path:    servicePath,
-				addMeta: nodeMeta,
-				depth:   parentNode.depth + 1,
-				config:  Map{},
-				isMount: false,
+				path:         servicePath,
+				addMeta:      nodeMeta,
+				depth:        parentNode.depth + 1,
+				config:       Map{},
+				isMount:      false,
+				interceptors: parentNode.interceptors,
+			}
+
+			// the children inherit the interceptors of the parent
+			if len(nodeMeta.service.interceptors) > 0 {
+				node.interceptors = append(
+					append([]Interceptor{}, parentNode.interceptors...),
+					nodeMeta.service.interceptors...,
+				)
 			}
 
 			for k, v := range nodeMeta.service.config {
@@ -502,8 +877,14 @@ func (p *Processor) mountAction(
 				strings.Join(argStrings, ", "),
 				convertTypeToString(returnType),
 			),
-			argTypes:  argTypes,
-			indicator: base.NewPerformanceIndicator(),
+			argTypes:     argTypes,
+			indicator:    base.NewPerformanceIndicator(),
+			interceptors: nil,
+		}
+
+		// the hooks are not called by the clients, so they are not intercepted
+		if !strings.HasPrefix(meta.name, "$") {
+			actionNode.interceptors = serviceNode.interceptors
 		}
 
 		if fnCache != nil {
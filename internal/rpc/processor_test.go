@@ -1,12 +1,16 @@
 package rpc
 
 import (
+	"container/heap"
 	"fmt"
 	"os"
 	"path"
 	"reflect"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -280,6 +284,186 @@ func TestNewProcessor(t *testing.T) {
 	})
 }
 
+func TestProcessor_SetIdentityResolver(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			1,
+			32,
+			32,
+			2048,
+			nil,
+			5*time.Second,
+			nil,
+			NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+
+		assert(processor.identityResolver).IsNil()
+		processor.SetIdentityResolver(func(_ uint64, _ uint64) Any {
+			return "user"
+		})
+		assert(processor.identityResolver(0, 0)).Equals("user")
+	})
+}
+
+func TestProcessor_GetActionArgTypes(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			1,
+			32,
+			32,
+			2048,
+			nil,
+			5*time.Second,
+			[]*ServiceMeta{{
+				name: "test",
+				service: NewService(nil).
+					On("Ping", func(rt Runtime) Return {
+						return rt.Reply(true)
+					}).
+					On("Eval", func(rt Runtime, a Uint64, b Bytes) Return {
+						return rt.Reply(true)
+					}),
+				fileLine: "",
+			}},
+			NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+
+		assert(processor.GetActionArgTypes("#.test:None")).Equals(
+			[]string(nil),
+			false,
+		)
+		assert(processor.GetActionArgTypes("#.test:Ping")).Equals(
+			[]string{},
+			true,
+		)
+		assert(processor.GetActionArgTypes("#.test:Eval")).Equals(
+			[]string{"rpc.Uint64", "rpc.Bytes"},
+			true,
+		)
+	})
+}
+
+func TestProcessor_SetInterceptors(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			1,
+			32,
+			32,
+			2048,
+			nil,
+			5*time.Second,
+			nil,
+			NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+
+		assert(processor.interceptors).IsNil()
+		processor.SetInterceptors([]Interceptor{
+			func(_ Runtime, _ string, _ string, _ Array) *base.Error {
+				return nil
+			},
+		})
+		assert(len(processor.interceptors)).Equals(1)
+	})
+}
+
+func TestProcessor_mountInterceptors(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fn := func(_ Runtime, _ string, _ string, _ Array) *base.Error {
+			return nil
+		}
+		handler := func(rt Runtime) Return {
+			return rt.Reply(true)
+		}
+		child := NewService(nil).On("Eval", handler).Use(fn, fn)
+		service := NewService(nil).
+			On("Eval", handler).
+			On("$onMount", handler).
+			AddChildService("child", child, nil).
+			Use(fn)
+		processor := NewProcessor(
+			1,
+			32,
+			32,
+			2048,
+			nil,
+			5*time.Second,
+			[]*ServiceMeta{{
+				name:     "test",
+				service:  service,
+				fileLine: "",
+			}},
+			NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+
+		assert(len(processor.servicesMap[rootName].interceptors)).Equals(0)
+		assert(len(processor.servicesMap["#.test"].interceptors)).Equals(1)
+		assert(len(processor.servicesMap["#.test.child"].interceptors)).
+			Equals(3)
+		assert(len(processor.actionsMap["#.test:Eval"].interceptors)).
+			Equals(1)
+		assert(len(processor.actionsMap["#.test:$onMount"].interceptors)).
+			Equals(0)
+		assert(len(processor.actionsMap["#.test.child:Eval"].interceptors)).
+			Equals(3)
+	})
+}
+
+func TestProcessor_GetActionIndicators(t *testing.T) {
+	t.Run("processor is closed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			1,
+			32,
+			32,
+			2048,
+			nil,
+			5*time.Second,
+			nil,
+			NewTestStreamReceiver(),
+		)
+		processor.Close()
+		assert(processor.GetActionIndicators()).IsNil()
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			1,
+			32,
+			32,
+			2048,
+			nil,
+			5*time.Second,
+			[]*ServiceMeta{{
+				name: "test",
+				service: NewService(nil).
+					On("$onMount", func(rt Runtime) Return {
+						return rt.Reply(true)
+					}).
+					On("SayHello", func(rt Runtime) Return {
+						return rt.Reply(true)
+					}),
+				fileLine: "",
+			}},
+			NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+
+		indicators := processor.GetActionIndicators()
+		assert(len(indicators)).Equals(1)
+		assert(indicators["#.test:SayHello"]).
+			Equals(processor.actionsMap["#.test:SayHello"].indicator)
+	})
+}
+
 func TestProcessor_Close(t *testing.T) {
 	t.Run("processor is not running", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -366,6 +550,356 @@ func TestProcessor_Close(t *testing.T) {
 	})
 }
 
+func TestProcessor_GetRunningCount(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		startCH := make(chan bool)
+		finishCH := make(chan bool)
+		streamReceiver := NewTestStreamReceiver()
+		processor := NewProcessor(
+			256,
+			2,
+			3,
+			2048,
+			nil,
+			time.Second,
+			[]*ServiceMeta{{
+				name: "test",
+				service: NewService(nil).
+					On("Eval", func(rt Runtime) Return {
+						startCH <- true
+						<-finishCH
+						return rt.Reply(true)
+					}),
+				fileLine: "",
+			}},
+			streamReceiver,
+		)
+		defer processor.Close()
+
+		assert(processor.GetRunningCount()).Equals(int64(0))
+		stream, _ := MakeInternalRequestStream(false, 0, "#.test:Eval", "")
+		assert(processor.PutStream(stream)).IsTrue()
+		<-startCH
+		assert(processor.GetRunningCount()).Equals(int64(1))
+		finishCH <- true
+		<-streamReceiver.streamCH
+		for processor.GetRunningCount() != 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestRpcStreamQueue(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := rpcStreamQueue(nil)
+		heap.Push(&v, &rpcQueueItem{priority: 1, seq: 0})
+		heap.Push(&v, &rpcQueueItem{priority: 3, seq: 1})
+		heap.Push(&v, &rpcQueueItem{priority: 3, seq: 2})
+		heap.Push(&v, &rpcQueueItem{priority: 0, seq: 3})
+		heap.Push(&v, &rpcQueueItem{priority: 255, seq: 4})
+		assert(v.Len()).Equals(5)
+
+		seqList := make([]uint64, 0)
+		for v.Len() > 0 {
+			seqList = append(seqList, heap.Pop(&v).(*rpcQueueItem).seq)
+		}
+		assert(seqList).Equals([]uint64{4, 1, 2, 0, 3})
+	})
+}
+
+// setTestProcessorBusy makes all the threads of the processor busy, it
+// returns the function that restores them
+func setTestProcessorBusy(processor *Processor) func() {
+	processor.waitMu.Lock()
+	freeCount := processor.freeCount
+	processor.freeCount = 0
+	processor.waitMu.Unlock()
+
+	return func() {
+		processor.waitMu.Lock()
+		processor.freeCount += freeCount
+		processor.waitMu.Unlock()
+	}
+}
+
+func TestProcessor_acquireThread(t *testing.T) {
+	newTestProcessor := func() *Processor {
+		return NewProcessor(
+			256,
+			2,
+			3,
+			2048,
+			nil,
+			time.Second,
+			nil,
+			NewTestStreamReceiver(),
+		)
+	}
+
+	t.Run("processor is closed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := newTestProcessor()
+		processor.Close()
+		assert(processor.acquireThread(NewStream())).Equals(nil, false, nil)
+	})
+
+	t.Run("thread is free", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := newTestProcessor()
+		defer processor.Close()
+		thread, accepted, err := processor.acquireThread(NewStream())
+		assert(thread).IsNotNil()
+		assert(accepted).IsTrue()
+		assert(err).IsNil()
+		assert(processor.freeCount).Equals(255)
+		assert(processor.releaseThread(thread)).IsNil()
+		assert(processor.freeCount).Equals(256)
+	})
+
+	t.Run("the stream is queued", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := newTestProcessor()
+		defer processor.Close()
+		defer setTestProcessorBusy(processor)()
+
+		stream := NewStream()
+		stream.SetPriority(7)
+		assert(processor.acquireThread(stream)).Equals(nil, true, nil)
+		assert(processor.GetQueueDepth()).Equals(1)
+		assert(processor.waitQueue[0].stream).Equals(stream)
+		assert(processor.waitQueue[0].priority).Equals(uint8(7))
+	})
+
+	t.Run("queue is full", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := newTestProcessor()
+		defer processor.Close()
+		defer setTestProcessorBusy(processor)()
+		processor.SetQueue(1, 0)
+
+		assert(processor.acquireThread(NewStream())).Equals(nil, true, nil)
+		assert(processor.acquireThread(NewStream())).
+			Equals(nil, false, base.ErrServerBusy)
+		assert(processor.GetQueueDepth()).Equals(1)
+	})
+}
+
+func TestProcessor_releaseThread(t *testing.T) {
+	t.Run("the streams with higher priority are first", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+
+		thread, _, _ := processor.acquireThread(NewStream())
+		restore := setTestProcessorBusy(processor)
+		for i, priority := range []uint8{1, 5, 3, 5} {
+			stream := NewStream()
+			stream.SetCallbackID(uint64(i))
+			stream.SetPriority(priority)
+			processor.acquireThread(stream)
+		}
+
+		cbIDList := make([]uint64, 0)
+		for stream := processor.releaseThread(thread); stream != nil; {
+			cbIDList = append(cbIDList, stream.GetCallbackID())
+			stream = processor.releaseThread(thread)
+		}
+		assert(cbIDList).Equals([]uint64{1, 3, 2, 0})
+		assert(processor.GetRunningCount()).Equals(int64(4))
+		atomic.StoreInt64(&processor.runningCount, 0)
+
+		restore()
+		assert(processor.freeCount).Equals(256)
+	})
+
+	t.Run("the queued stream times out", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		streamReceiver := NewTestStreamReceiver()
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, streamReceiver,
+		)
+		defer processor.Close()
+
+		thread, _, _ := processor.acquireThread(NewStream())
+		restore := setTestProcessorBusy(processor)
+		processor.SetQueue(0, time.Hour)
+		stream := NewStream()
+		stream.SetCallbackID(12)
+		processor.acquireThread(stream)
+		processor.SetQueue(0, time.Nanosecond)
+		time.Sleep(time.Millisecond)
+
+		assert(processor.releaseThread(thread)).IsNil()
+		assert(processor.GetRejectedCount()).Equals(int64(1))
+		backStream := streamReceiver.GetStream()
+		assert(backStream.GetCallbackID()).Equals(uint64(12))
+		assert(ParseResponseStream(backStream)).Equals(nil, base.ErrServerBusy)
+
+		restore()
+		assert(processor.freeCount).Equals(256)
+	})
+
+	t.Run("processor is closed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, NewTestStreamReceiver(),
+		)
+		thread, _, _ := processor.acquireThread(NewStream())
+		setTestProcessorBusy(processor)
+		processor.acquireThread(NewStream())
+		atomic.StoreInt32(&processor.status, processorStatusClosed)
+		assert(processor.releaseThread(thread)).IsNil()
+		assert(processor.GetQueueDepth()).Equals(1)
+		atomic.StoreInt32(&processor.status, processorStatusRunning)
+		processor.Close()
+		assert(processor.GetQueueDepth()).Equals(0)
+	})
+}
+
+func TestProcessor_rejectTimeoutStreams(t *testing.T) {
+	t.Run("queue timeout is 0", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+		defer setTestProcessorBusy(processor)()
+		processor.acquireThread(NewStream())
+		processor.rejectTimeoutStreams()
+		assert(processor.GetQueueDepth()).Equals(1)
+		assert(processor.GetRejectedCount()).Equals(int64(0))
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		streamReceiver := NewTestStreamReceiver()
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, streamReceiver,
+		)
+		defer processor.Close()
+		defer setTestProcessorBusy(processor)()
+
+		processor.SetQueue(0, time.Hour)
+		for i := 0; i < 5; i++ {
+			stream := NewStream()
+			stream.SetCallbackID(uint64(i))
+			stream.SetPriority(uint8(i % 2))
+			processor.acquireThread(stream)
+			if i == 2 {
+				processor.waitMu.Lock()
+				for _, item := range processor.waitQueue {
+					item.timeNS -= int64(2 * time.Hour)
+				}
+				processor.waitMu.Unlock()
+			}
+		}
+
+		processor.rejectTimeoutStreams()
+		assert(processor.GetQueueDepth()).Equals(2)
+		assert(processor.GetRejectedCount()).Equals(int64(3))
+		cbIDList := make([]uint64, 0)
+		for i := 0; i < 3; i++ {
+			stream := streamReceiver.GetStream()
+			cbIDList = append(cbIDList, stream.GetCallbackID())
+		}
+		sort.Slice(cbIDList, func(i, j int) bool {
+			return cbIDList[i] < cbIDList[j]
+		})
+		assert(cbIDList).Equals([]uint64{0, 1, 2})
+
+		// the heap is still in order
+		processor.waitMu.Lock()
+		assert(heap.Pop(&processor.waitQueue).(*rpcQueueItem).stream.
+			GetCallbackID()).Equals(uint64(3))
+		assert(heap.Pop(&processor.waitQueue).(*rpcQueueItem).stream.
+			GetCallbackID()).Equals(uint64(4))
+		processor.waitMu.Unlock()
+	})
+}
+
+func TestProcessor_SetSpanExporter(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+		assert(processor.spanExporter).IsNil()
+		exporter := &testSpanExporter{}
+		processor.SetSpanExporter(exporter, 0.5)
+		assert(processor.spanExporter).Equals(exporter)
+		assert(processor.traceSampleRate).Equals(0.5)
+	})
+}
+
+func TestProcessor_SetAccessLog(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+		assert(processor.accessLog).IsNil()
+		logger := base.NewLogger(base.ErrorLogAll, nil)
+		processor.SetAccessLog(logger, 0.5, nil)
+		assert(processor.accessLog).Equals(&accessLog{
+			logger:     logger,
+			sampleRate: 0.5,
+			redactor:   nil,
+		})
+		processor.SetAccessLog(nil, 1, nil)
+		assert(processor.accessLog).IsNil()
+	})
+}
+
+func TestProcessor_SetAddrResolver(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+		assert(processor.addrResolver).IsNil()
+		processor.SetAddrResolver(func(_ uint64, _ uint64) string {
+			return "127.0.0.1:8080"
+		})
+		assert(processor.addrResolver(0, 0)).Equals("127.0.0.1:8080")
+	})
+}
+
+func TestProcessor_SetQueue(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+		assert(processor.maxQueueSize).Equals(0)
+		assert(processor.queueTimeout).Equals(time.Duration(0))
+		processor.SetQueue(10, time.Second)
+		assert(processor.maxQueueSize).Equals(10)
+		assert(processor.queueTimeout).Equals(time.Second)
+	})
+}
+
+func TestProcessor_GetQueueDepth(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+		assert(processor.GetQueueDepth()).Equals(0)
+		heap.Push(&processor.waitQueue, &rpcQueueItem{})
+		assert(processor.GetQueueDepth()).Equals(1)
+		heap.Pop(&processor.waitQueue)
+	})
+}
+
 func TestProcessor_PutStream(t *testing.T) {
 	t.Run("processor is closed", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -384,6 +918,7 @@ func TestProcessor_PutStream(t *testing.T) {
 		for i := 0; i < 2048; i++ {
 			assert(processor.PutStream(NewStream())).IsFalse()
 		}
+		assert(processor.GetRunningCount()).Equals(int64(0))
 	})
 
 	t.Run("test ok", func(t *testing.T) {
@@ -418,6 +953,106 @@ func TestProcessor_PutStream(t *testing.T) {
 			freeSum += len(processor.freeCHArray[i])
 		}
 		assert(freeSum).Equals(256)
+		assert(processor.GetRunningCount()).Equals(int64(0))
+	})
+
+	t.Run("server is busy", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		streamReceiver := NewTestStreamReceiver()
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, streamReceiver,
+		)
+		defer processor.Close()
+		defer setTestProcessorBusy(processor)()
+		processor.SetQueue(1, 0)
+
+		// the stream is queued without blocking, and the next one is
+		// rejected at once
+		for cbID := uint64(11); cbID <= 12; cbID++ {
+			stream, _ := MakeInternalRequestStream(false, 0, "#.test:Eval", "")
+			stream.SetCallbackID(cbID)
+			assert(processor.PutStream(stream)).Equals(cbID == 11)
+		}
+		assert(processor.GetQueueDepth()).Equals(1)
+		assert(processor.GetRejectedCount()).Equals(int64(1))
+		assert(processor.GetRunningCount()).Equals(int64(0))
+
+		backStream := streamReceiver.GetStream()
+		assert(backStream.GetCallbackID()).Equals(uint64(12))
+		assert(ParseResponseStream(backStream)).Equals(nil, base.ErrServerBusy)
+	})
+
+	t.Run("the queued stream times out", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		streamReceiver := NewTestStreamReceiver()
+		processor := NewProcessor(
+			256, 2, 3, 2048, nil, time.Second, nil, streamReceiver,
+		)
+		defer processor.Close()
+		defer setTestProcessorBusy(processor)()
+		processor.SetQueue(0, 10*time.Millisecond)
+
+		stream, _ := MakeInternalRequestStream(false, 0, "#.test:Eval", "")
+		stream.SetCallbackID(12)
+		assert(processor.PutStream(stream)).IsTrue()
+
+		// no thread is released, the timer rejects it
+		backStream := streamReceiver.WaitStream()
+		assert(backStream.GetCallbackID()).Equals(uint64(12))
+		assert(ParseResponseStream(backStream)).Equals(nil, base.ErrServerBusy)
+		assert(processor.GetQueueDepth()).Equals(0)
+		assert(processor.GetRejectedCount()).Equals(int64(1))
+	})
+
+	t.Run("streams with higher priority are evaluated first", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		finishCH := make(chan bool)
+		orderCH := make(chan string, 2)
+		streamReceiver := NewTestStreamReceiver()
+		processor := NewProcessor(
+			256,
+			2,
+			3,
+			2048,
+			nil,
+			time.Second,
+			[]*ServiceMeta{{
+				name: "test",
+				service: NewService(nil).
+					On("Block", func(rt Runtime) Return {
+						<-finishCH
+						return rt.Reply(true)
+					}).
+					On("Order", func(rt Runtime, name string) Return {
+						orderCH <- name
+						return rt.Reply(true)
+					}),
+				fileLine: "",
+			}},
+			streamReceiver,
+		)
+		defer processor.Close()
+
+		// make all the threads busy
+		for i := 0; i < 256; i++ {
+			stream, _ := MakeInternalRequestStream(false, 0, "#.test:Block", "")
+			assert(processor.PutStream(stream)).IsTrue()
+		}
+
+		// the streams are put by one goroutine, like the streams of one conn
+		for _, priority := range []uint8{0, 200} {
+			stream, _ := MakeInternalRequestStream(
+				false, 0, "#.test:Order", "", fmt.Sprintf("%d", priority),
+			)
+			stream.SetPriority(priority)
+			assert(processor.PutStream(stream)).IsTrue()
+		}
+		assert(processor.GetQueueDepth()).Equals(2)
+
+		finishCH <- true
+		assert(<-orderCH).Equals("200")
+		close(finishCH)
+		assert(<-orderCH).Equals("0")
 	})
 }
 
@@ -480,6 +1115,38 @@ func TestProcessor_BuildCache(t *testing.T) {
 			Equals(base.ReadFromFile(snapshotFile))
 	})
 
+	t.Run("struct is not importable", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		tmpFile := path.Join(curDir, "_tmp_/test-processor-03.go")
+		snapshotFile := path.Join(
+			curDir,
+			"_snapshot_/test-processor-01.snapshot",
+		)
+		processor := NewProcessor(
+			freeGroups,
+			2,
+			3,
+			2048,
+			nil,
+			time.Second,
+			[]*ServiceMeta{{
+				name: "test",
+				service: NewService(nil).On(
+					"Eval",
+					func(rt Runtime, v structTestPrivate) Return {
+						return rt.Reply(true)
+					},
+				),
+				fileLine: "",
+			}},
+			NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+		assert(processor.BuildCache("pkgName", tmpFile)).IsNil()
+		assert(base.ReadFromFile(tmpFile)).
+			Equals(base.ReadFromFile(snapshotFile))
+	})
+
 	t.Run("processor is closed", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		processor := NewProcessor(
@@ -498,6 +1165,59 @@ func TestProcessor_BuildCache(t *testing.T) {
 	})
 }
 
+func TestProcessor_BuildClientStub(t *testing.T) {
+	_, file, _, _ := runtime.Caller(0)
+	curDir := path.Dir(file)
+	defer func() {
+		_ = os.RemoveAll(path.Join(path.Dir(file), "_tmp_"))
+	}()
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		tmpFile := path.Join(curDir, "_tmp_/test-processor-stub-01.go")
+		processor := NewProcessor(
+			freeGroups,
+			2,
+			3,
+			2048,
+			nil,
+			time.Second,
+			[]*ServiceMeta{{
+				name: "test",
+				service: NewService(nil).On("Ping", func(rt Runtime) Return {
+					return rt.Reply(true)
+				}),
+				fileLine: "",
+			}},
+			NewTestStreamReceiver(),
+		)
+		defer processor.Close()
+		assert(processor.BuildClientStub("pkgName", tmpFile)).IsNil()
+		content, _ := base.ReadFromFile(tmpFile)
+		assert(strings.Contains(
+			content,
+			"func (p *RPCClientStub) TestPing() (rpc.Any, *rpc.Error) {",
+		)).IsTrue()
+	})
+
+	t.Run("processor is closed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		processor := NewProcessor(
+			freeGroups,
+			2,
+			3,
+			2048,
+			nil,
+			time.Second,
+			nil,
+			NewTestStreamReceiver(),
+		)
+		processor.Close()
+		assert(processor.BuildClientStub("pkgName", "")).
+			Equals(base.ErrProcessorIsNotRunning)
+	})
+}
+
 func TestProcessor_onTimer(t *testing.T) {
 	t.Run("test ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -2,10 +2,17 @@ package rpc
 
 import (
 	"math"
+	"time"
 
 	"github.com/rpccloud/rpc/internal/base"
 )
 
+var closedDoneCH = func() chan struct{} {
+	ret := make(chan struct{})
+	close(ret)
+	return ret
+}()
+
 // Runtime ...
 type Runtime struct {
 	id     uint64
@@ -40,6 +47,48 @@ func (p Runtime) Reply(value interface{}) Return {
 	return emptyReturn
 }
 
+// Push sends one item of a streaming response to the caller. The items are
+// delivered on the callbackID of the request before the final Reply, so it
+// must be called before Reply and only by the action that serves the client.
+func (p Runtime) Push(value interface{}) *base.Error {
+	if thread := p.lock(); thread != nil {
+		defer p.unlock()
+		frame := thread.top
+
+		if frame.retStatus != 0 {
+			return base.ErrRuntimeReplyHasBeenCalled.
+				AddDebug(base.AddFileLine(thread.GetExecActionNodePath(), 1))
+		}
+
+		if frame != &thread.rootFrame {
+			return base.ErrRuntimePushNotSupported.
+				AddDebug(base.AddFileLine(thread.GetExecActionNodePath(), 1))
+		}
+
+		inStream := frame.stream
+		stream := NewStream()
+		stream.SetKind(StreamKindRPCResponseItem)
+		stream.SetGatewayID(inStream.GetGatewayID())
+		stream.SetSessionID(inStream.GetSessionID())
+		stream.SetCallbackID(inStream.GetCallbackID())
+		stream.WriteUint64(frame.itemSeq)
+		if reason := stream.Write(value); reason != StreamWriteOK {
+			stream.Release()
+			return base.ErrUnsupportedValue.AddDebug(base.ConcatString(
+				"value",
+				reason,
+			)).AddDebug(base.AddFileLine(thread.GetExecActionNodePath(), 1))
+		}
+
+		frame.itemSeq++
+		thread.processor.streamReceiver.OnReceiveStream(stream)
+		return nil
+	}
+
+	return base.ErrRuntimeIllegalInCurrentGoroutine.
+		AddDebug(base.GetFileLine(1))
+}
+
 // Post ...
 func (p Runtime) Post(endpoint string, message string, value Any) error {
 	if thread := p.lock(); thread != nil {
@@ -70,12 +119,51 @@ func (p Runtime) Post(endpoint string, message string, value Any) error {
 		AddDebug(base.GetFileLine(1))
 }
 
+// Publish sends value to all the sessions that subscribed message of the
+// current service. The boardcast stream has no session, the session server
+// finds the subscribers by the topic "<service path>%<message>".
+func (p Runtime) Publish(message string, value Any) error {
+	if thread := p.lock(); thread != nil {
+		defer p.unlock()
+
+		stream := NewStream()
+		stream.SetKind(StreamKindRPCBoardCast)
+		stream.SetGatewayID(0)
+		stream.SetSessionID(0)
+		stream.WriteString(thread.GetExecServicePath() + "%" + message)
+		if reason := stream.Write(value); reason != StreamWriteOK {
+			stream.Release()
+			return base.ErrUnsupportedValue.AddDebug(base.ConcatString(
+				reason,
+			))
+		}
+
+		thread.processor.streamReceiver.OnReceiveStream(stream)
+		return nil
+	}
+
+	return base.ErrRuntimeIllegalInCurrentGoroutine.
+		AddDebug(base.GetFileLine(1))
+}
+
 // Call ...
 func (p Runtime) Call(target string, args ...interface{}) RTValue {
 	if thread := p.lock(); thread != nil {
 		defer p.unlock()
 		frame := thread.top
 
+		// check deadline
+		remainNS := int64(0)
+		if frame.deadlineNS > 0 {
+			if remainNS = frame.deadlineNS - base.TimeNow().UnixNano(); remainNS <= 0 {
+				return RTValue{
+					err: base.ErrRuntimeTimeout.AddDebug(
+						base.AddFileLine(thread.GetExecActionNodePath(), 1),
+					),
+				}
+			}
+		}
+
 		// make stream
 		stream, err := MakeInternalRequestStream(
 			frame.stream.HasStatusBitDebug(),
@@ -93,6 +181,11 @@ func (p Runtime) Call(target string, args ...interface{}) RTValue {
 		}
 		defer stream.Release()
 
+		// the nested call inherits the remaining time
+		stream.SetTimeout(uint64(remainNS))
+		// the span of the action is the parent of the nested call
+		stream.SetTraceContext(frame.trace)
+
 		// switch thread frame and eval
 		func() {
 			thread.pushFrame()
@@ -118,6 +211,60 @@ func (p Runtime) Call(target string, args ...interface{}) RTValue {
 
 }
 
+// Deadline returns the time when the request should be finished. ok is false
+// when the caller does not set a timeout.
+func (p Runtime) Deadline() (deadline time.Time, ok bool) {
+	if thread := p.lock(); thread != nil {
+		defer p.unlock()
+
+		if deadlineNS := thread.top.deadlineNS; deadlineNS > 0 {
+			return time.Unix(0, deadlineNS), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Done returns a channel that is closed when the deadline is exceeded or the
+// action has returned. Long actions can select on it to abort early.
+func (p Runtime) Done() <-chan struct{} {
+	if thread := p.lock(); thread != nil {
+		defer p.unlock()
+		return thread.top.getDone()
+	}
+
+	return closedDoneCH
+}
+
+// Err returns base.ErrRuntimeTimeout if the deadline is exceeded, otherwise
+// it returns nil.
+func (p Runtime) Err() *base.Error {
+	if thread := p.lock(); thread != nil {
+		defer p.unlock()
+
+		if thread.top.isTimeout(base.TimeNow().UnixNano()) {
+			return base.ErrRuntimeTimeout
+		}
+
+		return nil
+	}
+
+	return base.ErrRuntimeIllegalInCurrentGoroutine.
+		AddDebug(base.GetFileLine(1))
+}
+
+// GetTraceContext returns the trace context of the running action, SpanID is
+// the span of the action. It can be sent as the W3C traceparent header to the
+// other systems, so their spans join the trace.
+func (p Runtime) GetTraceContext() TraceContext {
+	if thread := p.lock(); thread != nil {
+		defer p.unlock()
+		return thread.top.trace
+	}
+
+	return TraceContext{}
+}
+
 // NewRTArray ...
 func (p Runtime) NewRTArray(size int) RTArray {
 	if p.lock() != nil {
@@ -155,6 +302,25 @@ func (p Runtime) GetPostEndPoint() string {
 	return ""
 }
 
+// GetIdentity returns the identity of the session that sent the request. It is
+// nil if the session is not authenticated. Behind a router, it is the
+// identity that the gateway put in the request.
+func (p Runtime) GetIdentity() Any {
+	if thread := p.lock(); thread != nil {
+		defer p.unlock()
+
+		// the nested calls do not carry the session, use the root frame
+		if identity := thread.rootFrame.identity; identity != nil {
+			return identity
+		} else if fn := thread.processor.identityResolver; fn != nil {
+			stream := thread.rootFrame.stream
+			return fn(stream.GetGatewayID(), stream.GetSessionID())
+		}
+	}
+
+	return nil
+}
+
 // GetServiceConfig ...
 func (p Runtime) GetServiceConfig(key string) (Any, bool) {
 	if thread := p.lock(); thread != nil {
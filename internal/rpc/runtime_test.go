@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/rpccloud/rpc/internal/base"
@@ -140,6 +141,82 @@ func TestRuntime_Reply(t *testing.T) {
 	})
 }
 
+func TestRuntime_Push(t *testing.T) {
+	t.Run("thread lock error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		ret, source := Runtime{}.Push("HI"), base.GetFileLine(0)
+		assert(ret).
+			Equals(base.ErrRuntimeIllegalInCurrentGoroutine.AddDebug(source))
+	})
+
+	t.Run("Reply has been called", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		e := (*base.Error)(nil)
+		testWithProcessorAndRuntime(
+			func(processor *Processor, rt Runtime) Return {
+				ret := rt.Reply("ok")
+				e = rt.Push("HI")
+				return ret
+			},
+			nil,
+		)
+		assert(e.GetCode()).
+			Equals(base.ErrRuntimeReplyHasBeenCalled.GetCode())
+	})
+
+	t.Run("Push in nested call", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		e := (*base.Error)(nil)
+		depth := 0
+		testWithProcessorAndRuntime(
+			func(processor *Processor, rt Runtime) Return {
+				if depth++; depth == 1 {
+					return rt.Reply(rt.Call("#.test:Eval"))
+				}
+				e = rt.Push("HI")
+				return rt.Reply("ok")
+			},
+			nil,
+		)
+		assert(e.GetCode()).Equals(base.ErrRuntimePushNotSupported.GetCode())
+	})
+
+	t.Run("Push value not supported", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		e := (*base.Error)(nil)
+		testWithProcessorAndRuntime(
+			func(processor *Processor, rt Runtime) Return {
+				e = rt.Push(make(chan bool))
+				return rt.Reply("ok")
+			},
+			nil,
+		)
+		assert(e.GetCode()).Equals(base.ErrUnsupportedValue.GetCode())
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		e := (*base.Error)(nil)
+		stream := testWithProcessorAndRuntime(
+			func(processor *Processor, rt Runtime) Return {
+				if e = rt.Push("HI"); e != nil {
+					return rt.Reply(e)
+				}
+				e = rt.Push("WORLD")
+				return rt.Reply("ok")
+			},
+			nil,
+		)
+		assert(e).IsNil()
+		assert(stream.GetKind()).Equals(uint8(StreamKindRPCResponseItem))
+		assert(stream.GetGatewayID()).Equals(uint64(1234))
+		assert(stream.GetSessionID()).Equals(uint64(5678))
+		assert(stream.ReadUint64()).Equals(uint64(0), nil)
+		assert(stream.Read()).Equals("HI", nil)
+		assert(stream.IsReadFinish()).IsTrue()
+	})
+}
+
 func TestRuntime_Post(t *testing.T) {
 	t.Run("thread lock error", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -196,6 +273,49 @@ func TestRuntime_Post(t *testing.T) {
 	})
 }
 
+func TestRuntime_Publish(t *testing.T) {
+	t.Run("thread lock error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		ret, source := Runtime{}.Publish("Msg", "HI"), base.GetFileLine(0)
+		assert(ret).
+			Equals(base.ErrRuntimeIllegalInCurrentGoroutine.AddDebug(source))
+	})
+
+	t.Run("Publish value not supported", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		var e error
+		testWithProcessorAndRuntime(
+			func(processor *Processor, rt Runtime) Return {
+				e = rt.Publish("Msg", make(chan bool))
+				return rt.Reply("ok")
+			},
+			nil,
+		)
+		assert(e).Equals(base.ErrUnsupportedValue.AddDebug(base.ConcatString(
+			"value type(chan bool) is not supported",
+		)))
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		var e error
+		stream := testWithProcessorAndRuntime(
+			func(processor *Processor, rt Runtime) Return {
+				e = rt.Publish("Msg", "HI")
+				return emptyReturn
+			},
+			nil,
+		)
+		assert(e).IsNil()
+		assert(stream.GetKind()).Equals(uint8(StreamKindRPCBoardCast))
+		assert(stream.GetGatewayID()).Equals(uint64(0))
+		assert(stream.GetSessionID()).Equals(uint64(0))
+		assert(stream.Read()).Equals("#.test%Msg", nil)
+		assert(stream.Read()).Equals("HI", nil)
+		assert(stream.IsReadFinish()).IsTrue()
+	})
+}
+
 func TestRuntime_Call(t *testing.T) {
 	t.Run("thread lock error", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -270,6 +390,169 @@ func TestRuntime_Call(t *testing.T) {
 	})
 }
 
+func testRuntimeWithTimeout(
+	timeout time.Duration,
+	handler interface{},
+) *Stream {
+	helper := newTestProcessorHelper(
+		1,
+		16,
+		16,
+		2048,
+		nil,
+		3*time.Second,
+		[]*ServiceMeta{{
+			name: "test",
+			service: NewService(nil).
+				On("Eval", handler).
+				On("Sleep", func(rt Runtime, ms int64) Return {
+					time.Sleep(time.Duration(ms) * time.Millisecond)
+					return rt.Reply(ms)
+				}),
+			fileLine: "",
+		}},
+	)
+	defer helper.Close()
+
+	stream, _ := MakeInternalRequestStream(true, 0, "#.test:Eval", "")
+	stream.SetTimeout(uint64(timeout))
+	helper.GetProcessor().PutStream(stream)
+	return <-helper.streamReceiver.streamCH
+}
+
+func TestRuntime_Deadline(t *testing.T) {
+	t.Run("thread lock error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(Runtime{}.Deadline()).Equals(time.Time{}, false)
+	})
+
+	t.Run("no timeout", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(
+			testRuntimeWithTimeout(0, func(rt Runtime) Return {
+				_, ok := rt.Deadline()
+				return rt.Reply(ok)
+			}),
+		)).Equals(false, nil)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		start := base.TimeNow()
+		assert(ParseResponseStream(
+			testRuntimeWithTimeout(time.Second, func(rt Runtime) Return {
+				deadline, ok := rt.Deadline()
+				return rt.Reply(ok &&
+					deadline.After(start) &&
+					deadline.Before(start.Add(2*time.Second)),
+				)
+			}),
+		)).Equals(true, nil)
+	})
+}
+
+func TestRuntime_Done(t *testing.T) {
+	t.Run("thread lock error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		_, ok := <-Runtime{}.Done()
+		assert(ok).IsFalse()
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(
+			testRuntimeWithTimeout(50*time.Millisecond, func(rt Runtime) Return {
+				select {
+				case <-rt.Done():
+					return rt.Reply(rt.Err().GetCode())
+				case <-time.After(2 * time.Second):
+					return rt.Reply(true)
+				}
+			}),
+		)).Equals(uint64(base.ErrRuntimeTimeout.GetCode()), nil)
+	})
+
+	t.Run("closed after the action returns", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		doneCH := make(chan (<-chan struct{}), 1)
+		assert(ParseResponseStream(
+			testRuntimeWithTimeout(0, func(rt Runtime) Return {
+				doneCH <- rt.Done()
+				return rt.Reply(true)
+			}),
+		)).Equals(true, nil)
+		_, ok := <-(<-doneCH)
+		assert(ok).IsFalse()
+	})
+}
+
+func TestRuntime_Err(t *testing.T) {
+	t.Run("thread lock error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(Runtime{}.Err().GetCode()).
+			Equals(base.ErrRuntimeIllegalInCurrentGoroutine.GetCode())
+	})
+
+	t.Run("not timeout", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(
+			testRuntimeWithTimeout(time.Second, func(rt Runtime) Return {
+				return rt.Reply(rt.Err() == nil)
+			}),
+		)).Equals(true, nil)
+	})
+}
+
+func TestRuntime_CallWithTimeout(t *testing.T) {
+	t.Run("nested call timeout", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(
+			testRuntimeWithTimeout(
+				100*time.Millisecond,
+				func(rt Runtime) Return {
+					if v, err := rt.Call("#.test:Sleep", int64(200)).
+						ToInt64(); err != nil || v != 200 {
+						return rt.Reply(false)
+					}
+					_, err := rt.Call("#.test:Sleep", int64(1)).ToInt64()
+					return rt.Reply(err.GetCode())
+				},
+			),
+		)).Equals(uint64(base.ErrRuntimeTimeout.GetCode()), nil)
+	})
+
+	t.Run("nested call inherits deadline", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(
+			testRuntimeWithTimeout(time.Second, func(rt Runtime) Return {
+				deadline, _ := rt.Deadline()
+				return rt.Reply(rt.Call("#.test:Sleep", int64(1)).err == nil &&
+					deadline.Sub(base.TimeNow()) < time.Second)
+			}),
+		)).Equals(true, nil)
+	})
+}
+
+func TestRuntime_GetTraceContext(t *testing.T) {
+	t.Run("thread lock error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(Runtime{}.GetTraceContext()).Equals(TraceContext{})
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(
+			testWithProcessorAndRuntime(
+				func(processor *Processor, rt Runtime) Return {
+					trace := rt.GetTraceContext()
+					return rt.Reply(trace.IsValid() && !trace.IsSampled())
+				},
+				nil,
+			),
+		)).Equals(true, nil)
+	})
+}
+
 func TestRuntime_NewRTArray(t *testing.T) {
 	t.Run("runtime error", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -337,6 +620,104 @@ func TestRuntime_GetPostEndPoint(t *testing.T) {
 	})
 }
 
+func TestRuntime_GetIdentity(t *testing.T) {
+	t.Run("lock error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := Runtime{}
+		assert(v.GetIdentity()).IsNil()
+	})
+
+	t.Run("resolver is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(
+			testWithProcessorAndRuntime(
+				func(_ *Processor, rt Runtime) Return {
+					return rt.Reply(rt.GetIdentity())
+				},
+				nil,
+			),
+		)).Equals(nil, nil)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(
+			testWithProcessorAndRuntime(
+				func(processor *Processor, rt Runtime) Return {
+					processor.SetIdentityResolver(
+						func(gatewayID uint64, sessionID uint64) Any {
+							return Array{gatewayID, sessionID}
+						},
+					)
+					return rt.Reply(rt.GetIdentity())
+				},
+				nil,
+			),
+		)).Equals(Array{uint64(1234), uint64(5678)}, nil)
+	})
+
+	t.Run("identity in the stream", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		helper := newTestProcessorHelper(
+			1,
+			16,
+			16,
+			2048,
+			nil,
+			3*time.Second,
+			[]*ServiceMeta{{
+				name: "test",
+				service: NewService(nil).
+					On("WhoAmI", func(rt Runtime, name String) Return {
+						return rt.Reply(Array{name, rt.GetIdentity()})
+					}),
+				fileLine: "",
+			}},
+		)
+		defer helper.Close()
+		helper.GetProcessor().SetIdentityResolver(
+			func(gatewayID uint64, sessionID uint64) Any {
+				return "resolver"
+			},
+		)
+
+		stream, _ := MakeInternalRequestStream(false, 0, "#.test:WhoAmI", "", "a")
+		helper.GetProcessor().PutStream(MakeIdentityRequestStream(stream, "user"))
+		ret := <-helper.streamReceiver.streamCH
+		assert(ret.HasStatusBitIdentity()).IsFalse()
+		assert(ParseResponseStream(ret)).Equals(Array{"a", "user"}, nil)
+
+		stream, _ = MakeInternalRequestStream(false, 0, "#.test:WhoAmI", "", "b")
+		helper.GetProcessor().PutStream(stream)
+		assert(ParseResponseStream(<-helper.streamReceiver.streamCH)).
+			Equals(Array{"b", "resolver"}, nil)
+
+		// the client fakes its identity, the gateway replaces it
+		for _, identity := range []Any{"guest", nil} {
+			stream, _ = MakeInternalRequestStream(
+				false, 0, "#.test:WhoAmI", "", "c",
+			)
+			stream = MakeIdentityRequestStream(stream, "admin")
+			helper.GetProcessor().PutStream(
+				MakeIdentityRequestStream(stream, identity),
+			)
+			if identity == nil {
+				identity = "resolver"
+			}
+			assert(ParseResponseStream(<-helper.streamReceiver.streamCH)).
+				Equals(Array{"c", identity}, nil)
+		}
+
+		stream = NewStream()
+		stream.SetKind(StreamKindRPCRequest)
+		stream.SetStatusBitIdentity()
+		stream.PutBytes([]byte{0xFF})
+		helper.GetProcessor().PutStream(stream)
+		_, err := ParseResponseStream(<-helper.streamReceiver.streamCH)
+		assert(err.GetCode()).Equals(base.ErrStream.GetCode())
+	})
+}
+
 func TestRuntime_GetServiceConfig(t *testing.T) {
 	t.Run("runtime is invalid", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -36,23 +36,40 @@ func NewServiceMeta(
 	}
 }
 
+// Interceptor runs before the action of path is called. from is the caller,
+// args are the arguments of the action. It returns nil to continue, or an
+// error that is replied to the caller instead of calling the action.
+type Interceptor func(rt Runtime, path string, from string, args Array) *base.Error
+
 // Service ...
 type Service struct {
-	children []*ServiceMeta // all the children node meta pointer
-	actions  []*ActionMeta  // all the actions meta pointer
-	config   Map
-	mu       sync.Mutex
+	children     []*ServiceMeta // all the children node meta pointer
+	actions      []*ActionMeta  // all the actions meta pointer
+	interceptors []Interceptor  // run before the actions of the service
+	config       Map
+	mu           sync.Mutex
 }
 
 // NewService define a new service
 func NewService(config Map) *Service {
 	return &Service{
-		children: nil,
-		actions:  nil,
-		config:   config,
+		children:     nil,
+		actions:      nil,
+		interceptors: nil,
+		config:       config,
 	}
 }
 
+// Use adds interceptors to the service. They run in order before the actions
+// of the service and its children.
+func (p *Service) Use(interceptors ...Interceptor) *Service {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.interceptors = append(p.interceptors, interceptors...)
+	return p
+}
+
 // AddChildService ...
 func (p *Service) AddChildService(
 	name string,
@@ -26,6 +26,25 @@ func TestNewService(t *testing.T) {
 		assert(service).IsNotNil()
 		assert(len(service.children)).Equals(0)
 		assert(len(service.actions)).Equals(0)
+		assert(len(service.interceptors)).Equals(0)
+	})
+}
+
+func TestService_Use(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fn1 := func(_ Runtime, _ string, _ string, _ Array) *base.Error {
+			return nil
+		}
+		fn2 := func(_ Runtime, _ string, _ string, _ Array) *base.Error {
+			return base.ErrStream
+		}
+		service := NewService(nil)
+		assert(service.Use(fn1)).Equals(service)
+		assert(service.Use(fn2, fn1)).Equals(service)
+		assert(len(service.interceptors)).Equals(3)
+		assert(service.interceptors[1](Runtime{}, "", "", nil)).
+			Equals(base.ErrStream)
 	})
 }
 
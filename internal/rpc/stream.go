@@ -12,7 +12,9 @@ import (
 )
 
 const (
-	streamVersion            = 1
+	// streamVersion is 3 since the header carries the trace context, the
+	// peers of other versions are rejected by StreamGenerator
+	streamVersion            = 3
 	streamBlockSize          = 512
 	streamFrameArrayInitSize = 8
 
@@ -29,9 +31,15 @@ const (
 	streamPosSessionID  = 42
 	streamPosCallbackID = 50
 	streamPosDepth      = 58
-	streamPosBody       = 60
+	streamPosTimeout    = 60
+	streamPosTraceID    = 68
+	streamPosSpanID     = 84
+	streamPosTraceFlags = 92
+	streamPosBody       = 93
 
-	streamStatusBitDebug = 0
+	streamStatusBitDebug      = 0
+	streamStatusBitIdentity   = 1
+	streamStatusBitCompressed = 2
 
 	// StreamBlockSize ...
 	StreamBlockSize = streamBlockSize
@@ -62,6 +70,21 @@ const (
 	StreamKindRPCBoardCast = 8
 	// StreamKindSystemErrorReport ...
 	StreamKindSystemErrorReport = 9
+	// StreamKindRPCResponseItem is one item of a server streaming response,
+	// the body is the item sequence (uint64) followed by the item value
+	StreamKindRPCResponseItem = 10
+	// StreamKindSubscribe subscribes the boardcasts of a topic, the body is
+	// the topic string in the form of "<service path>%<message>"
+	StreamKindSubscribe = 11
+	// StreamKindUnsubscribe cancels a StreamKindSubscribe of the same topic
+	StreamKindUnsubscribe = 12
+	// StreamKindRPCCancel tells the server that the client does not wait for
+	// the request of the same callbackID any more, the body is empty
+	StreamKindRPCCancel = 13
+	// StreamKindDrain tells the client that the server is going to close. The
+	// client should not send new requests on the connection, and reconnect
+	// after the running requests are replied, the body is empty
+	StreamKindDrain = 14
 )
 
 var (
@@ -232,6 +255,39 @@ func (p *Stream) ClearStatusBitDebug() {
 	(*p.frames[0])[streamPosStatusBit] &= (1 << streamStatusBitDebug) ^ 0xFF
 }
 
+// HasStatusBitIdentity returns true if the body of the request starts with
+// the identity of the session
+func (p *Stream) HasStatusBitIdentity() bool {
+	return (*p.frames[0])[streamPosStatusBit]&(1<<streamStatusBitIdentity) != 0
+}
+
+// SetStatusBitIdentity ...
+func (p *Stream) SetStatusBitIdentity() {
+	(*p.frames[0])[streamPosStatusBit] |= 1 << streamStatusBitIdentity
+}
+
+// ClearStatusBitIdentity ...
+func (p *Stream) ClearStatusBitIdentity() {
+	(*p.frames[0])[streamPosStatusBit] &= (1 << streamStatusBitIdentity) ^ 0xFF
+}
+
+// HasStatusBitCompressed returns true if the body is compressed with the
+// codec that is negotiated in the connect request and response
+func (p *Stream) HasStatusBitCompressed() bool {
+	return (*p.frames[0])[streamPosStatusBit]&(1<<streamStatusBitCompressed) != 0
+}
+
+// SetStatusBitCompressed ...
+func (p *Stream) SetStatusBitCompressed() {
+	(*p.frames[0])[streamPosStatusBit] |= 1 << streamStatusBitCompressed
+}
+
+// ClearStatusBitCompressed ...
+func (p *Stream) ClearStatusBitCompressed() {
+	(*p.frames[0])[streamPosStatusBit] &=
+		(1 << streamStatusBitCompressed) ^ 0xFF
+}
+
 // GetKind ...
 func (p *Stream) GetKind() uint8 {
 	return (*p.frames[0])[streamPosKind]
@@ -377,6 +433,33 @@ func (p *Stream) SetDepth(v uint16) {
 	binary.LittleEndian.PutUint16((*p.frames[0])[streamPosDepth:], v)
 }
 
+// GetTimeout get the remaining time (in nanoseconds) of the request, zero
+// means the request has no deadline
+func (p *Stream) GetTimeout() uint64 {
+	return binary.LittleEndian.Uint64((*p.frames[0])[streamPosTimeout:])
+}
+
+// SetTimeout ...
+func (p *Stream) SetTimeout(v uint64) {
+	binary.LittleEndian.PutUint64((*p.frames[0])[streamPosTimeout:], v)
+}
+
+// GetTraceContext get the trace context of the request, the SpanID is the
+// span of the caller
+func (p *Stream) GetTraceContext() TraceContext {
+	ret := TraceContext{Flags: (*p.frames[0])[streamPosTraceFlags]}
+	copy(ret.TraceID[:], (*p.frames[0])[streamPosTraceID:])
+	copy(ret.SpanID[:], (*p.frames[0])[streamPosSpanID:])
+	return ret
+}
+
+// SetTraceContext ...
+func (p *Stream) SetTraceContext(v TraceContext) {
+	copy((*p.frames[0])[streamPosTraceID:], v.TraceID[:])
+	copy((*p.frames[0])[streamPosSpanID:], v.SpanID[:])
+	(*p.frames[0])[streamPosTraceFlags] = v.Flags
+}
+
 // GetReadPos get the current read pos of the stream
 func (p *Stream) GetReadPos() int {
 	return p.readSeg*streamBlockSize + p.readIndex
@@ -1382,10 +1465,34 @@ func (p *Stream) write(v interface{}, depth int) string {
 	case RTValue:
 		return p.writeRTValue(v)
 	default:
-		return fmt.Sprintf(" type(%T) is not supported", v)
+		return p.writeStruct(v, depth)
 	}
 }
 
+// writeStruct writes the struct or the pointer of the struct as a Map
+func (p *Stream) writeStruct(v interface{}, depth int) string {
+	rv := reflect.ValueOf(v)
+
+	if _, ok := v.(error); !ok {
+		if rv.Kind() == reflect.Ptr &&
+			rv.Type().Elem().Kind() == reflect.Struct {
+			if rv.IsNil() {
+				p.WriteNil()
+				return StreamWriteOK
+			}
+			rv = rv.Elem()
+		}
+
+		if rv.Kind() == reflect.Struct {
+			if m, err := structToMap(rv); err == nil {
+				return p.writeMap(m, depth)
+			}
+		}
+	}
+
+	return fmt.Sprintf(" type(%T) is not supported", v)
+}
+
 // ReadNil read nil
 func (p *Stream) ReadNil() (interface{}, *base.Error) {
 	if p.CanRead() && p.readFrame[p.readIndex] == 1 {
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+const (
+	// StreamCodecNone the body is not compressed
+	StreamCodecNone = 0
+	// StreamCodecDeflate the body is compressed with DEFLATE (RFC 1951)
+	StreamCodecDeflate = 1
+)
+
+var flateWriterCache = &sync.Pool{
+	New: func() interface{} {
+		ret, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return ret
+	},
+}
+
+// CompressStream returns the stream whose body is compressed with the codec,
+// and the stream is released. If the codec is not supported, the body is not
+// longer than threshold, or it can not be smaller, the stream is returned.
+func CompressStream(stream *Stream, codec uint8, threshold int) *Stream {
+	if codec != StreamCodecDeflate ||
+		stream.HasStatusBitCompressed() ||
+		stream.GetWritePos()-streamPosBody <= threshold {
+		return stream
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	writer := flateWriterCache.Get().(*flate.Writer)
+	defer flateWriterCache.Put(writer)
+	writer.Reset(buffer)
+
+	for pos := streamPosBody; ; {
+		buf, finish := stream.PeekBufferSlice(pos, streamBlockSize)
+		_, _ = writer.Write(buf)
+		pos += len(buf)
+		if finish {
+			break
+		}
+	}
+
+	if err := writer.Close(); err != nil ||
+		buffer.Len() >= stream.GetWritePos()-streamPosBody {
+		return stream
+	}
+
+	ret := NewStream()
+	copy((*ret.frames[0])[:streamPosBody], (*stream.frames[0])[:streamPosBody])
+	ret.SetStatusBitCompressed()
+	ret.PutBytes(buffer.Bytes())
+	stream.Release()
+	return ret
+}
+
+// DecompressStream returns the stream whose body is decompressed, and the
+// stream is released. If the stream is not compressed, it is returned. The
+// decompressed stream can not be longer than limit, so a small stream can not
+// use up the memory.
+func DecompressStream(stream *Stream, limit int) (*Stream, *base.Error) {
+	if !stream.HasStatusBitCompressed() {
+		return stream, nil
+	}
+
+	maxBodySize := limit - streamPosBody
+	if maxBodySize < 0 {
+		return nil, base.ErrStream
+	}
+
+	compressed := stream.GetBuffer()[streamPosBody:]
+	reader := flate.NewReader(bytes.NewReader(compressed))
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	body, err := ioutil.ReadAll(
+		io.LimitReader(reader, int64(maxBodySize)+1),
+	)
+	if err != nil || len(body) > maxBodySize {
+		return nil, base.ErrStream
+	}
+
+	ret := NewStream()
+	copy((*ret.frames[0])[:streamPosBody], (*stream.frames[0])[:streamPosBody])
+	ret.ClearStatusBitCompressed()
+	ret.PutBytes(body)
+	ret.BuildStreamCheck()
+	stream.Release()
+	return ret, nil
+}
@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+func TestCompressStream(t *testing.T) {
+	fnMakeStream := func(str string) *Stream {
+		ret := NewStream()
+		ret.SetKind(StreamKindRPCRequest)
+		ret.SetCallbackID(13)
+		ret.SetPriority(7)
+		ret.WriteString(str)
+		return ret
+	}
+
+	t.Run("codec is not supported", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := fnMakeStream(strings.Repeat("A", 4096))
+		assert(CompressStream(stream, StreamCodecNone, 0)).Equals(stream)
+		assert(CompressStream(stream, 100, 0)).Equals(stream)
+		assert(stream.HasStatusBitCompressed()).IsFalse()
+	})
+
+	t.Run("stream is compressed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := fnMakeStream(strings.Repeat("A", 4096))
+		stream.SetStatusBitCompressed()
+		assert(CompressStream(stream, StreamCodecDeflate, 0)).Equals(stream)
+	})
+
+	t.Run("body is not longer than threshold", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := fnMakeStream(strings.Repeat("A", 4096))
+		threshold := stream.GetWritePos() - streamPosBody
+		assert(CompressStream(stream, StreamCodecDeflate, threshold)).
+			Equals(stream)
+		assert(stream.HasStatusBitCompressed()).IsFalse()
+	})
+
+	t.Run("body can not be smaller", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := fnMakeStream(base.GetRandString(8))
+		assert(CompressStream(stream, StreamCodecDeflate, 0)).Equals(stream)
+		assert(stream.HasStatusBitCompressed()).IsFalse()
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, n := range []int{512, 4096, 100000} {
+			stream := fnMakeStream(strings.Repeat("A", n))
+			length := stream.GetWritePos()
+			v := CompressStream(stream, StreamCodecDeflate, 256)
+			assert(v.HasStatusBitCompressed()).IsTrue()
+			assert(v.GetWritePos() < length).IsTrue()
+			assert(v.GetKind()).Equals(uint8(StreamKindRPCRequest))
+			assert(v.GetCallbackID()).Equals(uint64(13))
+			assert(v.GetPriority()).Equals(uint8(7))
+			v.Release()
+		}
+	})
+}
+
+func TestDecompressStream(t *testing.T) {
+	t.Run("stream is not compressed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		stream.WriteString("hello")
+		assert(DecompressStream(stream, 0)).Equals(stream, nil)
+	})
+
+	t.Run("data error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		stream.SetStatusBitCompressed()
+		stream.PutBytes([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+		assert(DecompressStream(stream, 1024)).Equals(nil, base.ErrStream)
+	})
+
+	t.Run("limit is too small", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		stream.PutBytes(make([]byte, 4096))
+		stream = CompressStream(stream, StreamCodecDeflate, 0)
+		assert(stream.HasStatusBitCompressed()).IsTrue()
+		assert(DecompressStream(stream, streamPosBody-1)).
+			Equals(nil, base.ErrStream)
+	})
+
+	t.Run("stream is too large", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, n := range []int{4097, 64 * 1024 * 1024} {
+			stream := NewStream()
+			stream.PutBytes(make([]byte, n))
+			stream = CompressStream(stream, StreamCodecDeflate, 0)
+			assert(stream.HasStatusBitCompressed()).IsTrue()
+			assert(stream.GetWritePos() < 1024*1024).IsTrue()
+			assert(DecompressStream(stream, streamPosBody+4096)).
+				Equals(nil, base.ErrStream)
+		}
+	})
+
+	t.Run("stream is as long as the limit", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		stream.PutBytes(make([]byte, 4096))
+		stream = CompressStream(stream, StreamCodecDeflate, 0)
+		v, err := DecompressStream(stream, streamPosBody+4096)
+		assert(err).IsNil()
+		assert(v.GetWritePos()).Equals(streamPosBody + 4096)
+		v.Release()
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, n := range []int{512, 4096, 100000} {
+			str := strings.Repeat("A", n)
+			stream := NewStream()
+			stream.SetKind(StreamKindRPCResponseOK)
+			stream.SetCallbackID(13)
+			stream.WriteString(str)
+			stream.WriteInt64(1234)
+			stream = CompressStream(stream, StreamCodecDeflate, 0)
+			stream.BuildStreamCheck()
+			assert(stream.HasStatusBitCompressed()).IsTrue()
+
+			v, err := DecompressStream(stream, 1024*1024)
+			assert(err).IsNil()
+			assert(v.HasStatusBitCompressed()).IsFalse()
+			assert(v.CheckStream()).IsTrue()
+			assert(v.GetKind()).Equals(uint8(StreamKindRPCResponseOK))
+			assert(v.GetCallbackID()).Equals(uint64(13))
+			assert(v.ReadString()).Equals(str, nil)
+			assert(v.ReadInt64()).Equals(int64(1234), nil)
+			assert(v.IsReadFinish()).IsTrue()
+			v.Release()
+		}
+	})
+}
@@ -8,6 +8,8 @@ type StreamGenerator struct {
 	streamPos      int
 	streamBuffer   []byte
 	stream         *Stream
+	codec          uint8
+	transLimit     int
 }
 
 // NewStreamGenerator ...
@@ -17,9 +19,19 @@ func NewStreamGenerator(streamReceiver IStreamReceiver) *StreamGenerator {
 		streamPos:      0,
 		streamBuffer:   make([]byte, StreamHeadSize),
 		stream:         nil,
+		codec:          StreamCodecNone,
+		transLimit:     0,
 	}
 }
 
+// SetDecompression sets the codec that is negotiated, the compressed streams
+// are refused until it is set. The decompressed stream can not be longer than
+// transLimit. It must be called in the goroutine that calls OnBytes.
+func (p *StreamGenerator) SetDecompression(codec uint8, transLimit int) {
+	p.codec = codec
+	p.transLimit = transLimit
+}
+
 // Reset ...
 func (p *StreamGenerator) Reset() {
 	p.streamPos = 0
@@ -44,6 +56,11 @@ func (p *StreamGenerator) OnBytes(b []byte) *base.Error {
 			return nil
 		}
 
+		// the header of other versions can not be read correctly
+		if p.streamBuffer[streamPosVersion] != streamVersion {
+			return base.ErrStream
+		}
+
 		p.stream = NewStream()
 		p.stream.PutBytesTo(p.streamBuffer, 0)
 		p.streamPos = 0
@@ -63,11 +80,20 @@ func (p *StreamGenerator) OnBytes(b []byte) *base.Error {
 	streamPos := p.stream.GetWritePos()
 
 	if streamPos == streamLength {
-		if p.stream.CheckStream() {
-			p.streamReceiver.OnReceiveStream(p.stream)
-			p.stream = nil
-		} else {
+		if !p.stream.CheckStream() {
+			return base.ErrStream
+		} else if p.stream.HasStatusBitCompressed() &&
+			p.codec != StreamCodecDeflate {
+			// the codec is not negotiated
 			return base.ErrStream
+		} else if stream, err := DecompressStream(
+			p.stream,
+			p.transLimit,
+		); err != nil {
+			return err
+		} else {
+			p.stream = nil
+			p.streamReceiver.OnReceiveStream(stream)
 		}
 	}
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/rpccloud/rpc/internal/base"
@@ -20,6 +21,18 @@ func TestNewStreamGenerator(t *testing.T) {
 		assert(len(v.streamBuffer), cap(v.streamBuffer)).
 			Equals(StreamHeadSize, StreamHeadSize)
 		assert(v.stream).IsNil()
+		assert(v.codec).Equals(uint8(StreamCodecNone))
+		assert(v.transLimit).Equals(0)
+	})
+}
+
+func TestStreamGenerator_SetDecompression(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewStreamGenerator(NewTestStreamReceiver())
+		v.SetDecompression(StreamCodecDeflate, 4096)
+		assert(v.codec).Equals(uint8(StreamCodecDeflate))
+		assert(v.transLimit).Equals(4096)
 	})
 }
 
@@ -108,6 +121,17 @@ func TestStreamGenerator_OnBytes(t *testing.T) {
 		assert(v.OnBytes(NewStream().GetBuffer())).Equals(base.ErrStream)
 	})
 
+	t.Run("stream version error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		receiver := NewTestStreamReceiver()
+		v := NewStreamGenerator(receiver)
+		s := NewStream()
+		s.SetVersion(1)
+		s.BuildStreamCheck()
+		assert(v.OnBytes(s.GetBuffer())).Equals(base.ErrStream)
+		assert(receiver.GetStream()).IsNil()
+	})
+
 	t.Run("stream check error", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		receiver := NewTestStreamReceiver()
@@ -119,4 +143,58 @@ func TestStreamGenerator_OnBytes(t *testing.T) {
 		buffer[len(buffer)-1] = 0
 		assert(v.OnBytes(buffer)).Equals(base.ErrStream)
 	})
+
+	t.Run("stream is compressed, codec is not negotiated", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		receiver := NewTestStreamReceiver()
+		v := NewStreamGenerator(receiver)
+		s := NewStream()
+		s.WriteString(strings.Repeat("A", 4096))
+		s = CompressStream(s, StreamCodecDeflate, 0)
+		s.BuildStreamCheck()
+		assert(v.OnBytes(s.GetBuffer())).Equals(base.ErrStream)
+		assert(receiver.GetStream()).IsNil()
+	})
+
+	t.Run("stream is compressed, it is over the limit", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		receiver := NewTestStreamReceiver()
+		v := NewStreamGenerator(receiver)
+		v.SetDecompression(StreamCodecDeflate, 4096)
+		s := NewStream()
+		s.WriteString(strings.Repeat("A", 4096))
+		s = CompressStream(s, StreamCodecDeflate, 0)
+		s.BuildStreamCheck()
+		assert(v.OnBytes(s.GetBuffer())).Equals(base.ErrStream)
+		assert(receiver.GetStream()).IsNil()
+	})
+
+	t.Run("stream is compressed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		receiver := NewTestStreamReceiver()
+		v := NewStreamGenerator(receiver)
+		v.SetDecompression(StreamCodecDeflate, 1024*1024)
+		s := NewStream()
+		s.WriteString(strings.Repeat("A", 4096))
+		s = CompressStream(s, StreamCodecDeflate, 0)
+		s.BuildStreamCheck()
+		assert(v.OnBytes(s.GetBuffer())).IsNil()
+		stream := receiver.GetStream()
+		assert(stream.HasStatusBitCompressed()).IsFalse()
+		assert(stream.ReadString()).Equals(strings.Repeat("A", 4096), nil)
+		assert(stream.IsReadFinish()).IsTrue()
+	})
+
+	t.Run("stream decompress error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		receiver := NewTestStreamReceiver()
+		v := NewStreamGenerator(receiver)
+		v.SetDecompression(StreamCodecDeflate, 1024*1024)
+		s := NewStream()
+		s.SetStatusBitCompressed()
+		s.PutBytes([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+		s.BuildStreamCheck()
+		assert(v.OnBytes(s.GetBuffer())).Equals(base.ErrStream)
+		assert(receiver.GetStream()).IsNil()
+	})
 }
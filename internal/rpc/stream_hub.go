@@ -1,6 +1,8 @@
 package rpc
 
 import (
+	"io"
+
 	"github.com/rpccloud/rpc/internal/base"
 )
 
@@ -8,32 +10,46 @@ type StreamHubCallback struct {
 	OnRPCRequestStream        func(stream *Stream)
 	OnRPCResponseOKStream     func(stream *Stream)
 	OnRPCResponseErrorStream  func(stream *Stream)
+	OnRPCResponseItemStream   func(stream *Stream)
 	OnRPCBoardCastStream      func(stream *Stream)
 	OnSystemErrorReportStream func(sessionID uint64, err *base.Error)
 }
 
 // StreamHub ...
 type StreamHub struct {
-	logger   *base.Logger
+	logger   base.ILogger
 	logLevel base.ErrorLevel
 	callback StreamHubCallback
 }
 
-// NewStreamHub ...
+// NewStreamHub makes a StreamHub that logs the text records to the screen
+// and to logFile
 func NewStreamHub(
 	isLogErrorToScreen bool,
 	logFile string,
 	logLevel base.ErrorLevel,
 	callback StreamHubCallback,
 ) *StreamHub {
-	logger, err := base.NewLogger(isLogErrorToScreen, logFile)
+	sinks := make([]io.Writer, 0, 2)
+	if isLogErrorToScreen {
+		sinks = append(sinks, base.NewScreenLogSink())
+	}
 
-	ret := &StreamHub{
-		logger:   logger,
-		logLevel: logLevel,
-		callback: callback,
+	err := (*base.Error)(nil)
+	if logFile != "" {
+		if sink, e := base.NewRotatingFileSink(logFile, 0, 0, 0); e != nil {
+			err = e
+		} else {
+			sinks = append(sinks, sink)
+		}
 	}
 
+	ret := NewStreamHubWithLogger(
+		base.NewLogger(base.ErrorLogAll, base.NewTextLogEncoder(), sinks...),
+		logLevel,
+		callback,
+	)
+
 	if err != nil {
 		ret.OnReceiveStream(MakeSystemErrorStream(err))
 	}
@@ -41,10 +57,29 @@ func NewStreamHub(
 	return ret
 }
 
+// NewStreamHubWithLogger makes a StreamHub that logs the system errors to
+// logger, the logger is closed when the StreamHub is closed
+func NewStreamHubWithLogger(
+	logger base.ILogger,
+	logLevel base.ErrorLevel,
+	callback StreamHubCallback,
+) *StreamHub {
+	return &StreamHub{
+		logger:   logger,
+		logLevel: logLevel,
+		callback: callback,
+	}
+}
+
+// GetLogger ...
+func (p *StreamHub) GetLogger() base.ILogger {
+	return p.logger
+}
+
 // OnReceiveStream ...
 func (p *StreamHub) OnReceiveStream(stream *Stream) {
 	if stream != nil {
-        stream.SetReadPos(streamPosBody)
+		stream.SetReadPos(streamPosBody)
 		fn := (func(stream *Stream))(nil)
 		switch stream.GetKind() {
 		case StreamKindRPCRequest:
@@ -53,6 +88,8 @@ func (p *StreamHub) OnReceiveStream(stream *Stream) {
 			fn = p.callback.OnRPCResponseOKStream
 		case StreamKindRPCResponseError:
 			fn = p.callback.OnRPCResponseErrorStream
+		case StreamKindRPCResponseItem:
+			fn = p.callback.OnRPCResponseItemStream
 		case StreamKindRPCBoardCast:
 			fn = p.callback.OnRPCBoardCastStream
 		case StreamKindSystemErrorReport:
@@ -63,10 +100,11 @@ func (p *StreamHub) OnReceiveStream(stream *Stream) {
 				return
 			}
 
-			p.logger.Log(err.ReportString(
+			p.logger.Log(err.GetLevel(), err.Error(), getLogFields(
+				err,
 				stream.GetSourceID(),
 				stream.GetSessionID(),
-			))
+			)...)
 
 			if p.callback.OnSystemErrorReportStream != nil {
 				p.callback.OnSystemErrorReportStream(stream.GetSessionID(), err)
@@ -91,3 +129,19 @@ func (p *StreamHub) Close() bool {
 
 	return true
 }
+
+func getLogFields(
+	err *base.Error,
+	machineID uint64,
+	sessionID uint64,
+) []base.LogField {
+	ret := make([]base.LogField, 0, 3)
+	ret = append(ret, base.NewLogField(base.LogKeyErrorCode, err.GetCode()))
+	if machineID != 0 {
+		ret = append(ret, base.NewLogField(base.LogKeyMachineID, machineID))
+	}
+	if sessionID != 0 {
+		ret = append(ret, base.NewLogField(base.LogKeySessionID, sessionID))
+	}
+	return ret
+}
@@ -1,6 +1,8 @@
 package rpc
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"reflect"
 	"strings"
@@ -36,12 +38,54 @@ func TestNewStreamHub(t *testing.T) {
 	})
 }
 
+func TestNewStreamHubWithLogger(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		logger := base.NewLogger(base.ErrorLogAll, nil)
+		v := NewStreamHubWithLogger(
+			logger,
+			base.ErrorLevelError,
+			StreamHubCallback{},
+		)
+		assert(v.logger).Equals(logger)
+		assert(v.logLevel).Equals(base.ErrorLevelError)
+	})
+}
+
+func TestStreamHub_GetLogger(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		logger := base.NewLogger(base.ErrorLogAll, nil)
+		v := NewStreamHubWithLogger(
+			logger,
+			base.ErrorLogAll,
+			StreamHubCallback{},
+		)
+		assert(v.GetLogger()).Equals(logger)
+	})
+}
+
+func TestGetLogFields(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getLogFields(base.ErrStream, 0, 0)).Equals([]base.LogField{
+			base.NewLogField(base.LogKeyErrorCode, base.ErrStream.GetCode()),
+		})
+		assert(getLogFields(base.ErrStream, 3, 17)).Equals([]base.LogField{
+			base.NewLogField(base.LogKeyErrorCode, base.ErrStream.GetCode()),
+			base.NewLogField(base.LogKeyMachineID, uint64(3)),
+			base.NewLogField(base.LogKeySessionID, uint64(17)),
+		})
+	})
+}
+
 func TestStreamHub_OnReceiveStream(t *testing.T) {
 	t.Run("test ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		for _, kind := range []uint8{
 			StreamKindRPCRequest, StreamKindRPCResponseOK,
-			StreamKindRPCResponseError, StreamKindRPCBoardCast,
+			StreamKindRPCResponseError, StreamKindRPCResponseItem,
+			StreamKindRPCBoardCast,
 		} {
 			streamCH := make(chan *Stream, 1024)
 			callback := StreamHubCallback{
@@ -54,6 +98,9 @@ func TestStreamHub_OnReceiveStream(t *testing.T) {
 				OnRPCResponseErrorStream: func(stream *Stream) {
 					streamCH <- stream
 				},
+				OnRPCResponseItemStream: func(stream *Stream) {
+					streamCH <- stream
+				},
 				OnRPCBoardCastStream: func(stream *Stream) {
 					streamCH <- stream
 				},
@@ -107,6 +154,24 @@ func TestStreamHub_OnReceiveStream(t *testing.T) {
 		assert(len(errCH)).Equals(0)
 	})
 
+	t.Run("case StreamKindSystemErrorReport, json logger", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		buffer := &bytes.Buffer{}
+		v := NewStreamHubWithLogger(
+			base.NewLogger(base.ErrorLogAll, base.NewJSONLogEncoder(), buffer),
+			base.ErrorLogAll,
+			StreamHubCallback{},
+		)
+		stream := MakeSystemErrorStream(base.ErrStream)
+		stream.SetSessionID(17)
+		v.OnReceiveStream(stream)
+		assert(strings.HasSuffix(buffer.String(), fmt.Sprintf(
+			"\"level\":\"warn\",\"msg\":\"SecurityWarn[1]: stream error\","+
+				"\"errorCode\":%d,\"sessionID\":17}\n",
+			base.ErrStream.GetCode(),
+		))).IsTrue()
+	})
+
 	t.Run("case StreamKindSystemErrorReport, ErrorLogNone", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		errCH := make(chan *base.Error, 1024)
@@ -151,12 +216,17 @@ func TestStreamHub_Close(t *testing.T) {
 				errCH <- err
 			},
 		}
-		v := NewStreamHub(true, "./tmp03/test.log", base.ErrorLogAll, callback)
+		sink, _ := base.NewRotatingFileSink("./tmp03/test.log", 0, 0, 0)
+		v := NewStreamHubWithLogger(
+			base.NewLogger(base.ErrorLogAll, nil, sink),
+			base.ErrorLogAll,
+			callback,
+		)
 		defer func() {
 			os.RemoveAll("./tmp03")
 		}()
 
-		filePtr := (**os.File)(getFieldPointer(v.logger, "file"))
+		filePtr := (**os.File)(getFieldPointer(sink, "file"))
 		_ = (*filePtr).Close()
 		assert(v.Close()).IsFalse()
 		assert((<-errCH).GetCode()).Equals(base.ErrLogCloseFile.GetCode())
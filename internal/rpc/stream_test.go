@@ -2,8 +2,10 @@ package rpc
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/rpccloud/rpc/internal/base"
 )
@@ -457,7 +459,7 @@ func getTestRange(start uint, end uint, head uint, tail uint, step uint) []int {
 func TestStream(t *testing.T) {
 	t.Run("test constant", func(t *testing.T) {
 		assert := base.NewAssert(t)
-		assert(streamVersion).Equals(1)
+		assert(streamVersion).Equals(3)
 		assert(streamBlockSize).Equals(512)
 		assert(streamBlockSize % 8).Equals(0)
 		assert(streamFrameArrayInitSize).Equals(8)
@@ -475,10 +477,16 @@ func TestStream(t *testing.T) {
 		assert(streamPosSessionID).Equals(42)
 		assert(streamPosCallbackID).Equals(50)
 		assert(streamPosDepth).Equals(58)
-		assert(streamPosBody).Equals(60)
+		assert(streamPosTimeout).Equals(60)
+		assert(streamPosTraceID).Equals(68)
+		assert(streamPosSpanID).Equals(84)
+		assert(streamPosTraceFlags).Equals(92)
+		assert(streamPosBody).Equals(93)
 		assert(streamStatusBitDebug).Equals(0)
+		assert(streamStatusBitIdentity).Equals(1)
+		assert(streamStatusBitCompressed).Equals(2)
 		assert(StreamBlockSize).Equals(512)
-		assert(StreamHeadSize).Equals(60)
+		assert(StreamHeadSize).Equals(93)
 		assert(StreamWriteOK).Equals("")
 		assert(StreamKindConnectRequest).Equals(1)
 		assert(StreamKindConnectResponse).Equals(2)
@@ -489,6 +497,11 @@ func TestStream(t *testing.T) {
 		assert(StreamKindRPCResponseError).Equals(7)
 		assert(StreamKindRPCBoardCast).Equals(8)
 		assert(StreamKindSystemErrorReport).Equals(9)
+		assert(StreamKindRPCResponseItem).Equals(10)
+		assert(StreamKindSubscribe).Equals(11)
+		assert(StreamKindUnsubscribe).Equals(12)
+		assert(StreamKindRPCCancel).Equals(13)
+		assert(StreamKindDrain).Equals(14)
 	})
 
 	t.Run("test initStreamFrame0", func(t *testing.T) {
@@ -661,7 +674,7 @@ func TestStream_GetVersion(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		v := NewStream()
-		assert(v.GetVersion()).Equals(uint8(1))
+		assert(v.GetVersion()).Equals(uint8(3))
 		v.Release()
 	})
 }
@@ -736,6 +749,122 @@ func TestStream_ClearStatusBitDebug(t *testing.T) {
 	})
 }
 
+func TestStream_HasStatusBitIdentity(t *testing.T) {
+	t.Run("test bit set", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 256; i++ {
+			v := NewStream()
+			(*v.frames[0])[streamPosStatusBit] = byte(i)
+			v.SetStatusBitIdentity()
+			assert(v.HasStatusBitIdentity()).IsTrue()
+			v.Release()
+		}
+	})
+
+	t.Run("test bit unset", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 256; i++ {
+			v := NewStream()
+			(*v.frames[0])[streamPosStatusBit] = byte(i)
+			v.ClearStatusBitIdentity()
+			assert(v.HasStatusBitIdentity()).IsFalse()
+			v.Release()
+		}
+	})
+}
+
+func TestStream_SetStatusBitIdentity(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 256; i++ {
+			v := NewStream()
+			(*v.frames[0])[streamPosStatusBit] = byte(i)
+			if !v.HasStatusBitIdentity() {
+				v.SetStatusBitIdentity()
+				assert(v.HasStatusBitIdentity()).IsTrue()
+				v.ClearStatusBitIdentity()
+			}
+			assert((*v.frames[0])[streamPosStatusBit]).Equals(byte(i))
+			v.Release()
+		}
+	})
+}
+
+func TestStream_ClearStatusBitIdentity(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 256; i++ {
+			v := NewStream()
+			(*v.frames[0])[streamPosStatusBit] = byte(i)
+			if v.HasStatusBitIdentity() {
+				v.ClearStatusBitIdentity()
+				assert(v.HasStatusBitIdentity()).IsFalse()
+				v.SetStatusBitIdentity()
+			}
+			assert((*v.frames[0])[streamPosStatusBit]).Equals(byte(i))
+			v.Release()
+		}
+	})
+}
+
+func TestStream_HasStatusBitCompressed(t *testing.T) {
+	t.Run("test bit set", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 256; i++ {
+			v := NewStream()
+			(*v.frames[0])[streamPosStatusBit] = byte(i)
+			v.SetStatusBitCompressed()
+			assert(v.HasStatusBitCompressed()).IsTrue()
+			v.Release()
+		}
+	})
+
+	t.Run("test bit unset", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 256; i++ {
+			v := NewStream()
+			(*v.frames[0])[streamPosStatusBit] = byte(i)
+			v.ClearStatusBitCompressed()
+			assert(v.HasStatusBitCompressed()).IsFalse()
+			v.Release()
+		}
+	})
+}
+
+func TestStream_SetStatusBitCompressed(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 256; i++ {
+			v := NewStream()
+			(*v.frames[0])[streamPosStatusBit] = byte(i)
+			if !v.HasStatusBitCompressed() {
+				v.SetStatusBitCompressed()
+				assert(v.HasStatusBitCompressed()).IsTrue()
+				v.ClearStatusBitCompressed()
+			}
+			assert((*v.frames[0])[streamPosStatusBit]).Equals(byte(i))
+			v.Release()
+		}
+	})
+}
+
+func TestStream_ClearStatusBitCompressed(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 256; i++ {
+			v := NewStream()
+			(*v.frames[0])[streamPosStatusBit] = byte(i)
+			if v.HasStatusBitCompressed() {
+				v.ClearStatusBitCompressed()
+				assert(v.HasStatusBitCompressed()).IsFalse()
+				v.SetStatusBitCompressed()
+			}
+			assert((*v.frames[0])[streamPosStatusBit]).Equals(byte(i))
+			v.Release()
+		}
+	})
+}
+
 func TestStream_GetLength(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -1051,6 +1180,65 @@ func TestStream_SetDepth(t *testing.T) {
 	})
 }
 
+func TestStream_GetTimeout(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 1000; i++ {
+			v := NewStream()
+			timeout := uint64(i) * uint64(time.Millisecond)
+			v.SetTimeout(timeout)
+			assert(v.GetTimeout()).Equals(timeout)
+			v.Release()
+		}
+	})
+}
+
+func TestStream_SetTimeout(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 1000; i++ {
+			v := NewStream()
+			timeout := uint64(i) * uint64(time.Second)
+			v.SetTimeout(timeout)
+			assert(v.GetTimeout()).Equals(timeout)
+			v.Release()
+		}
+	})
+}
+
+func TestStream_GetTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewStream()
+		assert(v.GetTraceContext()).Equals(TraceContext{})
+		for i := 0; i < 1000; i++ {
+			trace := NewTraceContext(i%2 == 0)
+			v.SetTraceContext(trace)
+			assert(v.GetTraceContext()).Equals(trace)
+		}
+		v.Release()
+	})
+}
+
+func TestStream_SetTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewStream()
+		v.SetTimeout(math.MaxUint64)
+		v.SetTraceContext(TraceContext{
+			TraceID: [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			SpanID:  [8]byte{17, 18, 19, 20, 21, 22, 23, 24},
+			Flags:   TraceFlagSampled,
+		})
+		assert(v.GetTimeout()).Equals(uint64(math.MaxUint64))
+		assert(v.GetBuffer()[streamPosTraceID:streamPosBody]).Equals([]byte{
+			1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+			17, 18, 19, 20, 21, 22, 23, 24, 1,
+		})
+		v.Release()
+	})
+}
+
 func TestStream_GetReadPos(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -1931,6 +2119,65 @@ func TestStream_writeRTValue(t *testing.T) {
 	})
 }
 
+func TestStream_writeStruct(t *testing.T) {
+	t.Run("struct", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		assert(stream.Write(StructTestAddr{City: "paris", Zip: 75000})).
+			Equals(StreamWriteOK)
+		assert(stream.Read()).
+			Equals(Map{"city": "paris", "Zip": int64(75000)}, nil)
+	})
+
+	t.Run("struct pointer", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		assert(stream.Write(&StructTestAddr{City: "paris"})).
+			Equals(StreamWriteOK)
+		assert(stream.Read()).Equals(Map{"city": "paris", "Zip": int64(0)}, nil)
+	})
+
+	t.Run("nil struct pointer", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		assert(stream.Write((*StructTestAddr)(nil))).Equals(StreamWriteOK)
+		assert(stream.Read()).Equals(nil, nil)
+	})
+
+	t.Run("nested in map", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		assert(stream.Write(Map{"addr": StructTestAddr{City: "paris"}})).
+			Equals(StreamWriteOK)
+		assert(stream.Read()).Equals(Map{
+			"addr": Map{"city": "paris", "Zip": int64(0)},
+		}, nil)
+	})
+
+	t.Run("unsupported struct", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		assert(stream.Write(structTestUnsupported{})).
+			Equals("value type(rpc.structTestUnsupported) is not supported")
+		assert(stream.Write(&structTestUnsupported{})).
+			Equals("value type(*rpc.structTestUnsupported) is not supported")
+		assert(stream.GetWritePos()).Equals(streamPosBody)
+	})
+
+	t.Run("error is not struct", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		assert(stream.Write(structTestError{Message: "error"})).
+			Equals("value type(rpc.structTestError) is not supported")
+	})
+}
+
 func TestStream_Write(t *testing.T) {
 	t.Run("test write", func(t *testing.T) {
 		assert := base.NewAssert(t)
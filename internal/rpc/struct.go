@@ -0,0 +1,424 @@
+package rpc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+// the struct types that are used as action arguments, keyed by the struct
+// name in the kind string. BuildCache uses it to generate the decoders.
+var structKindMap = sync.Map{}
+
+// the results of getStructFields, keyed by the struct type
+var structFieldsMap = sync.Map{}
+
+var anyType = reflect.TypeOf((*Any)(nil)).Elem()
+
+type rpcStructField struct {
+	name  string
+	index int
+	kind  reflect.Type
+}
+
+type rpcStructFields struct {
+	fields []*rpcStructField
+	err    *base.Error
+}
+
+func getStructName(structType reflect.Type) string {
+	if structType.Name() == "" {
+		return structType.String()
+	}
+
+	return structType.PkgPath() + "." + structType.Name()
+}
+
+func getStructKind(structType reflect.Type) string {
+	name := getStructName(structType)
+	structKindMap.Store(name, structType)
+	return base.ConcatString(string(vkStructBegin), name, string(vkStructEnd))
+}
+
+// getStructFields returns the encoded fields of structType. The field name is
+// the rpc tag, or the field name if the tag is empty. The fields tagged with
+// "-" are ignored. Other unexported fields are not allowed, so the types like
+// time.Time are not encoded as empty maps by mistake. The result is cached
+// per type, because it is called for every encoded or decoded struct.
+func getStructFields(structType reflect.Type) ([]*rpcStructField, *base.Error) {
+	if v, ok := structFieldsMap.Load(structType); ok {
+		ret := v.(*rpcStructFields)
+		return ret.fields, ret.err
+	}
+
+	fields, err := parseStructFields(structType)
+	structFieldsMap.Store(structType, &rpcStructFields{fields: fields, err: err})
+	return fields, err
+}
+
+func parseStructFields(structType reflect.Type) ([]*rpcStructField, *base.Error) {
+	if structType.Kind() != reflect.Struct {
+		return nil, base.ErrUnsupportedValue.AddDebug(fmt.Sprintf(
+			"type %s is not a struct",
+			structType.String(),
+		))
+	}
+
+	ret := make([]*rpcStructField, 0, structType.NumField())
+	nameMap := make(map[string]bool)
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag := field.Tag.Get("rpc")
+
+		if tag == "-" {
+			continue
+		}
+
+		if field.PkgPath != "" {
+			return nil, base.ErrUnsupportedValue.AddDebug(fmt.Sprintf(
+				"%s field %s is unexported",
+				structType.String(),
+				field.Name,
+			))
+		}
+
+		name := field.Name
+		if tag != "" {
+			name = tag
+		}
+
+		if nameMap[name] {
+			return nil, base.ErrUnsupportedValue.AddDebug(fmt.Sprintf(
+				"%s field name %s is duplicated",
+				structType.String(),
+				name,
+			))
+		}
+		nameMap[name] = true
+
+		switch field.Type {
+		case boolType, int64Type, uint64Type, float64Type, stringType,
+			bytesType, arrayType, mapType, anyType:
+		default:
+			if field.Type.Kind() != reflect.Struct {
+				return nil, base.ErrUnsupportedValue.AddDebug(fmt.Sprintf(
+					"%s field %s type %s is not supported",
+					structType.String(),
+					field.Name,
+					field.Type.String(),
+				))
+			} else if _, err := getStructFields(field.Type); err != nil {
+				return nil, err
+			}
+		}
+
+		ret = append(ret, &rpcStructField{
+			name:  name,
+			index: i,
+			kind:  field.Type,
+		})
+	}
+
+	return ret, nil
+}
+
+func structToMap(v reflect.Value) (Map, *base.Error) {
+	fields, err := getStructFields(v.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(Map, len(fields))
+	for _, field := range fields {
+		if field.kind.Kind() == reflect.Struct {
+			if m, err := structToMap(v.Field(field.index)); err != nil {
+				return nil, err
+			} else {
+				ret[field.name] = m
+			}
+		} else {
+			ret[field.name] = v.Field(field.index).Interface()
+		}
+	}
+
+	return ret, nil
+}
+
+// mapToStruct decodes m to a value of structType. The missing keys and the
+// nil values are decoded as the zero values, the other keys are ignored.
+func mapToStruct(m Map, structType reflect.Type) (reflect.Value, bool) {
+	fields, err := getStructFields(structType)
+	if err != nil {
+		return reflect.Value{}, false
+	}
+
+	ret := reflect.New(structType).Elem()
+	for _, field := range fields {
+		value, ok := m[field.name]
+		if !ok || value == nil {
+			continue
+		}
+
+		if field.kind.Kind() == reflect.Struct {
+			if fieldMap, ok := value.(Map); !ok {
+				return reflect.Value{}, false
+			} else if fieldValue, ok := mapToStruct(fieldMap, field.kind); !ok {
+				return reflect.Value{}, false
+			} else {
+				ret.Field(field.index).Set(fieldValue)
+			}
+		} else if rv := reflect.ValueOf(value); field.kind != anyType &&
+			rv.Type() != field.kind {
+			return reflect.Value{}, false
+		} else {
+			ret.Field(field.index).Set(rv)
+		}
+	}
+
+	return ret, true
+}
+
+func readStruct(stream *Stream, structType reflect.Type) (reflect.Value, bool) {
+	// rewind the stream if it fails, so the error shows the wrong value
+	readPos := stream.GetReadPos()
+
+	if m, err := stream.ReadMap(); err == nil {
+		if ret, ok := mapToStruct(m, structType); ok {
+			return ret, true
+		}
+	}
+
+	stream.SetReadPos(readPos)
+	return reflect.Value{}, false
+}
+
+func isStructImportable(structType reflect.Type) bool {
+	if name := structType.Name(); name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	} else if pkgPath := structType.PkgPath(); pkgPath == "" ||
+		pkgPath == "main" {
+		return false
+	} else {
+		fields, _ := getStructFields(structType)
+		for _, field := range fields {
+			if field.kind.Kind() == reflect.Struct &&
+				!isStructImportable(field.kind) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func getStructPkgAlias(pkgPath string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, pkgPath)
+}
+
+// parseFuncKind splits kind to the kinds of the arguments. The struct kinds
+// like "{pkg.Name}" are kept as one token.
+func parseFuncKind(kind string) ([]string, bool) {
+	ret := make([]string, 0, len(kind))
+
+	for i := 0; i < len(kind); i++ {
+		if kind[i] == vkStructBegin {
+			end := strings.IndexByte(kind[i:], vkStructEnd)
+			if end < 2 {
+				return nil, false
+			}
+			ret = append(ret, kind[i:i+end+1])
+			i += end
+		} else {
+			ret = append(ret, kind[i:i+1])
+		}
+	}
+
+	return ret, true
+}
+
+func isFuncKindImportable(kind string) bool {
+	tokens, ok := parseFuncKind(kind)
+	if !ok {
+		return false
+	}
+
+	for _, token := range tokens {
+		if token[0] != vkStructBegin {
+			continue
+		} else if structType, ok := getStructTypeByKind(token); !ok ||
+			!isStructImportable(structType) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func getStructTypeByKind(kind string) (reflect.Type, bool) {
+	if len(kind) < 3 ||
+		kind[0] != vkStructBegin ||
+		kind[len(kind)-1] != vkStructEnd {
+		return nil, false
+	} else if v, ok := structKindMap.Load(kind[1 : len(kind)-1]); !ok {
+		return nil, false
+	} else {
+		return v.(reflect.Type), true
+	}
+}
+
+func getStructTypeString(structType reflect.Type) string {
+	return getStructPkgAlias(structType.PkgPath()) + "." + structType.Name()
+}
+
+func getStructFuncName(prefix string, structType reflect.Type) string {
+	return prefix + "_" + getStructPkgAlias(structType.PkgPath()) +
+		"_" + structType.Name()
+}
+
+// getStructTypesByKinds returns the struct types used by kinds, including
+// the nested ones, sorted by name.
+func getStructTypesByKinds(kinds []string) []reflect.Type {
+	typeMap := make(map[string]reflect.Type)
+
+	var addType func(structType reflect.Type)
+	addType = func(structType reflect.Type) {
+		name := getStructName(structType)
+		if _, ok := typeMap[name]; ok {
+			return
+		}
+		typeMap[name] = structType
+
+		fields, _ := getStructFields(structType)
+		for _, field := range fields {
+			if field.kind.Kind() == reflect.Struct {
+				addType(field.kind)
+			}
+		}
+	}
+
+	for _, kind := range kinds {
+		tokens, _ := parseFuncKind(kind)
+		for _, token := range tokens {
+			if structType, ok := getStructTypeByKind(token); ok {
+				addType(structType)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(typeMap))
+	for name := range typeMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := make([]reflect.Type, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, typeMap[name])
+	}
+	return ret
+}
+
+func getStructFieldTypeString(fieldType reflect.Type) string {
+	switch fieldType {
+	case boolType:
+		return "rpc.Bool"
+	case int64Type:
+		return "rpc.Int64"
+	case uint64Type:
+		return "rpc.Uint64"
+	case float64Type:
+		return "rpc.Float64"
+	case stringType:
+		return "rpc.String"
+	case bytesType:
+		return "rpc.Bytes"
+	case arrayType:
+		return "rpc.Array"
+	case mapType:
+		return "rpc.Map"
+	default:
+		return "rpc.Any"
+	}
+}
+
+// getStructDecoderBody returns the generated readStruct and decodeStruct
+// functions of structType, they do the same as readStruct and mapToStruct
+// without reflection.
+func getStructDecoderBody(structType reflect.Type) string {
+	sb := base.NewStringBuilder()
+	defer sb.Release()
+
+	typeString := getStructTypeString(structType)
+	readName := getStructFuncName("readStruct", structType)
+	decodeName := getStructFuncName("decodeStruct", structType)
+
+	sb.AppendString(fmt.Sprintf(
+		"func %s(stream *rpc.Stream) (%s, bool) {\n", readName, typeString,
+	))
+	sb.AppendString("\treadPos := stream.GetReadPos()\n")
+	sb.AppendString("\tif m, err := stream.ReadMap(); err == nil {\n")
+	sb.AppendString(fmt.Sprintf(
+		"\t\tif ret, ok := %s(m); ok {\n\t\t\treturn ret, true\n\t\t}\n",
+		decodeName,
+	))
+	sb.AppendString("\t}\n")
+	sb.AppendString("\tstream.SetReadPos(readPos)\n")
+	sb.AppendString(fmt.Sprintf("\treturn %s{}, false\n}\n\n", typeString))
+
+	sb.AppendString(fmt.Sprintf(
+		"func %s(m rpc.Map) (%s, bool) {\n", decodeName, typeString,
+	))
+	sb.AppendString(fmt.Sprintf("\tret := %s{}\n", typeString))
+
+	fields, _ := getStructFields(structType)
+	for _, field := range fields {
+		key := strconv.Quote(field.name)
+		goName := structType.Field(field.index).Name
+
+		if field.kind == anyType {
+			sb.AppendString(fmt.Sprintf(
+				"\tif v, ok := m[%s]; ok {\n\t\tret.%s = v\n\t}\n",
+				key,
+				goName,
+			))
+		} else if field.kind.Kind() == reflect.Struct {
+			sb.AppendString(fmt.Sprintf(
+				"\tif v, ok := m[%s]; ok && v != nil {\n"+
+					"\t\tif fieldMap, ok := v.(rpc.Map); !ok {\n"+
+					"\t\t\treturn ret, false\n"+
+					"\t\t} else if ret.%s, ok = %s(fieldMap); !ok {\n"+
+					"\t\t\treturn ret, false\n"+
+					"\t\t}\n"+
+					"\t}\n",
+				key,
+				goName,
+				getStructFuncName("decodeStruct", field.kind),
+			))
+		} else {
+			sb.AppendString(fmt.Sprintf(
+				"\tif v, ok := m[%s]; ok && v != nil {\n"+
+					"\t\tif ret.%s, ok = v.(%s); !ok {\n"+
+					"\t\t\treturn ret, false\n"+
+					"\t\t}\n"+
+					"\t}\n",
+				key,
+				goName,
+				getStructFieldTypeString(field.kind),
+			))
+		}
+	}
+
+	sb.AppendString("\treturn ret, true\n}")
+	return sb.String()
+}
@@ -0,0 +1,352 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+type StructTestAddr struct {
+	City String `rpc:"city"`
+	Zip  Int64
+}
+
+type StructTestUser struct {
+	Name   String         `rpc:"name"`
+	Age    Int64          `rpc:"age"`
+	Admin  Bool           `rpc:"admin"`
+	Score  Float64        `rpc:"score"`
+	Level  Uint64         `rpc:"level"`
+	Avatar Bytes          `rpc:"avatar"`
+	Tags   Array          `rpc:"tags"`
+	Meta   Map            `rpc:"meta"`
+	Extra  Any            `rpc:"extra"`
+	Addr   StructTestAddr `rpc:"addr"`
+	Token  String         `rpc:"-"`
+}
+
+type structTestPrivate struct {
+	Name String
+}
+
+type structTestUnexported struct {
+	name String
+}
+
+type structTestDuplicate struct {
+	Name  String `rpc:"name"`
+	Alias String `rpc:"name"`
+}
+
+type structTestUnsupported struct {
+	Count int32
+}
+
+type structTestNested struct {
+	Inner structTestUnsupported
+}
+
+type StructTestPrivateNested struct {
+	Inner structTestPrivate
+}
+
+type structTestError struct {
+	Message String
+}
+
+func (p structTestError) Error() string {
+	return p.Message
+}
+
+func TestGetStructName(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStructName(reflect.TypeOf(StructTestAddr{}))).
+			Equals("github.com/rpccloud/rpc/internal/rpc.StructTestAddr")
+		assert(getStructName(reflect.TypeOf(struct{ A Bool }{}))).
+			Equals("struct { A bool }")
+	})
+}
+
+func TestGetStructKind(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		structType := reflect.TypeOf(StructTestAddr{})
+		assert(getStructKind(structType)).
+			Equals("{github.com/rpccloud/rpc/internal/rpc.StructTestAddr}")
+		assert(structKindMap.Load(getStructName(structType))).
+			Equals(structType, true)
+	})
+}
+
+func TestGetStructFields(t *testing.T) {
+	t.Run("cached", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		structType := reflect.TypeOf(StructTestAddr{})
+		fields, err := getStructFields(structType)
+		v, ok := structFieldsMap.Load(structType)
+		assert(ok, err).Equals(true, nil)
+		assert(v.(*rpcStructFields).fields).Equals(fields)
+		fields2, _ := getStructFields(structType)
+		assert(len(fields2) > 0 && fields2[0] == fields[0]).IsTrue()
+
+		_, err = getStructFields(reflect.TypeOf(3))
+		v, _ = structFieldsMap.Load(reflect.TypeOf(3))
+		assert(v.(*rpcStructFields).err).Equals(err)
+	})
+
+	t.Run("not struct", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStructFields(reflect.TypeOf(3))).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug("type int is not a struct"),
+		)
+	})
+
+	t.Run("unexported field", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStructFields(reflect.TypeOf(structTestUnexported{}))).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug(
+				"rpc.structTestUnexported field name is unexported",
+			),
+		)
+		assert(getStructFields(reflect.TypeOf(time.Time{}))).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug("time.Time field wall is unexported"),
+		)
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStructFields(reflect.TypeOf(structTestDuplicate{}))).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug(
+				"rpc.structTestDuplicate field name name is duplicated",
+			),
+		)
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStructFields(reflect.TypeOf(structTestUnsupported{}))).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug(
+				"rpc.structTestUnsupported field Count type int32 is not supported",
+			),
+		)
+		assert(getStructFields(reflect.TypeOf(structTestNested{}))).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug(
+				"rpc.structTestUnsupported field Count type int32 is not supported",
+			),
+		)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fields, err := getStructFields(reflect.TypeOf(StructTestUser{}))
+		assert(err).IsNil()
+		names := make([]string, 0)
+		for _, field := range fields {
+			names = append(names, field.name)
+		}
+		assert(names).Equals([]string{
+			"name", "age", "admin", "score", "level",
+			"avatar", "tags", "meta", "extra", "addr",
+		})
+		assert(fields[9].index, fields[9].kind).
+			Equals(9, reflect.TypeOf(StructTestAddr{}))
+	})
+}
+
+func TestStructToMap(t *testing.T) {
+	t.Run("error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(structToMap(reflect.ValueOf(structTestDuplicate{}))).Equals(
+			nil,
+			base.ErrUnsupportedValue.AddDebug(
+				"rpc.structTestDuplicate field name name is duplicated",
+			),
+		)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(structToMap(reflect.ValueOf(StructTestUser{
+			Name:  "kitty",
+			Age:   18,
+			Tags:  Array{"a"},
+			Addr:  StructTestAddr{City: "paris", Zip: 75000},
+			Token: "secret",
+		}))).Equals(Map{
+			"name":   "kitty",
+			"age":    int64(18),
+			"admin":  false,
+			"score":  float64(0),
+			"level":  uint64(0),
+			"avatar": Bytes(nil),
+			"tags":   Array{"a"},
+			"meta":   Map(nil),
+			"extra":  nil,
+			"addr":   Map{"city": "paris", "Zip": int64(75000)},
+		}, nil)
+	})
+}
+
+func TestMapToStruct(t *testing.T) {
+	userType := reflect.TypeOf(StructTestUser{})
+
+	t.Run("struct error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, ok := mapToStruct(Map{}, reflect.TypeOf(structTestDuplicate{}))
+		assert(v.IsValid(), ok).Equals(false, false)
+	})
+
+	t.Run("type not match", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, ok := mapToStruct(Map{"name": int64(3)}, userType)
+		assert(v.IsValid(), ok).Equals(false, false)
+	})
+
+	t.Run("nested is not map", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, ok := mapToStruct(Map{"addr": "paris"}, userType)
+		assert(v.IsValid(), ok).Equals(false, false)
+	})
+
+	t.Run("nested type not match", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, ok := mapToStruct(Map{"addr": Map{"city": true}}, userType)
+		assert(v.IsValid(), ok).Equals(false, false)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, ok := mapToStruct(Map{
+			"name":  "kitty",
+			"age":   int64(18),
+			"meta":  nil,
+			"extra": true,
+			"addr":  Map{"city": "paris"},
+			"other": "ignored",
+		}, userType)
+		assert(ok).IsTrue()
+		assert(v.Interface()).Equals(StructTestUser{
+			Name:  "kitty",
+			Age:   18,
+			Extra: true,
+			Addr:  StructTestAddr{City: "paris"},
+		})
+	})
+}
+
+func TestReadStruct(t *testing.T) {
+	userType := reflect.TypeOf(StructTestUser{})
+
+	t.Run("not map", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		stream.WriteString("kitty")
+		v, ok := readStruct(stream, userType)
+		assert(v.IsValid(), ok).Equals(false, false)
+		assert(stream.GetReadPos()).Equals(streamPosBody)
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		stream.Write(Map{"name": true})
+		v, ok := readStruct(stream, userType)
+		assert(v.IsValid(), ok).Equals(false, false)
+		assert(stream.GetReadPos()).Equals(streamPosBody)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		defer stream.Release()
+		stream.Write(StructTestUser{Name: "kitty"})
+		v, ok := readStruct(stream, userType)
+		assert(ok).IsTrue()
+		assert(v.Interface()).Equals(StructTestUser{
+			Name:   "kitty",
+			Avatar: Bytes{},
+			Tags:   Array{},
+			Meta:   Map{},
+		})
+		assert(stream.IsReadFinish()).IsTrue()
+	})
+}
+
+func TestIsStructImportable(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(isStructImportable(reflect.TypeOf(StructTestUser{}))).IsTrue()
+		assert(isStructImportable(reflect.TypeOf(structTestPrivate{}))).IsFalse()
+		assert(isStructImportable(reflect.TypeOf(struct{ A Bool }{}))).IsFalse()
+		assert(isStructImportable(reflect.TypeOf(StructTestPrivateNested{}))).
+			IsFalse()
+	})
+}
+
+func TestGetStructPkgAlias(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getStructPkgAlias("github.com/a-b/c_d.v2")).
+			Equals("github_com_a_b_c_d_v2")
+	})
+}
+
+func TestParseFuncKind(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(parseFuncKind("")).Equals([]string{}, true)
+		assert(parseFuncKind("SB")).Equals([]string{"S", "B"}, true)
+		assert(parseFuncKind("S{a.B}I")).Equals([]string{"S", "{a.B}", "I"}, true)
+		assert(parseFuncKind("S{}")).Equals([]string(nil), false)
+		assert(parseFuncKind("S{a.B")).Equals([]string(nil), false)
+	})
+}
+
+func TestIsFuncKindImportable(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		userKind := getStructKind(reflect.TypeOf(StructTestUser{}))
+		privateKind := getStructKind(reflect.TypeOf(structTestPrivate{}))
+		assert(isFuncKindImportable("SB")).IsTrue()
+		assert(isFuncKindImportable("S" + userKind)).IsTrue()
+		assert(isFuncKindImportable("S" + privateKind)).IsFalse()
+		assert(isFuncKindImportable("S{a.NotRegistered}")).IsFalse()
+		assert(isFuncKindImportable("S{a.B")).IsFalse()
+	})
+}
+
+func TestGetStructTypeByKind(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		structType := reflect.TypeOf(StructTestAddr{})
+		assert(getStructTypeByKind(getStructKind(structType))).
+			Equals(structType, true)
+		assert(getStructTypeByKind("{}")).Equals(nil, false)
+		assert(getStructTypeByKind("S")).Equals(nil, false)
+		assert(getStructTypeByKind("{a.NotRegistered}")).Equals(nil, false)
+	})
+}
+
+func TestGetStructTypesByKinds(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		userType := reflect.TypeOf(StructTestUser{})
+		addrType := reflect.TypeOf(StructTestAddr{})
+		userKind := getStructKind(userType)
+		assert(getStructTypesByKinds([]string{"S", "B"})).
+			Equals([]reflect.Type{})
+		assert(getStructTypesByKinds([]string{userKind, "S" + userKind})).
+			Equals([]reflect.Type{addrType, userType})
+	})
+}
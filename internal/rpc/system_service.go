@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+const systemServiceName = "$system"
+
+// systemService is shared by all the processors, it only reads the
+// description that is built after the processor has mounted the services.
+var systemService = NewService(nil).
+	On("GetServices", func(rt Runtime) Return {
+		return rt.Reply(rt.thread.processor.systemServices)
+	}).
+	On("GetActions", func(rt Runtime) Return {
+		return rt.Reply(rt.thread.processor.systemActions)
+	})
+
+// NewSystemServiceMeta returns the meta of the built-in #.$system service.
+// Clients and tools can call #.$system:GetServices and #.$system:GetActions
+// to discover the mounted services and actions at runtime.
+func NewSystemServiceMeta() *ServiceMeta {
+	return &ServiceMeta{
+		name:     systemServiceName,
+		service:  systemService,
+		fileLine: base.GetFileLine(1),
+		config:   nil,
+	}
+}
+
+func isSystemServiceMeta(parentServiceNodePath string, meta *ServiceMeta) bool {
+	return parentServiceNodePath == rootName &&
+		meta.name == systemServiceName &&
+		meta.service == systemService
+}
+
+func buildSystemServices(servicesMap map[string]*rpcServiceNode) Array {
+	paths := make([]string, 0, len(servicesMap))
+	for path := range servicesMap {
+		if path != rootName {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	ret := make(Array, 0, len(paths))
+	for _, path := range paths {
+		keys := make([]string, 0, len(servicesMap[path].config))
+		for key := range servicesMap[path].config {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		config := make(Array, len(keys))
+		for i, key := range keys {
+			config[i] = key
+		}
+
+		ret = append(ret, Map{
+			"path":   path,
+			"config": config,
+		})
+	}
+
+	return ret
+}
+
+func buildSystemActions(actionsMap map[string]*rpcActionNode) Array {
+	paths := make([]string, 0, len(actionsMap))
+	for path := range actionsMap {
+		// the hooks ($onMount, $onUnmount, $onTimer) can not be called
+		if !strings.Contains(path, ":$") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	ret := make(Array, 0, len(paths))
+	for _, path := range paths {
+		action := actionsMap[path]
+		args := make(Array, 0, len(action.argTypes))
+		for i := 1; i < len(action.argTypes); i++ {
+			args = append(args, convertTypeToString(action.argTypes[i]))
+		}
+
+		ret = append(ret, Map{
+			"path":   path,
+			"args":   args,
+			"return": convertTypeToString(returnType),
+		})
+	}
+
+	return ret
+}
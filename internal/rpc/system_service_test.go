@@ -0,0 +1,140 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+func TestNewSystemServiceMeta(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v, source := NewSystemServiceMeta(), base.GetFileLine(0)
+		assert(v.name).Equals("$system")
+		assert(v.service).Equals(systemService)
+		assert(v.fileLine).Equals(source)
+		assert(v.config).IsNil()
+	})
+}
+
+func TestIsSystemServiceMeta(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(isSystemServiceMeta(rootName, NewSystemServiceMeta())).IsTrue()
+		assert(isSystemServiceMeta("#.test", NewSystemServiceMeta())).IsFalse()
+		assert(isSystemServiceMeta(rootName, &ServiceMeta{
+			name:    "$system",
+			service: NewService(nil),
+		})).IsFalse()
+		assert(isSystemServiceMeta(rootName, &ServiceMeta{
+			name:    "system",
+			service: systemService,
+		})).IsFalse()
+	})
+}
+
+func TestBuildSystemServices(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(buildSystemServices(map[string]*rpcServiceNode{
+			"#":      {path: "#", config: Map{}},
+			"#.user": {path: "#.user", config: Map{"b": 1, "a": true}},
+			"#.test": {path: "#.test", config: Map{}},
+		})).Equals(Array{
+			Map{"path": "#.test", "config": Array{}},
+			Map{"path": "#.user", "config": Array{"a", "b"}},
+		})
+	})
+}
+
+func TestBuildSystemActions(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(buildSystemActions(map[string]*rpcActionNode{
+			"#.test:$onMount": {
+				path:     "#.test:$onMount",
+				argTypes: []reflect.Type{runtimeType},
+			},
+			"#.test:Eval": {
+				path:     "#.test:Eval",
+				argTypes: []reflect.Type{runtimeType, stringType, rtMapType},
+			},
+			"#.test:Ping": {
+				path:     "#.test:Ping",
+				argTypes: []reflect.Type{runtimeType},
+			},
+		})).Equals(Array{
+			Map{
+				"path":   "#.test:Eval",
+				"args":   Array{"rpc.String", "rpc.RTMap"},
+				"return": "rpc.Return",
+			},
+			Map{
+				"path":   "#.test:Ping",
+				"args":   Array{},
+				"return": "rpc.Return",
+			},
+		})
+	})
+}
+
+func TestSystemService(t *testing.T) {
+	helper := newTestProcessorHelper(
+		1,
+		16,
+		16,
+		2048,
+		nil,
+		time.Second,
+		[]*ServiceMeta{{
+			name: "test",
+			service: NewService(nil).
+				On("$onMount", func(rt Runtime) Return {
+					return rt.Reply(true)
+				}).
+				On("SayHello", func(rt Runtime, name String) Return {
+					return rt.Reply("hello " + name)
+				}),
+			fileLine: "",
+			config:   Map{"key": "value"},
+		}, NewSystemServiceMeta()},
+	)
+	defer helper.Close()
+
+	fnCall := func(target string) (Any, *base.Error) {
+		stream, _ := MakeInternalRequestStream(true, 0, target, "")
+		helper.GetProcessor().PutStream(stream)
+		return ParseResponseStream(<-helper.streamReceiver.streamCH)
+	}
+
+	t.Run("GetServices", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnCall("#.$system:GetServices")).Equals(Array{
+			Map{"path": "#.$system", "config": Array{}},
+			Map{"path": "#.test", "config": Array{"key"}},
+		}, nil)
+	})
+
+	t.Run("GetActions", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnCall("#.$system:GetActions")).Equals(Array{
+			Map{
+				"path":   "#.$system:GetActions",
+				"args":   Array{},
+				"return": "rpc.Return",
+			},
+			Map{
+				"path":   "#.$system:GetServices",
+				"args":   Array{},
+				"return": "rpc.Return",
+			},
+			Map{
+				"path":   "#.test:SayHello",
+				"args":   Array{"rpc.String"},
+				"return": "rpc.Return",
+			},
+		}, nil)
+	})
+}
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"runtime"
@@ -29,6 +30,13 @@ var (
 				cacheMapEntryPos:   0,
 				retStatus:          0,
 				lockStatus:         0,
+				itemSeq:            0,
+				deadlineNS:         0,
+				trace:              TraceContext{},
+				parentSpanID:       [8]byte{},
+				retErr:             nil,
+				doneCH:             nil,
+				doneTimer:          nil,
 				parentRTWritePos:   streamPosBody,
 				next:               nil,
 			}
@@ -41,6 +49,7 @@ type rpcThreadFrame struct {
 	stream             *Stream
 	actionNode         unsafe.Pointer
 	from               string
+	identity           Any
 	depth              uint16
 	cacheArrayItemsPos uint32
 	cacheMapItemsPos   uint32
@@ -48,6 +57,13 @@ type rpcThreadFrame struct {
 	cacheMapEntryPos   uint32
 	retStatus          uint32
 	lockStatus         uint64
+	itemSeq            uint64
+	deadlineNS         int64
+	trace              TraceContext
+	parentSpanID       [8]byte
+	retErr             *base.Error
+	doneCH             chan struct{}
+	doneTimer          *time.Timer
 	parentRTWritePos   int
 	next               *rpcThreadFrame
 }
@@ -60,14 +76,56 @@ func (p *rpcThreadFrame) Reset() {
 	p.stream = nil
 	atomic.StorePointer(&p.actionNode, nil)
 	p.from = ""
+	p.identity = nil
 	p.cacheArrayItemsPos = 0
 	p.cacheMapItemsPos = 0
 	p.cacheArrayEntryPos = 0
 	p.cacheMapEntryPos = 0
+	p.itemSeq = 0
+	p.deadlineNS = 0
+	p.trace = TraceContext{}
+	p.parentSpanID = [8]byte{}
+	p.retErr = nil
+	p.closeDone()
 	p.parentRTWritePos = streamPosBody
 	p.next = nil
 }
 
+func (p *rpcThreadFrame) getDone() <-chan struct{} {
+	if p.doneCH == nil {
+		doneCH := make(chan struct{})
+		p.doneCH = doneCH
+
+		if p.deadlineNS > 0 {
+			if remainNS := p.deadlineNS - base.TimeNow().UnixNano(); remainNS > 0 {
+				p.doneTimer = time.AfterFunc(time.Duration(remainNS), func() {
+					close(doneCH)
+				})
+			} else {
+				p.closeDone()
+				return doneCH
+			}
+		}
+	}
+
+	return p.doneCH
+}
+
+func (p *rpcThreadFrame) closeDone() {
+	if p.doneCH != nil {
+		// if the timer has been fired, the doneCH is closed by the timer
+		if p.doneTimer == nil || p.doneTimer.Stop() {
+			close(p.doneCH)
+		}
+		p.doneCH = nil
+		p.doneTimer = nil
+	}
+}
+
+func (p *rpcThreadFrame) isTimeout(nowNS int64) bool {
+	return p.deadlineNS > 0 && nowNS >= p.deadlineNS
+}
+
 func (p *rpcThreadFrame) Release() {
 	p.Reset()
 	rpcThreadFrameCache.Put(p)
@@ -155,7 +213,7 @@ func newThread(
 	processor *Processor,
 	closeTimeout time.Duration,
 	bufferSize uint32,
-	onEvalFinish func(*rpcThread),
+	onEvalFinish func(*rpcThread) *Stream,
 ) *rpcThread {
 	if processor == nil || onEvalFinish == nil {
 		return nil
@@ -190,9 +248,12 @@ func newThread(
 		retCH <- thread
 
 		for stream := <-inputCH; stream != nil; stream = <-inputCH {
-			thread.Eval(stream, true)
-			onEvalFinish(thread)
-			thread.Reset()
+			// onEvalFinish returns the queued stream that is evaluated next
+			for stream != nil {
+				thread.Eval(stream, true)
+				stream = onEvalFinish(thread)
+				thread.Reset()
+			}
 		}
 
 		closeCH <- true
@@ -324,6 +385,7 @@ func (p *rpcThread) Write(value interface{}, skip uint, debug bool) Return {
 	}
 
 	frame.retStatus = 2
+	frame.retErr = writeErr
 	stream.SetKind(StreamKindRPCResponseError)
 
 	if debug {
@@ -366,6 +428,49 @@ func (p *rpcThread) PutStream(stream *Stream) (ret bool) {
 	return false
 }
 
+// readArgs reads the args of the request without moving the read position,
+// ok is false if the args are wrong
+func readArgs(inStream *Stream) (args Array, ok bool) {
+	readPos := inStream.GetReadPos()
+	defer inStream.SetReadPos(readPos)
+
+	args = Array{}
+	for !inStream.IsReadFinish() {
+		if v, err := inStream.Read(); err != nil {
+			return nil, false
+		} else {
+			args = append(args, v)
+		}
+	}
+
+	return args, true
+}
+
+func (p *rpcThread) hasInterceptors(actionNode *rpcActionNode) bool {
+	return len(p.processor.interceptors) > 0 ||
+		len(actionNode.interceptors) > 0
+}
+
+func (p *rpcThread) intercept(
+	rt Runtime,
+	actionNode *rpcActionNode,
+	args Array,
+) *base.Error {
+	from := p.top.from
+	for _, interceptor := range p.processor.interceptors {
+		if err := interceptor(rt, actionNode.path, from, args); err != nil {
+			return err
+		}
+	}
+	for _, interceptor := range actionNode.interceptors {
+		if err := interceptor(rt, actionNode.path, from, args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (p *rpcThread) Eval(inStream *Stream, needCallback bool) Return {
 	timeStart := base.TimeNow()
 	frame := p.top
@@ -374,9 +479,32 @@ func (p *rpcThread) Eval(inStream *Stream, needCallback bool) Return {
 	rtID := p.sequence
 	frame.lockStatus = rtID
 	frame.retStatus = 0
+	frame.retErr = nil
+	frame.itemSeq = 0
+	frame.identity = nil
 	frame.depth = inStream.GetDepth()
+	frame.deadlineNS = 0
+	if timeout := inStream.GetTimeout(); timeout > 0 &&
+		timeout < uint64(math.MaxInt64-timeStart.UnixNano()) {
+		frame.deadlineNS = timeStart.UnixNano() + int64(timeout)
+	}
+	// the span of the action is the child of the span of the caller
+	if trace := inStream.GetTraceContext(); trace.IsValid() {
+		frame.trace = trace.newChildTraceContext()
+		frame.parentSpanID = trace.SpanID
+	} else {
+		frame.trace = NewRootTraceContext(p.processor.traceSampleRate)
+		frame.parentSpanID = [8]byte{}
+	}
 	execActionNode := (*rpcActionNode)(nil)
 	argErrorIndex := 0
+	span := (*Span)(nil)
+	access := p.processor.accessLog
+	if access != nil && !access.isSampled() {
+		access = nil
+	}
+	accessFrom := ""
+	accessArgs := Array(nil)
 
 	defer func() {
 		if v := recover(); v != nil {
@@ -421,6 +549,35 @@ func (p *rpcThread) Eval(inStream *Stream, needCallback bool) Return {
 			}
 		}
 
+		// export span
+		if span != nil {
+			span.Duration = base.TimeNow().Sub(timeStart)
+			span.Error = frame.retErr
+			p.processor.spanExporter.Export(span)
+		}
+
+		// log access
+		if access != nil {
+			actionPath := ""
+			if execActionNode != nil {
+				actionPath = execActionNode.path
+			}
+			remoteAddr := ""
+			if fn := p.processor.addrResolver; fn != nil {
+				remoteAddr = fn(inStream.GetGatewayID(), inStream.GetSessionID())
+			}
+			access.log(
+				inStream.GetSessionID(),
+				remoteAddr,
+				actionPath,
+				frame.depth,
+				accessFrom,
+				accessArgs,
+				base.TimeNow().Sub(timeStart),
+				frame.retErr,
+			)
+		}
+
 		// callback
 		inStream.SetReadPosToBodyStart()
 
@@ -429,6 +586,16 @@ func (p *rpcThread) Eval(inStream *Stream, needCallback bool) Return {
 		}
 	}()
 
+	// the gateway puts the identity of the session before the body
+	if inStream.HasStatusBitIdentity() {
+		inStream.ClearStatusBitIdentity()
+		if identity, err := inStream.Read(); err != nil {
+			return p.Write(err, 0, false)
+		} else {
+			frame.identity = identity
+		}
+	}
+
 	// set exec action node
 	actionPath, _, err := inStream.readUnsafeString()
 	if err != nil {
@@ -463,10 +630,59 @@ func (p *rpcThread) Eval(inStream *Stream, needCallback bool) Return {
 		)
 	} else if frame.from, _, err = inStream.readUnsafeString(); err != nil {
 		return p.Write(err, 0, false)
+	}
+
+	// frame.from refers to inStream, the span and the access log copy it
+	// before the response is written to inStream
+	if p.processor.spanExporter != nil && frame.trace.IsSampled() {
+		span = &Span{
+			TraceID:      frame.trace.TraceID,
+			SpanID:       frame.trace.SpanID,
+			ParentSpanID: frame.parentSpanID,
+			Flags:        frame.trace.Flags,
+			Name:         execActionNode.path,
+			From:         string([]byte(frame.from)),
+			Depth:        frame.depth,
+			StartTime:    timeStart,
+		}
+	}
+
+	// the args are read once for both of the access log and the interceptors
+	callArgs, callArgsOK := Array(nil), false
+	if (access != nil && access.redactor != nil) ||
+		p.hasInterceptors(execActionNode) {
+		callArgs, callArgsOK = readArgs(inStream)
+	}
+
+	if access != nil {
+		accessFrom = string([]byte(frame.from))
+		if access.redactor != nil && callArgsOK {
+			accessArgs = access.redactor(execActionNode.path, callArgs)
+		}
+	}
+
+	if frame.isTimeout(base.TimeNow().UnixNano()) {
+		return p.Write(
+			base.ErrRuntimeTimeout.AddDebug(base.ConcatString(
+				"rpc-call: ",
+				actionPath,
+				" timeout before it runs",
+			)),
+			0,
+			false,
+		)
 	} else {
 		// create context
 		rt := Runtime{id: rtID, thread: p}
 
+		// the action is not called if the args are wrong, so they are not
+		// intercepted
+		if callArgsOK {
+			if err := p.intercept(rt, execActionNode, callArgs); err != nil {
+				return p.Write(err, 0, false)
+			}
+		}
+
 		if fnCache := execActionNode.cacheFN; fnCache != nil {
 			argErrorIndex = fnCache(rt, inStream, execActionNode.meta.handler)
 			if argErrorIndex == 0 {
@@ -545,7 +761,16 @@ func (p *rpcThread) Eval(inStream *Stream, needCallback bool) Return {
 						argErrorIndex = i
 					}
 				default:
-					argErrorIndex = i
+					if argType := execActionNode.argTypes[i]; argType.Kind() ==
+						reflect.Struct {
+						if v, ok := readStruct(inStream, argType); ok {
+							rv = v
+						} else {
+							argErrorIndex = i
+						}
+					} else {
+						argErrorIndex = i
+					}
 				}
 
 				if argErrorIndex != 0 {
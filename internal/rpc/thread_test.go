@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"reflect"
@@ -14,7 +15,7 @@ import (
 )
 
 var (
-	fnEvalFinish = func(thread *rpcThread) {}
+	fnEvalFinish = func(thread *rpcThread) *Stream { return nil }
 	testThread   = newThread(
 		testProcessor,
 		5*time.Second,
@@ -48,6 +49,9 @@ func TestRpcThreadFrame_Reset(t *testing.T) {
 		v.cacheMapEntryPos = 7
 		v.retStatus = 1
 		v.lockStatus = 82737243243
+		v.trace = NewTraceContext(true)
+		v.parentSpanID = [8]byte{1}
+		v.retErr = base.ErrAction
 		v.parentRTWritePos = 100
 		v.next = &rpcThreadFrame{}
 		v.Reset()
@@ -61,6 +65,9 @@ func TestRpcThreadFrame_Reset(t *testing.T) {
 		assert(v.cacheMapEntryPos).Equals(uint32(0))
 		assert(v.retStatus).Equals(uint32(1))
 		assert(v.lockStatus).Equals(uint64(82737243243))
+		assert(v.trace).Equals(TraceContext{})
+		assert(v.parentSpanID).Equals([8]byte{})
+		assert(v.retErr).IsNil()
 		assert(v.parentRTWritePos).Equals(streamPosBody)
 		assert(v.next).Equals(nil)
 		v.Release()
@@ -239,8 +246,9 @@ func TestNewThread(t *testing.T) {
 				testProcessor,
 				5*time.Second,
 				2048,
-				func(thread *rpcThread) {
+				func(thread *rpcThread) *Stream {
 					chFinish <- true
+					return nil
 				},
 			)
 			v.PutStream(NewStream())
@@ -262,7 +270,7 @@ func TestRpcThread_Reset(t *testing.T) {
 			testProcessor,
 			5*time.Second,
 			2048,
-			func(thread *rpcThread) {},
+			fnEvalFinish,
 		)
 
 		v.rtStream.Write(3)
@@ -755,6 +763,230 @@ func TestRpcThread_PutStream(t *testing.T) {
 	})
 }
 
+func TestReadArgs(t *testing.T) {
+	t.Run("read error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		stream.WriteString("kitty")
+		stream.PutBytes([]byte{13})
+		stream.SetReadPosToBodyStart()
+		assert(readArgs(stream)).Equals(nil, false)
+		assert(stream.GetReadPos()).Equals(streamPosBody)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := NewStream()
+		stream.WriteString("kitty")
+		stream.WriteInt64(3)
+		stream.SetReadPosToBodyStart()
+		assert(readArgs(stream)).Equals(Array{"kitty", int64(3)}, true)
+		assert(stream.GetReadPos()).Equals(streamPosBody)
+	})
+}
+
+func TestRpcThread_hasInterceptors(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fnInterceptor := func(
+			_ Runtime,
+			_ string,
+			_ string,
+			_ Array,
+		) *base.Error {
+			return nil
+		}
+		thread := &rpcThread{processor: &Processor{}}
+		assert(thread.hasInterceptors(&rpcActionNode{})).IsFalse()
+		assert(thread.hasInterceptors(&rpcActionNode{
+			interceptors: []Interceptor{fnInterceptor},
+		})).IsTrue()
+		thread.processor.interceptors = []Interceptor{fnInterceptor}
+		assert(thread.hasInterceptors(&rpcActionNode{})).IsTrue()
+	})
+}
+
+func TestRpcThread_intercept(t *testing.T) {
+	fnTest := func(
+		fnCache ActionCache,
+		processorInterceptors []Interceptor,
+		serviceInterceptors []Interceptor,
+		childInterceptors []Interceptor,
+		target string,
+		args ...interface{},
+	) (Any, *base.Error) {
+		handler := func(rt Runtime, name String) Return {
+			return rt.Reply("hello " + name)
+		}
+		child := NewService(nil).On("SayHello", handler).
+			Use(childInterceptors...)
+		service := NewService(nil).On("SayHello", handler).
+			On("$onMount", func(rt Runtime) Return {
+				return rt.Reply(true)
+			}).
+			AddChildService("child", child, nil).
+			Use(serviceInterceptors...)
+		helper := newTestProcessorHelper(
+			1,
+			16,
+			16,
+			1024,
+			fnCache,
+			3*time.Second,
+			[]*ServiceMeta{{
+				name:     "test",
+				service:  service,
+				fileLine: "",
+			}},
+		)
+		defer helper.Close()
+		helper.GetProcessor().SetInterceptors(processorInterceptors)
+
+		if len(args) == 1 {
+			if stream, ok := args[0].(*Stream); ok {
+				helper.GetProcessor().PutStream(stream)
+				return ParseResponseStream(<-helper.streamReceiver.streamCH)
+			}
+		}
+
+		stream, _ := MakeInternalRequestStream(false, 0, target, "@", args...)
+		helper.GetProcessor().PutStream(stream)
+		return ParseResponseStream(<-helper.streamReceiver.streamCH)
+	}
+
+	t.Run("no interceptors", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, fnCache := range []ActionCache{nil, &testFuncCache{}} {
+			assert(fnTest(fnCache, nil, nil, nil, "#.test:SayHello", "kitty")).
+				Equals("hello kitty", nil)
+		}
+	})
+
+	t.Run("interceptors see the call", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, fnCache := range []ActionCache{nil, &testFuncCache{}} {
+			records := make([]string, 0)
+			fnRecord := func(name string) Interceptor {
+				return func(
+					rt Runtime,
+					path string,
+					from string,
+					args Array,
+				) *base.Error {
+					assert(rt.thread).IsNotNil()
+					assert(path).Equals("#.test.child:SayHello")
+					assert(from).Equals("@")
+					assert(args).Equals(Array{"kitty"})
+					records = append(records, name)
+					return nil
+				}
+			}
+			assert(fnTest(
+				fnCache,
+				[]Interceptor{fnRecord("p1"), fnRecord("p2")},
+				[]Interceptor{fnRecord("s1")},
+				[]Interceptor{fnRecord("c1")},
+				"#.test.child:SayHello",
+				"kitty",
+			)).Equals("hello kitty", nil)
+			assert(records).Equals([]string{"p1", "p2", "s1", "c1"})
+		}
+	})
+
+	t.Run("interceptor short-circuits", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, fnCache := range []ActionCache{nil, &testFuncCache{}} {
+			called := false
+			fnReject := func(_ Runtime, _ string, _ string, _ Array) *base.Error {
+				return base.ErrAction.AddDebug("rejected")
+			}
+			fnNext := func(_ Runtime, _ string, _ string, _ Array) *base.Error {
+				called = true
+				return nil
+			}
+			assert(fnTest(
+				fnCache,
+				nil,
+				[]Interceptor{fnReject, fnNext},
+				nil,
+				"#.test:SayHello",
+				"kitty",
+			)).Equals(nil, base.ErrAction.AddDebug("rejected").Standardize())
+			assert(called).IsFalse()
+		}
+	})
+
+	t.Run("the args are read once for the access log", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		helper := newTestProcessorHelper(
+			1,
+			16,
+			16,
+			1024,
+			nil,
+			3*time.Second,
+			[]*ServiceMeta{{
+				name: "test",
+				service: NewService(nil).
+					On("SayHello", func(rt Runtime, name String) Return {
+						return rt.Reply("hello " + name)
+					}),
+				fileLine: "",
+			}},
+		)
+		defer helper.Close()
+
+		accessArgs, interceptArgs := Array(nil), Array(nil)
+		helper.GetProcessor().SetAccessLog(
+			base.NewLogger(
+				base.ErrorLogAll,
+				base.NewJSONLogEncoder(),
+				&bytes.Buffer{},
+			),
+			1,
+			func(_ string, args Array) Array {
+				accessArgs = args
+				return args
+			},
+		)
+		helper.GetProcessor().SetInterceptors([]Interceptor{
+			func(_ Runtime, _ string, _ string, args Array) *base.Error {
+				interceptArgs = args
+				return nil
+			},
+		})
+
+		stream, _ := MakeInternalRequestStream(
+			false, 0, "#.test:SayHello", "@", "kitty",
+		)
+		helper.GetProcessor().PutStream(stream)
+		assert(ParseResponseStream(<-helper.streamReceiver.streamCH)).
+			Equals("hello kitty", nil)
+		assert(interceptArgs).Equals(Array{"kitty"})
+		assert(&accessArgs[0] == &interceptArgs[0]).IsTrue()
+	})
+
+	t.Run("the args are wrong", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		called := false
+		fnNext := func(_ Runtime, _ string, _ string, _ Array) *base.Error {
+			called = true
+			return nil
+		}
+		stream, _ := MakeInternalRequestStream(
+			false, 0, "#.test:SayHello", "@", "kitty",
+		)
+		// break the last byte of the string arg
+		stream.SetWritePos(stream.GetWritePos() - 1)
+		stream.PutBytes([]byte{1})
+		_, err := fnTest(
+			nil, []Interceptor{fnNext}, nil, nil, "#.test:SayHello", stream,
+		)
+		assert(err).IsNotNil()
+		assert(called).IsFalse()
+	})
+}
+
 func TestRpcThread_Eval(t *testing.T) {
 	t.Run("action path type is not string", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -830,6 +1062,51 @@ func TestRpcThread_Eval(t *testing.T) {
 		fnTest(true, &testFuncCache{})
 	})
 
+	t.Run("call with struct value", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fnTest := func(dbg bool, fnCache ActionCache) {
+			assert(testReply(dbg, fnCache, nil,
+				func(rt Runtime, user StructTestUser) Return {
+					return rt.Reply(&StructTestAddr{City: user.Name})
+				},
+				Map{"name": "kitty"},
+			)).Equals(Map{"city": "kitty", "Zip": int64(0)}, nil)
+		}
+		fnTest(true, nil)
+		fnTest(false, nil)
+		fnTest(true, &testFuncCache{})
+		fnTest(false, &testFuncCache{})
+	})
+
+	t.Run("struct param error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fnTest := func(dbg bool, fnCache ActionCache) {
+			stream, source := testReplyWithSource(dbg, fnCache, nil,
+				func(rt Runtime, user StructTestUser) Return {
+					return rt.Reply(true)
+				},
+				Map{"name": true},
+			)
+
+			if dbg {
+				assert(ParseResponseStream(stream)).
+					Equals(nil, base.ErrArgumentsNotMatch.AddDebug(
+						"rpc-call: #.test:Eval 1st argument does not match. "+
+							"want: rpc.StructTestUser got: rpc.Map",
+					).AddDebug("#.test:Eval "+source).Standardize())
+			} else {
+				assert(ParseResponseStream(stream)).
+					Equals(nil, base.ErrArgumentsNotMatch.AddDebug(
+						"rpc-call: #.test:Eval arguments does not match",
+					).Standardize())
+			}
+		}
+		fnTest(true, nil)
+		fnTest(false, nil)
+		fnTest(true, &testFuncCache{})
+		fnTest(false, &testFuncCache{})
+	})
+
 	t.Run("1st param error", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		fnTest := func(dbg bool, fnCache ActionCache) {
@@ -0,0 +1,138 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+const (
+	// TraceFlagSampled is the sampled flag of the W3C trace context, the spans
+	// are exported only if it is set
+	TraceFlagSampled = 0x01
+
+	traceparentVersion = "00"
+	traceparentLength  = 55
+)
+
+// TraceContext is the W3C trace context (https://www.w3.org/TR/trace-context/)
+// of a request. In the stream header, SpanID is the span of the caller. In
+// Runtime, SpanID is the span of the running action.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   uint8
+}
+
+// NewTraceContext returns a trace context that starts a new trace
+func NewTraceContext(sampled bool) TraceContext {
+	ret := TraceContext{}
+	binary.LittleEndian.PutUint64(ret.TraceID[0:], rand.Uint64())
+	binary.LittleEndian.PutUint64(ret.TraceID[8:], rand.Uint64())
+	ret.SpanID = newSpanID()
+	if sampled {
+		ret.Flags = TraceFlagSampled
+	}
+	return ret
+}
+
+// NewRootTraceContext returns a trace context that starts a new trace,
+// sampleRate (0 to 1) of the traces are sampled
+func NewRootTraceContext(sampleRate float64) TraceContext {
+	return NewTraceContext(isSampledAtRate(sampleRate))
+}
+
+// ParseTraceContext parses the traceparent header of the W3C trace context,
+// ok is false if traceparent is not valid
+func ParseTraceContext(traceparent string) (TraceContext, bool) {
+	if len(traceparent) != traceparentLength ||
+		traceparent[0:2] != traceparentVersion ||
+		traceparent[2] != '-' ||
+		traceparent[35] != '-' ||
+		traceparent[52] != '-' {
+		return TraceContext{}, false
+	}
+
+	buf, e := hex.DecodeString(base.ConcatString(
+		traceparent[3:35],
+		traceparent[36:52],
+		traceparent[53:55],
+	))
+	if e != nil {
+		return TraceContext{}, false
+	}
+
+	ret := TraceContext{Flags: buf[24]}
+	copy(ret.TraceID[:], buf[0:16])
+	copy(ret.SpanID[:], buf[16:24])
+	if !ret.IsValid() {
+		return TraceContext{}, false
+	}
+
+	return ret, true
+}
+
+// IsValid returns true if both of the TraceID and the SpanID are not zero
+func (p TraceContext) IsValid() bool {
+	return p.TraceID != [16]byte{} && p.SpanID != [8]byte{}
+}
+
+// IsSampled ...
+func (p TraceContext) IsSampled() bool {
+	return p.Flags&TraceFlagSampled != 0
+}
+
+// String returns the traceparent header of the W3C trace context
+func (p TraceContext) String() string {
+	return base.ConcatString(
+		traceparentVersion,
+		"-",
+		hex.EncodeToString(p.TraceID[:]),
+		"-",
+		hex.EncodeToString(p.SpanID[:]),
+		"-",
+		hex.EncodeToString([]byte{p.Flags}),
+	)
+}
+
+// newChildTraceContext returns the trace context of the span that is called
+// with p
+func (p TraceContext) newChildTraceContext() TraceContext {
+	return TraceContext{TraceID: p.TraceID, SpanID: newSpanID(), Flags: p.Flags}
+}
+
+func isSampledAtRate(sampleRate float64) bool {
+	return sampleRate >= 1 || (sampleRate > 0 && rand.Float64() < sampleRate)
+}
+
+func newSpanID() [8]byte {
+	ret := [8]byte{}
+	for ret == [8]byte{} {
+		binary.LittleEndian.PutUint64(ret[:], rand.Uint64())
+	}
+	return ret
+}
+
+// Span is an evaluated action. The spans of the same TraceID make the call
+// tree of a request, ParentSpanID is the span of the caller.
+type Span struct {
+	TraceID      [16]byte
+	SpanID       [8]byte
+	ParentSpanID [8]byte
+	Flags        uint8
+	Name         string
+	From         string
+	Depth        uint16
+	StartTime    time.Time
+	Duration     time.Duration
+	Error        *base.Error
+}
+
+// SpanExporter receives the spans of the sampled traces. Export is called by
+// the thread that evaluates the action, so it should not block.
+type SpanExporter interface {
+	Export(span *Span)
+}
@@ -0,0 +1,320 @@
+package rpc
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+type testSpanExporter struct {
+	spans []*Span
+	mu    sync.Mutex
+}
+
+func (p *testSpanExporter) Export(span *Span) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spans = append(p.spans, span)
+}
+
+func (p *testSpanExporter) GetSpans() []*Span {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Span(nil), p.spans...)
+}
+
+func testTraceWithExporter(
+	exporter SpanExporter,
+	sampleRate float64,
+	trace TraceContext,
+	handler interface{},
+) *Stream {
+	helper := newTestProcessorHelper(
+		1,
+		16,
+		16,
+		2048,
+		nil,
+		3*time.Second,
+		[]*ServiceMeta{{
+			name: "test",
+			service: NewService(nil).
+				On("Eval", handler).
+				On("GetTraceContext", func(rt Runtime) Return {
+					return rt.Reply(rt.GetTraceContext().String())
+				}).
+				On("Error", func(rt Runtime) Return {
+					return rt.Reply(base.ErrAction)
+				}),
+			fileLine: "",
+		}},
+	)
+	defer helper.Close()
+	helper.GetProcessor().SetSpanExporter(exporter, sampleRate)
+
+	stream, _ := MakeInternalRequestStream(false, 0, "#.test:Eval", "@")
+	stream.SetTraceContext(trace)
+	helper.GetProcessor().PutStream(stream)
+	return <-helper.streamReceiver.streamCH
+}
+
+func TestTraceBasic(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(TraceFlagSampled).Equals(1)
+		assert(traceparentVersion).Equals("00")
+		assert(traceparentLength).Equals(55)
+	})
+}
+
+func TestNewTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v1 := NewTraceContext(true)
+		assert(v1.IsValid(), v1.IsSampled()).Equals(true, true)
+		v2 := NewTraceContext(false)
+		assert(v2.IsValid(), v2.IsSampled()).Equals(true, false)
+		assert(v1.TraceID != v2.TraceID).IsTrue()
+		assert(v1.SpanID != v2.SpanID).IsTrue()
+	})
+}
+
+func TestNewRootTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v1 := NewRootTraceContext(1)
+		assert(v1.IsValid(), v1.IsSampled()).Equals(true, true)
+		v2 := NewRootTraceContext(0)
+		assert(v2.IsValid(), v2.IsSampled()).Equals(true, false)
+	})
+}
+
+func TestParseTraceContext(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseTraceContext(
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		)).Equals(TraceContext{
+			TraceID: [16]byte{
+				0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd,
+				0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c,
+			},
+			SpanID: [8]byte{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31},
+			Flags:  TraceFlagSampled,
+		}, true)
+
+		for i := 0; i < 100; i++ {
+			v := NewTraceContext(i%2 == 0)
+			assert(ParseTraceContext(v.String())).Equals(v, true)
+		}
+	})
+
+	t.Run("test error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, traceparent := range []string{
+			"",
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-0",
+			"01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			"00+0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+			"00-0af7651916cd43dd8448eb211c80319c+b7ad6b7169203331-01",
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331+01",
+			"00-0af7651916cd43dd8448eb211c80319x-b7ad6b7169203331-01",
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b716920333x-01",
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-0x",
+			"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+			"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01",
+		} {
+			assert(ParseTraceContext(traceparent)).Equals(TraceContext{}, false)
+		}
+	})
+}
+
+func TestTraceContext_IsValid(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(TraceContext{}.IsValid()).IsFalse()
+		assert(TraceContext{TraceID: [16]byte{1}}.IsValid()).IsFalse()
+		assert(TraceContext{SpanID: [8]byte{1}}.IsValid()).IsFalse()
+		assert(TraceContext{TraceID: [16]byte{1}, SpanID: [8]byte{1}}.IsValid()).
+			IsTrue()
+	})
+}
+
+func TestTraceContext_IsSampled(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(TraceContext{}.IsSampled()).IsFalse()
+		assert(TraceContext{Flags: 0xFE}.IsSampled()).IsFalse()
+		assert(TraceContext{Flags: TraceFlagSampled}.IsSampled()).IsTrue()
+	})
+}
+
+func TestTraceContext_String(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(TraceContext{}.String()).Equals(
+			"00-00000000000000000000000000000000-0000000000000000-00",
+		)
+		assert(TraceContext{
+			TraceID: [16]byte{
+				0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd,
+				0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c,
+			},
+			SpanID: [8]byte{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31},
+			Flags:  TraceFlagSampled,
+		}.String()).Equals(
+			"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		)
+	})
+}
+
+func TestTraceContext_newChildTraceContext(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		parent := NewTraceContext(false)
+		v := parent.newChildTraceContext()
+		assert(v.TraceID).Equals(parent.TraceID)
+		assert(v.Flags).Equals(parent.Flags)
+		assert(v.SpanID != parent.SpanID).IsTrue()
+		assert(v.IsValid()).IsTrue()
+	})
+}
+
+func TestIsSampledAtRate(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(isSampledAtRate(1)).IsTrue()
+		assert(isSampledAtRate(2)).IsTrue()
+		assert(isSampledAtRate(0)).IsFalse()
+		assert(isSampledAtRate(-1)).IsFalse()
+
+		sampled := 0
+		for i := 0; i < 10000; i++ {
+			if isSampledAtRate(0.5) {
+				sampled++
+			}
+		}
+		assert(sampled > 4000 && sampled < 6000).IsTrue()
+	})
+}
+
+func TestNewSpanID(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for i := 0; i < 1000; i++ {
+			assert(newSpanID() != [8]byte{}).IsTrue()
+		}
+	})
+}
+
+func TestSpanExporter(t *testing.T) {
+	t.Run("the request has no trace", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		exporter := &testSpanExporter{}
+		assert(ParseResponseStream(testTraceWithExporter(
+			exporter,
+			1,
+			TraceContext{},
+			func(rt Runtime) Return {
+				return rt.Reply(rt.GetTraceContext().IsSampled())
+			},
+		))).Equals(true, nil)
+		spans := exporter.GetSpans()
+		assert(len(spans)).Equals(1)
+		assert(spans[0].ParentSpanID).Equals([8]byte{})
+		assert(spans[0].Name).Equals("#.test:Eval")
+	})
+
+	t.Run("the request has no trace, sample rate is 0", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		exporter := &testSpanExporter{}
+		assert(ParseResponseStream(testTraceWithExporter(
+			exporter,
+			0,
+			TraceContext{},
+			func(rt Runtime) Return {
+				return rt.Reply(rt.GetTraceContext().IsSampled())
+			},
+		))).Equals(false, nil)
+		assert(len(exporter.GetSpans())).Equals(0)
+	})
+
+	t.Run("the trace is not sampled", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		exporter := &testSpanExporter{}
+		_, err := ParseResponseStream(testTraceWithExporter(
+			exporter,
+			1,
+			NewTraceContext(false),
+			func(rt Runtime) Return {
+				return rt.Reply(rt.Call("#.test:GetTraceContext"))
+			},
+		))
+		assert(err).IsNil()
+		assert(len(exporter.GetSpans())).Equals(0)
+	})
+
+	t.Run("the exporter is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(ParseResponseStream(testTraceWithExporter(
+			nil,
+			1,
+			NewTraceContext(true),
+			func(rt Runtime) Return {
+				return rt.Reply(true)
+			},
+		))).Equals(true, nil)
+	})
+
+	t.Run("the call tree is exported", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		exporter := &testSpanExporter{}
+		trace := NewTraceContext(true)
+		start := base.TimeNow()
+		rootTrace := TraceContext{}
+		childTraceparent := ""
+		assert(ParseResponseStream(testTraceWithExporter(
+			exporter,
+			1,
+			trace,
+			func(rt Runtime) Return {
+				rootTrace = rt.GetTraceContext()
+				childTraceparent, _ = rt.Call("#.test:GetTraceContext").
+					ToString()
+				_, err := rt.Call("#.test:Error").ToString()
+				return rt.Reply(err.GetCode())
+			},
+		))).Equals(uint64(base.ErrAction.GetCode()), nil)
+
+		childTrace, ok := ParseTraceContext(childTraceparent)
+		assert(ok).IsTrue()
+		assert(rootTrace.TraceID, childTrace.TraceID).
+			Equals(trace.TraceID, trace.TraceID)
+		assert(rootTrace.SpanID != trace.SpanID).IsTrue()
+		assert(childTrace.SpanID != rootTrace.SpanID).IsTrue()
+
+		spans := exporter.GetSpans()
+		assert(len(spans)).Equals(3)
+		assert(spans[0].Name, spans[0].From, spans[0].Depth).
+			Equals("#.test:GetTraceContext", "@", uint16(1))
+		assert(spans[0].SpanID, spans[0].ParentSpanID).
+			Equals(childTrace.SpanID, rootTrace.SpanID)
+		assert(spans[0].Error).IsNil()
+		assert(spans[1].Name).Equals("#.test:Error")
+		assert(spans[1].ParentSpanID).Equals(rootTrace.SpanID)
+		assert(spans[1].Error).Equals(base.ErrAction)
+		assert(spans[2].Name, spans[2].From, spans[2].Depth).
+			Equals("#.test:Eval", "@", uint16(0))
+		assert(spans[2].SpanID, spans[2].ParentSpanID).
+			Equals(rootTrace.SpanID, trace.SpanID)
+		assert(spans[2].Flags).Equals(uint8(TraceFlagSampled))
+		assert(spans[2].Error).IsNil()
+		for _, span := range spans {
+			assert(span.TraceID).Equals(trace.TraceID)
+			assert(span.StartTime.Before(start)).IsFalse()
+			assert(span.Duration >= 0).IsTrue()
+		}
+	})
+}
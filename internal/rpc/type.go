@@ -19,6 +19,10 @@ const (
 	vkRTValue = 'V'
 	vkRTArray = 'Y'
 	vkRTMap   = 'Z'
+
+	// the struct name is between vkStructBegin and vkStructEnd
+	vkStructBegin = '{'
+	vkStructEnd   = '}'
 )
 
 var (
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/rpc"
+)
+
+// Authenticator checks the credentials of a connect request. It returns the
+// identity of the session, or an error to reject the connection. tlsState is
+// nil if the connection is not a TLS connection, otherwise its
+// PeerCertificates are the client certificates of mTLS.
+type Authenticator func(
+	remoteAddr net.Addr,
+	tlsState *tls.ConnectionState,
+	credentials rpc.Map,
+) (rpc.Any, *base.Error)
+
+// NewTokenAuthenticator returns an Authenticator that reads the "token" of the
+// credentials, and accepts it if it is a key of tokens. The identity is the
+// value of the key.
+func NewTokenAuthenticator(tokens map[string]rpc.Any) Authenticator {
+	return func(
+		_ net.Addr,
+		_ *tls.ConnectionState,
+		credentials rpc.Map,
+	) (rpc.Any, *base.Error) {
+		if token, ok := credentials["token"].(string); !ok {
+			return nil, base.ErrServerAuthenticate.AddDebug("token not found")
+		} else if identity, ok := tokens[token]; !ok {
+			return nil, base.ErrServerAuthenticate.AddDebug("token is invalid")
+		} else {
+			return identity, nil
+		}
+	}
+}
+
+// NewTLSCertAuthenticator returns an Authenticator that accepts the TLS
+// connections with a client certificate. The identity is the common name of
+// the certificate. It does not verify the certificate itself, so the
+// tls.Config of the listener must set ClientAuth to
+// tls.RequireAndVerifyClientCert.
+func NewTLSCertAuthenticator() Authenticator {
+	return func(
+		_ net.Addr,
+		tlsState *tls.ConnectionState,
+		_ rpc.Map,
+	) (rpc.Any, *base.Error) {
+		if tlsState == nil {
+			return nil, base.ErrServerAuthenticate.AddDebug("tls not found")
+		} else if len(tlsState.PeerCertificates) == 0 {
+			return nil, base.ErrServerAuthenticate.AddDebug(
+				"certificate not found",
+			)
+		} else {
+			return tlsState.PeerCertificates[0].Subject.CommonName, nil
+		}
+	}
+}
+
+func getHMACTicketSign(secret []byte, identity string, expire string) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(identity + "." + expire))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MakeHMACTicket makes a ticket of identity signed by secret, the ticket is
+// valid until expire.
+func MakeHMACTicket(secret []byte, identity string, expire time.Time) string {
+	expireString := strconv.FormatInt(expire.Unix(), 10)
+	return identity + "." + expireString + "." +
+		getHMACTicketSign(secret, identity, expireString)
+}
+
+// NewHMACAuthenticator returns an Authenticator that reads the "ticket" of the
+// credentials, and accepts it if it is made by MakeHMACTicket with the same
+// secret and has not expired. The identity is the identity of the ticket.
+func NewHMACAuthenticator(secret []byte) Authenticator {
+	return func(
+		_ net.Addr,
+		_ *tls.ConnectionState,
+		credentials rpc.Map,
+	) (rpc.Any, *base.Error) {
+		ticket, ok := credentials["ticket"].(string)
+		if !ok {
+			return nil, base.ErrServerAuthenticate.AddDebug("ticket not found")
+		}
+
+		// the identity may contain dots, so split the ticket from the right
+		signPos := strings.LastIndexByte(ticket, '.')
+		if signPos < 0 {
+			return nil, base.ErrServerAuthenticate.AddDebug("ticket is invalid")
+		}
+		expirePos := strings.LastIndexByte(ticket[:signPos], '.')
+		if expirePos < 0 {
+			return nil, base.ErrServerAuthenticate.AddDebug("ticket is invalid")
+		}
+
+		identity := ticket[:expirePos]
+		expireString := ticket[expirePos+1 : signPos]
+		sign := ticket[signPos+1:]
+
+		if !hmac.Equal(
+			[]byte(sign),
+			[]byte(getHMACTicketSign(secret, identity, expireString)),
+		) {
+			return nil, base.ErrServerAuthenticate.AddDebug("ticket is invalid")
+		} else if expire, err := strconv.ParseInt(
+			expireString,
+			10,
+			64,
+		); err != nil {
+			return nil, base.ErrServerAuthenticate.AddDebug("ticket is invalid")
+		} else if base.TimeNow().Unix() >= expire {
+			return nil, base.ErrServerAuthenticate.AddDebug("ticket has expired")
+		} else {
+			return identity, nil
+		}
+	}
+}
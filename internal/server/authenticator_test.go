@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/rpc"
+)
+
+func TestNewTokenAuthenticator(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+	authenticator := NewTokenAuthenticator(map[string]rpc.Any{
+		"pass": rpc.Map{"name": "user"},
+	})
+
+	t.Run("token not found", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(authenticator(addr, nil, nil)).Equals(
+			nil,
+			base.ErrServerAuthenticate.AddDebug("token not found"),
+		)
+		assert(authenticator(addr, nil, rpc.Map{"token": 1})).Equals(
+			nil,
+			base.ErrServerAuthenticate.AddDebug("token not found"),
+		)
+	})
+
+	t.Run("token is invalid", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(authenticator(addr, nil, rpc.Map{"token": "fail"})).Equals(
+			nil,
+			base.ErrServerAuthenticate.AddDebug("token is invalid"),
+		)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(authenticator(addr, nil, rpc.Map{"token": "pass"})).
+			Equals(rpc.Map{"name": "user"}, nil)
+	})
+}
+
+func TestNewTLSCertAuthenticator(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+	authenticator := NewTLSCertAuthenticator()
+
+	t.Run("tls not found", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(authenticator(addr, nil, nil)).Equals(
+			nil,
+			base.ErrServerAuthenticate.AddDebug("tls not found"),
+		)
+	})
+
+	t.Run("certificate not found", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(authenticator(addr, &tls.ConnectionState{}, nil)).Equals(
+			nil,
+			base.ErrServerAuthenticate.AddDebug("certificate not found"),
+		)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(authenticator(addr, &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{{
+				Subject: pkix.Name{CommonName: "user"},
+			}},
+		}, nil)).Equals("user", nil)
+	})
+}
+
+func TestMakeHMACTicket(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		expire := time.Unix(1600000000, 0)
+		ticket := MakeHMACTicket([]byte("secret"), "user.name", expire)
+		assert(strings.HasPrefix(ticket, "user.name.1600000000.")).IsTrue()
+		assert(strings.TrimPrefix(ticket, "user.name.1600000000.")).
+			Equals(getHMACTicketSign([]byte("secret"), "user.name", "1600000000"))
+		assert(len(strings.TrimPrefix(ticket, "user.name.1600000000."))).
+			Equals(64)
+	})
+}
+
+func TestNewHMACAuthenticator(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
+	secret := []byte("secret")
+	authenticator := NewHMACAuthenticator(secret)
+
+	t.Run("ticket not found", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(authenticator(addr, nil, rpc.Map{})).Equals(
+			nil,
+			base.ErrServerAuthenticate.AddDebug("ticket not found"),
+		)
+	})
+
+	t.Run("ticket is invalid", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		expireString := "99999999999"
+		for _, ticket := range []string{
+			"",
+			"user",
+			"user.sign",
+			"user.99999999999.sign",
+			MakeHMACTicket([]byte("fake"), "user", base.TimeNow().Add(time.Hour)),
+			"user.abc." + getHMACTicketSign(secret, "user", "abc"),
+			"user.1." + getHMACTicketSign(secret, "other", "1"),
+			"user." + expireString + "." +
+				getHMACTicketSign(secret, "other", expireString),
+		} {
+			assert(authenticator(addr, nil, rpc.Map{"ticket": ticket})).Equals(
+				nil,
+				base.ErrServerAuthenticate.AddDebug("ticket is invalid"),
+			)
+		}
+	})
+
+	t.Run("ticket has expired", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		ticket := MakeHMACTicket(secret, "user", base.TimeNow().Add(-time.Second))
+		assert(authenticator(addr, nil, rpc.Map{"ticket": ticket})).Equals(
+			nil,
+			base.ErrServerAuthenticate.AddDebug("ticket has expired"),
+		)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		ticket := MakeHMACTicket(secret, "user.name", base.TimeNow().Add(time.Hour))
+		assert(authenticator(addr, nil, rpc.Map{"ticket": ticket})).
+			Equals("user.name", nil)
+	})
+}
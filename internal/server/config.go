@@ -26,25 +26,37 @@ type SessionConfig struct {
 	heartbeatInterval time.Duration
 	heartbeatTimeout  time.Duration
 
-	serverMaxSessions     int
-	serverSessionTimeout  time.Duration
-	serverReadBufferSize  int
-	serverWriteBufferSize int
-	serverCacheTimeout    time.Duration
+	serverMaxSessions         int
+	serverSessionTimeout      time.Duration
+	serverReadBufferSize      int
+	serverWriteBufferSize     int
+	serverCacheTimeout        time.Duration
+	serverMaxCacheItems       int
+	serverSessionStore        SessionStore
+	serverSessionSaveInterval time.Duration
+	serverSessionRateLimit    rateLimit
+	serverIPRateLimit         rateLimit
+	serverCompressThreshold   int
 }
 
 // GetDefaultSessionConfig ...
 func GetDefaultSessionConfig() *SessionConfig {
 	return &SessionConfig{
-		numOfChannels:         32,
-		transLimit:            4 * 1024 * 1024,
-		heartbeatInterval:     4 * time.Second,
-		heartbeatTimeout:      8 * time.Second,
-		serverMaxSessions:     10240000,
-		serverSessionTimeout:  120 * time.Second,
-		serverReadBufferSize:  1200,
-		serverWriteBufferSize: 1200,
-		serverCacheTimeout:    10 * time.Second,
+		numOfChannels:             32,
+		transLimit:                4 * 1024 * 1024,
+		heartbeatInterval:         4 * time.Second,
+		heartbeatTimeout:          8 * time.Second,
+		serverMaxSessions:         10240000,
+		serverSessionTimeout:      120 * time.Second,
+		serverReadBufferSize:      1200,
+		serverWriteBufferSize:     1200,
+		serverCacheTimeout:        10 * time.Second,
+		serverMaxCacheItems:       256,
+		serverSessionStore:        nil,
+		serverSessionSaveInterval: 5 * time.Second,
+		serverSessionRateLimit:    rateLimit{},
+		serverIPRateLimit:         rateLimit{},
+		serverCompressThreshold:   4096,
 	}
 }
 
@@ -107,48 +119,176 @@ func (p *SessionConfig) SetServerCacheTimeout(
 	return p
 }
 
+// SetServerMaxCacheItems sets how many items of a streaming response are kept
+// for resending after the client reconnects. 0 keeps all the items.
+func (p *SessionConfig) SetServerMaxCacheItems(
+	serverMaxCacheItems int,
+) *SessionConfig {
+	p.serverMaxCacheItems = serverMaxCacheItems
+	return p
+}
+
+// SetServerSessionStore sets the store that keeps the sessions and their reply
+// caches, so the clients can resume them after the server restarts. nil keeps
+// the sessions in the server only.
+func (p *SessionConfig) SetServerSessionStore(
+	serverSessionStore SessionStore,
+) *SessionConfig {
+	p.serverSessionStore = serverSessionStore
+	return p
+}
+
+// SetServerSessionSaveInterval sets how often the changed sessions are saved
+// to the session store. Only the sessions changed in the interval are saved.
+func (p *SessionConfig) SetServerSessionSaveInterval(
+	serverSessionSaveInterval time.Duration,
+) *SessionConfig {
+	p.serverSessionSaveInterval = serverSessionSaveInterval
+	return p
+}
+
+// SetServerSessionRateLimit limits the requests of each session. rate is the
+// requests per second, and burst is the most requests that are accepted at
+// once. The requests over the limit are replied base.ErrServerRateLimited.
+// rate <= 0 disables the limit, it is disabled by default.
+func (p *SessionConfig) SetServerSessionRateLimit(
+	rate float64,
+	burst int,
+) *SessionConfig {
+	p.serverSessionRateLimit = makeRateLimit(rate, burst)
+	return p
+}
+
+// SetServerIPRateLimit limits the requests of all the sessions that come from
+// the same remote IP, the arguments are the same as SetServerSessionRateLimit.
+func (p *SessionConfig) SetServerIPRateLimit(
+	rate float64,
+	burst int,
+) *SessionConfig {
+	p.serverIPRateLimit = makeRateLimit(rate, burst)
+	return p
+}
+
+// SetServerCompressThreshold sets the body length over which the streams are
+// compressed, if the client supports the codec. Both the server and the
+// client use it. < 0 disables the compression.
+func (p *SessionConfig) SetServerCompressThreshold(
+	serverCompressThreshold int,
+) *SessionConfig {
+	p.serverCompressThreshold = serverCompressThreshold
+	return p
+}
+
 func (p *SessionConfig) clone() *SessionConfig {
 	return &SessionConfig{
-		numOfChannels:         p.numOfChannels,
-		transLimit:            p.transLimit,
-		heartbeatInterval:     p.heartbeatInterval,
-		heartbeatTimeout:      p.heartbeatTimeout,
-		serverMaxSessions:     p.serverMaxSessions,
-		serverSessionTimeout:  p.serverSessionTimeout,
-		serverReadBufferSize:  p.serverReadBufferSize,
-		serverWriteBufferSize: p.serverWriteBufferSize,
-		serverCacheTimeout:    p.serverCacheTimeout,
+		numOfChannels:             p.numOfChannels,
+		transLimit:                p.transLimit,
+		heartbeatInterval:         p.heartbeatInterval,
+		heartbeatTimeout:          p.heartbeatTimeout,
+		serverMaxSessions:         p.serverMaxSessions,
+		serverSessionTimeout:      p.serverSessionTimeout,
+		serverReadBufferSize:      p.serverReadBufferSize,
+		serverWriteBufferSize:     p.serverWriteBufferSize,
+		serverCacheTimeout:        p.serverCacheTimeout,
+		serverMaxCacheItems:       p.serverMaxCacheItems,
+		serverSessionStore:        p.serverSessionStore,
+		serverSessionSaveInterval: p.serverSessionSaveInterval,
+		serverSessionRateLimit:    p.serverSessionRateLimit,
+		serverIPRateLimit:         p.serverIPRateLimit,
+		serverCompressThreshold:   p.serverCompressThreshold,
 	}
 }
 
+// ServerRole ...
+type ServerRole uint8
+
+const (
+	// ServerRoleAll the server runs both the gateway and the processor
+	ServerRoleAll = ServerRole(0)
+	// ServerRoleGateway the server only accepts client sessions, and sends
+	// the requests to the processors through the router
+	ServerRoleGateway = ServerRole(1)
+	// ServerRoleProcessor the server only executes the requests coming from
+	// the router
+	ServerRoleProcessor = ServerRole(2)
+)
+
+type accessLogConfig struct {
+	logger     base.ILogger
+	sampleRate float64
+	redactor   rpc.AccessLogRedactor
+}
+
 type ServerConfig struct {
+	role             ServerRole
+	routerAddr       string
+	routerTLSConfig  *tls.Config
 	logToScreen      bool
 	logFile          string
 	logLevel         base.ErrorLevel
+	logger           base.ILogger
 	numOfThreads     int
 	maxNodeDepth     int16
 	maxCallDepth     int16
 	threadBufferSize uint32
+	maxQueueSize     int
+	queueTimeout     time.Duration
 	closeTimeout     time.Duration
+	drainTimeout     time.Duration
 	actionCache      rpc.ActionCache
+	systemService    bool
+	authenticator    Authenticator
+	interceptors     []rpc.Interceptor
+	actionRateLimits map[string]rateLimit
+	spanExporter     rpc.SpanExporter
+	traceSampleRate  float64
+	accessLog        accessLogConfig
 	session          *SessionConfig
 }
 
 func GetDefaultServerConfig() *ServerConfig {
 	return &ServerConfig{
+		role:             ServerRoleAll,
+		routerAddr:       "",
+		routerTLSConfig:  nil,
 		logToScreen:      true,
 		logFile:          "",
 		logLevel:         base.ErrorLogAll,
+		logger:           nil,
 		numOfThreads:     base.MinInt(runtime.NumCPU(), 64) * 16384,
 		maxNodeDepth:     128,
 		maxCallDepth:     128,
 		threadBufferSize: 2048,
+		maxQueueSize:     10240,
+		queueTimeout:     5 * time.Second,
 		closeTimeout:     5 * time.Second,
+		drainTimeout:     5 * time.Second,
 		actionCache:      nil,
+		systemService:    false,
+		authenticator:    nil,
+		interceptors:     nil,
+		actionRateLimits: nil,
+		spanExporter:     nil,
+		traceSampleRate:  0,
+		accessLog:        accessLogConfig{},
 		session:          GetDefaultSessionConfig(),
 	}
 }
 
+func (p *ServerConfig) SetRole(role ServerRole) *ServerConfig {
+	p.role = role
+	return p
+}
+
+func (p *ServerConfig) SetRouter(
+	routerAddr string,
+	routerTLSConfig *tls.Config,
+) *ServerConfig {
+	p.routerAddr = routerAddr
+	p.routerTLSConfig = routerTLSConfig
+	return p
+}
+
 func (p *ServerConfig) SetLogToScreen(logToScreen bool) *ServerConfig {
 	p.logToScreen = logToScreen
 	return p
@@ -164,6 +304,13 @@ func (p *ServerConfig) SetLogLevel(logLevel base.ErrorLevel) *ServerConfig {
 	return p
 }
 
+// SetLogger sets the structured logger of the server, logToScreen and logFile
+// are ignored if it is not nil. The logger is closed when the server is closed.
+func (p *ServerConfig) SetLogger(logger base.ILogger) *ServerConfig {
+	p.logger = logger
+	return p
+}
+
 func (p *ServerConfig) SetNumOfThreads(numOfThreads int) *ServerConfig {
 	p.numOfThreads = numOfThreads
 	return p
@@ -186,6 +333,23 @@ func (p *ServerConfig) SetThreadBufferSize(
 	return p
 }
 
+// SetMaxQueueSize sets how many requests can wait for a free thread when all
+// the threads are busy. The requests over it are replied base.ErrServerBusy
+// at once. 0 does not limit it.
+func (p *ServerConfig) SetMaxQueueSize(maxQueueSize int) *ServerConfig {
+	p.maxQueueSize = maxQueueSize
+	return p
+}
+
+// SetQueueTimeout sets how long a request can wait for a free thread, it is
+// replied base.ErrServerBusy after that. 0 waits until a thread is free.
+func (p *ServerConfig) SetQueueTimeout(
+	queueTimeout time.Duration,
+) *ServerConfig {
+	p.queueTimeout = queueTimeout
+	return p
+}
+
 func (p *ServerConfig) SetCloseTimeout(
 	closeTimeout time.Duration,
 ) *ServerConfig {
@@ -193,6 +357,15 @@ func (p *ServerConfig) SetCloseTimeout(
 	return p
 }
 
+// SetDrainTimeout sets how long Close waits for the running requests to be
+// replied before it closes the server. 0 closes the server at once.
+func (p *ServerConfig) SetDrainTimeout(
+	drainTimeout time.Duration,
+) *ServerConfig {
+	p.drainTimeout = drainTimeout
+	return p
+}
+
 func (p *ServerConfig) SetactionCache(
 	actionCache rpc.ActionCache,
 ) *ServerConfig {
@@ -200,6 +373,79 @@ func (p *ServerConfig) SetactionCache(
 	return p
 }
 
+// SetSystemService enables or disables the built-in #.$system service. It
+// is disabled by default, because it lists the actions, their arguments and
+// the config keys to every client that can connect.
+func (p *ServerConfig) SetSystemService(systemService bool) *ServerConfig {
+	p.systemService = systemService
+	return p
+}
+
+// SetAuthenticator sets the authenticator that checks the credentials of the
+// connect requests, nil accepts all the connections
+func (p *ServerConfig) SetAuthenticator(
+	authenticator Authenticator,
+) *ServerConfig {
+	p.authenticator = authenticator
+	return p
+}
+
+// Use adds interceptors that run in order before all the actions, they run
+// before the interceptors of the services
+func (p *ServerConfig) Use(interceptors ...rpc.Interceptor) *ServerConfig {
+	p.interceptors = append(p.interceptors, interceptors...)
+	return p
+}
+
+// SetActionRateLimit limits the requests of all the sessions to the action,
+// actionPath is the same as the target of the client, such as
+// "#.user:SayHello". The arguments are the same as
+// SessionConfig.SetServerSessionRateLimit, rate <= 0 removes the limit.
+func (p *ServerConfig) SetActionRateLimit(
+	actionPath string,
+	rate float64,
+	burst int,
+) *ServerConfig {
+	if limit := makeRateLimit(rate, burst); limit.rate > 0 {
+		if p.actionRateLimits == nil {
+			p.actionRateLimits = make(map[string]rateLimit)
+		}
+		p.actionRateLimits[actionPath] = limit
+	} else {
+		delete(p.actionRateLimits, actionPath)
+	}
+
+	return p
+}
+
+// SetSpanExporter sets the exporter that receives the spans of the sampled
+// traces, nil disables it. sampleRate (0 to 1) of the traces that start in
+// the server are sampled, the requests that join a trace follow it.
+func (p *ServerConfig) SetSpanExporter(
+	exporter rpc.SpanExporter,
+	sampleRate float64,
+) *ServerConfig {
+	p.spanExporter = exporter
+	p.traceSampleRate = sampleRate
+	return p
+}
+
+// SetAccessLog logs sampleRate (0 to 1) of the RPC calls to logger, nil
+// disables it. The args are logged only if redactor is not nil, it can mask
+// the sensitive ones.
+func (p *ServerConfig) SetAccessLog(
+	logger base.ILogger,
+	sampleRate float64,
+	redactor rpc.AccessLogRedactor,
+) *ServerConfig {
+	p.accessLog = accessLogConfig{
+		logger:     logger,
+		sampleRate: sampleRate,
+		redactor:   redactor,
+	}
+	return p
+}
+
 func (p *ServerConfig) SetSession(session *SessionConfig) *ServerConfig {
 	if session == nil {
 		session = GetDefaultSessionConfig()
@@ -210,16 +456,38 @@ func (p *ServerConfig) SetSession(session *SessionConfig) *ServerConfig {
 }
 
 func (p *ServerConfig) clone() *ServerConfig {
+	actionRateLimits := map[string]rateLimit(nil)
+	if p.actionRateLimits != nil {
+		actionRateLimits = make(map[string]rateLimit)
+		for actionPath, limit := range p.actionRateLimits {
+			actionRateLimits[actionPath] = limit
+		}
+	}
+
 	return &ServerConfig{
+		role:             p.role,
+		routerAddr:       p.routerAddr,
+		routerTLSConfig:  p.routerTLSConfig,
 		logToScreen:      p.logToScreen,
 		logFile:          p.logFile,
 		logLevel:         p.logLevel,
+		logger:           p.logger,
 		numOfThreads:     p.numOfThreads,
 		maxNodeDepth:     p.maxNodeDepth,
 		maxCallDepth:     p.maxCallDepth,
 		threadBufferSize: p.threadBufferSize,
+		maxQueueSize:     p.maxQueueSize,
+		queueTimeout:     p.queueTimeout,
 		closeTimeout:     p.closeTimeout,
+		drainTimeout:     p.drainTimeout,
 		actionCache:      p.actionCache,
+		systemService:    p.systemService,
+		authenticator:    p.authenticator,
+		interceptors:     append([]rpc.Interceptor(nil), p.interceptors...),
+		actionRateLimits: actionRateLimits,
+		spanExporter:     p.spanExporter,
+		traceSampleRate:  p.traceSampleRate,
+		accessLog:        p.accessLog,
 		session:          p.session.clone(),
 	}
 }
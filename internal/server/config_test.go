@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"runtime"
 	"testing"
 	"time"
@@ -28,6 +29,12 @@ func TestGetDefaultSessionConfig(t *testing.T) {
 		assert(v.serverReadBufferSize).Equals(1200)
 		assert(v.serverWriteBufferSize).Equals(1200)
 		assert(v.serverCacheTimeout).Equals(10 * time.Second)
+		assert(v.serverMaxCacheItems).Equals(256)
+		assert(v.serverSessionStore).IsNil()
+		assert(v.serverSessionSaveInterval).Equals(5 * time.Second)
+		assert(v.serverSessionRateLimit).Equals(rateLimit{})
+		assert(v.serverIPRateLimit).Equals(rateLimit{})
+		assert(v.serverCompressThreshold).Equals(4096)
 	})
 }
 
@@ -112,6 +119,69 @@ func TestSessionConfig_SetServerCacheTimeout(t *testing.T) {
 	})
 }
 
+func TestSessionConfig_SetServerMaxCacheItems(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultSessionConfig()
+		assert(v.SetServerMaxCacheItems(16)).Equals(v)
+		assert(v.serverMaxCacheItems).Equals(16)
+	})
+}
+
+func TestSessionConfig_SetServerSessionStore(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultSessionConfig()
+		store := NewMemorySessionStore()
+		assert(v.SetServerSessionStore(store)).Equals(v)
+		assert(v.serverSessionStore).Equals(store)
+	})
+}
+
+func TestSessionConfig_SetServerSessionSaveInterval(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultSessionConfig()
+		assert(v.SetServerSessionSaveInterval(time.Second)).Equals(v)
+		assert(v.serverSessionSaveInterval).Equals(time.Second)
+	})
+}
+
+func TestSessionConfig_SetServerSessionRateLimit(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultSessionConfig()
+		assert(v.SetServerSessionRateLimit(10, 20)).Equals(v)
+		assert(v.serverSessionRateLimit).Equals(rateLimit{rate: 10, burst: 20})
+		assert(v.SetServerSessionRateLimit(10, 0)).Equals(v)
+		assert(v.serverSessionRateLimit).Equals(rateLimit{rate: 10, burst: 1})
+		assert(v.SetServerSessionRateLimit(0, 20)).Equals(v)
+		assert(v.serverSessionRateLimit).Equals(rateLimit{})
+	})
+}
+
+func TestSessionConfig_SetServerIPRateLimit(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultSessionConfig()
+		assert(v.SetServerIPRateLimit(10, 20)).Equals(v)
+		assert(v.serverIPRateLimit).Equals(rateLimit{rate: 10, burst: 20})
+		assert(v.SetServerIPRateLimit(-1, 20)).Equals(v)
+		assert(v.serverIPRateLimit).Equals(rateLimit{})
+	})
+}
+
+func TestSessionConfig_SetServerCompressThreshold(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultSessionConfig()
+		assert(v.SetServerCompressThreshold(1024)).Equals(v)
+		assert(v.serverCompressThreshold).Equals(1024)
+		assert(v.SetServerCompressThreshold(-1)).Equals(v)
+		assert(v.serverCompressThreshold).Equals(-1)
+	})
+}
+
 func TestSessionConfig_clone(t *testing.T) {
 	t.Run("test ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -124,19 +194,53 @@ func TestGetDefaultServerConfig(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		v := GetDefaultServerConfig()
+		assert(v.role).Equals(ServerRoleAll)
+		assert(v.routerAddr).Equals("")
+		assert(v.routerTLSConfig).IsNil()
 		assert(v.logToScreen).IsTrue()
 		assert(v.logFile).Equals("")
 		assert(v.logLevel).Equals(base.ErrorLogAll)
+		assert(v.logger).IsNil()
 		assert(v.numOfThreads).Equals(base.MinInt(runtime.NumCPU(), 64) * 16384)
 		assert(v.maxNodeDepth).Equals(int16(128))
 		assert(v.maxCallDepth).Equals(int16(128))
 		assert(v.threadBufferSize).Equals(uint32(2048))
+		assert(v.maxQueueSize).Equals(10240)
+		assert(v.queueTimeout).Equals(5 * time.Second)
 		assert(v.closeTimeout).Equals(5 * time.Second)
+		assert(v.drainTimeout).Equals(5 * time.Second)
 		assert(v.actionCache).Equals(nil)
+		assert(v.systemService).IsFalse()
+		assert(v.authenticator).IsNil()
+		assert(v.interceptors).IsNil()
+		assert(v.actionRateLimits).IsNil()
+		assert(v.spanExporter).IsNil()
+		assert(v.traceSampleRate).Equals(0.0)
+		assert(v.accessLog).Equals(accessLogConfig{})
 		assert(v.session).Equals(GetDefaultSessionConfig())
 	})
 }
 
+func TestServerConfig_SetRole(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		assert(v.SetRole(ServerRoleGateway)).Equals(v)
+		assert(v.role).Equals(ServerRoleGateway)
+	})
+}
+
+func TestServerConfig_SetRouter(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		tlsConfig := &tls.Config{}
+		assert(v.SetRouter("127.0.0.1:8080", tlsConfig)).Equals(v)
+		assert(v.routerAddr).Equals("127.0.0.1:8080")
+		assert(v.routerTLSConfig).Equals(tlsConfig)
+	})
+}
+
 func TestServerConfig_SetLogToScreen(t *testing.T) {
 	t.Run("test ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -164,6 +268,19 @@ func TestServerConfig_SetLogLevel(t *testing.T) {
 	})
 }
 
+func TestServerConfig_SetLogger(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		logger := base.NewLogger(base.ErrorLogAll, base.NewJSONLogEncoder())
+		assert(v.SetLogger(logger)).Equals(v)
+		assert(v.logger).Equals(logger)
+		assert(v.clone().logger).Equals(logger)
+		assert(v.SetLogger(nil)).Equals(v)
+		assert(v.logger).IsNil()
+	})
+}
+
 func TestServerConfig_SetNumOfThreads(t *testing.T) {
 	t.Run("test ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -209,6 +326,33 @@ func TestServerConfig_SetCloseTimeout(t *testing.T) {
 	})
 }
 
+func TestServerConfig_SetMaxQueueSize(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		assert(v.SetMaxQueueSize(100)).Equals(v)
+		assert(v.maxQueueSize).Equals(100)
+	})
+}
+
+func TestServerConfig_SetQueueTimeout(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		assert(v.SetQueueTimeout(time.Second)).Equals(v)
+		assert(v.queueTimeout).Equals(time.Second)
+	})
+}
+
+func TestServerConfig_SetDrainTimeout(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		assert(v.SetDrainTimeout(time.Second)).Equals(v)
+		assert(v.drainTimeout).Equals(time.Second)
+	})
+}
+
 func TestServerConfig_SetactionCache(t *testing.T) {
 	t.Run("test ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -218,6 +362,104 @@ func TestServerConfig_SetactionCache(t *testing.T) {
 	})
 }
 
+func TestServerConfig_SetSystemService(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		assert(v.SetSystemService(false)).Equals(v)
+		assert(v.systemService).IsFalse()
+		assert(v.SetSystemService(true)).Equals(v)
+		assert(v.systemService).IsTrue()
+	})
+}
+
+func TestServerConfig_SetAuthenticator(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		authenticator := NewTokenAuthenticator(nil)
+		assert(v.SetAuthenticator(authenticator)).Equals(v)
+		assert(v.authenticator).IsNotNil()
+		assert(v.clone().authenticator).IsNotNil()
+		assert(v.SetAuthenticator(nil)).Equals(v)
+		assert(v.authenticator).IsNil()
+	})
+}
+
+func TestServerConfig_Use(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		fn := func(_ rpc.Runtime, _ string, _ string, _ rpc.Array) *base.Error {
+			return nil
+		}
+		v := GetDefaultServerConfig()
+		assert(v.Use(fn)).Equals(v)
+		assert(v.Use(fn, fn)).Equals(v)
+		assert(len(v.interceptors)).Equals(3)
+		assert(len(v.clone().interceptors)).Equals(3)
+	})
+}
+
+func TestServerConfig_SetActionRateLimit(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		assert(v.SetActionRateLimit("#.user:SayHello", 10, 20)).Equals(v)
+		assert(v.SetActionRateLimit("#.user:Sleep", 5, 0)).Equals(v)
+		assert(v.actionRateLimits).Equals(map[string]rateLimit{
+			"#.user:SayHello": {rate: 10, burst: 20},
+			"#.user:Sleep":    {rate: 5, burst: 1},
+		})
+		assert(v.clone().actionRateLimits).Equals(v.actionRateLimits)
+		assert(v.SetActionRateLimit("#.user:Sleep", 0, 0)).Equals(v)
+		assert(v.actionRateLimits).Equals(map[string]rateLimit{
+			"#.user:SayHello": {rate: 10, burst: 20},
+		})
+	})
+}
+
+type testSpanExporter struct {
+	spanCH chan *rpc.Span
+}
+
+func (p *testSpanExporter) Export(span *rpc.Span) {
+	if p.spanCH != nil {
+		p.spanCH <- span
+	}
+}
+
+func TestServerConfig_SetSpanExporter(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		exporter := &testSpanExporter{}
+		assert(v.SetSpanExporter(exporter, 0.5)).Equals(v)
+		assert(v.spanExporter, v.traceSampleRate).Equals(exporter, 0.5)
+		assert(v.clone().spanExporter, v.clone().traceSampleRate).
+			Equals(exporter, 0.5)
+		assert(v.SetSpanExporter(nil, 0)).Equals(v)
+		assert(v.spanExporter).IsNil()
+	})
+}
+
+func TestServerConfig_SetAccessLog(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := GetDefaultServerConfig()
+		logger := base.NewLogger(base.ErrorLogAll, nil)
+		redactor := func(_ string, args rpc.Array) rpc.Array {
+			return args
+		}
+		assert(v.SetAccessLog(logger, 0.5, redactor)).Equals(v)
+		assert(v.accessLog.logger, v.accessLog.sampleRate).Equals(logger, 0.5)
+		assert(v.accessLog.redactor).IsNotNil()
+		assert(v.clone().accessLog.logger).Equals(logger)
+		assert(v.clone().accessLog.redactor).IsNotNil()
+		assert(v.SetAccessLog(nil, 0, nil)).Equals(v)
+		assert(v.accessLog).Equals(accessLogConfig{})
+	})
+}
+
 func TestServerConfig_SetSession(t *testing.T) {
 	t.Run("session is nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/rpc"
+)
+
+const gatewayCredentialsHeaderPrefix = "X-Rpc-"
+
+// gatewayWaiters keeps the http requests that wait for their responses. The
+// requests of the gateway use session 0, which no session has, and are told
+// apart by their callback ids.
+type gatewayWaiters struct {
+	seed    uint64
+	waiters map[uint64]chan *rpc.Stream
+	mu      sync.Mutex
+}
+
+func (p *gatewayWaiters) add() (uint64, chan *rpc.Stream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.waiters == nil {
+		p.waiters = make(map[uint64]chan *rpc.Stream)
+	}
+
+	p.seed++
+	ch := make(chan *rpc.Stream, 1)
+	p.waiters[p.seed] = ch
+	return p.seed, ch
+}
+
+func (p *gatewayWaiters) remove(callbackID uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waiters, callbackID)
+}
+
+// onResponseStream returns false if the stream is not a response of the
+// gateway. The items of the streaming responses are dropped, and so are the
+// responses whose http requests have given up.
+func (p *gatewayWaiters) onResponseStream(stream *rpc.Stream) bool {
+	if stream.GetSessionID() != 0 ||
+		stream.GetKind() == rpc.StreamKindRPCBoardCast {
+		return false
+	}
+
+	if stream.GetKind() != rpc.StreamKindRPCResponseItem {
+		p.mu.Lock()
+		ch, ok := p.waiters[stream.GetCallbackID()]
+		delete(p.waiters, stream.GetCallbackID())
+		p.mu.Unlock()
+
+		if ok {
+			ch <- stream
+			return true
+		}
+	}
+
+	stream.Release()
+	return true
+}
+
+// GatewayHandler returns a http.Handler that lets the browsers and curl call
+// the actions with JSON. "POST /user/profile/Get" with the JSON array body
+// calls "#.user.profile:Get" with the items of the array, and the reply is
+// written as JSON. An error is written as {"code": ..., "message": ...} with
+// the http status of it. Put it in the fileMap of Listen, and use
+// http.StripPrefix if it is not mounted at the root.
+//
+// The Bytes args are base64 strings. If the server has an authenticator, the
+// credentials are the headers that start with "X-Rpc-", for example
+// "X-Rpc-Token: abc" is {"token": "abc"}.
+//
+// The requests are admitted like the ones of the sessions: they are refused
+// when the server is draining, and the rate limits are applied, the session
+// limit is applied to each remote IP. It panics if the server is a
+// processor, which has no sessions to receive the responses.
+func (p *Server) GatewayHandler(timeout time.Duration) http.Handler {
+	if p.config.role == ServerRoleProcessor {
+		panic("the gateway handler can not be mounted on the processor")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		streamHub := p.streamHub
+		processor := p.processor
+		sessionServer := p.sessionServer
+		p.mu.Unlock()
+
+		if streamHub == nil || sessionServer == nil {
+			writeGatewayError(w, base.ErrServerNotRunning)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeGatewayJSON(
+				w,
+				http.StatusMethodNotAllowed,
+				getGatewayErrorJSON(base.ErrServerGatewayRequest.AddDebug(
+					"method must be POST",
+				)),
+			)
+			return
+		}
+
+		target, ok := getGatewayTarget(r.URL.Path)
+		if !ok {
+			writeGatewayError(w, base.ErrTargetNotExist.AddDebug(
+				base.ConcatString("rpc-call: ", r.URL.Path, " does not exist"),
+			))
+			return
+		}
+
+		argTypes := []string(nil)
+		if processor != nil {
+			argTypes, _ = processor.GetActionArgTypes(target)
+		}
+
+		args, err := readGatewayArgs(
+			http.MaxBytesReader(w, r.Body, int64(p.config.session.transLimit)),
+			argTypes,
+		)
+		if err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+
+		identity := rpc.Any(nil)
+		if authenticator := p.config.authenticator; authenticator != nil {
+			remoteAddr := net.Addr(nil)
+			if addr, e := net.ResolveTCPAddr("tcp", r.RemoteAddr); e == nil {
+				remoteAddr = addr
+			}
+
+			if identity, err = authenticator(
+				remoteAddr,
+				r.TLS,
+				getGatewayCredentials(r.Header),
+			); err != nil {
+				writeGatewayError(w, err)
+				return
+			}
+		}
+
+		stream, err := rpc.MakeInternalRequestStream(
+			false,
+			0,
+			target,
+			"@",
+			args...,
+		)
+		if err != nil {
+			writeGatewayError(w, base.ErrServerGatewayRequest.AddDebug(
+				err.GetMessage(),
+			))
+			return
+		}
+
+		if err := sessionServer.checkGatewayRequest(
+			getGatewayRemoteIP(r.RemoteAddr),
+			stream,
+		); err != nil {
+			stream.Release()
+			writeGatewayError(w, err)
+			return
+		}
+		stream = rpc.MakeIdentityRequestStream(stream, identity)
+
+		callbackID, ch := p.gateway.add()
+		stream.SetCallbackID(callbackID)
+		stream.SetSessionID(0)
+		if timeout > 0 {
+			stream.SetTimeout(uint64(timeout))
+		}
+		streamHub.OnReceiveStream(stream)
+
+		timer := (<-chan time.Time)(nil)
+		if timeout > 0 {
+			// the processor replies the timeout error, wait a little longer
+			t := time.NewTimer(timeout + time.Second)
+			defer t.Stop()
+			timer = t.C
+		}
+
+		select {
+		case response := <-ch:
+			ret, err := rpc.ParseResponseStream(response)
+			response.Release()
+			if err != nil {
+				writeGatewayError(w, err)
+			} else {
+				writeGatewayJSON(w, http.StatusOK, ret)
+			}
+		case <-timer:
+			p.gateway.remove(callbackID)
+			writeGatewayError(w, base.ErrServerGatewayTimeout)
+		case <-r.Context().Done():
+			p.gateway.remove(callbackID)
+		}
+	})
+}
+
+// getGatewayTarget converts "/user/profile/Get" to "#.user.profile:Get"
+func getGatewayTarget(urlPath string) (string, bool) {
+	urlPath = strings.Trim(urlPath, "/")
+	pos := strings.LastIndexByte(urlPath, '/')
+	if pos <= 0 || pos == len(urlPath)-1 {
+		return "", false
+	}
+
+	return base.ConcatString(
+		"#.",
+		strings.ReplaceAll(urlPath[:pos], "/", "."),
+		":",
+		urlPath[pos+1:],
+	), true
+}
+
+// getGatewayRemoteIP returns the IP of the remote addr without the port
+func getGatewayRemoteIP(remoteAddr string) string {
+	if host, _, e := net.SplitHostPort(remoteAddr); e == nil {
+		return host
+	}
+
+	return remoteAddr
+}
+
+func getGatewayCredentials(header http.Header) rpc.Map {
+	ret := rpc.Map{}
+	for key, values := range header {
+		if len(values) > 0 && len(key) > len(gatewayCredentialsHeaderPrefix) &&
+			strings.HasPrefix(key, gatewayCredentialsHeaderPrefix) {
+			name := strings.ToLower(key[len(gatewayCredentialsHeaderPrefix):])
+			ret[name] = values[0]
+		}
+	}
+	return ret
+}
+
+func readGatewayArgs(
+	body io.Reader,
+	argTypes []string,
+) ([]interface{}, *base.Error) {
+	values := make([]interface{}, 0)
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	if e := decoder.Decode(&values); e != nil {
+		return nil, base.ErrServerGatewayRequest.AddDebug(
+			"body must be a JSON array: " + e.Error(),
+		)
+	}
+
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		argType := ""
+		if i < len(argTypes) {
+			argType = argTypes[i]
+		}
+
+		arg, ok := convertGatewayArg(v, argType)
+		if !ok {
+			// the 1st argument of the action is rpc.Runtime
+			return nil, base.ErrServerGatewayRequest.AddDebug(
+				base.ConvertOrdinalToString(uint(i)+2) + " argument is invalid",
+			)
+		}
+		args[i] = arg
+	}
+
+	return args, nil
+}
+
+// convertGatewayArg converts the decoded JSON value to the value of argType.
+// If argType is unknown, the integers are rpc.Int64 and the other numbers
+// are rpc.Float64.
+func convertGatewayArg(v interface{}, argType string) (rpc.Any, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		switch argType {
+		case "rpc.Uint64":
+			ret, e := strconv.ParseUint(v.String(), 10, 64)
+			return ret, e == nil
+		case "rpc.Float64":
+			ret, e := v.Float64()
+			return ret, e == nil
+		default:
+			if ret, e := v.Int64(); e == nil {
+				return ret, true
+			}
+			ret, e := v.Float64()
+			return ret, e == nil && argType != "rpc.Int64"
+		}
+	case string:
+		if argType == "rpc.Bytes" {
+			ret, e := base64.StdEncoding.DecodeString(v)
+			return ret, e == nil
+		}
+		return v, true
+	case []interface{}:
+		ret := make(rpc.Array, len(v))
+		for i, item := range v {
+			if arg, ok := convertGatewayArg(item, ""); ok {
+				ret[i] = arg
+			} else {
+				return nil, false
+			}
+		}
+		return ret, true
+	case map[string]interface{}:
+		ret := make(rpc.Map, len(v))
+		for key, item := range v {
+			if arg, ok := convertGatewayArg(item, ""); ok {
+				ret[key] = arg
+			} else {
+				return nil, false
+			}
+		}
+		return ret, true
+	default:
+		// bool and nil
+		return v, true
+	}
+}
+
+// getGatewayHTTPStatus maps the error to the http status
+func getGatewayHTTPStatus(err *base.Error) int {
+	switch err.GetCode() {
+	case base.ErrTargetNotExist.GetCode():
+		return http.StatusNotFound
+	case base.ErrServerGatewayRequest.GetCode(),
+		base.ErrArgumentsNotMatch.GetCode(),
+		base.ErrUnsupportedValue.GetCode(),
+		base.ErrStream.GetCode():
+		return http.StatusBadRequest
+	case base.ErrServerAuthenticate.GetCode():
+		return http.StatusUnauthorized
+	case base.ErrServerRateLimited.GetCode():
+		return http.StatusTooManyRequests
+	case base.ErrServerNotRunning.GetCode(),
+		base.ErrServerBusy.GetCode(),
+		base.ErrServerDraining.GetCode(),
+		base.ErrServerRouterUnavailable.GetCode():
+		return http.StatusServiceUnavailable
+	case base.ErrRuntimeTimeout.GetCode(),
+		base.ErrServerGatewayTimeout.GetCode():
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func getGatewayErrorJSON(err *base.Error) map[string]interface{} {
+	return map[string]interface{}{
+		"code":    err.GetCode(),
+		"message": err.GetMessage(),
+	}
+}
+
+func writeGatewayError(w http.ResponseWriter, err *base.Error) {
+	writeGatewayJSON(w, getGatewayHTTPStatus(err), getGatewayErrorJSON(err))
+}
+
+func writeGatewayJSON(w http.ResponseWriter, status int, v interface{}) {
+	buffer := &bytes.Buffer{}
+	if e := json.NewEncoder(buffer).Encode(v); e != nil {
+		status = http.StatusInternalServerError
+		buffer.Reset()
+		_ = json.NewEncoder(buffer).Encode(getGatewayErrorJSON(
+			base.ErrUnsupportedValue.AddDebug(e.Error()),
+		))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(buffer.Bytes())
+}
@@ -0,0 +1,570 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/rpc"
+)
+
+type testGatewayErrorReader struct{}
+
+func (p testGatewayErrorReader) Read(_ []byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestGatewayWaiters_add(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &gatewayWaiters{}
+		id1, ch1 := v.add()
+		id2, ch2 := v.add()
+		assert(id1, id2).Equals(uint64(1), uint64(2))
+		assert(cap(ch1), cap(ch2)).Equals(1, 1)
+		assert(v.waiters[id1] == ch1, v.waiters[id2] == ch2).Equals(true, true)
+	})
+}
+
+func TestGatewayWaiters_remove(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &gatewayWaiters{}
+		id, _ := v.add()
+		v.remove(id)
+		assert(len(v.waiters)).Equals(0)
+		v.remove(id)
+		assert(len(v.waiters)).Equals(0)
+	})
+}
+
+func TestGatewayWaiters_onResponseStream(t *testing.T) {
+	t.Run("stream is not of the gateway", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &gatewayWaiters{}
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCResponseOK)
+		stream.SetSessionID(1)
+		assert(v.onResponseStream(stream)).IsFalse()
+		stream.SetSessionID(0)
+		stream.SetKind(rpc.StreamKindRPCBoardCast)
+		assert(v.onResponseStream(stream)).IsFalse()
+	})
+
+	t.Run("the waiter gets the response", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &gatewayWaiters{}
+		id, ch := v.add()
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCResponseOK)
+		stream.SetCallbackID(id)
+		assert(v.onResponseStream(stream)).IsTrue()
+		assert(<-ch).Equals(stream)
+		assert(len(v.waiters)).Equals(0)
+	})
+
+	t.Run("the items are dropped", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &gatewayWaiters{}
+		id, ch := v.add()
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCResponseItem)
+		stream.SetCallbackID(id)
+		assert(v.onResponseStream(stream)).IsTrue()
+		assert(len(ch), len(v.waiters)).Equals(0, 1)
+	})
+
+	t.Run("the waiter has given up", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &gatewayWaiters{}
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCResponseError)
+		stream.SetCallbackID(3)
+		assert(v.onResponseStream(stream)).IsTrue()
+	})
+}
+
+func TestGetGatewayTarget(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getGatewayTarget("")).Equals("", false)
+		assert(getGatewayTarget("/")).Equals("", false)
+		assert(getGatewayTarget("/user")).Equals("", false)
+		assert(getGatewayTarget("//user")).Equals("", false)
+		assert(getGatewayTarget("/user/")).Equals("", false)
+		assert(getGatewayTarget("/user/Login")).Equals("#.user:Login", true)
+		assert(getGatewayTarget("user/profile/Get/")).
+			Equals("#.user.profile:Get", true)
+	})
+}
+
+func TestGetGatewayRemoteIP(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(getGatewayRemoteIP("")).Equals("")
+		assert(getGatewayRemoteIP("127.0.0.1")).Equals("127.0.0.1")
+		assert(getGatewayRemoteIP("127.0.0.1:8080")).Equals("127.0.0.1")
+		assert(getGatewayRemoteIP("[::1]:8080")).Equals("::1")
+	})
+}
+
+func TestGetGatewayCredentials(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		header := http.Header{}
+		header.Set("X-Rpc-Token", "abc")
+		header.Set("X-Rpc-", "empty")
+		header.Set("Content-Type", "application/json")
+		header["X-Rpc-Ticket"] = []string{}
+		assert(getGatewayCredentials(header)).Equals(rpc.Map{"token": "abc"})
+	})
+}
+
+func TestReadGatewayArgs(t *testing.T) {
+	t.Run("read error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		args, err := readGatewayArgs(testGatewayErrorReader{}, nil)
+		assert(args).IsNil()
+		assert(err.GetCode()).Equals(base.ErrServerGatewayRequest.GetCode())
+	})
+
+	t.Run("body is not an array", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		args, err := readGatewayArgs(strings.NewReader(`{"a": 1}`), nil)
+		assert(args).IsNil()
+		assert(err.GetCode()).Equals(base.ErrServerGatewayRequest.GetCode())
+	})
+
+	t.Run("argument is invalid", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		args, err := readGatewayArgs(
+			strings.NewReader(`["kitty", 1.5]`),
+			[]string{"rpc.String", "rpc.Int64"},
+		)
+		assert(args).IsNil()
+		assert(err).Equals(base.ErrServerGatewayRequest.AddDebug(
+			"3rd argument is invalid",
+		))
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(readGatewayArgs(
+			strings.NewReader(`["kitty", 1, 2, 3, true, null, [1], {"a": 1.5}]`),
+			[]string{"rpc.String", "rpc.Uint64", "rpc.Float64"},
+		)).Equals([]interface{}{
+			"kitty", uint64(1), float64(2), int64(3), true, nil,
+			rpc.Array{int64(1)}, rpc.Map{"a": 1.5},
+		}, nil)
+	})
+}
+
+func TestConvertGatewayArg(t *testing.T) {
+	t.Run("number", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(convertGatewayArg(json.Number("3"), "rpc.Uint64")).
+			Equals(uint64(3), true)
+		assert(convertGatewayArg(json.Number("-3"), "rpc.Uint64")).
+			Equals(uint64(0), false)
+		assert(convertGatewayArg(json.Number("3"), "rpc.Float64")).
+			Equals(float64(3), true)
+		assert(convertGatewayArg(json.Number("1e999"), "rpc.Float64")).
+			Equals(math.Inf(1), false)
+		assert(convertGatewayArg(json.Number("-3"), "rpc.Int64")).
+			Equals(int64(-3), true)
+		assert(convertGatewayArg(json.Number("1.5"), "rpc.Int64")).
+			Equals(1.5, false)
+		assert(convertGatewayArg(json.Number("-3"), "")).Equals(int64(-3), true)
+		assert(convertGatewayArg(json.Number("1.5"), "")).Equals(1.5, true)
+		assert(convertGatewayArg(json.Number("1e999"), "")).
+			Equals(math.Inf(1), false)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(convertGatewayArg("AQI=", "rpc.Bytes")).
+			Equals([]byte{1, 2}, true)
+		v, ok := convertGatewayArg("!", "rpc.Bytes")
+		assert(len(v.([]byte)), ok).Equals(0, false)
+		assert(convertGatewayArg("AQI=", "rpc.String")).Equals("AQI=", true)
+		assert(convertGatewayArg("AQI=", "")).Equals("AQI=", true)
+	})
+
+	t.Run("array", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(convertGatewayArg(
+			[]interface{}{json.Number("1"), "a"},
+			"rpc.Array",
+		)).Equals(rpc.Array{int64(1), "a"}, true)
+		assert(convertGatewayArg(
+			[]interface{}{json.Number("1e999")},
+			"rpc.Array",
+		)).Equals(nil, false)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(convertGatewayArg(
+			map[string]interface{}{"a": json.Number("1")},
+			"rpc.Map",
+		)).Equals(rpc.Map{"a": int64(1)}, true)
+		assert(convertGatewayArg(
+			map[string]interface{}{"a": json.Number("1e999")},
+			"rpc.Map",
+		)).Equals(nil, false)
+	})
+
+	t.Run("others", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(convertGatewayArg(true, "rpc.Bool")).Equals(true, true)
+		assert(convertGatewayArg(nil, "")).Equals(nil, true)
+	})
+}
+
+func TestGetGatewayHTTPStatus(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for status, errors := range map[int][]*base.Error{
+			http.StatusNotFound: {base.ErrTargetNotExist},
+			http.StatusBadRequest: {
+				base.ErrServerGatewayRequest.AddDebug("debug"),
+				base.ErrArgumentsNotMatch,
+				base.ErrUnsupportedValue,
+				base.ErrStream,
+			},
+			http.StatusUnauthorized:    {base.ErrServerAuthenticate},
+			http.StatusTooManyRequests: {base.ErrServerRateLimited},
+			http.StatusServiceUnavailable: {
+				base.ErrServerNotRunning,
+				base.ErrServerBusy,
+				base.ErrServerDraining,
+				base.ErrServerRouterUnavailable,
+			},
+			http.StatusGatewayTimeout: {
+				base.ErrRuntimeTimeout,
+				base.ErrServerGatewayTimeout,
+			},
+			http.StatusInternalServerError: {
+				base.ErrAction,
+				base.ErrActionPanic,
+			},
+		} {
+			for _, err := range errors {
+				assert(getGatewayHTTPStatus(err)).Equals(status)
+			}
+		}
+	})
+}
+
+func TestWriteGatewayJSON(t *testing.T) {
+	t.Run("encode error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		w := httptest.NewRecorder()
+		writeGatewayJSON(w, http.StatusOK, math.NaN())
+		assert(w.Code).Equals(http.StatusInternalServerError)
+		assert(w.Header().Get("Content-Type")).Equals("application/json")
+		assert(strings.HasPrefix(w.Body.String(), fmt.Sprintf(
+			"{\"code\":%d,\"message\":\"json: unsupported value: NaN",
+			base.ErrUnsupportedValue.GetCode(),
+		))).IsTrue()
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		w := httptest.NewRecorder()
+		writeGatewayJSON(w, http.StatusCreated, rpc.Map{"a": rpc.Bytes{1, 2}})
+		assert(w.Code).Equals(http.StatusCreated)
+		assert(w.Header().Get("Content-Type")).Equals("application/json")
+		assert(w.Body.String()).Equals("{\"a\":\"AQI=\"}\n")
+	})
+}
+
+func TestWriteGatewayError(t *testing.T) {
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		w := httptest.NewRecorder()
+		writeGatewayError(w, base.ErrTargetNotExist.AddDebug("not found"))
+		assert(w.Code).Equals(http.StatusNotFound)
+		assert(w.Body.String()).Equals(fmt.Sprintf(
+			"{\"code\":%d,\"message\":\"not found\"}\n",
+			base.ErrTargetNotExist.GetCode(),
+		))
+	})
+}
+
+func TestServer_GatewayHandler(t *testing.T) {
+	fnPost := func(
+		handler http.Handler,
+		method string,
+		target string,
+		body string,
+		header http.Header,
+	) (int, string) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		handler.ServeHTTP(w, r)
+		ret, _ := ioutil.ReadAll(w.Result().Body)
+		return w.Code, string(ret)
+	}
+
+	fnServer := func(config *ServerConfig, fn func(s *Server)) bool {
+		service := rpc.NewService(nil).
+			On("Add", func(rt rpc.Runtime, a rpc.Uint64, b rpc.Float64) rpc.Return {
+				return rt.Reply(float64(a) + b)
+			}).
+			On("Echo", func(rt rpc.Runtime, v rpc.Map) rpc.Return {
+				return rt.Reply(v)
+			}).
+			On("GetIdentity", func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply(rt.GetIdentity())
+			}).
+			On("Error", func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply(base.ErrAction.AddDebug("action error"))
+			}).
+			On("Sleep", func(rt rpc.Runtime) rpc.Return {
+				time.Sleep(1500 * time.Millisecond)
+				return rt.Reply(true)
+			})
+		s := NewServer(config.SetNumOfThreads(256)).
+			Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("user", rpc.NewService(nil).AddChildService(
+				"profile", service, nil,
+			), nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+			fn(s)
+			s.Close()
+		}()
+
+		return s.Open()
+	}
+
+	t.Run("server is not running", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnPost(
+			NewServer(nil).GatewayHandler(time.Second),
+			http.MethodPost, "/user/profile/Echo", "[1]", nil,
+		)).Equals(http.StatusServiceUnavailable, fmt.Sprintf(
+			"{\"code\":%d,\"message\":\"it is not running\"}\n",
+			base.ErrServerNotRunning.GetCode(),
+		))
+	})
+
+	t.Run("server is a processor", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(base.RunWithCatchPanic(func() {
+			NewServer(
+				GetDefaultServerConfig().SetRole(ServerRoleProcessor),
+			).GatewayHandler(time.Second)
+		})).Equals("the gateway handler can not be mounted on the processor")
+	})
+
+	t.Run("server is draining", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnServer(GetDefaultServerConfig(), func(s *Server) {
+			s.sessionServer.Drain(0)
+			code, body := fnPost(
+				s.GatewayHandler(time.Second),
+				http.MethodPost, "/user/profile/Add", "[1, 2.5]", nil,
+			)
+			assert(code).Equals(http.StatusServiceUnavailable)
+			assert(body).Equals(fmt.Sprintf(
+				"{\"code\":%d,\"message\":\"server is draining\"}\n",
+				base.ErrServerDraining.GetCode(),
+			))
+		})).IsTrue()
+	})
+
+	t.Run("rate limits", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		configs := []*ServerConfig{
+			GetDefaultServerConfig().SetSession(
+				GetDefaultSessionConfig().SetServerSessionRateLimit(0.001, 1),
+			),
+			GetDefaultServerConfig().SetSession(
+				GetDefaultSessionConfig().SetServerIPRateLimit(0.001, 1),
+			),
+			GetDefaultServerConfig().
+				SetActionRateLimit("#.user.profile:Add", 0.001, 1),
+		}
+
+		for _, config := range configs {
+			assert(fnServer(config, func(s *Server) {
+				handler := s.GatewayHandler(time.Second)
+				assert(fnPost(
+					handler, http.MethodPost, "/user/profile/Add",
+					"[1, 2.5]", nil,
+				)).Equals(http.StatusOK, "3.5\n")
+				code, _ := fnPost(
+					handler, http.MethodPost, "/user/profile/Add",
+					"[1, 2.5]", nil,
+				)
+				assert(code).Equals(http.StatusTooManyRequests)
+			})).IsTrue()
+		}
+	})
+
+	t.Run("method is not POST", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnServer(GetDefaultServerConfig(), func(s *Server) {
+			w := httptest.NewRecorder()
+			s.GatewayHandler(time.Second).ServeHTTP(
+				w,
+				httptest.NewRequest(http.MethodGet, "/user/profile/Echo", nil),
+			)
+			assert(w.Code).Equals(http.StatusMethodNotAllowed)
+			assert(w.Header().Get("Allow")).Equals(http.MethodPost)
+		})).IsTrue()
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnServer(GetDefaultServerConfig(), func(s *Server) {
+			handler := s.GatewayHandler(time.Second)
+			assert(fnPost(
+				handler, http.MethodPost, "/user/profile/Add", "[1, 2.5]", nil,
+			)).Equals(http.StatusOK, "3.5\n")
+			assert(fnPost(
+				handler, http.MethodPost, "/user/profile/Echo",
+				`[{"a": [1, "b", null, true]}]`, nil,
+			)).Equals(http.StatusOK, "{\"a\":[1,\"b\",null,true]}\n")
+			assert(fnPost(
+				handler, http.MethodPost, "/user/profile/GetIdentity", "[]", nil,
+			)).Equals(http.StatusOK, "null\n")
+		})).IsTrue()
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnServer(GetDefaultServerConfig(), func(s *Server) {
+			handler := s.GatewayHandler(100 * time.Millisecond)
+			code, _ := fnPost(handler, http.MethodPost, "/user", "[]", nil)
+			assert(code).Equals(http.StatusNotFound)
+			code, _ = fnPost(
+				handler, http.MethodPost, "/user/profile/None", "[]", nil,
+			)
+			assert(code).Equals(http.StatusNotFound)
+			code, _ = fnPost(
+				handler, http.MethodPost, "/user/profile/Add", "[1]", nil,
+			)
+			assert(code).Equals(http.StatusBadRequest)
+			code, _ = fnPost(
+				handler, http.MethodPost, "/user/profile/Add", "[-1, 2]", nil,
+			)
+			assert(code).Equals(http.StatusBadRequest)
+			code, _ = fnPost(
+				handler, http.MethodPost, "/user/profile/Echo", "1", nil,
+			)
+			assert(code).Equals(http.StatusBadRequest)
+			code, body := fnPost(
+				handler, http.MethodPost, "/user/profile/Error", "[]", nil,
+			)
+			assert(code).Equals(http.StatusInternalServerError)
+			assert(strings.HasPrefix(body, fmt.Sprintf(
+				"{\"code\":%d,\"message\":\"action error\\n",
+				base.ErrAction.GetCode(),
+			))).IsTrue()
+			code, _ = fnPost(
+				handler, http.MethodPost, "/user/profile/Sleep", "[]", nil,
+			)
+			assert(code).Equals(http.StatusGatewayTimeout)
+		})).IsTrue()
+	})
+
+	t.Run("body is too large", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnServer(
+			GetDefaultServerConfig().SetSession(
+				GetDefaultSessionConfig().SetTransLimit(16),
+			),
+			func(s *Server) {
+				code, _ := fnPost(
+					s.GatewayHandler(time.Second),
+					http.MethodPost,
+					"/user/profile/Echo",
+					`["`+strings.Repeat("a", 32)+`"]`,
+					nil,
+				)
+				assert(code).Equals(http.StatusBadRequest)
+			},
+		)).IsTrue()
+	})
+
+	t.Run("authenticator", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(fnServer(
+			GetDefaultServerConfig().SetAuthenticator(
+				func(
+					remoteAddr net.Addr,
+					_ *tls.ConnectionState,
+					credentials rpc.Map,
+				) (rpc.Any, *base.Error) {
+					if remoteAddr == nil || credentials["token"] != "abc" {
+						return nil, base.ErrServerAuthenticate
+					}
+					return "kitty", nil
+				},
+			),
+			func(s *Server) {
+				handler := s.GatewayHandler(time.Second)
+				code, _ := fnPost(
+					handler, http.MethodPost, "/user/profile/GetIdentity",
+					"[]", nil,
+				)
+				assert(code).Equals(http.StatusUnauthorized)
+				assert(fnPost(
+					handler, http.MethodPost, "/user/profile/GetIdentity",
+					"[]", http.Header{"X-Rpc-Token": {"abc"}},
+				)).Equals(http.StatusOK, "\"kitty\"\n")
+			},
+		)).IsTrue()
+	})
+
+	t.Run("mounted in the fileMap", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		s := NewServer(GetDefaultServerConfig().SetNumOfThreads(256))
+		s.Listen("ws", "0.0.0.0:1234", "/ws", nil, map[string]http.Handler{
+			"/api/": http.StripPrefix("/api", s.GatewayHandler(time.Second)),
+		}).AddService("test", rpc.NewService(nil).
+			On("SayHello", func(rt rpc.Runtime, name rpc.String) rpc.Return {
+				return rt.Reply("Hello " + name)
+			}), nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			response, e := http.Post(
+				"http://127.0.0.1:1234/api/test/SayHello",
+				"application/json",
+				bytes.NewReader([]byte(`["kitty"]`)),
+			)
+			assert(e).IsNil()
+			body, _ := ioutil.ReadAll(response.Body)
+			_ = response.Body.Close()
+			assert(response.StatusCode, string(body)).
+				Equals(http.StatusOK, "\"Hello kitty\"\n")
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+}
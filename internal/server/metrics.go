@@ -0,0 +1,170 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/metrics"
+)
+
+const (
+	metricsCPUInterval       = 100 * time.Millisecond
+	metricsCPUSampleInterval = time.Second
+)
+
+var metricsLabelReplacer = strings.NewReplacer(
+	"\\", "\\\\",
+	"\"", "\\\"",
+	"\n", "\\n",
+)
+
+func formatMetricsFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeActionMetrics(
+	sb *base.StringBuilder,
+	indicators map[string]*base.PerformanceIndicator,
+) {
+	paths := make([]string, 0, len(indicators))
+	for path := range indicators {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	sb.AppendString("# HELP rpc_action_calls_total Total number of action calls.\n")
+	sb.AppendString("# TYPE rpc_action_calls_total counter\n")
+	for _, path := range paths {
+		successArray, failArray := indicators[path].GetCounts()
+		success, fail := int64(0), int64(0)
+		for i := 0; i < len(successArray); i++ {
+			success += successArray[i]
+			fail += failArray[i]
+		}
+		label := metricsLabelReplacer.Replace(path)
+		sb.AppendString("rpc_action_calls_total{path=\"" + label +
+			"\",result=\"success\"} " + strconv.FormatInt(success, 10) + "\n")
+		sb.AppendString("rpc_action_calls_total{path=\"" + label +
+			"\",result=\"fail\"} " + strconv.FormatInt(fail, 10) + "\n")
+	}
+
+	sb.AppendString("# HELP rpc_action_duration_seconds Action call latency.\n")
+	sb.AppendString("# TYPE rpc_action_duration_seconds histogram\n")
+	for _, path := range paths {
+		successArray, failArray := indicators[path].GetCounts()
+		label := metricsLabelReplacer.Replace(path)
+		total := int64(0)
+		for i := 0; i < len(successArray); i++ {
+			total += successArray[i] + failArray[i]
+			le := "+Inf"
+			if i < len(base.PerformanceBuckets) {
+				le = formatMetricsFloat(base.PerformanceBuckets[i].Seconds())
+			}
+			sb.AppendString("rpc_action_duration_seconds_bucket{path=\"" +
+				label + "\",le=\"" + le + "\"} " +
+				strconv.FormatInt(total, 10) + "\n")
+		}
+		sb.AppendString("rpc_action_duration_seconds_sum{path=\"" +
+			label + "\"} " + formatMetricsFloat(
+			indicators[path].GetTotalDuration().Seconds(),
+		) + "\n")
+		sb.AppendString("rpc_action_duration_seconds_count{path=\"" +
+			label + "\"} " + strconv.FormatInt(total, 10) + "\n")
+	}
+}
+
+func writeQueueMetrics(sb *base.StringBuilder, depth int, rejected int64) {
+	sb.AppendString("# HELP rpc_queue_depth Number of requests waiting " +
+		"for a free thread.\n")
+	sb.AppendString("# TYPE rpc_queue_depth gauge\n")
+	sb.AppendString("rpc_queue_depth " + strconv.Itoa(depth) + "\n")
+	sb.AppendString("# HELP rpc_queue_rejected_total Total number of " +
+		"requests rejected because the server is busy.\n")
+	sb.AppendString("# TYPE rpc_queue_rejected_total counter\n")
+	sb.AppendString(
+		"rpc_queue_rejected_total " + strconv.FormatInt(rejected, 10) + "\n",
+	)
+}
+
+func writeSessionMetrics(sb *base.StringBuilder, totalSessions int64) {
+	sb.AppendString("# HELP rpc_sessions Number of sessions.\n")
+	sb.AppendString("# TYPE rpc_sessions gauge\n")
+	sb.AppendString(
+		"rpc_sessions " + strconv.FormatInt(totalSessions, 10) + "\n",
+	)
+}
+
+func writeCPUMetrics(sb *base.StringBuilder, m *metrics.Metrics) {
+	sb.AppendString("# HELP rpc_cpu_usage CPU usage between 0 and 1.\n")
+	sb.AppendString("# TYPE rpc_cpu_usage gauge\n")
+	sb.AppendString("rpc_cpu_usage " + formatMetricsFloat(m.GetCPU()) + "\n")
+}
+
+// sampleCPU measures the cpu usage in the background until closeCH is
+// closed, so the scrapes do not wait for the measurement
+func (p *Server) sampleCPU(closeCH chan bool) {
+	for {
+		m := metrics.GetMetrics(metricsCPUInterval)
+
+		// Close resets cpuMetrics under the lock, so check closeCH under it
+		p.mu.Lock()
+		select {
+		case <-closeCH:
+			p.mu.Unlock()
+			return
+		default:
+			p.cpuMetrics = m
+			p.mu.Unlock()
+		}
+
+		select {
+		case <-closeCH:
+			return
+		case <-time.After(metricsCPUSampleInterval):
+		}
+	}
+}
+
+// MetricsHandler returns a http.Handler that exports the action counters,
+// the request queue, the number of sessions and the cpu usage in Prometheus
+// text format. Put it
+// in the fileMap of Listen, for example {"/metrics": s.MetricsHandler()}.
+// The cpu usage is sampled in the background while the server is running.
+func (p *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		processor := p.processor
+		sessionServer := p.sessionServer
+		cpuMetrics := p.cpuMetrics
+		p.mu.Unlock()
+
+		sb := base.NewStringBuilder()
+		defer sb.Release()
+
+		if processor != nil {
+			if indicators := processor.GetActionIndicators(); indicators != nil {
+				writeActionMetrics(sb, indicators)
+			}
+			writeQueueMetrics(
+				sb,
+				processor.GetQueueDepth(),
+				processor.GetRejectedCount(),
+			)
+		}
+
+		if sessionServer != nil {
+			writeSessionMetrics(sb, sessionServer.TotalSessions())
+		}
+
+		if cpuMetrics != nil {
+			writeCPUMetrics(sb, cpuMetrics)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(sb.String()))
+	})
+}
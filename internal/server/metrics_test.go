@@ -0,0 +1,182 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/metrics"
+	"github.com/rpccloud/rpc/internal/rpc"
+)
+
+func TestFormatMetricsFloat(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(formatMetricsFloat(0.01)).Equals("0.01")
+		assert(formatMetricsFloat(1)).Equals("1")
+		assert(formatMetricsFloat(0)).Equals("0")
+	})
+}
+
+func TestWriteActionMetrics(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		indicator := base.NewPerformanceIndicator()
+		indicator.Count(5*time.Millisecond, true)
+		indicator.Count(20*time.Millisecond, false)
+		indicator.Count(2*time.Second, true)
+
+		sb := base.NewStringBuilder()
+		defer sb.Release()
+		writeActionMetrics(sb, map[string]*base.PerformanceIndicator{
+			"#.test:\"Say\"": indicator,
+			"#.a:Empty":      base.NewPerformanceIndicator(),
+		})
+		assert(sb.String()).Equals(
+			"# HELP rpc_action_calls_total Total number of action calls.\n" +
+				"# TYPE rpc_action_calls_total counter\n" +
+				"rpc_action_calls_total{path=\"#.a:Empty\",result=\"success\"} 0\n" +
+				"rpc_action_calls_total{path=\"#.a:Empty\",result=\"fail\"} 0\n" +
+				"rpc_action_calls_total{path=\"#.test:\\\"Say\\\"\",result=\"success\"} 2\n" +
+				"rpc_action_calls_total{path=\"#.test:\\\"Say\\\"\",result=\"fail\"} 1\n" +
+				"# HELP rpc_action_duration_seconds Action call latency.\n" +
+				"# TYPE rpc_action_duration_seconds histogram\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.a:Empty\",le=\"0.01\"} 0\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.a:Empty\",le=\"0.02\"} 0\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.a:Empty\",le=\"0.05\"} 0\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.a:Empty\",le=\"0.1\"} 0\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.a:Empty\",le=\"0.2\"} 0\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.a:Empty\",le=\"0.5\"} 0\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.a:Empty\",le=\"1\"} 0\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.a:Empty\",le=\"+Inf\"} 0\n" +
+				"rpc_action_duration_seconds_sum{path=\"#.a:Empty\"} 0\n" +
+				"rpc_action_duration_seconds_count{path=\"#.a:Empty\"} 0\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.test:\\\"Say\\\"\",le=\"0.01\"} 1\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.test:\\\"Say\\\"\",le=\"0.02\"} 2\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.test:\\\"Say\\\"\",le=\"0.05\"} 2\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.test:\\\"Say\\\"\",le=\"0.1\"} 2\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.test:\\\"Say\\\"\",le=\"0.2\"} 2\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.test:\\\"Say\\\"\",le=\"0.5\"} 2\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.test:\\\"Say\\\"\",le=\"1\"} 2\n" +
+				"rpc_action_duration_seconds_bucket{path=\"#.test:\\\"Say\\\"\",le=\"+Inf\"} 3\n" +
+				"rpc_action_duration_seconds_sum{path=\"#.test:\\\"Say\\\"\"} 2.025\n" +
+				"rpc_action_duration_seconds_count{path=\"#.test:\\\"Say\\\"\"} 3\n",
+		)
+	})
+}
+
+func TestWriteQueueMetrics(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		sb := base.NewStringBuilder()
+		defer sb.Release()
+		writeQueueMetrics(sb, 3, 7)
+		assert(sb.String()).Equals(
+			"# HELP rpc_queue_depth Number of requests waiting for a free " +
+				"thread.\n" +
+				"# TYPE rpc_queue_depth gauge\n" +
+				"rpc_queue_depth 3\n" +
+				"# HELP rpc_queue_rejected_total Total number of requests " +
+				"rejected because the server is busy.\n" +
+				"# TYPE rpc_queue_rejected_total counter\n" +
+				"rpc_queue_rejected_total 7\n",
+		)
+	})
+}
+
+func TestWriteSessionMetrics(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		sb := base.NewStringBuilder()
+		defer sb.Release()
+		writeSessionMetrics(sb, 12)
+		assert(sb.String()).Equals(
+			"# HELP rpc_sessions Number of sessions.\n" +
+				"# TYPE rpc_sessions gauge\n" +
+				"rpc_sessions 12\n",
+		)
+	})
+}
+
+func TestWriteCPUMetrics(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		sb := base.NewStringBuilder()
+		defer sb.Release()
+		m := metrics.GetMetrics(10 * time.Millisecond)
+		writeCPUMetrics(sb, m)
+		assert(sb.String()).Equals(
+			"# HELP rpc_cpu_usage CPU usage between 0 and 1.\n" +
+				"# TYPE rpc_cpu_usage gauge\n" +
+				"rpc_cpu_usage " + formatMetricsFloat(m.GetCPU()) + "\n",
+		)
+	})
+}
+
+func TestServer_MetricsHandler(t *testing.T) {
+	fnGet := func(s *Server) (int, string, string) {
+		w := httptest.NewRecorder()
+		s.MetricsHandler().ServeHTTP(
+			w,
+			httptest.NewRequest(http.MethodGet, "/metrics", nil),
+		)
+		body, _ := ioutil.ReadAll(w.Result().Body)
+		return w.Code, w.Header().Get("Content-Type"), string(body)
+	}
+
+	t.Run("server is not running", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		code, contentType, body := fnGet(NewServer(nil))
+		assert(code).Equals(http.StatusOK)
+		assert(contentType).Equals("text/plain; version=0.0.4")
+		assert(strings.Contains(body, "rpc_cpu_usage ")).IsFalse()
+		assert(strings.Contains(body, "rpc_sessions")).IsFalse()
+		assert(strings.Contains(body, "rpc_action_calls_total")).IsFalse()
+		assert(strings.Contains(body, "rpc_queue_depth")).IsFalse()
+	})
+
+	t.Run("server is running", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		s := NewServer(GetDefaultServerConfig().SetNumOfThreads(1024))
+		s.Listen("tcp", "0.0.0.0:1234", "", nil, nil).AddService(
+			"test",
+			rpc.NewService(nil).On("SayHello", func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply(true)
+			}),
+			nil,
+		)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			// wait for the first cpu sample
+			code, _, body := fnGet(s)
+			for i := 0; i < 100 && !strings.Contains(body, "rpc_cpu_usage "); i++ {
+				time.Sleep(10 * time.Millisecond)
+				code, _, body = fnGet(s)
+			}
+			assert(code).Equals(http.StatusOK)
+			assert(strings.Contains(
+				body,
+				"rpc_action_calls_total{path=\"#.test:SayHello\","+
+					"result=\"success\"} 0\n",
+			)).IsTrue()
+			assert(strings.Contains(body, "rpc_queue_depth 0\n")).IsTrue()
+			assert(strings.Contains(body, "rpc_queue_rejected_total 0\n")).
+				IsTrue()
+			assert(strings.Contains(body, "rpc_sessions 0\n")).IsTrue()
+			assert(strings.Contains(body, "rpc_cpu_usage ")).IsTrue()
+			s.Close()
+			_, _, body = fnGet(s)
+			assert(strings.Contains(body, "rpc_cpu_usage ")).IsFalse()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+}
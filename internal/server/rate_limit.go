@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net"
+	"sync"
+
+	"github.com/rpccloud/rpc/internal/adapter"
+)
+
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+func makeRateLimit(rate float64, burst int) rateLimit {
+	if rate <= 0 {
+		return rateLimit{}
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return rateLimit{rate: rate, burst: burst}
+}
+
+// rateBucket is a token bucket. The tokens are added at rate per second and
+// at most burst tokens are kept, a request takes one token.
+type rateBucket struct {
+	tokens float64
+	timeNS int64
+}
+
+func (p *rateBucket) fill(limit rateLimit, nowNS int64) {
+	if p.timeNS == 0 {
+		p.tokens = float64(limit.burst)
+		p.timeNS = nowNS
+	} else if nowNS > p.timeNS {
+		p.tokens += limit.rate * float64(nowNS-p.timeNS) / 1e9
+		if p.tokens > float64(limit.burst) {
+			p.tokens = float64(limit.burst)
+		}
+		p.timeNS = nowNS
+	}
+}
+
+func (p *rateBucket) take(limit rateLimit, nowNS int64) bool {
+	if limit.rate <= 0 {
+		return true
+	}
+
+	p.fill(limit, nowNS)
+	if p.tokens >= 1 {
+		p.tokens--
+		return true
+	}
+
+	return false
+}
+
+type rateLimiter struct {
+	limit   rateLimit
+	buckets map[string]*rateBucket
+	mu      sync.Mutex
+}
+
+// newRateLimiter returns nil if the limit is disabled
+func newRateLimiter(limit rateLimit) *rateLimiter {
+	if limit.rate <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+// Allow takes a token from the bucket of key
+func (p *rateLimiter) Allow(key string, nowNS int64) bool {
+	if p == nil {
+		return true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	bucket, ok := p.buckets[key]
+	if !ok {
+		bucket = &rateBucket{}
+		p.buckets[key] = bucket
+	}
+
+	return bucket.take(p.limit, nowNS)
+}
+
+// TimeCheck removes the full buckets, they are the same as the new ones
+func (p *rateLimiter) TimeCheck(nowNS int64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, bucket := range p.buckets {
+		bucket.fill(p.limit, nowNS)
+		if bucket.tokens >= float64(p.limit.burst) {
+			delete(p.buckets, key)
+		}
+	}
+}
+
+// getRemoteIP returns the IP of the remote addr without the port
+func getRemoteIP(streamConn *adapter.StreamConn) string {
+	addr := streamConn.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+
+	return addr.String()
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rpccloud/rpc/internal/adapter"
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+type testAddrConn struct {
+	adapter.IConn
+	addr net.Addr
+}
+
+func (p *testAddrConn) RemoteAddr() net.Addr {
+	return p.addr
+}
+
+func TestMakeRateLimit(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(makeRateLimit(0, 10)).Equals(rateLimit{})
+		assert(makeRateLimit(-1, 10)).Equals(rateLimit{})
+		assert(makeRateLimit(2, 0)).Equals(rateLimit{rate: 2, burst: 1})
+		assert(makeRateLimit(2, 10)).Equals(rateLimit{rate: 2, burst: 10})
+	})
+}
+
+func TestRateBucket_take(t *testing.T) {
+	t.Run("limit is disabled", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &rateBucket{}
+		for i := 0; i < 100; i++ {
+			assert(v.take(rateLimit{}, 1)).IsTrue()
+		}
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &rateBucket{}
+		limit := rateLimit{rate: 10, burst: 3}
+		nowNS := base.TimeNow().UnixNano()
+
+		// the new bucket is full
+		assert(v.take(limit, nowNS)).IsTrue()
+		assert(v.take(limit, nowNS)).IsTrue()
+		assert(v.take(limit, nowNS)).IsTrue()
+		assert(v.take(limit, nowNS)).IsFalse()
+
+		// a token is added every 100ms
+		nowNS += int64(100 * time.Millisecond)
+		assert(v.take(limit, nowNS)).IsTrue()
+		assert(v.take(limit, nowNS)).IsFalse()
+
+		// the time goes back
+		assert(v.take(limit, nowNS-int64(time.Second))).IsFalse()
+
+		// at most burst tokens are kept
+		nowNS += int64(time.Hour)
+		assert(v.take(limit, nowNS)).IsTrue()
+		assert(v.take(limit, nowNS)).IsTrue()
+		assert(v.take(limit, nowNS)).IsTrue()
+		assert(v.take(limit, nowNS)).IsFalse()
+	})
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	t.Run("limit is disabled", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(newRateLimiter(rateLimit{})).IsNil()
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := newRateLimiter(rateLimit{rate: 1, burst: 2})
+		assert(v.limit).Equals(rateLimit{rate: 1, burst: 2})
+		assert(len(v.buckets)).Equals(0)
+	})
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	t.Run("p is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert((*rateLimiter)(nil).Allow("a", 1)).IsTrue()
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := newRateLimiter(rateLimit{rate: 1, burst: 1})
+		nowNS := base.TimeNow().UnixNano()
+		assert(v.Allow("a", nowNS)).IsTrue()
+		assert(v.Allow("a", nowNS)).IsFalse()
+		assert(v.Allow("b", nowNS)).IsTrue()
+		assert(len(v.buckets)).Equals(2)
+	})
+}
+
+func TestRateLimiter_TimeCheck(t *testing.T) {
+	t.Run("p is nil", func(t *testing.T) {
+		(*rateLimiter)(nil).TimeCheck(1)
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := newRateLimiter(rateLimit{rate: 1, burst: 2})
+		nowNS := base.TimeNow().UnixNano()
+		assert(v.Allow("a", nowNS)).IsTrue()
+		assert(v.Allow("a", nowNS)).IsTrue()
+		assert(v.Allow("b", nowNS)).IsTrue()
+
+		v.TimeCheck(nowNS + int64(time.Second))
+		assert(len(v.buckets)).Equals(1)
+		assert(v.buckets["a"]).IsNotNil()
+
+		v.TimeCheck(nowNS + int64(2*time.Second))
+		assert(len(v.buckets)).Equals(0)
+	})
+}
+
+func TestGetRemoteIP(t *testing.T) {
+	t.Run("addr is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		streamConn := adapter.NewStreamConn(false, &testAddrConn{}, nil)
+		assert(getRemoteIP(streamConn)).Equals("")
+	})
+
+	t.Run("addr has port", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		streamConn := adapter.NewStreamConn(false, &testAddrConn{
+			addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080},
+		}, nil)
+		assert(getRemoteIP(streamConn)).Equals("127.0.0.1")
+	})
+
+	t.Run("addr has no port", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		streamConn := adapter.NewStreamConn(false, &testAddrConn{
+			addr: &net.UnixAddr{Name: "/tmp/test.sock", Net: "unix"},
+		}, nil)
+		assert(getRemoteIP(streamConn)).Equals("/tmp/test.sock")
+	})
+}
@@ -7,9 +7,12 @@ import (
 	"path"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rpccloud/rpc/internal/base"
+	"github.com/rpccloud/rpc/internal/metrics"
+	"github.com/rpccloud/rpc/internal/router"
 	"github.com/rpccloud/rpc/internal/rpc"
 )
 
@@ -20,7 +23,12 @@ type Server struct {
 	processor     *rpc.Processor
 	sessionServer *SessionServer
 	streamHub     *rpc.StreamHub
+	routerClient  *router.Client
 	mountServices []*rpc.ServiceMeta
+	cpuMetrics    *metrics.Metrics
+	gateway       gatewayWaiters
+	draining      int32
+	closeCH       chan bool
 	mu            sync.Mutex
 }
 
@@ -38,7 +46,11 @@ func NewServer(config *ServerConfig) *Server {
 		processor:     nil,
 		sessionServer: nil,
 		streamHub:     nil,
+		routerClient:  nil,
 		mountServices: make([]*rpc.ServiceMeta, 0),
+		cpuMetrics:    nil,
+		draining:      0,
+		closeCH:       nil,
 	}
 }
 
@@ -151,9 +163,32 @@ func (p *Server) BuildReplyCache() *base.Error {
 	)
 }
 
+// BuildClientStub writes the typed client stubs of the added services to
+// output, the generated code is in package pkgName.
+func (p *Server) BuildClientStub(pkgName string, output string) *base.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	processor := rpc.NewProcessor(
+		1,
+		64,
+		64,
+		1024,
+		nil,
+		time.Second,
+		p.mountServices,
+		rpc.NewTestStreamReceiver(),
+	)
+	defer processor.Close()
+
+	return processor.BuildClientStub(pkgName, output)
+}
+
 // Open ...
 func (p *Server) Open() bool {
 	source := base.GetFileLine(1)
+	sessionServer := (*SessionServer)(nil)
+	closeCH := make(chan bool)
 
 	ret := func() bool {
 		p.mu.Lock()
@@ -166,66 +201,214 @@ func (p *Server) Open() bool {
 			return false
 		}
 
+		role := p.config.role
 		processor := (*rpc.Processor)(nil)
-		sessionServer := (*SessionServer)(nil)
-
-		streamHub := rpc.NewStreamHub(
-			p.config.logToScreen,
-			p.config.logFile,
-			p.config.logLevel,
-			rpc.StreamHubCallback{
-				OnRPCRequestStream: func(stream *rpc.Stream) {
+		routerClient := (*router.Client)(nil)
+		streamHub := (*rpc.StreamHub)(nil)
+
+		// streams coming out of the local processor or the router
+		onResponseStream := func(stream *rpc.Stream) {
+			if role == ServerRoleProcessor {
+				if !routerClient.SendStream(stream) {
+					// the response can not go back to the gateway
+					errStream := rpc.MakeSystemErrorStream(
+						base.ErrServerRouterUnavailable.AddDebug(source),
+					)
+					errStream.SetSessionID(stream.GetSessionID())
+					streamHub.OnReceiveStream(errStream)
+					stream.Release()
+				}
+			} else if !p.gateway.onResponseStream(stream) {
+				sessionServer.OutStream(stream)
+			}
+		}
+
+		streamHubCallback := rpc.StreamHubCallback{
+			OnRPCRequestStream: func(stream *rpc.Stream) {
+				if role == ServerRoleGateway {
+					stream.SetGatewayID(routerClient.GetID())
+					// the processor behind the router can not see the
+					// sessions, so the identity goes with the request. The
+					// requests of the http gateway have no session, their
+					// identity is put by the gateway handler.
+					if sessionID := stream.GetSessionID(); sessionID != 0 {
+						identity := rpc.Any(nil)
+						if session, ok := sessionServer.GetSession(
+							sessionID,
+						); ok {
+							identity = session.GetIdentity()
+						}
+						stream = rpc.MakeIdentityRequestStream(stream, identity)
+					}
+					if !routerClient.SendStream(stream) {
+						// reply the error, so the client does not wait
+						// until timeout
+						sessionServer.OutStream(rpc.MakeRequestErrorStream(
+							stream,
+							base.ErrServerRouterUnavailable,
+						))
+					}
+				} else if role == ServerRoleProcessor &&
+					atomic.LoadInt32(&p.draining) != 0 {
+					// the gateway replies the error to the client, so
+					// the client can retry it on another server
+					onResponseStream(rpc.MakeRequestErrorStream(
+						stream,
+						base.ErrServerDraining,
+					))
+				} else {
 					processor.PutStream(stream)
-				},
-				OnRPCResponseOKStream: func(stream *rpc.Stream) {
-					sessionServer.OutStream(stream)
-				},
-				OnRPCResponseErrorStream: func(stream *rpc.Stream) {
-					sessionServer.OutStream(stream)
-				},
-				OnRPCBoardCastStream: func(stream *rpc.Stream) {
-					sessionServer.OutStream(stream)
-				},
-				OnSystemErrorReportStream: func(
-					sessionID uint64,
-					err *base.Error,
-				) {
-					// ignore
-				},
+				}
 			},
-		)
-
-		processor = rpc.NewProcessor(
-			p.config.numOfThreads,
-			p.config.maxNodeDepth,
-			p.config.maxCallDepth,
-			p.config.threadBufferSize,
-			p.config.actionCache,
-			p.config.closeTimeout,
-			p.mountServices,
-			streamHub,
-		)
-
-		if processor == nil {
-			streamHub.Close()
-			return false
+			OnRPCResponseOKStream:    onResponseStream,
+			OnRPCResponseErrorStream: onResponseStream,
+			OnRPCResponseItemStream:  onResponseStream,
+			OnRPCBoardCastStream:     onResponseStream,
+			OnSystemErrorReportStream: func(
+				sessionID uint64,
+				err *base.Error,
+			) {
+				// ignore
+			},
+		}
+
+		if p.config.logger != nil {
+			streamHub = rpc.NewStreamHubWithLogger(
+				p.config.logger,
+				p.config.logLevel,
+				streamHubCallback,
+			)
+		} else {
+			streamHub = rpc.NewStreamHub(
+				p.config.logToScreen,
+				p.config.logFile,
+				p.config.logLevel,
+				streamHubCallback,
+			)
+		}
+
+		if role != ServerRoleAll {
+			if p.config.routerAddr == "" {
+				streamHub.OnReceiveStream(rpc.MakeSystemErrorStream(
+					base.ErrServerRouterAddrIsEmpty.AddDebug(source),
+				))
+				streamHub.Close()
+				return false
+			}
+
+			slotKind := router.SlotKindGateway
+			if role == ServerRoleProcessor {
+				slotKind = router.SlotKindProcessor
+			}
+
+			client, err := router.NewClient(
+				p.config.routerAddr,
+				p.config.routerTLSConfig,
+				slotKind,
+				streamHub,
+			)
+
+			if err != nil {
+				streamHub.OnReceiveStream(rpc.MakeSystemErrorStream(
+					err.AddDebug(source),
+				))
+				streamHub.Close()
+				return false
+			}
+
+			routerClient = client
 		}
 
-		sessionServer = NewSessionServer(
-			p.listeners,
-			p.config.session,
-			streamHub,
-		)
+		if role != ServerRoleGateway {
+			mountServices := p.mountServices
+			if p.config.systemService {
+				mountServices = append(
+					append([]*rpc.ServiceMeta{}, p.mountServices...),
+					rpc.NewSystemServiceMeta(),
+				)
+			}
+
+			processor = rpc.NewProcessor(
+				p.config.numOfThreads,
+				p.config.maxNodeDepth,
+				p.config.maxCallDepth,
+				p.config.threadBufferSize,
+				p.config.actionCache,
+				p.config.closeTimeout,
+				mountServices,
+				streamHub,
+			)
+
+			if processor == nil {
+				if routerClient != nil {
+					routerClient.Close()
+				}
+				streamHub.Close()
+				return false
+			}
+
+			processor.SetInterceptors(p.config.interceptors)
+			processor.SetQueue(p.config.maxQueueSize, p.config.queueTimeout)
+			processor.SetSpanExporter(
+				p.config.spanExporter,
+				p.config.traceSampleRate,
+			)
+			processor.SetAccessLog(
+				p.config.accessLog.logger,
+				p.config.accessLog.sampleRate,
+				p.config.accessLog.redactor,
+			)
+		}
+
+		if role != ServerRoleProcessor {
+			sessionServer = NewSessionServer(
+				p.listeners,
+				p.config.session,
+				streamHub,
+			)
+			sessionServer.authenticator = p.config.authenticator
+			sessionServer.setActionRateLimits(p.config.actionRateLimits)
+		}
+
+		// the processor behind a router reads the identity that the gateway
+		// puts in the request
+		if role == ServerRoleAll {
+			processor.SetIdentityResolver(
+				func(_ uint64, sessionID uint64) rpc.Any {
+					if session, ok := sessionServer.GetSession(sessionID); ok {
+						return session.GetIdentity()
+					}
+					return nil
+				},
+			)
+			processor.SetAddrResolver(
+				func(_ uint64, sessionID uint64) string {
+					if session, ok := sessionServer.GetSession(sessionID); ok {
+						return session.GetRemoteAddr()
+					}
+					return ""
+				},
+			)
+		}
 
 		p.streamHub = streamHub
 		p.processor = processor
 		p.sessionServer = sessionServer
+		p.routerClient = routerClient
+		p.closeCH = closeCH
 
 		return true
 	}()
 
 	if ret {
-		p.sessionServer.Open()
+		go p.sampleCPU(closeCH)
+
+		if sessionServer != nil {
+			sessionServer.Open()
+		} else {
+			// the processor role has no listeners, so wait until it is closed
+			<-closeCH
+		}
 	}
 
 	return ret
@@ -239,10 +422,47 @@ func (p *Server) IsRunning() bool {
 	return p.streamHub != nil
 }
 
-// Close ...
+// drain stops accepting new sessions and requests, tells the clients to
+// migrate, and waits until the running requests are replied or the drain
+// timeout expires. It returns false if the server is not running or is being
+// closed by another goroutine.
+func (p *Server) drain() bool {
+	p.mu.Lock()
+	if p.streamHub == nil || !atomic.CompareAndSwapInt32(&p.draining, 0, 1) {
+		p.mu.Unlock()
+		return false
+	}
+	sessionServer := p.sessionServer
+	processor := p.processor
+	drainTimeout := p.config.drainTimeout
+	p.mu.Unlock()
+
+	deadline := base.TimeNow().Add(drainTimeout)
+
+	if sessionServer != nil {
+		sessionServer.Drain(drainTimeout)
+	}
+
+	if processor != nil {
+		for processor.GetRunningCount() > 0 && base.TimeNow().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	return true
+}
+
+// Close drains the server, and then closes it. It blocks until the running
+// requests are replied or the drain timeout (5s by default, see
+// ServerConfig.SetDrainTimeout) expires.
 func (p *Server) Close() bool {
+	if !p.drain() {
+		return false
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	defer atomic.StoreInt32(&p.draining, 0)
 
 	if p.streamHub == nil {
 		return false
@@ -258,6 +478,18 @@ func (p *Server) Close() bool {
 		p.processor = nil
 	}
 
+	if p.routerClient != nil {
+		p.routerClient.Close()
+		p.routerClient = nil
+	}
+
+	if p.closeCH != nil {
+		close(p.closeCH)
+		p.closeCH = nil
+	}
+
+	p.cpuMetrics = nil
+
 	p.streamHub.Close()
 	p.streamHub = nil
 	return true
@@ -2,16 +2,19 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/rpccloud/rpc/internal/base"
 	"github.com/rpccloud/rpc/internal/client"
+	"github.com/rpccloud/rpc/internal/router"
 	"github.com/rpccloud/rpc/internal/rpc"
 )
 
@@ -202,6 +205,44 @@ func TestServer_BuildReplyCache(t *testing.T) {
 	})
 }
 
+func TestServer_BuildClientStub(t *testing.T) {
+	_, curFile, _, _ := runtime.Caller(0)
+	curDir := path.Dir(curFile)
+
+	t.Run("test ok", func(t *testing.T) {
+		defer func() {
+			_ = os.RemoveAll(path.Join(curDir, "stub"))
+		}()
+		assert := base.NewAssert(t)
+		v := NewServer(nil)
+		v.AddService("user", rpc.NewService(nil).
+			On("SayHello", func(rt rpc.Runtime, name rpc.String) rpc.Return {
+				return rt.Reply("hello " + name)
+			}), nil)
+		output := path.Join(curDir, "stub", "rpc_client_stub.go")
+		assert(v.BuildClientStub("stub", output)).IsNil()
+		content, _ := base.ReadFromFile(output)
+		assert(strings.Contains(
+			content,
+			"return p.client.Send(p.timeout, \"#.user:SayHello\", arg0)",
+		)).IsTrue()
+	})
+
+	t.Run("output file exists", func(t *testing.T) {
+		defer func() {
+			_ = os.RemoveAll(path.Join(curDir, "stub"))
+		}()
+
+		_ = os.MkdirAll(path.Join(curDir, "stub", "rpc_client_stub.go"), 0555)
+		assert := base.NewAssert(t)
+		v := NewServer(nil)
+		assert(v.BuildClientStub(
+			"stub",
+			path.Join(curDir, "stub", "rpc_client_stub.go"),
+		)).Equals(base.ErrCacheWriteFile)
+	})
+}
+
 func TestServer_Open(t *testing.T) {
 	t.Run("server is already running", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -239,6 +280,25 @@ func TestServer_Open(t *testing.T) {
 		)).IsTrue()
 	})
 
+	t.Run("processor create error, logger is set", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		buffer := &bytes.Buffer{}
+		v := NewServer(GetDefaultServerConfig().SetLogger(
+			base.NewLogger(base.ErrorLogAll, base.NewJSONLogEncoder(), buffer),
+		))
+		v.config.numOfThreads = 0
+
+		assert(captureStdout(func() {
+			assert(v.Open()).IsFalse()
+		})).Equals("")
+
+		assert(strings.Contains(
+			buffer.String(),
+			"\"level\":\"fatal\","+
+				"\"msg\":\"ConfigFatal[20]: numOfThreads is wrong\"",
+		)).IsTrue()
+	})
+
 	t.Run("test ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		v := NewServer(nil)
@@ -286,6 +346,275 @@ func TestServer_Open(t *testing.T) {
 		assert(s.Open()).IsTrue()
 	})
 
+	t.Run("system service", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		service := rpc.NewService(nil).On(
+			"SayHello",
+			func(rt rpc.Runtime, name rpc.String) rpc.Return {
+				return rt.Reply("Hello " + name)
+			},
+		)
+		s := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetSystemService(true),
+		).
+			Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("test", service, nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			assert(c.Send(10*time.Second, "#.$system:GetActions")).Equals(
+				rpc.Array{
+					rpc.Map{
+						"path":   "#.$system:GetActions",
+						"args":   rpc.Array{},
+						"return": "rpc.Return",
+					},
+					rpc.Map{
+						"path":   "#.$system:GetServices",
+						"args":   rpc.Array{},
+						"return": "rpc.Return",
+					},
+					rpc.Map{
+						"path":   "#.test:SayHello",
+						"args":   rpc.Array{"rpc.String"},
+						"return": "rpc.Return",
+					},
+				},
+				nil,
+			)
+			c.Close()
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+
+	t.Run("authenticator", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		service := rpc.NewService(nil).On(
+			"WhoAmI",
+			func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply(rt.GetIdentity())
+			},
+		)
+		s := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetAuthenticator(NewTokenAuthenticator(
+					map[string]rpc.Any{"pass": "user"},
+				)),
+		).
+			Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("test", service, nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c1 := client.NewClientWithCredentials(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024,
+				rpc.Map{"token": "pass"}, nil,
+			)
+			assert(c1.Send(10*time.Second, "#.test:WhoAmI")).
+				Equals("user", nil)
+			c1.Close()
+
+			errCH := make(chan *base.Error, 1024)
+			c2 := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024,
+				func(err *base.Error) {
+					errCH <- err
+				},
+			)
+			assert((<-errCH).GetCode()).
+				Equals(base.ErrServerAuthenticate.GetCode())
+			c2.Close()
+
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+
+	t.Run("interceptors", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		service := rpc.NewService(nil).On(
+			"SayHello",
+			func(rt rpc.Runtime, name rpc.String) rpc.Return {
+				return rt.Reply("Hello " + name)
+			},
+		)
+		s := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				Use(func(
+					_ rpc.Runtime,
+					path string,
+					_ string,
+					args rpc.Array,
+				) *base.Error {
+					if path == "#.test:SayHello" && args[0] == "nobody" {
+						return base.ErrAction.AddDebug("nobody is rejected")
+					}
+					return nil
+				}),
+		).
+			Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("test", service, nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			assert(c.Send(10*time.Second, "#.test:SayHello", "kitty")).
+				Equals("Hello kitty", nil)
+			_, err := c.Send(10*time.Second, "#.test:SayHello", "nobody")
+			assert(err.GetCode()).Equals(base.ErrAction.GetCode())
+			c.Close()
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+
+	t.Run("span exporter", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		service := rpc.NewService(nil).
+			On("SayHello", func(rt rpc.Runtime, name rpc.String) rpc.Return {
+				return rt.Reply(rt.Call("#.test:Hello", name))
+			}).
+			On("Hello", func(rt rpc.Runtime, name rpc.String) rpc.Return {
+				return rt.Reply("Hello " + name)
+			})
+		exporter := &testSpanExporter{spanCH: make(chan *rpc.Span, 16)}
+		s := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetSpanExporter(exporter, 0),
+		).
+			Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("test", service, nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			trace := rpc.NewTraceContext(true)
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			assert(c.SendContext(
+				client.WithTraceContext(context.Background(), trace),
+				"#.test:SayHello",
+				"kitty",
+			)).Equals("Hello kitty", nil)
+
+			child, root := <-exporter.spanCH, <-exporter.spanCH
+			assert(child.Name, root.Name).
+				Equals("#.test:Hello", "#.test:SayHello")
+			assert(child.TraceID, root.TraceID).
+				Equals(trace.TraceID, trace.TraceID)
+			assert(child.ParentSpanID, root.ParentSpanID).
+				Equals(root.SpanID, trace.SpanID)
+
+			c.Close()
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+
+	t.Run("access log", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		service := rpc.NewService(nil).
+			On("Login", func(
+				rt rpc.Runtime,
+				name rpc.String,
+				_ rpc.String,
+			) rpc.Return {
+				return rt.Reply("Hello " + name)
+			})
+		buffer := &bytes.Buffer{}
+		s := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetAccessLog(
+					base.NewLogger(
+						base.ErrorLogAll,
+						base.NewLogfmtLogEncoder(),
+						buffer,
+					),
+					1,
+					func(_ string, args rpc.Array) rpc.Array {
+						return rpc.Array{args[0], "***"}
+					},
+				),
+		).
+			Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("test", service, nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			assert(c.Send(3*time.Second, "#.test:Login", "kitty", "secret")).
+				Equals("Hello kitty", nil)
+
+			log := buffer.String()
+			assert(strings.Contains(log, " remoteAddr=127.0.0.1:")).IsTrue()
+			assert(strings.Contains(
+				log,
+				" actionPath=#.test:Login depth=0 from=@ errorCode=0 ",
+			)).IsTrue()
+			assert(strings.HasSuffix(log, " args=\"[kitty ***]\"\n")).IsTrue()
+
+			c.Close()
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+
+	t.Run("system service is disabled by default", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		s := NewServer(GetDefaultServerConfig().SetNumOfThreads(256)).
+			Listen("tcp", "0.0.0.0:1234", "", nil, nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			_, err := c.Send(10*time.Second, "#.$system:GetActions")
+			assert(err).IsNotNil()
+			c.Close()
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+
 	t.Run("OnRPCResponseErrorStream", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		s := NewServer(GetDefaultServerConfig().SetNumOfThreads(256)).
@@ -308,6 +637,152 @@ func TestServer_Open(t *testing.T) {
 		assert(s.Open()).IsTrue()
 	})
 
+	t.Run("router addr is empty", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewServer(GetDefaultServerConfig().SetRole(ServerRoleGateway))
+
+		outStr := captureStdout(func() {
+			assert(v.Open()).IsFalse()
+		})
+
+		assert(strings.Contains(
+			outStr,
+			"ConfigFatal[774]: router address is empty",
+		)).IsTrue()
+	})
+
+	t.Run("gateway and processor", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		r := router.NewRouter("127.0.0.1:28080", nil, false, "", 0)
+		defer r.Close()
+
+		service := rpc.NewService(nil).On(
+			"SayHello",
+			func(rt rpc.Runtime, name rpc.String) rpc.Return {
+				_ = rt.Post(rt.GetPostEndPoint(), "SayHello", "Hello")
+				return rt.Reply("Hello " + name)
+			},
+		)
+
+		processor := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetRole(ServerRoleProcessor).
+				SetRouter("127.0.0.1:28080", nil),
+		).AddService("test", service, nil)
+		go func() {
+			assert(processor.Open()).IsTrue()
+		}()
+
+		gateway := NewServer(
+			GetDefaultServerConfig().
+				SetRole(ServerRoleGateway).
+				SetRouter("127.0.0.1:28080", nil),
+		).Listen("tcp", "0.0.0.0:1234", "", nil, nil)
+
+		go func() {
+			for !gateway.IsRunning() || !processor.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			wait := make(chan bool, 1)
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			c.Subscribe("#.test", "SayHello", func(value rpc.Any) {
+				assert(value).Equals("Hello")
+				wait <- true
+			})
+			assert(c.Send(10*time.Second, "#.test:SayHello", "world")).
+				Equals("Hello world", nil)
+			<-wait
+			c.Close()
+			gateway.Close()
+			processor.Close()
+		}()
+
+		assert(gateway.Open()).IsTrue()
+	})
+
+	t.Run("gateway and processor with authenticator", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		r := router.NewRouter("127.0.0.1:28081", nil, false, "", 0)
+		defer r.Close()
+
+		service := rpc.NewService(nil).On(
+			"WhoAmI",
+			func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply(rt.GetIdentity())
+			},
+		)
+
+		processor := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetRole(ServerRoleProcessor).
+				SetRouter("127.0.0.1:28081", nil),
+		).AddService("test", service, nil)
+		go func() {
+			assert(processor.Open()).IsTrue()
+		}()
+
+		gateway := NewServer(
+			GetDefaultServerConfig().
+				SetRole(ServerRoleGateway).
+				SetRouter("127.0.0.1:28081", nil).
+				SetAuthenticator(NewTokenAuthenticator(
+					map[string]rpc.Any{"pass": rpc.Map{"name": "user"}},
+				)),
+		).Listen("tcp", "0.0.0.0:1234", "", nil, nil)
+
+		go func() {
+			for !gateway.IsRunning() || !processor.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c := client.NewClientWithCredentials(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024,
+				rpc.Map{"token": "pass"}, nil,
+			)
+			assert(c.Send(10*time.Second, "#.test:WhoAmI")).
+				Equals(rpc.Map{"name": "user"}, nil)
+			c.Close()
+			gateway.Close()
+			processor.Close()
+		}()
+
+		assert(gateway.Open()).IsTrue()
+	})
+
+	t.Run("gateway router is unavailable", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		r := router.NewRouter("127.0.0.1:28080", nil, false, "", 0)
+		defer r.Close()
+
+		gateway := NewServer(
+			GetDefaultServerConfig().
+				SetRole(ServerRoleGateway).
+				SetRouter("127.0.0.1:28080", nil),
+		).Listen("tcp", "0.0.0.0:1234", "", nil, nil)
+
+		go func() {
+			for !gateway.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			gateway.routerClient.Close()
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			assert(c.Send(10*time.Second, "#.test:SayHello", "world")).
+				Equals(nil, base.ErrServerRouterUnavailable)
+			c.Close()
+			gateway.Close()
+		}()
+
+		assert(gateway.Open()).IsTrue()
+	})
+
 	t.Run("OnRPCBoardCastStream", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		service := rpc.NewService(nil).On(
@@ -344,6 +819,115 @@ func TestServer_Open(t *testing.T) {
 		assert(s.Open()).IsTrue()
 	})
 
+	t.Run("requests over the rate limit", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		service := rpc.NewService(nil).
+			On("SayHello", func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply("Hello")
+			}).
+			On("SayGoodbye", func(rt rpc.Runtime) rpc.Return {
+				return rt.Reply("Goodbye")
+			})
+		s := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetActionRateLimit("#.test:SayHello", 0.001, 2),
+		).Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("test", service, nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			assert(c.Send(10*time.Second, "#.test:SayHello")).
+				Equals("Hello", nil)
+			assert(c.Send(10*time.Second, "#.test:SayHello")).
+				Equals("Hello", nil)
+			assert(c.Send(10*time.Second, "#.test:SayHello")).
+				Equals(nil, base.ErrServerRateLimited)
+			assert(c.Send(10*time.Second, "#.test:SayGoodbye")).
+				Equals("Goodbye", nil)
+			c.Close()
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
+
+	t.Run("priority of the requests over one conn", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		finishCH := make(chan bool)
+		orderCH := make(chan string, 2)
+		service := rpc.NewService(nil).
+			On("Block", func(rt rpc.Runtime) rpc.Return {
+				<-finishCH
+				return rt.Reply(true)
+			}).
+			On("Order", func(rt rpc.Runtime, name string) rpc.Return {
+				orderCH <- name
+				return rt.Reply(true)
+			})
+		s := NewServer(
+			GetDefaultServerConfig().
+				SetNumOfThreads(256).
+				SetSession(GetDefaultSessionConfig().SetNumOfChannels(512)),
+		).Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("test", service, nil)
+
+		go func() {
+			for !s.IsRunning() {
+				time.Sleep(10 * time.Millisecond)
+			}
+			processor := s.processor
+
+			c := client.NewClient(
+				"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+			)
+			wait := sync.WaitGroup{}
+			fnSend := func(priority uint8, target string, args ...rpc.Any) {
+				wait.Add(1)
+				go func() {
+					defer wait.Done()
+					assert(c.SendWithPriority(
+						priority, 10*time.Second, target, args...,
+					)).Equals(true, nil)
+				}()
+			}
+
+			// all the threads are busy
+			for i := 0; i < 256; i++ {
+				fnSend(0, "#.test:Block")
+			}
+			for processor.GetRunningCount() < 256 {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			// the conn is not blocked by the queued request, so the request
+			// with higher priority is queued behind it
+			fnSend(0, "#.test:Order", "low")
+			for processor.GetQueueDepth() < 1 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			fnSend(200, "#.test:Order", "high")
+			for processor.GetQueueDepth() < 2 {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			finishCH <- true
+			assert(<-orderCH).Equals("high")
+			close(finishCH)
+			assert(<-orderCH).Equals("low")
+			wait.Wait()
+			c.Close()
+			s.Close()
+		}()
+
+		assert(s.Open()).IsTrue()
+	})
 }
 
 func TestServer_IsRunning(t *testing.T) {
@@ -390,4 +974,49 @@ func TestServer_Close(t *testing.T) {
 		assert(v.IsRunning()).IsFalse()
 		assert(v.processor).IsNil()
 	})
+	t.Run("running actions are replied before closing", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		startCH := make(chan bool, 1)
+		service := rpc.NewService(nil).On(
+			"Sleep",
+			func(rt rpc.Runtime) rpc.Return {
+				startCH <- true
+				time.Sleep(300 * time.Millisecond)
+				return rt.Reply("done")
+			},
+		)
+		s := NewServer(GetDefaultServerConfig().SetNumOfThreads(256)).
+			Listen("tcp", "0.0.0.0:1234", "", nil, nil).
+			AddService("test", service, nil)
+
+		go func() {
+			s.Open()
+		}()
+
+		for !s.IsRunning() {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		c := client.NewClient(
+			"tcp4", "127.0.0.1:1234", "", nil, 1024, 1024, nil,
+		)
+		defer c.Close()
+		future := c.SendAsync(2*time.Second, "#.test:Sleep")
+		<-startCH
+
+		// the reply is sent before the sessions are closed
+		assert(s.Close()).IsTrue()
+		assert(future.Wait()).Equals("done", nil)
+	})
+
+	t.Run("closed by another goroutine", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewServer(nil)
+		v.streamHub = rpc.NewStreamHub(
+			false, "", base.ErrorLogAll, rpc.StreamHubCallback{},
+		)
+		v.draining = 1
+		assert(v.Close()).IsFalse()
+		v.streamHub.Close()
+	})
 }
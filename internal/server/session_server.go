@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,9 +16,11 @@ import (
 
 // Channel ...
 type Channel struct {
-	sequence   uint64
-	backTimeNS int64
-	backStream *rpc.Stream
+	sequence    uint64
+	backTimeNS  int64
+	backStream  *rpc.Stream
+	itemStreams []*rpc.Stream
+	running     bool
 }
 
 // In ...
@@ -25,6 +28,7 @@ func (p *Channel) In(id uint64) (canIn bool, backStream *rpc.Stream) {
 	if id > p.sequence {
 		p.Clean()
 		p.sequence = id
+		p.running = true
 		return true, nil
 	} else if id == p.sequence {
 		return false, p.backStream
@@ -41,6 +45,7 @@ func (p *Channel) Out(stream *rpc.Stream) (canOut bool) {
 		if p.backTimeNS == 0 {
 			p.backTimeNS = base.TimeNow().UnixNano()
 			p.backStream = stream
+			p.running = false
 			return true
 		}
 		return false
@@ -51,6 +56,58 @@ func (p *Channel) Out(stream *rpc.Stream) (canOut bool) {
 	}
 }
 
+// OutItem records the item of a streaming response, so it can be resent
+// when the client reconnects before the final response arrives. At most
+// maxItems items are kept, the oldest items are dropped, and the client
+// reports them lost if it has not received them.
+func (p *Channel) OutItem(stream *rpc.Stream, maxItems int) (canOut bool) {
+	if id := stream.GetCallbackID(); id == p.sequence && p.backTimeNS == 0 {
+		if maxItems > 0 && len(p.itemStreams) >= maxItems {
+			dropItems := len(p.itemStreams) - maxItems + 1
+			for i := 0; i < dropItems; i++ {
+				p.itemStreams[i].Release()
+				p.itemStreams[i] = nil
+			}
+			p.itemStreams = p.itemStreams[dropItems:]
+		}
+		p.itemStreams = append(p.itemStreams, stream)
+		return true
+	}
+
+	return false
+}
+
+// Cancel drops the reply of the request id, because the client does not wait
+// for it any more. The channel is cleaned when the cache times out.
+func (p *Channel) Cancel(id uint64) bool {
+	if id == p.sequence && p.backTimeNS == 0 {
+		for i := 0; i < len(p.itemStreams); i++ {
+			p.itemStreams[i].Release()
+		}
+		p.itemStreams = nil
+		p.backTimeNS = base.TimeNow().UnixNano()
+		p.running = false
+		return true
+	}
+
+	return false
+}
+
+// GetItems returns the recorded items if id is the current sequence.
+func (p *Channel) GetItems(id uint64) []*rpc.Stream {
+	if id == p.sequence {
+		return p.itemStreams
+	}
+
+	return nil
+}
+
+// IsRunning returns true if the request of the channel is not replied yet.
+// The requests restored from the session store are never running.
+func (p *Channel) IsRunning() bool {
+	return p.running
+}
+
 // IsTimeout ...
 func (p *Channel) IsTimeout(nowNS int64, timeout int64) bool {
 	return p.backTimeNS > 0 && nowNS-p.backTimeNS > timeout
@@ -59,10 +116,15 @@ func (p *Channel) IsTimeout(nowNS int64, timeout int64) bool {
 // Clean ...
 func (p *Channel) Clean() {
 	p.backTimeNS = 0
+	p.running = false
 	if p.backStream != nil {
 		p.backStream.Release()
 		p.backStream = nil
 	}
+	for i := 0; i < len(p.itemStreams); i++ {
+		p.itemStreams[i].Release()
+	}
+	p.itemStreams = nil
 }
 
 // Session ...
@@ -70,9 +132,13 @@ type Session struct {
 	id            uint64
 	sessionServer *SessionServer
 	security      string
+	identity      rpc.Any
 	conn          *adapter.StreamConn
 	channels      []Channel
+	topics        map[string]bool
+	dirty         bool
 	activeTimeNS  int64
+	rateBucket    rateBucket
 	prev          *Session
 	next          *Session
 	mu            sync.Mutex
@@ -93,6 +159,12 @@ func InitSession(
 	} else if sessionString, err := stream.ReadString(); err != nil {
 		stream.Release()
 		sessionServer.OnConnError(streamConn, base.ErrStream)
+	} else if credentials, err := readConnectCredentials(stream); err != nil {
+		stream.Release()
+		sessionServer.OnConnError(streamConn, base.ErrStream)
+	} else if codecs, err := readConnectCodecs(stream); err != nil {
+		stream.Release()
+		sessionServer.OnConnError(streamConn, base.ErrStream)
 	} else if !stream.IsReadFinish() {
 		stream.Release()
 		sessionServer.OnConnError(streamConn, base.ErrStream)
@@ -100,18 +172,51 @@ func InitSession(
 		session := (*Session)(nil)
 		config := sessionServer.config
 
+		// check the credentials, the rejected connection gets the error
+		// before it is closed
+		identity := rpc.Any(nil)
+		if authenticator := sessionServer.authenticator; authenticator != nil {
+			v, err := authenticator(
+				streamConn.RemoteAddr(),
+				streamConn.TLSConnectionState(),
+				credentials,
+			)
+			if err != nil {
+				stream.Release()
+				streamConn.WriteStreamAndRelease(rpc.MakeSystemErrorStream(err))
+				sessionServer.OnConnError(streamConn, err)
+				return
+			}
+			identity = v
+		}
+
 		// try to find session by session string
 		strArray := strings.Split(sessionString, "-")
 		if len(strArray) == 2 && len(strArray[1]) == 32 {
 			if id, err := strconv.ParseUint(strArray[0], 10, 64); err == nil {
-				if s, ok := sessionServer.GetSession(id); ok && s.security == strArray[1] {
+				s, ok := sessionServer.GetSession(id)
+				if !ok {
+					// the session may be saved before the server restarts
+					s, ok = sessionServer.LoadSession(id)
+				}
+				if ok && s.security == strArray[1] {
 					session = s
+					session.SetIdentity(identity)
 				}
 			}
 		}
 
 		// if session not find by session string, create a new session
 		if session == nil {
+			if sessionServer.IsDraining() {
+				stream.Release()
+				streamConn.WriteStreamAndRelease(
+					rpc.MakeSystemErrorStream(base.ErrServerDraining),
+				)
+				sessionServer.OnConnError(streamConn, base.ErrServerDraining)
+				return
+			}
+
 			if sessionServer.TotalSessions() >= int64(config.serverMaxSessions) {
 				stream.Release()
 				sessionServer.OnConnError(streamConn, base.ErrServerSessionSeedOverflows)
@@ -122,9 +227,13 @@ func InitSession(
 				id:            sessionServer.CreateSessionID(),
 				sessionServer: sessionServer,
 				security:      base.GetRandString(32),
+				identity:      identity,
 				conn:          nil,
 				channels:      make([]Channel, config.numOfChannels),
+				topics:        nil,
+				dirty:         true,
 				activeTimeNS:  base.TimeNow().UnixNano(),
+				rateBucket:    rateBucket{},
 				prev:          nil,
 				next:          nil,
 			}
@@ -141,9 +250,128 @@ func InitSession(
 		stream.WriteInt64(int64(config.transLimit))
 		stream.WriteInt64(int64(config.heartbeatInterval / time.Millisecond))
 		stream.WriteInt64(int64(config.heartbeatTimeout / time.Millisecond))
+		// the old clients do not negotiate the codec, do not reply it
+		codec := selectConnectCodec(codecs, config.serverCompressThreshold)
+		if codecs != nil {
+			stream.WriteInt64(int64(codec))
+			stream.WriteInt64(int64(config.serverCompressThreshold))
+		}
 		streamConn.WriteStreamAndRelease(stream)
+		streamConn.SetCompression(
+			codec,
+			config.serverCompressThreshold,
+			config.transLimit,
+		)
 
 		session.OnConnOpen(streamConn)
+
+		// the resumed session only waits for the replies of its requests
+		if sessionServer.IsDraining() {
+			session.notifyDrain()
+		}
+	}
+}
+
+func readConnectCredentials(stream *rpc.Stream) (rpc.Map, *base.Error) {
+	// the credentials are optional
+	if stream.IsReadFinish() {
+		return nil, nil
+	}
+
+	// the credentials are nil if the client only sends the codecs
+	if _, err := stream.ReadNil(); err == nil {
+		return nil, nil
+	}
+
+	if credentials, err := stream.ReadMap(); err != nil {
+		return nil, err
+	} else {
+		return credentials, nil
+	}
+}
+
+// readConnectCodecs reads the compression codecs that the client supports.
+// They are optional, nil means the client does not negotiate the codec.
+func readConnectCodecs(stream *rpc.Stream) (rpc.Bytes, *base.Error) {
+	if stream.IsReadFinish() {
+		return nil, nil
+	}
+
+	if codecs, err := stream.ReadBytes(); err != nil {
+		return nil, err
+	} else {
+		return codecs, nil
+	}
+}
+
+// selectConnectCodec returns the first codec of the client that the server
+// supports, threshold < 0 disables the compression
+func selectConnectCodec(codecs rpc.Bytes, threshold int) uint8 {
+	if threshold >= 0 {
+		for _, codec := range codecs {
+			if codec == rpc.StreamCodecDeflate {
+				return codec
+			}
+		}
+	}
+
+	return rpc.StreamCodecNone
+}
+
+// GetIdentity returns the identity that the authenticator attached to the
+// session, it is nil if the server has no authenticator.
+func (p *Session) GetIdentity() rpc.Any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.identity
+}
+
+// SetIdentity ...
+func (p *Session) SetIdentity(identity rpc.Any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.identity = identity
+}
+
+// GetRemoteAddr returns the remote address of the connection of the session,
+// it is empty if the session is not connected.
+func (p *Session) GetRemoteAddr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		if addr := p.conn.RemoteAddr(); addr != nil {
+			return addr.String()
+		}
+	}
+
+	return ""
+}
+
+// RunningRequests returns the number of the requests that are not replied
+func (p *Session) RunningRequests() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ret := 0
+	for i := 0; i < len(p.channels); i++ {
+		if p.channels[i].IsRunning() {
+			ret++
+		}
+	}
+	return ret
+}
+
+// notifyDrain tells the client of the session that the server is draining
+func (p *Session) notifyDrain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindDrain)
+		stream.SetCallbackID(0)
+		p.conn.WriteStreamAndRelease(stream)
 	}
 }
 
@@ -172,6 +400,7 @@ func (p *Session) TimeCheck(nowNS int64) {
 		for i := 0; i < len(p.channels); i++ {
 			if channel := &p.channels[i]; channel.IsTimeout(nowNS, timeoutNS) {
 				channel.Clean()
+				p.dirty = true
 			}
 		}
 	}
@@ -190,13 +419,35 @@ func (p *Session) OutStream(stream *rpc.Stream) {
 			// record stream
 			callbackID := stream.GetCallbackID()
 			channel := &p.channels[callbackID%uint64(len(p.channels))]
-			if channel.Out(stream) && p.conn != nil {
-				p.conn.WriteStreamAndRelease(stream.Clone())
+			if !channel.Out(stream) {
+				stream.Release()
 			} else {
+				// the channel keeps the stream even if the conn is closed
+				p.dirty = true
+				if p.conn != nil {
+					p.conn.WriteStreamAndRelease(stream.Clone())
+				}
+			}
+		case rpc.StreamKindRPCResponseItem:
+			// record stream
+			callbackID := stream.GetCallbackID()
+			channel := &p.channels[callbackID%uint64(len(p.channels))]
+			maxItems := p.sessionServer.config.serverMaxCacheItems
+			if !channel.OutItem(stream, maxItems) {
 				stream.Release()
+			} else {
+				p.dirty = true
+				if p.conn != nil {
+					p.conn.WriteStreamAndRelease(stream.Clone())
+				}
 			}
 		case rpc.StreamKindRPCBoardCast:
-			p.conn.WriteStreamAndRelease(stream)
+			// the boardcast is not cached, it is lost if the conn is closed
+			if p.conn != nil {
+				p.conn.WriteStreamAndRelease(stream)
+			} else {
+				stream.Release()
+			}
 		default:
 			stream.Release()
 		}
@@ -210,13 +461,47 @@ func (p *Session) OnConnOpen(streamConn *adapter.StreamConn) {
 	p.conn = streamConn
 }
 
+// checkRequest returns the error that the request is replied instead of being
+// received, the session must be locked
+func (p *Session) checkRequest(
+	streamConn *adapter.StreamConn,
+	stream *rpc.Stream,
+) *base.Error {
+	sessionServer := p.sessionServer
+	if sessionServer.IsDraining() {
+		return base.ErrServerDraining
+	}
+
+	nowNS := base.TimeNow().UnixNano()
+	if !p.rateBucket.take(sessionServer.config.serverSessionRateLimit, nowNS) {
+		return base.ErrServerRateLimited
+	}
+
+	// the request with the identity bit is rejected before, so the body
+	// starts with the action path
+	return sessionServer.checkRequestLimits(
+		getRemoteIP(streamConn),
+		stream,
+		nowNS,
+	)
+}
+
 // OnConnReadStream ...
 func (p *Session) OnConnReadStream(
 	streamConn *adapter.StreamConn,
 	stream *rpc.Stream,
 ) {
+	// the request is received after the session is unlocked, because the
+	// receiver may reply to the session at once
+	receiveStream := (*rpc.Stream)(nil)
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	defer func() {
+		p.mu.Unlock()
+		if receiveStream != nil {
+			// who receives the stream is responsible for releasing it
+			p.sessionServer.streamReceiver.OnReceiveStream(receiveStream)
+		}
+	}()
 
 	switch stream.GetKind() {
 	case rpc.StreamKindPing:
@@ -229,15 +514,33 @@ func (p *Session) OnConnReadStream(
 			stream.Release()
 		}
 	case rpc.StreamKindRPCRequest:
-		if cbID := stream.GetCallbackID(); cbID > 0 {
+		// only the gateway can put the identity in the request, the client
+		// that does it is trying to fake its identity
+		if cbID := stream.GetCallbackID(); cbID > 0 &&
+			!stream.HasStatusBitIdentity() {
 			channel := &p.channels[cbID%uint64(len(p.channels))]
 			if accepted, backStream := channel.In(cbID); accepted {
+				p.dirty = true
 				stream.SetSessionID(p.id)
-				// who receives the stream is responsible for releasing it
-				p.sessionServer.streamReceiver.OnReceiveStream(stream)
-			} else if backStream != nil {
-				// do not release the backStream, so we need to clone it
-				streamConn.WriteStreamAndRelease(backStream.Clone())
+				if err := p.checkRequest(streamConn, stream); err != nil {
+					// the reply is cached, so the client gets the same error
+					// if it resends the request
+					errStream := rpc.MakeRequestErrorStream(stream, err)
+					channel.Out(errStream)
+					streamConn.WriteStreamAndRelease(errStream.Clone())
+				} else {
+					receiveStream = stream
+				}
+			} else if items := channel.GetItems(cbID); backStream != nil ||
+				len(items) > 0 {
+				// the client ignores the items it has already received
+				// do not release the cached streams, so we need to clone them
+				for i := 0; i < len(items); i++ {
+					streamConn.WriteStreamAndRelease(items[i].Clone())
+				}
+				if backStream != nil {
+					streamConn.WriteStreamAndRelease(backStream.Clone())
+				}
 				stream.Release()
 			} else {
 				// ignore the stream
@@ -247,6 +550,35 @@ func (p *Session) OnConnReadStream(
 			p.OnConnError(streamConn, base.ErrStream)
 			stream.Release()
 		}
+	case rpc.StreamKindRPCCancel:
+		if cbID := stream.GetCallbackID(); cbID > 0 && stream.IsReadFinish() {
+			channel := &p.channels[cbID%uint64(len(p.channels))]
+			if channel.Cancel(cbID) {
+				p.dirty = true
+			}
+		} else {
+			p.OnConnError(streamConn, base.ErrStream)
+		}
+		stream.Release()
+	case rpc.StreamKindSubscribe:
+		fallthrough
+	case rpc.StreamKindUnsubscribe:
+		if topic, err := stream.ReadString(); err != nil ||
+			!stream.IsReadFinish() {
+			p.OnConnError(streamConn, base.ErrStream)
+		} else if stream.GetKind() == rpc.StreamKindSubscribe {
+			if p.topics == nil {
+				p.topics = make(map[string]bool)
+			}
+			p.topics[topic] = true
+			p.dirty = true
+			p.sessionServer.subscribe(topic, p.id)
+		} else {
+			delete(p.topics, topic)
+			p.dirty = true
+			p.sessionServer.unsubscribe(topic, p.id)
+		}
+		stream.Release()
 	default:
 		p.OnConnError(streamConn, base.ErrStream)
 		stream.Release()
@@ -271,6 +603,107 @@ func (p *Session) OnConnClose(_ *adapter.StreamConn) {
 	p.conn = nil
 }
 
+// getRecord returns the record of the session if it has changed since the
+// last call, otherwise it returns nil
+func (p *Session) getRecord() *SessionRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.dirty {
+		return nil
+	}
+	p.dirty = false
+
+	ret := &SessionRecord{
+		ID:       p.id,
+		Security: p.security,
+		Topics:   make([]string, 0, len(p.topics)),
+		Channels: make([]SessionChannelRecord, len(p.channels)),
+	}
+
+	for topic := range p.topics {
+		ret.Topics = append(ret.Topics, topic)
+	}
+	sort.Strings(ret.Topics)
+
+	for i := 0; i < len(p.channels); i++ {
+		channel := &p.channels[i]
+		record := &ret.Channels[i]
+		record.Sequence = channel.sequence
+		record.BackTimeNS = channel.backTimeNS
+		if channel.backStream != nil {
+			record.BackStream = channel.backStream.GetBuffer()
+		}
+		for _, itemStream := range channel.itemStreams {
+			record.ItemStreams = append(
+				record.ItemStreams,
+				itemStream.GetBuffer(),
+			)
+		}
+	}
+
+	return ret
+}
+
+func newSessionByRecord(
+	sessionServer *SessionServer,
+	record *SessionRecord,
+) *Session {
+	ret := &Session{
+		id:            record.ID,
+		sessionServer: sessionServer,
+		security:      record.Security,
+		identity:      nil,
+		conn:          nil,
+		channels:      make([]Channel, len(record.Channels)),
+		topics:        nil,
+		dirty:         false,
+		activeTimeNS:  base.TimeNow().UnixNano(),
+		rateBucket:    rateBucket{},
+		prev:          nil,
+		next:          nil,
+	}
+
+	if len(record.Topics) > 0 {
+		ret.topics = make(map[string]bool)
+		for _, topic := range record.Topics {
+			ret.topics[topic] = true
+		}
+	}
+
+	fnMakeStream := func(buf []byte) *rpc.Stream {
+		stream := rpc.NewStream()
+		stream.PutBytesTo(buf, 0)
+		return stream
+	}
+
+	for i := 0; i < len(record.Channels); i++ {
+		channelRecord := &record.Channels[i]
+		channel := &ret.channels[i]
+		channel.sequence = channelRecord.Sequence
+		channel.backTimeNS = channelRecord.BackTimeNS
+		if channelRecord.BackStream != nil {
+			channel.backStream = fnMakeStream(channelRecord.BackStream)
+		}
+		for _, buf := range channelRecord.ItemStreams {
+			channel.itemStreams = append(channel.itemStreams, fnMakeStream(buf))
+		}
+	}
+
+	return ret
+}
+
+// clearTopics removes the subscriptions of the session when it is timeout
+func (p *Session) clearTopics() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for topic := range p.topics {
+		p.sessionServer.unsubscribe(topic, p.id)
+	}
+	p.topics = nil
+}
+
 // SessionPool ...
 type SessionPool struct {
 	sessionServer *SessionServer
@@ -324,6 +757,18 @@ func (p *SessionPool) Add(session *Session) bool {
 	return false
 }
 
+// GetSessions returns all the sessions in the pool
+func (p *SessionPool) GetSessions() []*Session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ret := make([]*Session, 0, len(p.idMap))
+	for node := p.head; node != nil; node = node.next {
+		ret = append(ret, node)
+	}
+	return ret
+}
+
 // TimeCheck ...
 func (p *SessionPool) TimeCheck(nowNS int64) {
 	p.mu.Lock()
@@ -336,6 +781,8 @@ func (p *SessionPool) TimeCheck(nowNS int64) {
 		// remove it from the list
 		if node.activeTimeNS == 0 {
 			delete(p.idMap, node.id)
+			node.clearTopics()
+			p.sessionServer.removeStoredSession(node.id)
 
 			if node.prev != nil {
 				node.prev.next = node.next
@@ -359,14 +806,23 @@ func (p *SessionPool) TimeCheck(nowNS int64) {
 // SessionServer ...
 type SessionServer struct {
 	isRunning      bool
+	draining       int32
 	sessionSeed    uint64
 	totalSessions  int64
 	sessionMapList []*SessionPool
 	streamReceiver rpc.IStreamReceiver
 	closeCH        chan bool
 	config         *SessionConfig
+	authenticator  Authenticator
 	adapters       []*adapter.Adapter
 	orcManager     *base.ORCManager
+	topicMap       map[string]map[uint64]bool
+	topicMu        sync.Mutex
+	ipLimiter      *rateLimiter
+	gatewayLimiter *rateLimiter
+	actionLimiters map[string]*rateLimiter
+	removedIDs     []uint64
+	storeMu        sync.Mutex
 	mu             sync.Mutex
 }
 
@@ -382,14 +838,21 @@ func NewSessionServer(
 
 	ret := &SessionServer{
 		isRunning:      false,
+		draining:       0,
 		sessionSeed:    0,
 		totalSessions:  0,
 		sessionMapList: make([]*SessionPool, 1024),
 		streamReceiver: streamReceiver,
 		closeCH:        make(chan bool, 1),
 		config:         config,
+		authenticator:  nil,
 		adapters:       make([]*adapter.Adapter, len(listeners)),
 		orcManager:     base.NewORCManager(),
+		topicMap:       make(map[string]map[uint64]bool),
+		ipLimiter:      newRateLimiter(config.serverIPRateLimit),
+		gatewayLimiter: newRateLimiter(config.serverSessionRateLimit),
+		actionLimiters: nil,
+		removedIDs:     nil,
 	}
 
 	for i := 0; i < 1024; i++ {
@@ -438,6 +901,191 @@ func (p *SessionServer) TimeCheck(nowNS int64) {
 	for i := 0; i < 1024; i++ {
 		p.sessionMapList[i].TimeCheck(nowNS)
 	}
+
+	p.ipLimiter.TimeCheck(nowNS)
+	p.gatewayLimiter.TimeCheck(nowNS)
+}
+
+// setActionRateLimits sets the limits of the actions, the key is the action
+// path. It must be called before Open.
+func (p *SessionServer) setActionRateLimits(limits map[string]rateLimit) {
+	p.actionLimiters = make(map[string]*rateLimiter)
+	for actionPath, limit := range limits {
+		if limiter := newRateLimiter(limit); limiter != nil {
+			p.actionLimiters[actionPath] = limiter
+		}
+	}
+}
+
+// checkRequestLimits returns base.ErrServerRateLimited if the request is over
+// the limit of its remote IP or its action. The body of the stream must start
+// with the action path.
+func (p *SessionServer) checkRequestLimits(
+	remoteIP string,
+	stream *rpc.Stream,
+	nowNS int64,
+) *base.Error {
+	if p.ipLimiter != nil {
+		if !p.ipLimiter.Allow(remoteIP, nowNS) {
+			return base.ErrServerRateLimited
+		}
+	}
+
+	if len(p.actionLimiters) > 0 {
+		actionPath, _ := stream.ReadString()
+		stream.SetReadPosToBodyStart()
+
+		if !p.actionLimiters[actionPath].Allow("", nowNS) {
+			return base.ErrServerRateLimited
+		}
+	}
+
+	return nil
+}
+
+// checkGatewayRequest is the checkRequest of the http gateway. Its requests
+// have no session, so the session limit is applied to each remote IP.
+func (p *SessionServer) checkGatewayRequest(
+	remoteIP string,
+	stream *rpc.Stream,
+) *base.Error {
+	if p.IsDraining() {
+		return base.ErrServerDraining
+	}
+
+	nowNS := base.TimeNow().UnixNano()
+	if !p.gatewayLimiter.Allow(remoteIP, nowNS) {
+		return base.ErrServerRateLimited
+	}
+
+	return p.checkRequestLimits(remoteIP, stream, nowNS)
+}
+
+// RunningRequests returns the number of the requests of all the sessions that
+// are not replied
+func (p *SessionServer) RunningRequests() int {
+	ret := 0
+	for i := 0; i < 1024; i++ {
+		for _, session := range p.sessionMapList[i].GetSessions() {
+			ret += session.RunningRequests()
+		}
+	}
+	return ret
+}
+
+// IsDraining ...
+func (p *SessionServer) IsDraining() bool {
+	return atomic.LoadInt32(&p.draining) != 0
+}
+
+// Drain stops accepting new sessions and requests, and tells the connected
+// clients to migrate. It waits until the running requests are replied or
+// the timeout expires, and returns true if all of them are replied.
+func (p *SessionServer) Drain(timeout time.Duration) bool {
+	if atomic.CompareAndSwapInt32(&p.draining, 0, 1) {
+		for i := 0; i < 1024; i++ {
+			for _, session := range p.sessionMapList[i].GetSessions() {
+				session.notifyDrain()
+			}
+		}
+	}
+
+	deadlineNS := base.TimeNow().Add(timeout).UnixNano()
+	for p.RunningRequests() > 0 {
+		if base.TimeNow().UnixNano() >= deadlineNS {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return true
+}
+
+// LoadSession loads the session from the session store and adds it to the
+// server, it is used to resume the session after the server restarts.
+func (p *SessionServer) LoadSession(id uint64) (*Session, bool) {
+	store := p.config.serverSessionStore
+	if store == nil {
+		return nil, false
+	}
+
+	record, err := store.Load(id)
+	if err != nil {
+		p.streamReceiver.OnReceiveStream(rpc.MakeSystemErrorStream(err))
+		return nil, false
+	} else if record == nil || record.ID != id ||
+		len(record.Channels) != p.config.numOfChannels {
+		// the channels of the client do not match the config any more
+		return nil, false
+	}
+
+	session := newSessionByRecord(p, record)
+	if !p.AddSession(session) {
+		// it is loaded by another connection at the same time
+		return p.GetSession(id)
+	}
+
+	for topic := range session.topics {
+		p.subscribe(topic, id)
+	}
+
+	return session, true
+}
+
+// SaveSessions saves the changed sessions to the session store and deletes
+// the removed sessions from it
+func (p *SessionServer) SaveSessions() {
+	store := p.config.serverSessionStore
+	if store == nil {
+		return
+	}
+
+	p.storeMu.Lock()
+	removedIDs := p.removedIDs
+	p.removedIDs = nil
+	p.storeMu.Unlock()
+
+	for _, id := range removedIDs {
+		if err := store.Delete(id); err != nil {
+			p.streamReceiver.OnReceiveStream(rpc.MakeSystemErrorStream(err))
+		}
+	}
+
+	for i := 0; i < 1024; i++ {
+		for _, session := range p.sessionMapList[i].GetSessions() {
+			if record := session.getRecord(); record == nil {
+				continue
+			} else if err := store.Save(record); err != nil {
+				p.streamReceiver.OnReceiveStream(rpc.MakeSystemErrorStream(err))
+				// try it again next time
+				session.mu.Lock()
+				session.dirty = true
+				session.mu.Unlock()
+			}
+		}
+	}
+}
+
+// removeStoredSession marks the session to be deleted from the session store
+// by the next SaveSessions, it is called with the SessionPool locked
+func (p *SessionServer) removeStoredSession(id uint64) {
+	if p.config.serverSessionStore != nil {
+		p.storeMu.Lock()
+		p.removedIDs = append(p.removedIDs, id)
+		p.storeMu.Unlock()
+	}
+}
+
+// initSessionSeed makes sure the new session ids are not used by the stored
+// sessions
+func (p *SessionServer) initSessionSeed() {
+	if store := p.config.serverSessionStore; store != nil {
+		if maxID, err := store.MaxID(); err != nil {
+			p.streamReceiver.OnReceiveStream(rpc.MakeSystemErrorStream(err))
+		} else if maxID > atomic.LoadUint64(&p.sessionSeed) {
+			atomic.StoreUint64(&p.sessionSeed, maxID)
+		}
+	}
 }
 
 // Open ...
@@ -458,6 +1106,7 @@ func (p *SessionServer) Open() {
 			return false
 		} else {
 			p.isRunning = true
+			p.initSessionSeed()
 			return true
 		}
 	})
@@ -480,6 +1129,23 @@ func (p *SessionServer) Open() {
 			}(item)
 		}
 
+		// the sessions are saved in their own loop, so the slow store does
+		// not delay the TimeCheck
+		if p.config.serverSessionStore != nil {
+			waitCount++
+			go func() {
+				for isRunning() {
+					base.WaitWhileRunning(
+						base.TimeNow().UnixNano(),
+						isRunning,
+						p.config.serverSessionSaveInterval,
+					)
+					p.SaveSessions()
+				}
+				waitCH <- true
+			}()
+		}
+
 		for isRunning() {
 			startNS := base.TimeNow().UnixNano()
 			p.TimeCheck(startNS)
@@ -500,15 +1166,76 @@ func (p *SessionServer) Close() {
 			item.Close()
 		}
 	}, func() {
+		// keep the last changes, so the clients can resume the sessions
+		// after the server restarts
+		p.SaveSessions()
+
 		p.mu.Lock()
 		defer p.mu.Unlock()
 		p.isRunning = false
+		atomic.StoreInt32(&p.draining, 0)
 	})
 }
 
+func (p *SessionServer) subscribe(topic string, sessionID uint64) {
+	p.topicMu.Lock()
+	defer p.topicMu.Unlock()
+
+	sessionMap, ok := p.topicMap[topic]
+	if !ok {
+		sessionMap = make(map[uint64]bool)
+		p.topicMap[topic] = sessionMap
+	}
+	sessionMap[sessionID] = true
+}
+
+func (p *SessionServer) unsubscribe(topic string, sessionID uint64) {
+	p.topicMu.Lock()
+	defer p.topicMu.Unlock()
+
+	if sessionMap, ok := p.topicMap[topic]; ok {
+		delete(sessionMap, sessionID)
+		if len(sessionMap) == 0 {
+			delete(p.topicMap, topic)
+		}
+	}
+}
+
+// publish sends the boardcast stream to the sessions that subscribed its
+// topic. The stream is released.
+func (p *SessionServer) publish(stream *rpc.Stream) {
+	topic, err := stream.ReadString()
+	if err != nil {
+		stream.Release()
+		return
+	}
+	stream.SetReadPosToBodyStart()
+
+	p.topicMu.Lock()
+	sessionIDs := make([]uint64, 0, len(p.topicMap[topic]))
+	for sessionID := range p.topicMap[topic] {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	p.topicMu.Unlock()
+
+	for _, sessionID := range sessionIDs {
+		if session, ok := p.GetSession(sessionID); ok {
+			sessionStream := stream.Clone()
+			sessionStream.SetSessionID(sessionID)
+			session.OutStream(sessionStream)
+		}
+	}
+
+	stream.Release()
+}
+
 // OutStream ...
 func (p *SessionServer) OutStream(stream *rpc.Stream) {
-	if session, ok := p.GetSession(stream.GetSessionID()); ok {
+	if stream.GetKind() == rpc.StreamKindRPCBoardCast &&
+		stream.GetSessionID() == 0 {
+		// published by Runtime.Publish
+		p.publish(stream)
+	} else if session, ok := p.GetSession(stream.GetSessionID()); ok {
 		session.OutStream(stream)
 	} else {
 		errStream := rpc.MakeSystemErrorStream(base.ErrServerSessionNotFound)
@@ -521,7 +1248,7 @@ func (p *SessionServer) OutStream(stream *rpc.Stream) {
 // OnConnOpen ...
 func (p *SessionServer) OnConnOpen(_ *adapter.StreamConn) {
 	// ignore
-	// we will add some security checks here
+	// the credentials are checked by InitSession on the connect request
 }
 
 // OnConnReadStream ...
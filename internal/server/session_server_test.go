@@ -1,8 +1,11 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
 	"testing"
 	"time"
 
@@ -55,7 +58,7 @@ func (p *testNetConn) LocalAddr() net.Addr {
 }
 
 func (p *testNetConn) RemoteAddr() net.Addr {
-	panic("not implemented")
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}
 }
 
 func (p *testNetConn) SetDeadline(_ time.Time) error {
@@ -173,6 +176,7 @@ func TestChannel_In(t *testing.T) {
 		v := &Channel{sequence: 10, backStream: rpc.NewStream(), backTimeNS: 1}
 		assert(v.In(11)).Equals(true, nil)
 		assert(v.backTimeNS, v.backStream).Equals(int64(0), nil)
+		assert(v.running).IsTrue()
 	})
 }
 
@@ -188,11 +192,12 @@ func TestChannel_Out(t *testing.T) {
 
 	t.Run("id equals sequence", func(t *testing.T) {
 		assert := base.NewAssert(t)
-		v := &Channel{sequence: 10}
+		v := &Channel{sequence: 10, running: true}
 		stream := rpc.NewStream()
 		stream.SetCallbackID(10)
 		assert(v.Out(stream)).Equals(true)
 		assert(v.backTimeNS > 0, v.backStream != nil).Equals(true, true)
+		assert(v.running).IsFalse()
 	})
 
 	t.Run("id equals sequence, but not in", func(t *testing.T) {
@@ -223,6 +228,108 @@ func TestChannel_Out(t *testing.T) {
 	})
 }
 
+func TestChannel_OutItem(t *testing.T) {
+	t.Run("id equals sequence", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{sequence: 10}
+		stream := rpc.NewStream()
+		stream.SetCallbackID(10)
+		assert(v.OutItem(stream, 0)).Equals(true)
+		assert(v.OutItem(stream, 0)).Equals(true)
+		assert(v.itemStreams).Equals([]*rpc.Stream{stream, stream})
+		assert(v.backTimeNS, v.backStream).Equals(int64(0), nil)
+	})
+
+	t.Run("the oldest items are dropped", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{sequence: 10}
+		streams := make([]*rpc.Stream, 4)
+		for i := 0; i < len(streams); i++ {
+			streams[i] = rpc.NewStream()
+			streams[i].SetCallbackID(10)
+			assert(v.OutItem(streams[i], 2)).Equals(true)
+		}
+		assert(v.itemStreams).Equals([]*rpc.Stream{streams[2], streams[3]})
+	})
+
+	t.Run("back stream has been out", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{sequence: 10, backTimeNS: 10}
+		stream := rpc.NewStream()
+		stream.SetCallbackID(10)
+		assert(v.OutItem(stream, 0)).Equals(false)
+		assert(len(v.itemStreams)).Equals(0)
+	})
+
+	t.Run("id is wrong", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{sequence: 10}
+		stream := rpc.NewStream()
+		stream.SetCallbackID(9)
+		assert(v.OutItem(stream, 0)).Equals(false)
+		stream.SetCallbackID(0)
+		assert(v.OutItem(stream, 0)).Equals(false)
+		assert(len(v.itemStreams)).Equals(0)
+	})
+}
+
+func TestChannel_Cancel(t *testing.T) {
+	t.Run("id is wrong", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{sequence: 10}
+		assert(v.Cancel(9)).IsFalse()
+		assert(v.backTimeNS).Equals(int64(0))
+	})
+
+	t.Run("back stream has been out", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{sequence: 10, backTimeNS: 10}
+		assert(v.Cancel(10)).IsFalse()
+		assert(v.backTimeNS).Equals(int64(10))
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{sequence: 10, running: true}
+		itemStream := rpc.NewStream()
+		itemStream.SetCallbackID(10)
+		v.OutItem(itemStream, 0)
+		assert(v.Cancel(10)).IsTrue()
+		assert(v.running).IsFalse()
+		assert(v.itemStreams).IsNil()
+		assert(v.backTimeNS > 0).IsTrue()
+		stream := rpc.NewStream()
+		stream.SetCallbackID(10)
+		assert(v.Out(stream)).IsFalse()
+		assert(v.OutItem(stream, 0)).IsFalse()
+	})
+}
+
+func TestChannel_GetItems(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		v := &Channel{sequence: 10, itemStreams: []*rpc.Stream{stream}}
+		assert(v.GetItems(9)).IsNil()
+		assert(v.GetItems(11)).IsNil()
+		assert(v.GetItems(10)).Equals([]*rpc.Stream{stream})
+	})
+}
+
+func TestChannel_IsRunning(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{}
+		assert(v.IsRunning()).IsFalse()
+		v.In(10)
+		assert(v.IsRunning()).IsTrue()
+		stream := rpc.NewStream()
+		stream.SetCallbackID(10)
+		v.Out(stream)
+		assert(v.IsRunning()).IsFalse()
+	})
+}
+
 func TestChannel_IsTimeout(t *testing.T) {
 	t.Run("backTimeNS is zero", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -270,6 +377,16 @@ func TestChannel_Clean(t *testing.T) {
 		assert(v.sequence, v.backTimeNS, v.backStream).
 			Equals(uint64(10), int64(0), nil)
 	})
+
+	t.Run("itemStreams is not empty", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := &Channel{
+			sequence:    10,
+			itemStreams: []*rpc.Stream{rpc.NewStream(), rpc.NewStream()},
+		}
+		v.Clean()
+		assert(v.sequence, v.itemStreams).Equals(uint64(10), nil)
+	})
 }
 
 func TestInitSession(t *testing.T) {
@@ -369,6 +486,141 @@ func TestInitSession(t *testing.T) {
 			Equals(nil, base.ErrStream)
 	})
 
+	t.Run("read credentials error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		netConn := newTestNetConn()
+		streamReceiver := rpc.NewTestStreamReceiver()
+		sessionServer := NewSessionServer(
+			nil, GetDefaultSessionConfig(), streamReceiver,
+		)
+
+		streamConn := adapter.NewStreamConn(
+			false,
+			adapter.NewServerSyncConn(netConn, 1200, 1200),
+			sessionServer,
+		)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString("")
+		stream.Write(rpc.Array{})
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+		assert(netConn.isRunning).IsFalse()
+		assert(rpc.ParseResponseStream(streamReceiver.GetStream())).
+			Equals(nil, base.ErrStream)
+	})
+
+	t.Run("authenticate error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		netConn := newTestNetConn()
+		streamReceiver := rpc.NewTestStreamReceiver()
+		sessionServer := NewSessionServer(
+			nil, GetDefaultSessionConfig(), streamReceiver,
+		)
+		sessionServer.authenticator = NewTokenAuthenticator(
+			map[string]rpc.Any{"pass": "user"},
+		)
+
+		syncConn := adapter.NewServerSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, sessionServer)
+		syncConn.SetNext(streamConn)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString("")
+		stream.Write(rpc.Map{"token": "fail"})
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+
+		assert(netConn.isRunning).IsFalse()
+		assert(sessionServer.TotalSessions()).Equals(int64(0))
+		_, err := rpc.ParseResponseStream(streamReceiver.GetStream())
+		assert(err.GetCode()).Equals(base.ErrServerAuthenticate.GetCode())
+		assert(err.GetMessage()).Equals("authentication failed\ntoken is invalid")
+
+		// the rejected client gets the error
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rs.CheckStream()).IsTrue()
+		_, err = rpc.ParseResponseStream(rs)
+		assert(err.GetCode()).Equals(base.ErrServerAuthenticate.GetCode())
+	})
+
+	t.Run("authenticate ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		netConn := newTestNetConn()
+		streamReceiver := rpc.NewTestStreamReceiver()
+		sessionServer := NewSessionServer(
+			nil, GetDefaultSessionConfig(), streamReceiver,
+		)
+		sessionServer.authenticator = NewTokenAuthenticator(
+			map[string]rpc.Any{"pass": "user"},
+		)
+
+		syncConn := adapter.NewServerSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, sessionServer)
+		syncConn.SetNext(streamConn)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString("")
+		stream.Write(rpc.Map{"token": "pass"})
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+
+		assert(netConn.isRunning).IsTrue()
+		v, _ := sessionServer.GetSession(1)
+		assert(v.GetIdentity()).Equals("user")
+
+		// resume the session with another identity
+		sessionServer.authenticator = NewTokenAuthenticator(
+			map[string]rpc.Any{"pass": "admin"},
+		)
+		syncConn = adapter.NewServerSyncConn(newTestNetConn(), 1200, 1200)
+		streamConn = adapter.NewStreamConn(false, syncConn, sessionServer)
+		syncConn.SetNext(streamConn)
+		stream = rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString(fmt.Sprintf("%d-%s", v.id, v.security))
+		stream.Write(rpc.Map{"token": "pass"})
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+		assert(sessionServer.TotalSessions()).Equals(int64(1))
+		assert(v.GetIdentity()).Equals("admin")
+	})
+
+	t.Run("resume the stored session", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		store := NewMemorySessionStore()
+		config := GetDefaultSessionConfig().SetServerSessionStore(store)
+		security := "12345678123456781234567812345678"
+		_ = store.Save(&SessionRecord{
+			ID:       234,
+			Security: security,
+			Channels: make([]SessionChannelRecord, config.numOfChannels),
+		})
+		sessionServer := NewSessionServer(
+			nil, config, rpc.NewTestStreamReceiver(),
+		)
+
+		syncConn := adapter.NewServerSyncConn(newTestNetConn(), 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, sessionServer)
+		syncConn.SetNext(streamConn)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString("234-" + security)
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+
+		assert(sessionServer.TotalSessions()).Equals(int64(1))
+		v, ok := sessionServer.GetSession(234)
+		assert(ok).IsTrue()
+		assert(v.security).Equals(security)
+		assert(v.conn).IsNotNil()
+	})
+
 	t.Run("max sessions limit", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		streamReceiver := rpc.NewTestStreamReceiver()
@@ -395,6 +647,69 @@ func TestInitSession(t *testing.T) {
 			Equals(nil, base.ErrServerSessionSeedOverflows)
 	})
 
+	t.Run("server is draining, new session", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		streamReceiver := rpc.NewTestStreamReceiver()
+		sessionServer := NewSessionServer(
+			nil, GetDefaultSessionConfig(), streamReceiver,
+		)
+		sessionServer.draining = 1
+
+		netConn := newTestNetConn()
+		syncConn := adapter.NewServerSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, sessionServer)
+		syncConn.SetNext(streamConn)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString("")
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+
+		assert(sessionServer.TotalSessions()).Equals(int64(0))
+		assert(rpc.ParseResponseStream(streamReceiver.GetStream())).
+			Equals(nil, base.ErrServerDraining)
+		// the client gets the error before the conn is closed
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rs.GetKind()).Equals(uint8(rpc.StreamKindSystemErrorReport))
+		assert(netConn.isRunning).IsFalse()
+	})
+
+	t.Run("server is draining, resume the session", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		sessionServer := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		sessionServer.draining = 1
+		security := "12345678123456781234567812345678"
+		sessionServer.AddSession(&Session{
+			id:            234,
+			sessionServer: sessionServer,
+			security:      security,
+			channels:      make([]Channel, 32),
+		})
+
+		netConn := newTestNetConn()
+		syncConn := adapter.NewServerSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, sessionServer)
+		syncConn.SetNext(streamConn)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString("234-" + security)
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+
+		// the drain stream follows the connect response
+		drainStream := rpc.NewStream()
+		drainStream.SetKind(rpc.StreamKindDrain)
+		drainStream.BuildStreamCheck()
+		assert(bytes.HasSuffix(netConn.writeBuffer, drainStream.GetBuffer())).
+			IsTrue()
+		assert(netConn.isRunning).IsTrue()
+	})
+
 	t.Run("stream is ok, create new session", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		id := uint64(234)
@@ -480,6 +795,59 @@ func TestInitSession(t *testing.T) {
 			}
 		}
 	})
+	t.Run("stream is ok, negotiate the codec", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		sessionServer := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		netConn := newTestNetConn()
+		syncConn := adapter.NewServerSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, sessionServer)
+		syncConn.SetNext(streamConn)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString("")
+		stream.WriteNil()
+		stream.WriteBytes(rpc.Bytes{100, rpc.StreamCodecDeflate})
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rs.GetKind()).Equals(uint8(rpc.StreamKindConnectResponse))
+		_, _ = rs.ReadString()
+		for i := 0; i < 4; i++ {
+			_, _ = rs.ReadInt64()
+		}
+		assert(rs.ReadInt64()).Equals(int64(rpc.StreamCodecDeflate), nil)
+		assert(rs.ReadInt64()).Equals(int64(4096), nil)
+		assert(rs.IsReadFinish()).IsTrue()
+		assert(rs.CheckStream()).IsTrue()
+	})
+
+	t.Run("read codecs error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		netConn := newTestNetConn()
+		streamReceiver := rpc.NewTestStreamReceiver()
+		sessionServer := NewSessionServer(
+			nil, GetDefaultSessionConfig(), streamReceiver,
+		)
+		syncConn := adapter.NewServerSyncConn(netConn, 1200, 1200)
+		streamConn := adapter.NewStreamConn(false, syncConn, sessionServer)
+		syncConn.SetNext(streamConn)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindConnectRequest)
+		stream.WriteString("")
+		stream.WriteNil()
+		stream.WriteBool(true)
+		stream.BuildStreamCheck()
+		streamConn.OnReadBytes(stream.GetBuffer())
+		assert(netConn.isRunning).IsFalse()
+		assert(rpc.ParseResponseStream(streamReceiver.GetStream())).
+			Equals(nil, base.ErrStream)
+	})
 }
 
 func TestNewSession(t *testing.T) {
@@ -503,33 +871,139 @@ func TestNewSession(t *testing.T) {
 	})
 }
 
-func TestSession_TimeCheck(t *testing.T) {
-	t.Run("p.conn is active", func(t *testing.T) {
+func TestReadConnectCredentials(t *testing.T) {
+	t.Run("no credentials", func(t *testing.T) {
 		assert := base.NewAssert(t)
-		session, syncConn, netConn := prepareTestSession(nil)
-		session.sessionServer.config.heartbeatTimeout = 100 * time.Millisecond
-		syncConn.OnOpen()
-		session.TimeCheck(base.TimeNow().UnixNano())
-		assert(netConn.isRunning).IsTrue()
-		assert(session.conn).IsNotNil()
+		stream := rpc.NewStream()
+		assert(readConnectCredentials(stream)).Equals(nil, nil)
 	})
 
-	t.Run("p.conn is not active", func(t *testing.T) {
+	t.Run("credentials are nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
-		session, syncConn, netConn := prepareTestSession(nil)
-		session.sessionServer.config.heartbeatTimeout = 1 * time.Millisecond
-		syncConn.OnOpen()
-		time.Sleep(30 * time.Millisecond)
-		session.TimeCheck(base.TimeNow().UnixNano())
-		assert(netConn.isRunning).IsFalse()
+		stream := rpc.NewStream()
+		stream.WriteNil()
+		stream.WriteBytes(rpc.Bytes{rpc.StreamCodecDeflate})
+		assert(readConnectCredentials(stream)).Equals(nil, nil)
+		assert(stream.ReadBytes()).
+			Equals(rpc.Bytes{rpc.StreamCodecDeflate}, nil)
 	})
 
-	t.Run("p.conn is nil, session is not timeout", func(t *testing.T) {
+	t.Run("read error", func(t *testing.T) {
 		assert := base.NewAssert(t)
-		session, _, _ := prepareTestSession(nil)
-		session.sessionServer.config.serverSessionTimeout = time.Second
-		session.sessionServer.TimeCheck(base.TimeNow().UnixNano())
-		assert(session.sessionServer.TotalSessions()).Equals(int64(1))
+		stream := rpc.NewStream()
+		stream.WriteBool(true)
+		assert(readConnectCredentials(stream)).Equals(nil, base.ErrStream)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.Write(rpc.Map{"token": "pass"})
+		assert(readConnectCredentials(stream)).
+			Equals(rpc.Map{"token": "pass"}, nil)
+	})
+}
+
+func TestReadConnectCodecs(t *testing.T) {
+	t.Run("no codecs", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		assert(readConnectCodecs(stream)).Equals(nil, nil)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.WriteBool(true)
+		assert(readConnectCodecs(stream)).Equals(nil, base.ErrStream)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		stream := rpc.NewStream()
+		stream.WriteBytes(rpc.Bytes{100, rpc.StreamCodecDeflate})
+		assert(readConnectCodecs(stream)).
+			Equals(rpc.Bytes{100, rpc.StreamCodecDeflate}, nil)
+	})
+}
+
+func TestSelectConnectCodec(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		assert(selectConnectCodec(nil, 4096)).
+			Equals(uint8(rpc.StreamCodecNone))
+		assert(selectConnectCodec(rpc.Bytes{100}, 4096)).
+			Equals(uint8(rpc.StreamCodecNone))
+		assert(selectConnectCodec(rpc.Bytes{100, rpc.StreamCodecDeflate}, 0)).
+			Equals(uint8(rpc.StreamCodecDeflate))
+		assert(selectConnectCodec(rpc.Bytes{rpc.StreamCodecDeflate}, -1)).
+			Equals(uint8(rpc.StreamCodecNone))
+	})
+}
+
+func TestSession_GetIdentity(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		assert(session.GetIdentity()).IsNil()
+		session.identity = "user"
+		assert(session.GetIdentity()).Equals("user")
+	})
+}
+
+func TestSession_SetIdentity(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		session.SetIdentity("user")
+		assert(session.identity).Equals("user")
+		session.SetIdentity(nil)
+		assert(session.identity).IsNil()
+	})
+}
+
+func TestSession_GetRemoteAddr(t *testing.T) {
+	t.Run("conn is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		assert(session.GetRemoteAddr()).Equals("")
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, _ := prepareTestSession(nil)
+		syncConn.OnOpen()
+		assert(session.GetRemoteAddr()).Equals("127.0.0.1:8080")
+	})
+}
+
+func TestSession_TimeCheck(t *testing.T) {
+	t.Run("p.conn is active", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, netConn := prepareTestSession(nil)
+		session.sessionServer.config.heartbeatTimeout = 100 * time.Millisecond
+		syncConn.OnOpen()
+		session.TimeCheck(base.TimeNow().UnixNano())
+		assert(netConn.isRunning).IsTrue()
+		assert(session.conn).IsNotNil()
+	})
+
+	t.Run("p.conn is not active", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, netConn := prepareTestSession(nil)
+		session.sessionServer.config.heartbeatTimeout = 1 * time.Millisecond
+		syncConn.OnOpen()
+		time.Sleep(30 * time.Millisecond)
+		session.TimeCheck(base.TimeNow().UnixNano())
+		assert(netConn.isRunning).IsFalse()
+	})
+
+	t.Run("p.conn is nil, session is not timeout", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		session.sessionServer.config.serverSessionTimeout = time.Second
+		session.sessionServer.TimeCheck(base.TimeNow().UnixNano())
+		assert(session.sessionServer.TotalSessions()).Equals(int64(1))
 	})
 
 	t.Run("p.conn is nil, session is timeout", func(t *testing.T) {
@@ -595,6 +1069,16 @@ func TestSession_OutStream(t *testing.T) {
 		assert(len(netConn.writeBuffer)).Equals(0)
 	})
 
+	t.Run("boardcast p.conn is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, netConn := prepareTestSession(nil)
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCBoardCast)
+		stream.WriteString("#.test%Message")
+		session.OutStream(stream)
+		assert(len(netConn.writeBuffer)).Equals(0)
+	})
+
 	t.Run("p.conn is nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		session, _, netConn := prepareTestSession(nil)
@@ -671,6 +1155,44 @@ func TestSession_OutStream(t *testing.T) {
 		assert(netConn.writeBuffer).Equals(exceptBuffer)
 	})
 
+	t.Run("stream is StreamKindRPCResponseItem", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, netConn := prepareTestSession(nil)
+		syncConn.OnOpen()
+		// ignore the init stream
+		netConn.writeBuffer = make([]byte, 0)
+
+		(&session.channels[1]).In(1)
+
+		exceptBuffer := make([]byte, 0)
+		for i := 0; i < 3; i++ {
+			stream := rpc.NewStream()
+			stream.SetCallbackID(1)
+			stream.SetKind(rpc.StreamKindRPCResponseItem)
+			stream.WriteUint64(uint64(i))
+			stream.BuildStreamCheck()
+			exceptBuffer = append(exceptBuffer, stream.GetBuffer()...)
+			session.OutStream(stream)
+		}
+
+		// the item can not out after the back stream
+		backStream := rpc.NewStream()
+		backStream.SetCallbackID(1)
+		backStream.SetKind(rpc.StreamKindRPCResponseOK)
+		backStream.BuildStreamCheck()
+		exceptBuffer = append(exceptBuffer, backStream.GetBuffer()...)
+		session.OutStream(backStream)
+
+		stream := rpc.NewStream()
+		stream.SetCallbackID(1)
+		stream.SetKind(rpc.StreamKindRPCResponseItem)
+		stream.WriteUint64(3)
+		session.OutStream(stream)
+
+		assert(netConn.writeBuffer).Equals(exceptBuffer)
+		assert(len(session.channels[1].itemStreams)).Equals(3)
+	})
+
 	t.Run("stream is StreamKindRPCBoardCast", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		session, syncConn, netConn := prepareTestSession(nil)
@@ -698,6 +1220,42 @@ func TestSession_OutStream(t *testing.T) {
 	})
 }
 
+func TestSession_RunningRequests(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		assert(session.RunningRequests()).Equals(0)
+		session.channels[1].In(1)
+		session.channels[2].In(2)
+		assert(session.RunningRequests()).Equals(2)
+		session.channels[2].Cancel(2)
+		assert(session.RunningRequests()).Equals(1)
+	})
+}
+
+func TestSession_notifyDrain(t *testing.T) {
+	t.Run("p.conn is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, netConn := prepareTestSession(nil)
+		session.notifyDrain()
+		assert(len(netConn.writeBuffer)).Equals(0)
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, netConn := prepareTestSession(nil)
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(streamConn)
+		session.OnConnOpen(streamConn)
+		session.notifyDrain()
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rs.GetKind()).Equals(uint8(rpc.StreamKindDrain))
+		assert(rs.GetCallbackID()).Equals(uint64(0))
+		assert(rs.IsReadFinish()).IsTrue()
+	})
+}
+
 func TestSession_OnConnOpen(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -709,6 +1267,84 @@ func TestSession_OnConnOpen(t *testing.T) {
 	})
 }
 
+func TestSession_OnConnReadStream_Subscribe(t *testing.T) {
+	t.Run("stream error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		for _, kind := range []uint8{
+			rpc.StreamKindSubscribe,
+			rpc.StreamKindUnsubscribe,
+		} {
+			for _, topic := range []interface{}{true, nil} {
+				session, syncConn, _ := prepareTestSession(nil)
+				streamConn := adapter.NewStreamConn(false, syncConn, session)
+				streamReceiver := rpc.NewTestStreamReceiver()
+				session.sessionServer.streamReceiver = streamReceiver
+				stream := rpc.NewStream()
+				stream.SetKind(kind)
+				if topic == nil {
+					stream.WriteString("#.test%Message")
+					stream.WriteBool(true)
+				} else {
+					stream.Write(topic)
+				}
+				session.OnConnReadStream(streamConn, stream)
+				assert(rpc.ParseResponseStream(streamReceiver.GetStream())).
+					Equals(nil, base.ErrStream)
+				assert(len(session.topics)).Equals(0)
+			}
+		}
+	})
+
+	t.Run("subscribe and unsubscribe", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, _ := prepareTestSession(nil)
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		sessionServer := session.sessionServer
+
+		fnSend := func(kind uint8, topic string) {
+			stream := rpc.NewStream()
+			stream.SetKind(kind)
+			stream.WriteString(topic)
+			session.OnConnReadStream(streamConn, stream)
+		}
+
+		fnSend(rpc.StreamKindSubscribe, "#.test%Message")
+		fnSend(rpc.StreamKindSubscribe, "#.test%Message")
+		fnSend(rpc.StreamKindSubscribe, "#.test%Other")
+		assert(session.topics).Equals(map[string]bool{
+			"#.test%Message": true,
+			"#.test%Other":   true,
+		})
+		assert(sessionServer.topicMap).Equals(map[string]map[uint64]bool{
+			"#.test%Message": {11: true},
+			"#.test%Other":   {11: true},
+		})
+
+		fnSend(rpc.StreamKindUnsubscribe, "#.test%Message")
+		fnSend(rpc.StreamKindUnsubscribe, "#.test%NotExist")
+		assert(session.topics).Equals(map[string]bool{"#.test%Other": true})
+		assert(sessionServer.topicMap).Equals(map[string]map[uint64]bool{
+			"#.test%Other": {11: true},
+		})
+	})
+}
+
+func TestSession_clearTopics(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		sessionServer := session.sessionServer
+		session.topics = map[string]bool{"#.test%Message": true}
+		sessionServer.subscribe("#.test%Message", 11)
+		sessionServer.subscribe("#.test%Message", 12)
+		session.clearTopics()
+		assert(session.topics).IsNil()
+		assert(sessionServer.topicMap).Equals(map[string]map[uint64]bool{
+			"#.test%Message": {12: true},
+		})
+	})
+}
+
 func TestSession_OnConnReadStream(t *testing.T) {
 	t.Run("cbID == 0, kind == StreamKindPing ok", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -744,6 +1380,42 @@ func TestSession_OnConnReadStream(t *testing.T) {
 			Equals(nil, base.ErrStream)
 	})
 
+	t.Run("kind == StreamKindRPCCancel", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, _ := prepareTestSession(nil)
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		channel := &session.channels[42%len(session.channels)]
+		channel.sequence = 42
+
+		stream := rpc.NewStream()
+		stream.SetCallbackID(42)
+		stream.SetKind(rpc.StreamKindRPCCancel)
+		session.OnConnReadStream(streamConn, stream)
+		assert(session.dirty).IsTrue()
+		assert(channel.backTimeNS > 0).IsTrue()
+
+		// the reply of the canceled request is dropped
+		replyStream := rpc.NewStream()
+		replyStream.SetCallbackID(42)
+		replyStream.SetKind(rpc.StreamKindRPCResponseOK)
+		session.OutStream(replyStream)
+		assert(channel.backStream).IsNil()
+	})
+
+	t.Run("kind == StreamKindRPCCancel error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, _ := prepareTestSession(nil)
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		streamReceiver := rpc.NewTestStreamReceiver()
+		session.sessionServer.streamReceiver = streamReceiver
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCCancel)
+		session.OnConnReadStream(streamConn, stream)
+		assert(rpc.ParseResponseStream(streamReceiver.GetStream())).
+			Equals(nil, base.ErrStream)
+	})
+
 	t.Run("cbID > 0, accept = true, backStream = nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
 
@@ -761,6 +1433,178 @@ func TestSession_OnConnReadStream(t *testing.T) {
 		assert(backStream.GetSessionID()).Equals(uint64(11))
 	})
 
+	t.Run("cbID > 0, the client fakes its identity", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		streamReceiver := rpc.NewTestStreamReceiver()
+		session, syncConn, _ := prepareTestSession(nil)
+		session.sessionServer.streamReceiver = streamReceiver
+		session.SetIdentity("guest")
+
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		stream, _ := rpc.MakeInternalRequestStream(
+			false, 0, "#.test:WhoAmI", "",
+		)
+		stream = rpc.MakeIdentityRequestStream(stream, "admin")
+		stream.SetCallbackID(10)
+		session.OnConnReadStream(streamConn, stream)
+
+		// the request is not received, the conn is closed with the error
+		assert(rpc.ParseResponseStream(streamReceiver.GetStream())).
+			Equals(nil, base.ErrStream)
+		assert(streamReceiver.GetStream()).IsNil()
+		assert(session.RunningRequests()).Equals(0)
+	})
+
+	t.Run("cbID > 0, accept = true, server is draining", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		streamReceiver := rpc.NewTestStreamReceiver()
+		session, syncConn, netConn := prepareTestSession(nil)
+		session.sessionServer.streamReceiver = streamReceiver
+		session.sessionServer.draining = 1
+
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(streamConn)
+		stream := rpc.NewStream()
+		stream.SetCallbackID(10)
+		stream.SetKind(rpc.StreamKindRPCRequest)
+		session.OnConnReadStream(streamConn, stream)
+
+		// the request is replied with the error instead of running
+		assert(streamReceiver.GetStream()).IsNil()
+		assert(session.RunningRequests()).Equals(0)
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rs.GetCallbackID()).Equals(uint64(10))
+		assert(rpc.ParseResponseStream(rs)).
+			Equals(nil, base.ErrServerDraining)
+
+		// the error is cached for the resent request
+		channel := &session.channels[10%len(session.channels)]
+		assert(channel.backStream).IsNotNil()
+	})
+
+	t.Run("cbID > 0, accept = true, session is rate limited", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		streamReceiver := rpc.NewTestStreamReceiver()
+		session, syncConn, netConn := prepareTestSession(nil)
+		session.sessionServer.streamReceiver = streamReceiver
+		session.sessionServer.config.SetServerSessionRateLimit(1, 1)
+
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(streamConn)
+		for cbID := uint64(10); cbID <= 11; cbID++ {
+			stream := rpc.NewStream()
+			stream.SetCallbackID(cbID)
+			stream.SetKind(rpc.StreamKindRPCRequest)
+			session.OnConnReadStream(streamConn, stream)
+		}
+
+		assert(streamReceiver.GetStream().GetCallbackID()).Equals(uint64(10))
+		assert(streamReceiver.GetStream()).IsNil()
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rs.GetCallbackID()).Equals(uint64(11))
+		assert(rpc.ParseResponseStream(rs)).
+			Equals(nil, base.ErrServerRateLimited)
+	})
+
+	t.Run("cbID > 0, accept = true, ip is rate limited", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		streamReceiver := rpc.NewTestStreamReceiver()
+		session, syncConn, netConn := prepareTestSession(nil)
+		session.sessionServer.streamReceiver = streamReceiver
+		session.sessionServer.ipLimiter = newRateLimiter(
+			rateLimit{rate: 1, burst: 1},
+		)
+		session.sessionServer.ipLimiter.Allow(
+			"127.0.0.1",
+			base.TimeNow().UnixNano(),
+		)
+
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(streamConn)
+		stream := rpc.NewStream()
+		stream.SetCallbackID(10)
+		stream.SetKind(rpc.StreamKindRPCRequest)
+		session.OnConnReadStream(streamConn, stream)
+
+		assert(streamReceiver.GetStream()).IsNil()
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rpc.ParseResponseStream(rs)).
+			Equals(nil, base.ErrServerRateLimited)
+	})
+
+	t.Run("cbID > 0, accept = true, action is rate limited", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		streamReceiver := rpc.NewTestStreamReceiver()
+		session, syncConn, netConn := prepareTestSession(nil)
+		session.sessionServer.streamReceiver = streamReceiver
+		session.sessionServer.setActionRateLimits(map[string]rateLimit{
+			"#.user:SayHello": {rate: 1, burst: 1},
+		})
+
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(streamConn)
+		for cbID := uint64(10); cbID <= 12; cbID++ {
+			stream := rpc.NewStream()
+			stream.SetCallbackID(cbID)
+			stream.SetKind(rpc.StreamKindRPCRequest)
+			if cbID == 12 {
+				stream.WriteString("#.user:Sleep")
+			} else {
+				stream.WriteString("#.user:SayHello")
+			}
+			session.OnConnReadStream(streamConn, stream)
+		}
+
+		// the received stream is read from the body start
+		backStream := streamReceiver.GetStream()
+		assert(backStream.GetCallbackID()).Equals(uint64(10))
+		assert(backStream.ReadString()).Equals("#.user:SayHello", nil)
+		assert(streamReceiver.GetStream().GetCallbackID()).Equals(uint64(12))
+
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rs.GetCallbackID()).Equals(uint64(11))
+		assert(rpc.ParseResponseStream(rs)).
+			Equals(nil, base.ErrServerRateLimited)
+	})
+
+	t.Run("cbID > 0, the identity bit does not skip the limit", func(t *testing.T) {
+		assert := base.NewAssert(t)
+
+		streamReceiver := rpc.NewTestStreamReceiver()
+		session, syncConn, _ := prepareTestSession(nil)
+		session.sessionServer.streamReceiver = streamReceiver
+		session.sessionServer.setActionRateLimits(map[string]rateLimit{
+			"#.user:SayHello": {rate: 1, burst: 1},
+		})
+
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(streamConn)
+		for cbID := uint64(10); cbID <= 11; cbID++ {
+			stream, _ := rpc.MakeInternalRequestStream(
+				false, 0, "#.user:SayHello", "",
+			)
+			if cbID == 11 {
+				stream = rpc.MakeIdentityRequestStream(stream, "admin")
+			}
+			stream.SetCallbackID(cbID)
+			session.OnConnReadStream(streamConn, stream)
+		}
+
+		assert(streamReceiver.GetStream().GetCallbackID()).Equals(uint64(10))
+		assert(rpc.ParseResponseStream(streamReceiver.GetStream())).
+			Equals(nil, base.ErrStream)
+		assert(streamReceiver.GetStream()).IsNil()
+	})
+
 	t.Run("cbID > 0, accept = false, backStream != nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		session, syncConn, netConn := prepareTestSession(nil)
@@ -784,6 +1628,50 @@ func TestSession_OnConnReadStream(t *testing.T) {
 		assert(netConn.writeBuffer).Equals(cacheStream.GetBuffer())
 	})
 
+	t.Run("cbID > 0, accept = false, items are resent", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, netConn := prepareTestSession(nil)
+
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(streamConn)
+
+		channel := &session.channels[10%len(session.channels)]
+		channel.In(10)
+
+		exceptBuffer := make([]byte, 0)
+		for i := 0; i < 2; i++ {
+			itemStream := rpc.NewStream()
+			itemStream.SetKind(rpc.StreamKindRPCResponseItem)
+			itemStream.SetCallbackID(10)
+			itemStream.WriteUint64(uint64(i))
+			itemStream.BuildStreamCheck()
+			exceptBuffer = append(exceptBuffer, itemStream.GetBuffer()...)
+			channel.OutItem(itemStream, 0)
+		}
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCRequest)
+		stream.SetCallbackID(10)
+		session.OnConnOpen(streamConn)
+		netConn.writeBuffer = make([]byte, 0)
+		session.OnConnReadStream(streamConn, stream)
+		assert(netConn.writeBuffer).Equals(exceptBuffer)
+
+		// resend the items and the back stream
+		cacheStream := rpc.NewStream()
+		cacheStream.SetCallbackID(10)
+		cacheStream.BuildStreamCheck()
+		exceptBuffer = append(exceptBuffer, cacheStream.GetBuffer()...)
+		channel.Out(cacheStream)
+
+		stream = rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCRequest)
+		stream.SetCallbackID(10)
+		netConn.writeBuffer = make([]byte, 0)
+		session.OnConnReadStream(streamConn, stream)
+		assert(netConn.writeBuffer).Equals(exceptBuffer)
+	})
+
 	t.Run("cbID > 0, accept = false, backStream == nil", func(t *testing.T) {
 		assert := base.NewAssert(t)
 		session, syncConn, netConn := prepareTestSession(nil)
@@ -854,6 +1742,81 @@ func TestSession_OnConnClose(t *testing.T) {
 	})
 }
 
+func TestSession_getRecord(t *testing.T) {
+	t.Run("session is not changed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		assert(session.getRecord()).IsNil()
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		session.topics = map[string]bool{"b": true, "a": true}
+		session.dirty = true
+		backStream := rpc.NewStream()
+		backStream.SetCallbackID(33)
+		itemStream := rpc.NewStream()
+		itemStream.SetCallbackID(34)
+		session.channels[1].sequence = 33
+		session.channels[1].backTimeNS = 100
+		session.channels[1].backStream = backStream
+		session.channels[2].sequence = 34
+		session.channels[2].itemStreams = []*rpc.Stream{itemStream}
+
+		record := session.getRecord()
+		assert(session.dirty).IsFalse()
+		assert(record.ID).Equals(session.id)
+		assert(record.Security).Equals(session.security)
+		assert(record.Topics).Equals([]string{"a", "b"})
+		assert(len(record.Channels)).Equals(len(session.channels))
+		assert(record.Channels[1]).Equals(SessionChannelRecord{
+			Sequence:   33,
+			BackTimeNS: 100,
+			BackStream: backStream.GetBuffer(),
+		})
+		assert(record.Channels[2]).Equals(SessionChannelRecord{
+			Sequence:    34,
+			ItemStreams: [][]byte{itemStream.GetBuffer()},
+		})
+		assert(session.getRecord()).IsNil()
+	})
+}
+
+func TestNewSessionByRecord(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		session.topics = map[string]bool{"a": true}
+		session.dirty = true
+		backStream := rpc.NewStream()
+		backStream.SetCallbackID(33)
+		backStream.WriteString("hello")
+		session.channels[1].sequence = 33
+		session.channels[1].backTimeNS = 100
+		session.channels[1].backStream = backStream
+		session.channels[2].itemStreams = []*rpc.Stream{backStream.Clone()}
+
+		v := newSessionByRecord(session.sessionServer, session.getRecord())
+		assert(v.id).Equals(session.id)
+		assert(v.sessionServer).Equals(session.sessionServer)
+		assert(v.security).Equals(session.security)
+		assert(v.conn).IsNil()
+		assert(v.topics).Equals(session.topics)
+		assert(v.dirty).IsFalse()
+		assert(len(v.channels)).Equals(len(session.channels))
+		assert(v.channels[1].sequence).Equals(uint64(33))
+		assert(v.channels[1].backTimeNS).Equals(int64(100))
+		assert(v.channels[1].backStream.GetBuffer()).
+			Equals(backStream.GetBuffer())
+		assert(v.channels[1].backStream.ReadString()).Equals("hello", nil)
+		assert(len(v.channels[2].itemStreams)).Equals(1)
+		assert(v.channels[2].itemStreams[0].GetBuffer()).
+			Equals(backStream.GetBuffer())
+		assert(v.channels[0].backStream).IsNil()
+	})
+}
+
 func TestNewSessionPool(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -923,6 +1886,19 @@ func TestSessionPool_Get(t *testing.T) {
 	})
 }
 
+func TestSessionPool_GetSessions(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionPool(&SessionServer{})
+		assert(v.GetSessions()).Equals([]*Session{})
+		session1 := &Session{id: 11}
+		session2 := &Session{id: 12}
+		assert(v.Add(session1)).IsTrue()
+		assert(v.Add(session2)).IsTrue()
+		assert(v.GetSessions()).Equals([]*Session{session2, session1})
+	})
+}
+
 func TestSessionPool_TimeCheck(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -931,6 +1907,20 @@ func TestSessionPool_TimeCheck(t *testing.T) {
 		assert(testTimeCheck(2)).IsTrue()
 		assert(testTimeCheck(3)).IsTrue()
 	})
+
+	t.Run("the topics of the removed session are cleared", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		sessionServer := session.sessionServer
+		session.topics = map[string]bool{"#.test%Message": true}
+		sessionServer.subscribe("#.test%Message", session.id)
+		session.activeTimeNS = 0
+		sessionServer.sessionMapList[session.id%1024].TimeCheck(
+			base.TimeNow().UnixNano(),
+		)
+		assert(sessionServer.GetSession(session.id)).Equals(nil, false)
+		assert(sessionServer.topicMap).Equals(map[string]map[uint64]bool{})
+	})
 }
 
 func TestSessionServerBasic(t *testing.T) {
@@ -961,6 +1951,7 @@ func TestNewSessionServer(t *testing.T) {
 		assert(len(v.closeCH)).Equals(0)
 		assert(cap(v.closeCH)).Equals(1)
 		assert(v.config).Equals(GetDefaultSessionConfig())
+		assert(v.authenticator).IsNil()
 		assert(len(v.adapters)).Equals(0)
 		assert(cap(v.adapters)).Equals(0)
 		assert(v.orcManager).IsNotNil()
@@ -982,6 +1973,75 @@ func TestSessionServer_TotalSessions(t *testing.T) {
 	})
 }
 
+func TestSessionServer_RunningRequests(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		assert(v.RunningRequests()).Equals(0)
+		s1 := newSession(1, v)
+		s1.channels[1].In(1)
+		v.AddSession(s1)
+		s2 := newSession(2, v)
+		s2.channels[1].In(1)
+		s2.channels[2].In(2)
+		v.AddSession(s2)
+		assert(v.RunningRequests()).Equals(3)
+	})
+}
+
+func TestSessionServer_IsDraining(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		assert(v.IsDraining()).IsFalse()
+		v.draining = 1
+		assert(v.IsDraining()).IsTrue()
+	})
+}
+
+func TestSessionServer_Drain(t *testing.T) {
+	t.Run("no running requests", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, netConn := prepareTestSession(nil)
+		streamConn := adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(streamConn)
+		session.OnConnOpen(streamConn)
+		assert(session.sessionServer.Drain(time.Second)).IsTrue()
+		assert(session.sessionServer.IsDraining()).IsTrue()
+		rs := rpc.NewStream()
+		rs.PutBytesTo(netConn.writeBuffer, 0)
+		assert(rs.GetKind()).Equals(uint8(rpc.StreamKindDrain))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		session.channels[1].In(1)
+		startTime := base.TimeNow()
+		assert(session.sessionServer.Drain(50 * time.Millisecond)).IsFalse()
+		assert(base.TimeNow().Sub(startTime) >= 50*time.Millisecond).IsTrue()
+	})
+
+	t.Run("the running requests are replied", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		session.channels[1].In(1)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			stream := rpc.NewStream()
+			stream.SetKind(rpc.StreamKindRPCResponseOK)
+			stream.SetCallbackID(1)
+			session.OutStream(stream)
+		}()
+		assert(session.sessionServer.Drain(5 * time.Second)).IsTrue()
+		assert(session.RunningRequests()).Equals(0)
+	})
+}
+
 func TestSessionServer_AddSession(t *testing.T) {
 	t.Run("test", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -1054,6 +2114,334 @@ func TestSessionServer_TimeCheck(t *testing.T) {
 		v.TimeCheck(base.TimeNow().UnixNano())
 		assert(v.TotalSessions()).Equals(int64(0))
 	})
+
+	t.Run("the full buckets of the ip limiter are removed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().SetServerIPRateLimit(1, 1),
+			rpc.NewTestStreamReceiver(),
+		)
+		nowNS := base.TimeNow().UnixNano()
+		assert(v.ipLimiter.Allow("127.0.0.1", nowNS)).IsTrue()
+		assert(len(v.ipLimiter.buckets)).Equals(1)
+		v.TimeCheck(nowNS + int64(time.Second))
+		assert(len(v.ipLimiter.buckets)).Equals(0)
+	})
+
+	t.Run("full buckets of the gateway limiter are removed", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().SetServerSessionRateLimit(1, 1),
+			rpc.NewTestStreamReceiver(),
+		)
+		nowNS := base.TimeNow().UnixNano()
+		assert(v.gatewayLimiter.Allow("127.0.0.1", nowNS)).IsTrue()
+		assert(len(v.gatewayLimiter.buckets)).Equals(1)
+		v.TimeCheck(nowNS + int64(time.Second))
+		assert(len(v.gatewayLimiter.buckets)).Equals(0)
+	})
+}
+
+func TestSessionServer_checkRequestLimits(t *testing.T) {
+	fnStream := func() *rpc.Stream {
+		stream, _ := rpc.MakeInternalRequestStream(
+			false, 0, "#.user:SayHello", "@",
+		)
+		return stream
+	}
+
+	t.Run("no limits", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		nowNS := base.TimeNow().UnixNano()
+		for i := 0; i < 10; i++ {
+			assert(v.checkRequestLimits("127.0.0.1", fnStream(), nowNS)).
+				IsNil()
+		}
+	})
+
+	t.Run("ip is rate limited", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().SetServerIPRateLimit(1, 1),
+			rpc.NewTestStreamReceiver(),
+		)
+		nowNS := base.TimeNow().UnixNano()
+		assert(v.checkRequestLimits("127.0.0.1", fnStream(), nowNS)).IsNil()
+		assert(v.checkRequestLimits("127.0.0.1", fnStream(), nowNS)).
+			Equals(base.ErrServerRateLimited)
+		assert(v.checkRequestLimits("127.0.0.2", fnStream(), nowNS)).IsNil()
+	})
+
+	t.Run("action is rate limited", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		v.setActionRateLimits(map[string]rateLimit{
+			"#.user:SayHello": {rate: 1, burst: 1},
+		})
+		nowNS := base.TimeNow().UnixNano()
+		stream := fnStream()
+		assert(v.checkRequestLimits("127.0.0.1", stream, nowNS)).IsNil()
+		assert(stream.ReadString()).Equals("#.user:SayHello", nil)
+		assert(v.checkRequestLimits("127.0.0.2", fnStream(), nowNS)).
+			Equals(base.ErrServerRateLimited)
+	})
+}
+
+func TestSessionServer_checkGatewayRequest(t *testing.T) {
+	fnStream := func() *rpc.Stream {
+		stream, _ := rpc.MakeInternalRequestStream(
+			false, 0, "#.user:SayHello", "@",
+		)
+		return stream
+	}
+
+	t.Run("server is draining", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		assert(v.checkGatewayRequest("127.0.0.1", fnStream())).IsNil()
+		v.Drain(0)
+		assert(v.checkGatewayRequest("127.0.0.1", fnStream())).
+			Equals(base.ErrServerDraining)
+	})
+
+	t.Run("session limit is applied to each remote ip", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().SetServerSessionRateLimit(0.001, 1),
+			rpc.NewTestStreamReceiver(),
+		)
+		assert(v.checkGatewayRequest("127.0.0.1", fnStream())).IsNil()
+		assert(v.checkGatewayRequest("127.0.0.1", fnStream())).
+			Equals(base.ErrServerRateLimited)
+		assert(v.checkGatewayRequest("127.0.0.2", fnStream())).IsNil()
+	})
+
+	t.Run("action is rate limited", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		v.setActionRateLimits(map[string]rateLimit{
+			"#.user:SayHello": {rate: 0.001, burst: 1},
+		})
+		assert(v.checkGatewayRequest("127.0.0.1", fnStream())).IsNil()
+		assert(v.checkGatewayRequest("127.0.0.2", fnStream())).
+			Equals(base.ErrServerRateLimited)
+	})
+}
+
+func TestSessionServer_setActionRateLimits(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		v.setActionRateLimits(map[string]rateLimit{
+			"#.user:SayHello": {rate: 1, burst: 2},
+			"#.user:Sleep":    {},
+		})
+		assert(len(v.actionLimiters)).Equals(1)
+		assert(v.actionLimiters["#.user:SayHello"].limit).
+			Equals(rateLimit{rate: 1, burst: 2})
+	})
+}
+
+func TestSessionServer_LoadSession(t *testing.T) {
+	t.Run("store is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		assert(v.LoadSession(1)).Equals(nil, false)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		file, _ := ioutil.TempFile("", "rpc-session-")
+		_ = file.Close()
+		defer func() {
+			_ = os.Remove(file.Name())
+		}()
+		streamReceiver := rpc.NewTestStreamReceiver()
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().
+				SetServerSessionStore(NewFileSessionStore(file.Name())),
+			streamReceiver,
+		)
+		assert(v.LoadSession(1)).Equals(nil, false)
+		_, err := rpc.ParseResponseStream(streamReceiver.GetStream())
+		assert(err.GetCode()).Equals(base.ErrServerSessionStore.GetCode())
+	})
+
+	t.Run("session does not exist", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().
+				SetServerSessionStore(NewMemorySessionStore()),
+			rpc.NewTestStreamReceiver(),
+		)
+		assert(v.LoadSession(1)).Equals(nil, false)
+	})
+
+	t.Run("numOfChannels does not match", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		store := NewMemorySessionStore()
+		_ = store.Save(&SessionRecord{
+			ID:       1,
+			Channels: make([]SessionChannelRecord, 2),
+		})
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().SetServerSessionStore(store),
+			rpc.NewTestStreamReceiver(),
+		)
+		assert(v.LoadSession(1)).Equals(nil, false)
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		store := NewMemorySessionStore()
+		config := GetDefaultSessionConfig().SetServerSessionStore(store)
+		_ = store.Save(&SessionRecord{
+			ID:       1,
+			Security: "12345678123456781234567812345678",
+			Topics:   []string{"news"},
+			Channels: make([]SessionChannelRecord, config.numOfChannels),
+		})
+		v := NewSessionServer(nil, config, rpc.NewTestStreamReceiver())
+		session, ok := v.LoadSession(1)
+		assert(ok).IsTrue()
+		assert(session.security).Equals("12345678123456781234567812345678")
+		assert(v.GetSession(1)).Equals(session, true)
+		assert(v.topicMap).Equals(map[string]map[uint64]bool{
+			"news": {1: true},
+		})
+		// it is loaded already
+		assert(v.LoadSession(1)).Equals(session, true)
+	})
+}
+
+func TestSessionServer_SaveSessions(t *testing.T) {
+	t.Run("store is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, _, _ := prepareTestSession(nil)
+		session.dirty = true
+		session.sessionServer.SaveSessions()
+		assert(session.dirty).IsTrue()
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		file, _ := ioutil.TempFile("", "rpc-session-")
+		_ = file.Close()
+		defer func() {
+			_ = os.Remove(file.Name())
+		}()
+		session, _, _ := prepareTestSession(nil)
+		sessionServer := session.sessionServer
+		sessionServer.config.serverSessionStore =
+			NewFileSessionStore(file.Name())
+		streamReceiver := rpc.NewTestStreamReceiver()
+		sessionServer.streamReceiver = streamReceiver
+		session.dirty = true
+		sessionServer.SaveSessions()
+		assert(session.dirty).IsTrue()
+		_, err := rpc.ParseResponseStream(streamReceiver.GetStream())
+		assert(err.GetCode()).Equals(base.ErrServerSessionStore.GetCode())
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		store := NewMemorySessionStore()
+		session1, _, _ := prepareTestSession(nil)
+		sessionServer := session1.sessionServer
+		sessionServer.config.serverSessionStore = store
+		session1.dirty = true
+		session2 := newSession(12, sessionServer)
+		sessionServer.AddSession(session2)
+		sessionServer.SaveSessions()
+		assert(session1.dirty).IsFalse()
+		record, _ := store.Load(session1.id)
+		assert(record.Security).Equals(session1.security)
+		assert(store.Load(session2.id)).Equals(nil, nil)
+	})
+}
+
+func TestSessionServer_removeStoredSession(t *testing.T) {
+	t.Run("store is nil", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil, GetDefaultSessionConfig(), rpc.NewTestStreamReceiver(),
+		)
+		v.removeStoredSession(3)
+		assert(v.removedIDs).IsNil()
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		store := NewMemorySessionStore()
+		_ = store.Save(&SessionRecord{ID: 3})
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().SetServerSessionStore(store),
+			rpc.NewTestStreamReceiver(),
+		)
+		v.removeStoredSession(3)
+		assert(v.removedIDs).Equals([]uint64{3})
+		// it is deleted by the next SaveSessions
+		assert(store.Load(3)).Equals(&SessionRecord{ID: 3}, nil)
+		v.SaveSessions()
+		assert(v.removedIDs).IsNil()
+		assert(store.Load(3)).Equals(nil, nil)
+	})
+}
+
+func TestSessionServer_initSessionSeed(t *testing.T) {
+	t.Run("store error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		file, _ := ioutil.TempFile("", "rpc-session-")
+		_ = file.Close()
+		defer func() {
+			_ = os.Remove(file.Name())
+		}()
+		streamReceiver := rpc.NewTestStreamReceiver()
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().
+				SetServerSessionStore(NewFileSessionStore(file.Name())),
+			streamReceiver,
+		)
+		v.initSessionSeed()
+		assert(v.CreateSessionID()).Equals(uint64(1))
+		_, err := rpc.ParseResponseStream(streamReceiver.GetStream())
+		assert(err.GetCode()).Equals(base.ErrServerSessionStore.GetCode())
+	})
+
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		store := NewMemorySessionStore()
+		_ = store.Save(&SessionRecord{ID: 30})
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig().SetServerSessionStore(store),
+			rpc.NewTestStreamReceiver(),
+		)
+		v.initSessionSeed()
+		assert(v.CreateSessionID()).Equals(uint64(31))
+	})
 }
 
 // func TestSessionServer_Listen(t *testing.T) {
@@ -1171,8 +2559,10 @@ func TestSessionServer_Close(t *testing.T) {
 				time.Sleep(10 * time.Millisecond)
 			}
 			assert(v.isRunning).IsTrue()
+			v.Drain(0)
 			v.Close()
 			assert(v.isRunning).IsFalse()
+			assert(v.IsDraining()).IsFalse()
 			ln1, err1 := net.Listen("tcp", "127.0.0.1:8000")
 			ln2, err2 := net.Listen("tcp", "127.0.0.1:8001")
 			assert(err1).IsNil()
@@ -1188,6 +2578,89 @@ func TestSessionServer_Close(t *testing.T) {
 	})
 }
 
+func TestSessionServer_subscribe(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig(),
+			rpc.NewTestStreamReceiver(),
+		)
+		v.subscribe("#.test%Message", 1)
+		v.subscribe("#.test%Message", 2)
+		v.subscribe("#.test%Message", 2)
+		v.subscribe("#.test%Other", 1)
+		assert(v.topicMap).Equals(map[string]map[uint64]bool{
+			"#.test%Message": {1: true, 2: true},
+			"#.test%Other":   {1: true},
+		})
+	})
+}
+
+func TestSessionServer_unsubscribe(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewSessionServer(
+			nil,
+			GetDefaultSessionConfig(),
+			rpc.NewTestStreamReceiver(),
+		)
+		v.subscribe("#.test%Message", 1)
+		v.subscribe("#.test%Message", 2)
+		v.unsubscribe("#.test%Message", 1)
+		v.unsubscribe("#.test%Other", 1)
+		assert(v.topicMap).Equals(map[string]map[uint64]bool{
+			"#.test%Message": {2: true},
+		})
+		v.unsubscribe("#.test%Message", 2)
+		assert(v.topicMap).Equals(map[string]map[uint64]bool{})
+	})
+}
+
+func TestSessionServer_publish(t *testing.T) {
+	t.Run("topic error", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, netConn := prepareTestSession(nil)
+		syncConn.OnOpen()
+		netConn.writeBuffer = make([]byte, 0)
+		session.sessionServer.subscribe("#.test%Message", 11)
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCBoardCast)
+		stream.WriteBool(true)
+		session.sessionServer.publish(stream)
+		assert(len(netConn.writeBuffer)).Equals(0)
+	})
+
+	t.Run("test ok", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		session, syncConn, netConn := prepareTestSession(nil)
+		syncConn.OnOpen()
+		netConn.writeBuffer = make([]byte, 0)
+		sessionServer := session.sessionServer
+		session.conn = adapter.NewStreamConn(false, syncConn, session)
+		syncConn.SetNext(session.conn)
+		// session 12 is not exist
+		sessionServer.subscribe("#.test%Message", 11)
+		sessionServer.subscribe("#.test%Message", 12)
+		sessionServer.subscribe("#.test%Other", 11)
+
+		stream := rpc.NewStream()
+		stream.SetKind(rpc.StreamKindRPCBoardCast)
+		stream.WriteString("#.test%Message")
+		stream.WriteString("hello")
+		sessionServer.OutStream(stream)
+
+		backStream := rpc.NewStream()
+		backStream.PutBytesTo(netConn.writeBuffer, 0)
+		assert(backStream.GetKind()).Equals(uint8(rpc.StreamKindRPCBoardCast))
+		assert(backStream.GetSessionID()).Equals(uint64(11))
+		assert(backStream.ReadString()).Equals("#.test%Message", nil)
+		assert(backStream.ReadString()).Equals("hello", nil)
+		assert(backStream.IsReadFinish()).IsTrue()
+		assert(len(netConn.writeBuffer)).Equals(len(backStream.GetBuffer()))
+	})
+}
+
 func TestSessionServer_ReceiveStreamFromRouter(t *testing.T) {
 	t.Run("session is exist", func(t *testing.T) {
 		assert := base.NewAssert(t)
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+const sessionFileExt = ".session"
+
+// SessionChannelRecord is the reply cache of a session channel
+type SessionChannelRecord struct {
+	Sequence    uint64
+	BackTimeNS  int64
+	BackStream  []byte
+	ItemStreams [][]byte
+}
+
+// SessionRecord is the state of a session in the SessionStore. InitSession
+// resumes the session from it after the server restarts.
+type SessionRecord struct {
+	ID       uint64
+	Security string
+	Topics   []string
+	Channels []SessionChannelRecord
+}
+
+// SessionStore keeps the sessions outside of the server. The servers that
+// share a store can not create sessions at the same time, because the new
+// session id only grows from MaxID when the server opens.
+type SessionStore interface {
+	// Load returns nil if the session does not exist
+	Load(id uint64) (*SessionRecord, *base.Error)
+	Save(record *SessionRecord) *base.Error
+	Delete(id uint64) *base.Error
+	MaxID() (uint64, *base.Error)
+}
+
+type memorySessionStore struct {
+	recordMap map[uint64]*SessionRecord
+	mu        sync.Mutex
+}
+
+// NewMemorySessionStore returns a SessionStore that keeps the sessions in
+// memory, it survives the restarts of the servers in the same process.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{
+		recordMap: make(map[uint64]*SessionRecord),
+	}
+}
+
+func (p *memorySessionStore) Load(id uint64) (*SessionRecord, *base.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.recordMap[id], nil
+}
+
+func (p *memorySessionStore) Save(record *SessionRecord) *base.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recordMap[record.ID] = record
+	return nil
+}
+
+func (p *memorySessionStore) Delete(id uint64) *base.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.recordMap, id)
+	return nil
+}
+
+func (p *memorySessionStore) MaxID() (uint64, *base.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ret := uint64(0)
+	for id := range p.recordMap {
+		if id > ret {
+			ret = id
+		}
+	}
+	return ret, nil
+}
+
+type fileSessionStore struct {
+	dir string
+}
+
+// NewFileSessionStore returns a SessionStore that saves every session to a
+// json file in dir.
+func NewFileSessionStore(dir string) SessionStore {
+	return &fileSessionStore{dir: dir}
+}
+
+func (p *fileSessionStore) getFilePath(id uint64) string {
+	return path.Join(p.dir, strconv.FormatUint(id, 10)+sessionFileExt)
+}
+
+func (p *fileSessionStore) Load(id uint64) (*SessionRecord, *base.Error) {
+	data, err := ioutil.ReadFile(p.getFilePath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, base.ErrServerSessionStore.AddDebug(err.Error())
+	}
+
+	ret := &SessionRecord{}
+	if err := json.Unmarshal(data, ret); err != nil {
+		return nil, base.ErrServerSessionStore.AddDebug(err.Error())
+	}
+	return ret, nil
+}
+
+func (p *fileSessionStore) Save(record *SessionRecord) *base.Error {
+	filePath := p.getFilePath(record.ID)
+	tmpPath := filePath + ".tmp"
+
+	// write to a temp file first, so the old record is kept if it fails
+	if data, err := json.Marshal(record); err != nil {
+		return base.ErrServerSessionStore.AddDebug(err.Error())
+	} else if err := os.MkdirAll(p.dir, os.ModePerm); err != nil {
+		return base.ErrServerSessionStore.AddDebug(err.Error())
+	} else if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return base.ErrServerSessionStore.AddDebug(err.Error())
+	} else if err := os.Rename(tmpPath, filePath); err != nil {
+		return base.ErrServerSessionStore.AddDebug(err.Error())
+	} else {
+		return nil
+	}
+}
+
+func (p *fileSessionStore) Delete(id uint64) *base.Error {
+	if err := os.Remove(p.getFilePath(id)); err != nil && !os.IsNotExist(err) {
+		return base.ErrServerSessionStore.AddDebug(err.Error())
+	}
+	return nil
+}
+
+func (p *fileSessionStore) MaxID() (uint64, *base.Error) {
+	files, err := ioutil.ReadDir(p.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, base.ErrServerSessionStore.AddDebug(err.Error())
+	}
+
+	ret := uint64(0)
+	for _, file := range files {
+		if name := file.Name(); strings.HasSuffix(name, sessionFileExt) {
+			id, err := strconv.ParseUint(
+				strings.TrimSuffix(name, sessionFileExt), 10, 64,
+			)
+			if err == nil && id > ret {
+				ret = id
+			}
+		}
+	}
+	return ret, nil
+}
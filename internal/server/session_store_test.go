@@ -0,0 +1,108 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/rpccloud/rpc/internal/base"
+)
+
+func getTestSessionRecord(id uint64) *SessionRecord {
+	return &SessionRecord{
+		ID:       id,
+		Security: "12345678123456781234567812345678",
+		Topics:   []string{"news"},
+		Channels: []SessionChannelRecord{
+			{Sequence: 1, BackTimeNS: 10, BackStream: []byte{1, 2, 3}},
+			{Sequence: 2, ItemStreams: [][]byte{{4, 5}, {6}}},
+		},
+	}
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	assert := base.NewAssert(t)
+
+	assert(store.Load(1)).Equals(nil, nil)
+	assert(store.MaxID()).Equals(uint64(0), nil)
+
+	assert(store.Save(getTestSessionRecord(3))).IsNil()
+	assert(store.Save(getTestSessionRecord(12))).IsNil()
+	assert(store.Load(3)).Equals(getTestSessionRecord(3), nil)
+	assert(store.Load(12)).Equals(getTestSessionRecord(12), nil)
+	assert(store.MaxID()).Equals(uint64(12), nil)
+
+	record := getTestSessionRecord(3)
+	record.Topics = nil
+	assert(store.Save(record)).IsNil()
+	assert(store.Load(3)).Equals(record, nil)
+
+	assert(store.Delete(12)).IsNil()
+	assert(store.Delete(12)).IsNil()
+	assert(store.Load(12)).Equals(nil, nil)
+	assert(store.MaxID()).Equals(uint64(3), nil)
+}
+
+func TestNewMemorySessionStore(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewMemorySessionStore().(*memorySessionStore)
+		assert(len(v.recordMap)).Equals(0)
+	})
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		testSessionStore(t, NewMemorySessionStore())
+	})
+}
+
+func TestNewFileSessionStore(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		v := NewFileSessionStore("dir").(*fileSessionStore)
+		assert(v.dir).Equals("dir")
+		assert(v.getFilePath(12)).Equals(path.Join("dir", "12.session"))
+	})
+}
+
+func TestFileSessionStore(t *testing.T) {
+	t.Run("test", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "rpc-session-")
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+		testSessionStore(t, NewFileSessionStore(path.Join(dir, "sessions")))
+	})
+
+	t.Run("file is broken", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		dir, _ := ioutil.TempDir("", "rpc-session-")
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+		store := NewFileSessionStore(dir)
+		_ = ioutil.WriteFile(path.Join(dir, "5.session"), []byte("{"), 0600)
+		_ = ioutil.WriteFile(path.Join(dir, "abc.session"), []byte("{}"), 0600)
+		_ = ioutil.WriteFile(path.Join(dir, "9.txt"), []byte("{}"), 0600)
+		record, err := store.Load(5)
+		assert(record).IsNil()
+		assert(err.GetCode()).Equals(base.ErrServerSessionStore.GetCode())
+		assert(store.MaxID()).Equals(uint64(5), nil)
+	})
+
+	t.Run("dir is a file", func(t *testing.T) {
+		assert := base.NewAssert(t)
+		file, _ := ioutil.TempFile("", "rpc-session-")
+		_ = file.Close()
+		defer func() {
+			_ = os.Remove(file.Name())
+		}()
+		store := NewFileSessionStore(file.Name())
+		assert(store.Save(getTestSessionRecord(1)).GetCode()).
+			Equals(base.ErrServerSessionStore.GetCode())
+		_, err := store.MaxID()
+		assert(err.GetCode()).Equals(base.ErrServerSessionStore.GetCode())
+	})
+}
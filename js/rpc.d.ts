@@ -0,0 +1,194 @@
+// Type declarations of rpc.js
+
+export type Any =
+  | null
+  | undefined
+  | boolean
+  | number
+  | bigint
+  | string
+  | Uint8Array
+  | ArrayBuffer
+  | Int64
+  | Uint64
+  | Float64
+  | Any[]
+  | Map<string, Any>
+  | { [key: string]: Any }
+
+// Value is what is read from the stream. The integers that are not safe are
+// bigint, the Bytes are Uint8Array and the Maps are plain objects.
+export type Value =
+  | null
+  | boolean
+  | number
+  | bigint
+  | string
+  | Uint8Array
+  | Value[]
+  | { [key: string]: Value }
+
+export const StreamHeadSize: number
+export const StreamWriteOK: string
+export const StreamWriteOverflow: string
+
+export const StreamKindConnectRequest: number
+export const StreamKindConnectResponse: number
+export const StreamKindPing: number
+export const StreamKindPong: number
+export const StreamKindRPCRequest: number
+export const StreamKindRPCResponseOK: number
+export const StreamKindRPCResponseError: number
+export const StreamKindRPCBoardCast: number
+export const StreamKindSystemErrorReport: number
+export const StreamKindRPCResponseItem: number
+export const StreamKindSubscribe: number
+export const StreamKindUnsubscribe: number
+export const StreamKindRPCCancel: number
+export const StreamKindDrain: number
+
+export const StreamCodecNone: number
+
+export type ConnState = 0 | 1 | 2
+export const ConnStateConnecting: ConnState
+export const ConnStateConnected: ConnState
+export const ConnStateDisconnected: ConnState
+
+export class RPCError extends Error {
+  readonly code: number
+  constructor(code: number, message: string)
+  getCode(): number
+  getMessage(): string
+  addDebug(debug: string): RPCError
+}
+
+export const ErrStream: RPCError
+export const ErrUnsupportedValue: RPCError
+export const ErrClientTimeout: RPCError
+export const ErrClientConfig: RPCError
+export const ErrClientCanceled: RPCError
+
+export class Int64 {
+  readonly value: number | bigint
+  constructor(value: number | bigint)
+}
+
+export class Uint64 {
+  readonly value: number | bigint
+  constructor(value: number | bigint)
+}
+
+export class Float64 {
+  readonly value: number
+  constructor(value: number)
+}
+
+export interface TraceContext {
+  traceID: Uint8Array
+  spanID: Uint8Array
+  flags: number
+}
+
+export class Stream {
+  constructor()
+  static fromBytes(bytes: Uint8Array): Stream
+
+  getVersion(): number
+  setVersion(v: number): void
+  hasStatusBitDebug(): boolean
+  setStatusBitDebug(): void
+  hasStatusBitIdentity(): boolean
+  hasStatusBitCompressed(): boolean
+  getKind(): number
+  setKind(v: number): void
+  getPriority(): number
+  setPriority(v: number): void
+  getLength(): number
+  getZoneID(): number
+  setZoneID(v: number): void
+  getTargetID(): number | bigint
+  setTargetID(v: number | bigint): void
+  getSourceID(): number | bigint
+  setSourceID(v: number | bigint): void
+  getGatewayID(): number | bigint
+  setGatewayID(v: number | bigint): void
+  getSessionID(): number | bigint
+  setSessionID(v: number | bigint): void
+  getCallbackID(): number | bigint
+  setCallbackID(v: number | bigint): void
+  getDepth(): number
+  setDepth(v: number): void
+  getTimeout(): number | bigint
+  setTimeout(v: number | bigint): void
+  getTraceContext(): TraceContext
+  setTraceContext(v: TraceContext): void
+
+  getReadPos(): number
+  setReadPos(pos: number): boolean
+  setReadPosToBodyStart(): void
+  getWritePos(): number
+  setWritePosToBodyStart(): void
+  canRead(): boolean
+  isReadFinish(): boolean
+  getBuffer(): Uint8Array
+  buildStreamCheck(): void
+  checkStream(): boolean
+
+  writeNil(): void
+  writeBool(v: boolean): void
+  writeFloat64(v: number): void
+  writeInt64(v: number | bigint): void
+  writeUint64(v: number | bigint): void
+  writeString(v: string): void
+  writeBytes(v: Uint8Array): void
+  write(v: Any): string
+
+  readNil(): null
+  readBool(): boolean
+  readFloat64(): number
+  readInt64(): number | bigint
+  readUint64(): number | bigint
+  readString(): string
+  readBytes(): Uint8Array
+  readArray(): Value[]
+  readMap(): { [key: string]: Value }
+  read(): Value
+}
+
+export function parseResponseStream(stream: Stream): Value
+
+export class StreamGenerator {
+  constructor(onStream: (stream: Stream) => void)
+  reset(): void
+  onBytes(b: Uint8Array): void
+}
+
+export interface ClientOptions {
+  credentials?: { [key: string]: Any } | Map<string, Any>
+  onError?: (err: RPCError) => void
+  onConnState?: (state: ConnState) => void
+  reconnectMinInterval?: number
+  reconnectMaxInterval?: number
+  WebSocket?: typeof WebSocket
+}
+
+export interface Subscription {
+  close(): void
+}
+
+export class Client {
+  constructor(url: string, options?: ClientOptions)
+  send(timeoutMS: number, target: string, ...args: Any[]): Promise<Value>
+  sendWithPriority(
+    priority: number,
+    timeoutMS: number,
+    target: string,
+    ...args: Any[]
+  ): Promise<Value>
+  subscribe(
+    nodePath: string,
+    message: string,
+    fn: (value: Value) => void,
+  ): Subscription
+  close(): boolean
+}
@@ -0,0 +1,1451 @@
+// Package rpc is the browser client of the rpccloud server. It speaks the
+// RPCStream v1 encoding (doc/rpcstream/v1) over the websocket adapter.
+
+const streamVersion = 3
+const streamBlockSize = 512
+
+const streamPosVersion = 0
+const streamPosStatusBit = 1
+const streamPosKind = 2
+const streamPosPriority = 3
+const streamPosLength = 4
+const streamPosCheckSum = 8
+const streamPosZoneID = 16
+const streamPosTargetID = 18
+const streamPosSourceID = 26
+const streamPosGatewayID = 34
+const streamPosSessionID = 42
+const streamPosCallbackID = 50
+const streamPosDepth = 58
+const streamPosTimeout = 60
+const streamPosTraceID = 68
+const streamPosSpanID = 84
+const streamPosTraceFlags = 92
+const streamPosBody = 93
+
+const streamStatusBitDebug = 0
+const streamStatusBitIdentity = 1
+const streamStatusBitCompressed = 2
+
+const streamWriteMaxDepth = 64
+
+const int64Offset = BigInt("9223372036854775808")
+const int64Min = -int64Offset
+const int64Max = int64Offset - BigInt(1)
+const uint64Max = BigInt("18446744073709551615")
+
+const utf8Encoder = new TextEncoder()
+const utf8Decoder = new TextDecoder("utf-8", { fatal: true })
+
+export const StreamHeadSize = streamPosBody
+export const StreamWriteOK = ""
+export const StreamWriteOverflow = " overflows"
+
+export const StreamKindConnectRequest = 1
+export const StreamKindConnectResponse = 2
+export const StreamKindPing = 3
+export const StreamKindPong = 4
+export const StreamKindRPCRequest = 5
+export const StreamKindRPCResponseOK = 6
+export const StreamKindRPCResponseError = 7
+export const StreamKindRPCBoardCast = 8
+export const StreamKindSystemErrorReport = 9
+export const StreamKindRPCResponseItem = 10
+export const StreamKindSubscribe = 11
+export const StreamKindUnsubscribe = 12
+export const StreamKindRPCCancel = 13
+export const StreamKindDrain = 14
+
+export const StreamCodecNone = 0
+
+export const ConnStateConnecting = 0
+export const ConnStateConnected = 1
+export const ConnStateDisconnected = 2
+
+// RPCError is the error of the server or of the client, code is the same as
+// the code of the Go error.
+export class RPCError extends Error {
+  constructor(code, message) {
+    super(message)
+    this.name = "RPCError"
+    this.code = code & 0xFFFFFF
+  }
+
+  getCode() {
+    return this.code
+  }
+
+  getMessage() {
+    return this.message
+  }
+
+  addDebug(debug) {
+    return new RPCError(
+      this.code,
+      this.message === "" ? debug : this.message + "\n" + debug,
+    )
+  }
+}
+
+export const ErrStream = new RPCError(6422529, "stream error")
+export const ErrUnsupportedValue = new RPCError(4456450, "")
+export const ErrClientTimeout = new RPCError(2229249, "timeout")
+export const ErrClientConfig = new RPCError(1180674, "client config error")
+export const ErrClientCanceled = new RPCError(2229251, "canceled")
+
+// Int64, Uint64 and Float64 tell the stream how to write the number. The
+// integers are written as Int64 and the others as Float64 by default, but the
+// action of the server only accepts the exact type of its argument.
+export class Int64 {
+  constructor(value) {
+    this.value = value
+  }
+}
+
+export class Uint64 {
+  constructor(value) {
+    this.value = value
+  }
+}
+
+export class Float64 {
+  constructor(value) {
+    this.value = value
+  }
+}
+
+// toNumber returns the number if it is safe, otherwise the bigint
+function toNumber(v) {
+  return v >= BigInt(Number.MIN_SAFE_INTEGER) &&
+    v <= BigInt(Number.MAX_SAFE_INTEGER) ? Number(v) : v
+}
+
+function toBigInt(v) {
+  if (typeof v === "bigint") {
+    return v
+  }
+  if (typeof v === "number" && Number.isInteger(v)) {
+    return BigInt(v)
+  }
+  return null
+}
+
+function getTypeName(v) {
+  if (typeof v !== "object") {
+    return typeof v
+  }
+  return v.constructor && v.constructor.name ? v.constructor.name : "Object"
+}
+
+function isPlainObject(v) {
+  const proto = Object.getPrototypeOf(v)
+  return proto === Object.prototype || proto === null
+}
+
+// Stream is the RPCStream, the frames of the Go stream are a linear buffer
+// here, the bytes on the wire are the same.
+export class Stream {
+  constructor() {
+    this.buffer = new Uint8Array(streamBlockSize)
+    this.view = new DataView(this.buffer.buffer)
+    this.buffer[streamPosVersion] = streamVersion
+    this.writePos = streamPosBody
+    this.readPos = streamPosBody
+  }
+
+  // fromBytes returns the stream of the bytes, the bytes are copied
+  static fromBytes(bytes) {
+    const ret = new Stream()
+    ret.writePos = 0
+    ret.putBytes(bytes)
+    return ret
+  }
+
+  getVersion() {
+    return this.buffer[streamPosVersion]
+  }
+
+  setVersion(v) {
+    this.buffer[streamPosVersion] = v
+  }
+
+  hasStatusBitDebug() {
+    return this.hasStatusBit(streamStatusBitDebug)
+  }
+
+  setStatusBitDebug() {
+    this.buffer[streamPosStatusBit] |= 1 << streamStatusBitDebug
+  }
+
+  hasStatusBitIdentity() {
+    return this.hasStatusBit(streamStatusBitIdentity)
+  }
+
+  hasStatusBitCompressed() {
+    return this.hasStatusBit(streamStatusBitCompressed)
+  }
+
+  hasStatusBit(bit) {
+    return (this.buffer[streamPosStatusBit] & (1 << bit)) !== 0
+  }
+
+  getKind() {
+    return this.buffer[streamPosKind]
+  }
+
+  setKind(v) {
+    this.buffer[streamPosKind] = v
+  }
+
+  getPriority() {
+    return this.buffer[streamPosPriority]
+  }
+
+  setPriority(v) {
+    this.buffer[streamPosPriority] = v
+  }
+
+  getLength() {
+    return this.view.getUint32(streamPosLength, true)
+  }
+
+  getZoneID() {
+    return this.view.getUint16(streamPosZoneID, true)
+  }
+
+  setZoneID(v) {
+    this.view.setUint16(streamPosZoneID, v, true)
+  }
+
+  getTargetID() {
+    return this.getHeadUint64(streamPosTargetID)
+  }
+
+  setTargetID(v) {
+    this.setHeadUint64(streamPosTargetID, v)
+  }
+
+  getSourceID() {
+    return this.getHeadUint64(streamPosSourceID)
+  }
+
+  setSourceID(v) {
+    this.setHeadUint64(streamPosSourceID, v)
+  }
+
+  getGatewayID() {
+    return this.getHeadUint64(streamPosGatewayID)
+  }
+
+  setGatewayID(v) {
+    this.setHeadUint64(streamPosGatewayID, v)
+  }
+
+  getSessionID() {
+    return this.getHeadUint64(streamPosSessionID)
+  }
+
+  setSessionID(v) {
+    this.setHeadUint64(streamPosSessionID, v)
+  }
+
+  getCallbackID() {
+    return this.getHeadUint64(streamPosCallbackID)
+  }
+
+  setCallbackID(v) {
+    this.setHeadUint64(streamPosCallbackID, v)
+  }
+
+  getDepth() {
+    return this.view.getUint16(streamPosDepth, true)
+  }
+
+  setDepth(v) {
+    this.view.setUint16(streamPosDepth, v, true)
+  }
+
+  // getTimeout returns the remaining time of the request in nanoseconds
+  getTimeout() {
+    return this.getHeadUint64(streamPosTimeout)
+  }
+
+  setTimeout(v) {
+    this.setHeadUint64(streamPosTimeout, v)
+  }
+
+  // getTraceContext returns the W3C trace context, the spanID is the span of
+  // the caller
+  getTraceContext() {
+    return {
+      traceID: this.buffer.slice(streamPosTraceID, streamPosTraceID + 16),
+      spanID: this.buffer.slice(streamPosSpanID, streamPosSpanID + 8),
+      flags: this.buffer[streamPosTraceFlags],
+    }
+  }
+
+  setTraceContext(v) {
+    this.buffer.set(v.traceID.subarray(0, 16), streamPosTraceID)
+    this.buffer.set(v.spanID.subarray(0, 8), streamPosSpanID)
+    this.buffer[streamPosTraceFlags] = v.flags
+  }
+
+  getHeadUint64(pos) {
+    return toNumber(this.view.getBigUint64(pos, true))
+  }
+
+  setHeadUint64(pos, v) {
+    this.view.setBigUint64(pos, BigInt.asUintN(64, BigInt(v)), true)
+  }
+
+  getReadPos() {
+    return this.readPos
+  }
+
+  setReadPos(pos) {
+    if (pos >= streamPosBody && pos <= this.writePos) {
+      this.readPos = pos
+      return true
+    }
+    return false
+  }
+
+  setReadPosToBodyStart() {
+    this.readPos = streamPosBody
+  }
+
+  getWritePos() {
+    return this.writePos
+  }
+
+  setWritePosToBodyStart() {
+    this.writePos = streamPosBody
+  }
+
+  canRead() {
+    return this.readPos < this.writePos
+  }
+
+  isReadFinish() {
+    return this.readPos === this.writePos
+  }
+
+  // getBuffer returns a copy of the written bytes
+  getBuffer() {
+    return this.buffer.slice(0, this.writePos)
+  }
+
+  // grow makes sure n bytes can be written, the buffer is padded with zeros
+  // to the blocks, so the checksum can read it as uint64
+  grow(n) {
+    if (this.writePos + n > this.buffer.length) {
+      const size = Math.ceil((this.writePos + n) / streamBlockSize) *
+        streamBlockSize
+      const buffer = new Uint8Array(Math.max(size, this.buffer.length * 2))
+      buffer.set(this.buffer)
+      this.buffer = buffer
+      this.view = new DataView(buffer.buffer)
+    }
+  }
+
+  putBytes(v) {
+    this.grow(v.length)
+    this.buffer.set(v, this.writePos)
+    this.writePos += v.length
+  }
+
+  putByte(v) {
+    this.grow(1)
+    this.buffer[this.writePos++] = v
+  }
+
+  getCheckSum() {
+    // xor the uint64 words as two uint32 halves, the tail is zero padded
+    const end = Math.ceil(this.writePos / 8) * 8
+    this.buffer.fill(0, this.writePos, end)
+    let lo = 0
+    let hi = 0
+    for (let i = 0; i < end; i += 8) {
+      lo ^= this.view.getUint32(i, true)
+      hi ^= this.view.getUint32(i + 4, true)
+    }
+    return [lo >>> 0, hi >>> 0]
+  }
+
+  buildStreamCheck() {
+    this.view.setUint32(streamPosLength, this.writePos, true)
+    this.view.setUint32(streamPosCheckSum, 0, true)
+    this.view.setUint32(streamPosCheckSum + 4, 0, true)
+    const [lo, hi] = this.getCheckSum()
+    this.view.setUint32(streamPosCheckSum, lo, true)
+    this.view.setUint32(streamPosCheckSum + 4, hi, true)
+  }
+
+  checkStream() {
+    const [lo, hi] = this.getCheckSum()
+    return lo === 0 && hi === 0 && this.getLength() === this.writePos
+  }
+
+  writeNil() {
+    this.putByte(1)
+  }
+
+  writeBool(v) {
+    this.putByte(v ? 2 : 3)
+  }
+
+  writeFloat64(v) {
+    if (v === 0) {
+      this.putByte(4)
+    } else {
+      this.grow(9)
+      this.buffer[this.writePos] = 5
+      this.view.setFloat64(this.writePos + 1, v, true)
+      this.writePos += 9
+    }
+  }
+
+  // writeInt64 writes the number or the bigint in the range of int64
+  writeInt64(value) {
+    const v = BigInt(value)
+    if (v > BigInt(-8) && v < BigInt(33)) {
+      this.putByte(Number(v) + 21)
+    } else if (v >= BigInt(-32768) && v < BigInt(32768)) {
+      this.grow(3)
+      this.buffer[this.writePos] = 6
+      this.view.setUint16(this.writePos + 1, Number(v) + 32768, true)
+      this.writePos += 3
+    } else if (v >= BigInt(-2147483648) && v < BigInt(2147483648)) {
+      this.grow(5)
+      this.buffer[this.writePos] = 7
+      this.view.setUint32(this.writePos + 1, Number(v) + 2147483648, true)
+      this.writePos += 5
+    } else {
+      this.grow(9)
+      this.buffer[this.writePos] = 8
+      this.view.setBigUint64(this.writePos + 1, v + int64Offset, true)
+      this.writePos += 9
+    }
+  }
+
+  // writeUint64 writes the number or the bigint in the range of uint64
+  writeUint64(value) {
+    const v = BigInt(value)
+    if (v < BigInt(10)) {
+      this.putByte(Number(v) + 54)
+    } else if (v < BigInt(65536)) {
+      this.grow(3)
+      this.buffer[this.writePos] = 9
+      this.view.setUint16(this.writePos + 1, Number(v), true)
+      this.writePos += 3
+    } else if (v < BigInt(4294967296)) {
+      this.grow(5)
+      this.buffer[this.writePos] = 10
+      this.view.setUint32(this.writePos + 1, Number(v), true)
+      this.writePos += 5
+    } else {
+      this.grow(9)
+      this.buffer[this.writePos] = 11
+      this.view.setBigUint64(this.writePos + 1, v, true)
+      this.writePos += 9
+    }
+  }
+
+  writeString(v) {
+    const b = utf8Encoder.encode(v)
+    if (b.length === 0) {
+      this.putByte(128)
+    } else if (b.length < 63) {
+      this.putByte(b.length + 128)
+      this.putBytes(b)
+      this.putByte(0)
+    } else {
+      this.grow(5)
+      this.buffer[this.writePos] = 191
+      this.view.setUint32(this.writePos + 1, b.length + 6, true)
+      this.writePos += 5
+      this.putBytes(b)
+      this.putByte(0)
+    }
+  }
+
+  writeBytes(v) {
+    if (v.length === 0) {
+      this.putByte(192)
+    } else if (v.length < 63) {
+      this.putByte(v.length + 192)
+      this.putBytes(v)
+    } else {
+      this.grow(5)
+      this.buffer[this.writePos] = 255
+      this.view.setUint32(this.writePos + 1, v.length + 5, true)
+      this.writePos += 5
+      this.putBytes(v)
+    }
+  }
+
+  // writeContainer writes the header of the Array (op 64) or the Map (op 96),
+  // then the items, then the total length in the header
+  writeContainer(op, length, writeItems) {
+    if (length === 0) {
+      this.putByte(op)
+      return StreamWriteOK
+    }
+
+    const startPos = this.writePos
+    this.grow(9)
+    if (length < 31) {
+      this.buffer[this.writePos] = op + length
+      this.writePos += 5
+    } else {
+      this.buffer[this.writePos] = op + 31
+      this.view.setUint32(this.writePos + 5, length, true)
+      this.writePos += 9
+    }
+
+    const reason = writeItems()
+    if (reason !== StreamWriteOK) {
+      this.writePos = startPos
+      return reason
+    }
+
+    this.view.setUint32(startPos + 1, this.writePos - startPos, true)
+    return StreamWriteOK
+  }
+
+  writeArray(v, depth) {
+    return this.writeContainer(64, v.length, () => {
+      for (let i = 0; i < v.length; i++) {
+        const reason = this.writeValue(v[i], depth - 1)
+        if (reason !== StreamWriteOK) {
+          return "[" + i + "]" + reason
+        }
+      }
+      return StreamWriteOK
+    })
+  }
+
+  writeMap(entries, depth) {
+    return this.writeContainer(96, entries.length, () => {
+      for (const [name, value] of entries) {
+        if (typeof name !== "string") {
+          return "[" + String(name) + "] key is not a string"
+        }
+        this.writeString(name)
+        const reason = this.writeValue(value, depth - 1)
+        if (reason !== StreamWriteOK) {
+          return "[\"" + name + "\"]" + reason
+        }
+      }
+      return StreamWriteOK
+    })
+  }
+
+  // write writes the value, it returns the reason if the value is not
+  // supported, for example "value[0] type(Date) is not supported"
+  write(v) {
+    const reason = this.writeValue(v, streamWriteMaxDepth)
+    return reason === StreamWriteOK ? StreamWriteOK : "value" + reason
+  }
+
+  writeValue(v, depth) {
+    if (depth <= 0) {
+      return StreamWriteOverflow
+    }
+
+    if (v === null || v === undefined) {
+      this.writeNil()
+      return StreamWriteOK
+    }
+
+    switch (typeof v) {
+    case "boolean":
+      this.writeBool(v)
+      return StreamWriteOK
+    case "number":
+      if (Number.isSafeInteger(v)) {
+        this.writeInt64(v)
+      } else {
+        this.writeFloat64(v)
+      }
+      return StreamWriteOK
+    case "bigint":
+      if (v >= int64Min && v <= int64Max) {
+        this.writeInt64(v)
+      } else if (v > int64Max && v <= uint64Max) {
+        this.writeUint64(v)
+      } else {
+        return " overflows int64 and uint64"
+      }
+      return StreamWriteOK
+    case "string":
+      this.writeString(v)
+      return StreamWriteOK
+    case "object":
+      return this.writeObject(v, depth)
+    default:
+      return " type(" + getTypeName(v) + ") is not supported"
+    }
+  }
+
+  writeObject(v, depth) {
+    if (v instanceof Int64) {
+      const n = toBigInt(v.value)
+      if (n === null || n < int64Min || n > int64Max) {
+        return " is not an Int64"
+      }
+      this.writeInt64(n)
+    } else if (v instanceof Uint64) {
+      const n = toBigInt(v.value)
+      if (n === null || n < BigInt(0) || n > uint64Max) {
+        return " is not an Uint64"
+      }
+      this.writeUint64(n)
+    } else if (v instanceof Float64) {
+      if (typeof v.value !== "number") {
+        return " is not a Float64"
+      }
+      this.writeFloat64(v.value)
+    } else if (v instanceof Uint8Array) {
+      this.writeBytes(v)
+    } else if (v instanceof ArrayBuffer) {
+      this.writeBytes(new Uint8Array(v))
+    } else if (Array.isArray(v)) {
+      return this.writeArray(v, depth)
+    } else if (v instanceof Map) {
+      return this.writeMap(Array.from(v.entries()), depth)
+    } else if (isPlainObject(v)) {
+      return this.writeMap(Object.entries(v), depth)
+    } else {
+      return " type(" + getTypeName(v) + ") is not supported"
+    }
+    return StreamWriteOK
+  }
+
+  // peek returns the op and checks that n bytes can be read
+  peek(n) {
+    if (this.readPos + n > this.writePos) {
+      throw ErrStream
+    }
+    return this.buffer[this.readPos]
+  }
+
+  readNil() {
+    if (this.peek(1) !== 1) {
+      throw ErrStream
+    }
+    this.readPos++
+    return null
+  }
+
+  readBool() {
+    const op = this.peek(1)
+    if (op !== 2 && op !== 3) {
+      throw ErrStream
+    }
+    this.readPos++
+    return op === 2
+  }
+
+  readFloat64() {
+    const op = this.peek(1)
+    if (op === 4) {
+      this.readPos++
+      return 0
+    } else if (op === 5) {
+      this.peek(9)
+      const ret = this.view.getFloat64(this.readPos + 1, true)
+      this.readPos += 9
+      return ret
+    }
+    throw ErrStream
+  }
+
+  // readInt64 returns the number, or the bigint if it is not safe
+  readInt64() {
+    const op = this.peek(1)
+    let ret
+    if (op > 13 && op < 54) {
+      this.readPos++
+      return op - 21
+    } else if (op === 6) {
+      this.peek(3)
+      ret = this.view.getUint16(this.readPos + 1, true) - 32768
+      this.readPos += 3
+    } else if (op === 7) {
+      this.peek(5)
+      ret = this.view.getUint32(this.readPos + 1, true) - 2147483648
+      this.readPos += 5
+    } else if (op === 8) {
+      this.peek(9)
+      ret = toNumber(
+        this.view.getBigUint64(this.readPos + 1, true) - int64Offset,
+      )
+      this.readPos += 9
+    } else {
+      throw ErrStream
+    }
+    return ret
+  }
+
+  // readUint64 returns the number, or the bigint if it is not safe
+  readUint64() {
+    const op = this.peek(1)
+    let ret
+    if (op > 53 && op < 64) {
+      this.readPos++
+      return op - 54
+    } else if (op === 9) {
+      this.peek(3)
+      ret = this.view.getUint16(this.readPos + 1, true)
+      this.readPos += 3
+    } else if (op === 10) {
+      this.peek(5)
+      ret = this.view.getUint32(this.readPos + 1, true)
+      this.readPos += 5
+    } else if (op === 11) {
+      this.peek(9)
+      ret = toNumber(this.view.getBigUint64(this.readPos + 1, true))
+      this.readPos += 9
+    } else {
+      throw ErrStream
+    }
+    return ret
+  }
+
+  readString() {
+    const op = this.peek(1)
+    let start = 0
+    let length = 0
+    if (op === 128) {
+      this.readPos++
+      return ""
+    } else if (op > 128 && op < 191) {
+      start = this.readPos + 1
+      length = op - 128
+    } else if (op === 191) {
+      this.peek(5)
+      start = this.readPos + 5
+      length = this.view.getUint32(this.readPos + 1, true) - 6
+      if (length < 63) {
+        throw ErrStream
+      }
+    } else {
+      throw ErrStream
+    }
+
+    if (start + length + 1 > this.writePos || this.buffer[start + length]) {
+      throw ErrStream
+    }
+    let ret
+    try {
+      ret = utf8Decoder.decode(this.buffer.subarray(start, start + length))
+    } catch (e) {
+      throw ErrStream
+    }
+    this.readPos = start + length + 1
+    return ret
+  }
+
+  readBytes() {
+    const op = this.peek(1)
+    let start = 0
+    let length = 0
+    if (op === 192) {
+      this.readPos++
+      return new Uint8Array(0)
+    } else if (op > 192 && op < 255) {
+      start = this.readPos + 1
+      length = op - 192
+    } else if (op === 255) {
+      this.peek(5)
+      start = this.readPos + 5
+      length = this.view.getUint32(this.readPos + 1, true) - 5
+      if (length < 63) {
+        throw ErrStream
+      }
+    } else {
+      throw ErrStream
+    }
+
+    if (start + length > this.writePos) {
+      throw ErrStream
+    }
+    this.readPos = start + length
+    return this.buffer.slice(start, start + length)
+  }
+
+  // readContainer reads the header of the Array (op 64) or the Map (op 96),
+  // then the items, and checks the total length
+  readContainer(op, readItem) {
+    const v = this.peek(1)
+    if (v < op || v >= op + 32) {
+      throw ErrStream
+    } else if (v === op) {
+      this.readPos++
+      return 0
+    }
+
+    const start = this.readPos
+    let length = v - op
+    this.peek(5)
+    const totalLength = this.view.getUint32(start + 1, true)
+    if (length < 31) {
+      this.readPos += 5
+    } else {
+      this.peek(9)
+      length = this.view.getUint32(start + 5, true)
+      this.readPos += 9
+    }
+
+    if (length <= 0 || totalLength <= 4) {
+      throw ErrStream
+    }
+    for (let i = 0; i < length; i++) {
+      readItem()
+    }
+    if (this.readPos !== start + totalLength) {
+      throw ErrStream
+    }
+    return length
+  }
+
+  readArray() {
+    const ret = []
+    this.readContainer(64, () => {
+      ret.push(this.readValue())
+    })
+    return ret
+  }
+
+  // readMap returns the plain object of the Map
+  readMap() {
+    const ret = {}
+    this.readContainer(96, () => {
+      const name = this.readString()
+      Object.defineProperty(ret, name, {
+        value: this.readValue(),
+        writable: true,
+        enumerable: true,
+        configurable: true,
+      })
+    })
+    return ret
+  }
+
+  // read reads a value, the read position is not moved if it fails
+  read() {
+    const start = this.readPos
+    try {
+      return this.readValue()
+    } catch (e) {
+      this.readPos = start
+      throw e
+    }
+  }
+
+  readValue() {
+    const op = this.peek(1)
+    switch (op) {
+    case 1:
+      return this.readNil()
+    case 2:
+    case 3:
+      return this.readBool()
+    case 4:
+    case 5:
+      return this.readFloat64()
+    case 6:
+    case 7:
+    case 8:
+      return this.readInt64()
+    case 9:
+    case 10:
+    case 11:
+      return this.readUint64()
+    case 0:
+    case 12:
+    case 13:
+      throw ErrStream
+    }
+
+    switch (op >> 6) {
+    case 0:
+      return op < 54 ? this.readInt64() : this.readUint64()
+    case 1:
+      return op < 96 ? this.readArray() : this.readMap()
+    case 2:
+      return this.readString()
+    default:
+      return this.readBytes()
+    }
+  }
+}
+
+// parseResponseStream returns the value of the response, or throws the error
+export function parseResponseStream(stream) {
+  switch (stream.getKind()) {
+  case StreamKindRPCResponseOK:
+    return stream.read()
+  case StreamKindSystemErrorReport:
+  case StreamKindRPCResponseError: {
+    const code = stream.readUint64()
+    const message = stream.readString()
+    if (code === 0 || code > 0xFFFFFFFF || !stream.isReadFinish()) {
+      throw ErrStream
+    }
+    throw new RPCError(code, message)
+  }
+  default:
+    throw ErrStream
+  }
+}
+
+// StreamGenerator cuts the streams out of the received bytes, the websocket
+// messages can hold a part of a stream or many streams.
+export class StreamGenerator {
+  constructor(onStream) {
+    this.onStream = onStream
+    this.header = new Uint8Array(streamPosBody)
+    this.headerPos = 0
+    this.stream = null
+  }
+
+  reset() {
+    this.headerPos = 0
+    this.stream = null
+  }
+
+  // onBytes throws ErrStream if the bytes are not valid
+  onBytes(b) {
+    while (b.length > 0) {
+      if (this.stream === null) {
+        const n = Math.min(b.length, streamPosBody - this.headerPos)
+        this.header.set(b.subarray(0, n), this.headerPos)
+        this.headerPos += n
+        b = b.subarray(n)
+
+        if (this.headerPos < streamPosBody) {
+          return
+        }
+
+        // the header of other versions can not be read correctly
+        if (this.header[streamPosVersion] !== streamVersion) {
+          throw ErrStream
+        }
+
+        this.stream = Stream.fromBytes(this.header)
+        this.headerPos = 0
+      }
+
+      const remains = this.stream.getLength() - this.stream.getWritePos()
+      if (remains < 0) {
+        throw ErrStream
+      }
+      const n = Math.min(b.length, remains)
+      this.stream.putBytes(b.subarray(0, n))
+      b = b.subarray(n)
+
+      if (this.stream.getWritePos() === this.stream.getLength()) {
+        // the client does not negotiate the codec, so nothing is compressed
+        const stream = this.stream
+        if (!stream.checkStream() || stream.hasStatusBitCompressed()) {
+          throw ErrStream
+        }
+        this.stream = null
+        this.onStream(stream)
+      }
+    }
+  }
+}
+
+// Client calls the actions of the server over the websocket. It keeps the
+// session of the server, and resends the unreplied requests after it
+// reconnects.
+//
+// The options are:
+//   credentials: the Map that is checked by the authenticator of the server
+//   onError: called with the RPCError of the connection
+//   onConnState: called with ConnStateConnecting, ConnStateConnected and
+//     ConnStateDisconnected
+//   reconnectMinInterval, reconnectMaxInterval: the backoff in milliseconds
+//   WebSocket: the constructor of the websocket, globalThis.WebSocket by
+//     default
+export class Client {
+  constructor(url, options = {}) {
+    this.url = url
+    this.credentials = options.credentials || null
+    this.onError = options.onError || null
+    this.onConnState = options.onConnState || null
+    this.reconnectMinInterval = options.reconnectMinInterval || 500
+    this.reconnectMaxInterval = options.reconnectMaxInterval || 16000
+    this.WebSocket = options.WebSocket || globalThis.WebSocket
+
+    this.config = {
+      numOfChannels: 0,
+      transLimit: 0,
+      heartbeat: 0,
+      heartbeatTimeout: 0,
+    }
+    this.sessionString = ""
+    this.conn = null
+    this.ready = false
+    this.draining = false
+    this.closed = false
+    this.failures = 0
+    this.lastPingMS = 0
+    this.lastReadMS = 0
+    this.channels = []
+    this.preSendList = []
+    this.subscriptionMap = new Map()
+    this.reconnectTimer = null
+    this.timer = setInterval(() => this.onTimer(), 100)
+
+    this.connect()
+  }
+
+  // send calls the target action with the args, the promise is rejected with
+  // the RPCError of the action, or with ErrClientTimeout.
+  send(timeoutMS, target, ...args) {
+    return this.sendWithPriority(0, timeoutMS, target, ...args)
+  }
+
+  // sendWithPriority is the same as send, but the request is sent with the
+  // priority, 0 is the lowest.
+  sendWithPriority(priority, timeoutMS, target, ...args) {
+    return new Promise((resolve, reject) => {
+      if (this.closed) {
+        reject(ErrClientCanceled)
+        return
+      }
+
+      const stream = new Stream()
+      stream.setKind(StreamKindRPCRequest)
+      stream.setPriority(priority)
+      stream.setDepth(0)
+      stream.writeString(target)
+      stream.writeString("@")
+      for (let i = 0; i < args.length; i++) {
+        const reason = stream.write(args[i])
+        if (reason !== StreamWriteOK) {
+          reject(ErrUnsupportedValue.addDebug(reason))
+          return
+        }
+      }
+
+      this.preSendList.push({
+        stream,
+        startMS: Date.now(),
+        timeoutMS,
+        resolve,
+        reject,
+      })
+      this.tryToDeliverPreSendMessages()
+    })
+  }
+
+  // subscribe calls fn with the value of every boardcast of the message that
+  // the service of nodePath publishes, it returns the object to unsubscribe.
+  subscribe(nodePath, message, fn) {
+    const topic = nodePath + "%" + message
+    let list = this.subscriptionMap.get(topic)
+    if (!list) {
+      list = []
+      this.subscriptionMap.set(topic, list)
+      this.sendTopicStream(StreamKindSubscribe, topic)
+    }
+    const subscription = { fn }
+    list.push(subscription)
+
+    return {
+      close: () => {
+        const pos = list.indexOf(subscription)
+        if (pos >= 0) {
+          list.splice(pos, 1)
+          if (list.length === 0 && this.subscriptionMap.get(topic) === list) {
+            this.subscriptionMap.delete(topic)
+            this.sendTopicStream(StreamKindUnsubscribe, topic)
+          }
+        }
+      },
+    }
+  }
+
+  // close closes the connection, the calls that are not replied are rejected
+  // with ErrClientCanceled. It returns false if the client is closed.
+  close() {
+    if (this.closed) {
+      return false
+    }
+
+    this.closed = true
+    clearInterval(this.timer)
+    clearTimeout(this.reconnectTimer)
+    if (this.conn) {
+      this.conn.close()
+    }
+
+    for (const item of this.preSendList) {
+      item.reject(ErrClientCanceled)
+    }
+    this.preSendList = []
+    for (const channel of this.channels) {
+      if (channel.item) {
+        channel.item.reject(ErrClientCanceled)
+        channel.item = null
+      }
+    }
+    return true
+  }
+
+  connect() {
+    if (this.closed) {
+      return
+    }
+
+    this.setConnState(ConnStateConnecting)
+    let conn
+    try {
+      conn = new this.WebSocket(this.url)
+    } catch (e) {
+      this.reportError(ErrClientConfig.addDebug(String(e)))
+      this.onConnClose()
+      return
+    }
+
+    const generator = new StreamGenerator((stream) => {
+      this.onConnReadStream(conn, stream)
+    })
+    conn.binaryType = "arraybuffer"
+    conn.onopen = () => this.onConnOpen(conn)
+    conn.onmessage = (event) => {
+      if (conn !== this.conn || !(event.data instanceof ArrayBuffer)) {
+        return
+      }
+      this.lastReadMS = Date.now()
+      try {
+        generator.onBytes(new Uint8Array(event.data))
+      } catch (e) {
+        this.onConnError(conn, e instanceof RPCError ? e : ErrStream)
+      }
+    }
+    conn.onclose = () => {
+      if (conn === this.conn) {
+        this.onConnClose()
+      }
+    }
+    this.conn = conn
+  }
+
+  setConnState(state) {
+    if (this.onConnState) {
+      this.onConnState(state)
+    }
+  }
+
+  reportError(err) {
+    if (this.onError) {
+      this.onError(err)
+    }
+  }
+
+  writeStream(stream) {
+    if (this.conn && this.conn.readyState === 1) {
+      stream.buildStreamCheck()
+      this.conn.send(stream.getBuffer())
+    }
+  }
+
+  onConnOpen(conn) {
+    if (conn !== this.conn) {
+      return
+    }
+
+    this.lastReadMS = Date.now()
+    const stream = new Stream()
+    stream.setKind(StreamKindConnectRequest)
+    stream.setCallbackID(0)
+    stream.writeString(this.sessionString)
+    if (this.credentials === null) {
+      stream.writeNil()
+    } else {
+      const reason = stream.write(this.credentials)
+      if (reason !== StreamWriteOK) {
+        this.onConnError(
+          conn,
+          ErrClientConfig.addDebug("credentials " + reason),
+        )
+        return
+      }
+    }
+    // no codec is supported, the server does not compress the streams
+    stream.writeBytes(new Uint8Array(0))
+    this.writeStream(stream)
+  }
+
+  onConnReadStream(conn, stream) {
+    if (conn !== this.conn) {
+      return
+    }
+
+    if (!this.ready) {
+      if (stream.getCallbackID() !== 0) {
+        this.onConnError(conn, ErrStream)
+      } else {
+        this.initConn(conn, stream)
+      }
+      return
+    }
+
+    const callbackID = stream.getCallbackID()
+    switch (stream.getKind()) {
+    case StreamKindRPCResponseOK:
+    case StreamKindRPCResponseError: {
+      const channel = this.channels[callbackID % this.channels.length]
+      if (channel.sequence === callbackID && channel.item) {
+        const item = channel.item
+        channel.item = null
+        try {
+          item.resolve(parseResponseStream(stream))
+        } catch (e) {
+          item.reject(e)
+        }
+        this.tryToDeliverPreSendMessages()
+      }
+      break
+    }
+    case StreamKindRPCResponseItem:
+      // the items of the streaming actions are not supported, the final
+      // response is still delivered
+      break
+    case StreamKindRPCBoardCast: {
+      let topic
+      let value
+      try {
+        topic = stream.readString()
+        value = stream.read()
+      } catch (e) {
+        this.onConnError(conn, ErrStream)
+        return
+      }
+      if (!stream.isReadFinish()) {
+        this.onConnError(conn, ErrStream)
+        return
+      }
+      const list = this.subscriptionMap.get(topic)
+      if (list) {
+        for (const subscription of list.slice()) {
+          subscription.fn(value)
+        }
+      }
+      break
+    }
+    case StreamKindPong:
+      if (!stream.isReadFinish()) {
+        this.onConnError(conn, ErrStream)
+      }
+      break
+    case StreamKindDrain:
+      if (!stream.isReadFinish()) {
+        this.onConnError(conn, ErrStream)
+      } else {
+        // the client has only one endpoint, it would reconnect to the same
+        // draining server, so it stops sending until the server closes the
+        // conn
+        this.draining = true
+      }
+      break
+    case StreamKindSystemErrorReport:
+      try {
+        parseResponseStream(stream)
+      } catch (e) {
+        this.reportError(e)
+      }
+      break
+    default:
+      this.onConnError(conn, ErrStream)
+    }
+  }
+
+  initConn(conn, stream) {
+    let sessionString
+    let numOfChannels
+    let transLimit
+    let heartbeat
+    let heartbeatTimeout
+
+    try {
+      if (stream.getKind() === StreamKindSystemErrorReport) {
+        // the connection is rejected by the server
+        parseResponseStream(stream)
+      } else if (stream.getKind() !== StreamKindConnectResponse) {
+        throw ErrStream
+      }
+
+      sessionString = stream.readString()
+      numOfChannels = stream.readInt64()
+      transLimit = stream.readInt64()
+      heartbeat = stream.readInt64()
+      heartbeatTimeout = stream.readInt64()
+      if (numOfChannels <= 0 || transLimit <= 0 ||
+        heartbeat <= 0 || heartbeatTimeout <= 0) {
+        throw ErrClientConfig
+      }
+      if (!stream.isReadFinish()) {
+        // the codec and the threshold of the compression
+        if (stream.readInt64() !== StreamCodecNone) {
+          throw ErrClientConfig
+        }
+        stream.readInt64()
+      }
+      if (!stream.isReadFinish()) {
+        throw ErrStream
+      }
+    } catch (e) {
+      this.onConnError(conn, e instanceof RPCError ? e : ErrStream)
+      return
+    }
+
+    this.ready = true
+    this.failures = 0
+    this.lastPingMS = Date.now()
+
+    if (sessionString !== this.sessionString) {
+      // new session, the server does not know the requests in the channels,
+      // they are not resent because they may have been run
+      for (const channel of this.channels) {
+        if (channel.item) {
+          channel.item.reject(ErrClientCanceled)
+        }
+      }
+
+      this.sessionString = sessionString
+      this.config = {
+        numOfChannels: Number(numOfChannels),
+        transLimit: Number(transLimit),
+        heartbeat: Number(heartbeat),
+        heartbeatTimeout: Number(heartbeatTimeout),
+      }
+      this.channels = []
+      for (let i = 0; i < this.config.numOfChannels; i++) {
+        this.channels.push({ sequence: i, item: null })
+      }
+    } else {
+      // the server replies the cached responses of the resent requests
+      for (const channel of this.channels) {
+        if (channel.item) {
+          this.writeStream(channel.item.stream)
+        }
+      }
+    }
+
+    for (const topic of this.subscriptionMap.keys()) {
+      this.sendTopicStream(StreamKindSubscribe, topic)
+    }
+
+    this.setConnState(ConnStateConnected)
+    this.tryToDeliverPreSendMessages()
+  }
+
+  sendTopicStream(kind, topic) {
+    if (this.ready) {
+      const stream = new Stream()
+      stream.setKind(kind)
+      stream.setCallbackID(0)
+      stream.writeString(topic)
+      this.writeStream(stream)
+    }
+  }
+
+  tryToDeliverPreSendMessages() {
+    if (!this.ready || this.draining) {
+      return
+    }
+
+    const channelSize = this.channels.length
+    for (let i = 0; i < channelSize && this.preSendList.length > 0; i++) {
+      const channel = this.channels[i]
+      if (channel.item) {
+        continue
+      }
+
+      const item = this.preSendList.shift()
+      channel.sequence += channelSize
+      channel.item = item
+      item.stream.setCallbackID(channel.sequence)
+
+      // tell the server how much time is left
+      const remainMS = item.timeoutMS - (Date.now() - item.startMS)
+      if (remainMS > 0) {
+        item.stream.setTimeout(BigInt(Math.ceil(remainMS * 1000000)))
+        this.writeStream(item.stream)
+      } else {
+        channel.item = null
+        item.reject(ErrClientTimeout)
+      }
+    }
+  }
+
+  onTimer() {
+    const nowMS = Date.now()
+
+    // sweep the pre send list and the channels
+    this.preSendList = this.preSendList.filter((item) => {
+      if (nowMS - item.startMS > item.timeoutMS) {
+        item.reject(ErrClientTimeout)
+        return false
+      }
+      return true
+    })
+    for (const channel of this.channels) {
+      const item = channel.item
+      if (item && nowMS - item.startMS > item.timeoutMS) {
+        channel.item = null
+        item.reject(ErrClientTimeout)
+      }
+    }
+    this.tryToDeliverPreSendMessages()
+
+    if (this.ready) {
+      if (nowMS - this.lastReadMS > this.config.heartbeatTimeout) {
+        this.conn.close()
+        this.onConnClose()
+      } else if (nowMS - this.lastPingMS >= this.config.heartbeat) {
+        this.lastPingMS = nowMS
+        const stream = new Stream()
+        stream.setKind(StreamKindPing)
+        stream.setCallbackID(0)
+        this.writeStream(stream)
+      }
+    }
+  }
+
+  onConnError(conn, err) {
+    this.reportError(err)
+    if (conn === this.conn) {
+      conn.close()
+      this.onConnClose()
+    }
+  }
+
+  onConnClose() {
+    if (this.conn) {
+      this.conn.onopen = null
+      this.conn.onmessage = null
+      this.conn.onclose = null
+    }
+    this.conn = null
+    this.ready = false
+    this.draining = false
+    this.setConnState(ConnStateDisconnected)
+
+    if (!this.closed) {
+      const interval = Math.min(
+        this.reconnectMinInterval * Math.pow(2, this.failures),
+        this.reconnectMaxInterval,
+      )
+      this.failures++
+      this.reconnectTimer = setTimeout(() => this.connect(), interval)
+    }
+  }
+}
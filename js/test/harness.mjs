@@ -0,0 +1,422 @@
+// The test harness of rpc.js, it is run by internal/client/js_test.go
+//
+//   node harness.mjs fixtures <streams.json>
+//   node harness.mjs server <url>
+//
+// It prints "ok" if all the checks pass.
+
+import { readFileSync } from "fs"
+import * as rpc from "../rpc.js"
+
+function check(ok, message) {
+  if (!ok) {
+    throw new Error(message)
+  }
+}
+
+function hexToBytes(str) {
+  const ret = new Uint8Array(str.length / 2)
+  for (let i = 0; i < ret.length; i++) {
+    ret[i] = parseInt(str.substr(i * 2, 2), 16)
+  }
+  return ret
+}
+
+function bytesToHex(bytes) {
+  return Array.from(bytes, (b) => b.toString(16).padStart(2, "0")).join("")
+}
+
+function toNumber(v) {
+  return v >= BigInt(Number.MIN_SAFE_INTEGER) &&
+    v <= BigInt(Number.MAX_SAFE_INTEGER) ? Number(v) : v
+}
+
+// makeValue returns the value that is written for the typed fixture value
+function makeValue([kind, v]) {
+  switch (kind) {
+  case "nil":
+    return null
+  case "int64":
+    return new rpc.Int64(BigInt(v))
+  case "uint64":
+    return new rpc.Uint64(BigInt(v))
+  case "float64":
+    return new rpc.Float64(v)
+  case "bytes":
+    return hexToBytes(v)
+  case "array":
+    return v.map(makeValue)
+  case "map":
+    return new Map(v.map(([key, value]) => [key, makeValue(value)]))
+  default:
+    return v
+  }
+}
+
+// expectValue returns the value that is read for the typed fixture value
+function expectValue([kind, v]) {
+  switch (kind) {
+  case "nil":
+    return null
+  case "int64":
+  case "uint64":
+    return toNumber(BigInt(v))
+  case "bytes":
+    return hexToBytes(v)
+  case "array":
+    return v.map(expectValue)
+  case "map": {
+    const ret = {}
+    for (const [key, value] of v) {
+      ret[key] = expectValue(value)
+    }
+    return ret
+  }
+  default:
+    return v
+  }
+}
+
+function deepEqual(a, b) {
+  if (typeof a !== typeof b) {
+    return false
+  } else if (a === null || b === null || typeof a !== "object") {
+    return Object.is(a, b)
+  } else if (a instanceof Uint8Array || b instanceof Uint8Array) {
+    return a instanceof Uint8Array && b instanceof Uint8Array &&
+      bytesToHex(a) === bytesToHex(b)
+  } else if (Array.isArray(a) || Array.isArray(b)) {
+    return Array.isArray(a) && Array.isArray(b) && a.length === b.length &&
+      a.every((item, i) => deepEqual(item, b[i]))
+  }
+  const keys = Object.keys(a)
+  return keys.length === Object.keys(b).length &&
+    keys.every((key) => Object.hasOwn(b, key) && deepEqual(a[key], b[key]))
+}
+
+function makeStream(fixture) {
+  const header = fixture.header
+  const stream = new rpc.Stream()
+  if (header.debug) {
+    stream.setStatusBitDebug()
+  }
+  stream.setKind(header.kind)
+  stream.setPriority(header.priority || 0)
+  stream.setZoneID(header.zoneID || 0)
+  stream.setTargetID(BigInt(header.targetID || "0"))
+  stream.setSourceID(BigInt(header.sourceID || "0"))
+  stream.setGatewayID(BigInt(header.gatewayID || "0"))
+  stream.setSessionID(BigInt(header.sessionID || "0"))
+  stream.setCallbackID(BigInt(header.callbackID || "0"))
+  stream.setDepth(header.depth || 0)
+  stream.setTimeout(BigInt(header.timeout || "0"))
+  stream.setTraceContext({
+    traceID: hexToBytes(header.traceID || "00".repeat(16)),
+    spanID: hexToBytes(header.spanID || "00".repeat(8)),
+    flags: header.traceFlags || 0,
+  })
+  for (const value of fixture.values) {
+    const reason = stream.write(makeValue(value))
+    check(reason === rpc.StreamWriteOK, fixture.name + ": " + reason)
+  }
+  stream.buildStreamCheck()
+  return stream
+}
+
+function checkStream(fixture, stream) {
+  const header = fixture.header
+  const name = fixture.name
+  check(stream.getVersion() === 3, name + ": version")
+  check(stream.hasStatusBitDebug() === !!header.debug, name + ": debug")
+  check(stream.getKind() === header.kind, name + ": kind")
+  check(stream.getPriority() === (header.priority || 0), name + ": priority")
+  check(stream.getZoneID() === (header.zoneID || 0), name + ": zoneID")
+  for (const field of [
+    "targetID", "sourceID", "gatewayID", "sessionID", "callbackID", "timeout",
+  ]) {
+    const getter = "get" + field[0].toUpperCase() + field.substr(1)
+    check(
+      stream[getter]() === toNumber(BigInt(header[field] || "0")),
+      name + ": " + field,
+    )
+  }
+  check(stream.getDepth() === (header.depth || 0), name + ": depth")
+  const trace = stream.getTraceContext()
+  check(
+    bytesToHex(trace.traceID) === (header.traceID || "00".repeat(16)) &&
+      bytesToHex(trace.spanID) === (header.spanID || "00".repeat(8)) &&
+      trace.flags === (header.traceFlags || 0),
+    name + ": trace context",
+  )
+  for (const value of fixture.values) {
+    check(deepEqual(stream.read(), expectValue(value)), name + ": value")
+  }
+  check(stream.isReadFinish(), name + ": read finish")
+}
+
+function readStreams(chunks) {
+  const ret = []
+  const generator = new rpc.StreamGenerator((stream) => ret.push(stream))
+  for (const chunk of chunks) {
+    generator.onBytes(chunk)
+  }
+  return ret
+}
+
+function splitBytes(bytes, size) {
+  const ret = []
+  for (let i = 0; i < bytes.length; i += size) {
+    ret.push(bytes.subarray(i, i + size))
+  }
+  return ret
+}
+
+function expectThrow(fn, err, message) {
+  try {
+    fn()
+  } catch (e) {
+    check(e === err, message + ": " + e)
+    return
+  }
+  check(false, message + ": no error")
+}
+
+function runFixtures(file) {
+  const fixtures = JSON.parse(readFileSync(file, "utf-8"))
+
+  for (const item of fixtures.errors) {
+    const err = rpc[item.name]
+    check(err instanceof rpc.RPCError, item.name + " is not defined")
+    check(err.getCode() === item.code, item.name + ": code")
+    check(err.getMessage() === item.message, item.name + ": message")
+  }
+
+  for (const fixture of fixtures.streams) {
+    // rpc.js writes the same bytes as Go
+    const stream = makeStream(fixture)
+    const bytes = hexToBytes(fixture.hex)
+    if (fixture.unordered) {
+      check(stream.getWritePos() === bytes.length, fixture.name + ": length")
+      checkStream(fixture, readStreams([stream.getBuffer()])[0])
+    } else {
+      check(
+        bytesToHex(stream.getBuffer()) === fixture.hex,
+        fixture.name + ": bytes",
+      )
+    }
+
+    // rpc.js reads the bytes of Go, however they are split
+    for (const size of [1, 7, 93, 512, bytes.length]) {
+      const streams = readStreams(splitBytes(bytes, size))
+      check(streams.length === 1, fixture.name + ": streams")
+      checkStream(fixture, streams[0])
+    }
+    const twice = new Uint8Array(bytes.length * 2)
+    twice.set(bytes)
+    twice.set(bytes, bytes.length)
+    const streams = readStreams([twice])
+    check(streams.length === 2, fixture.name + ": two streams")
+    streams.forEach((stream) => checkStream(fixture, stream))
+  }
+
+  // the bad streams
+  const ping = hexToBytes(
+    fixtures.streams.find((fixture) => fixture.name === "ping").hex,
+  )
+  const badCheckSum = ping.slice()
+  badCheckSum[8] ^= 1
+  expectThrow(() => readStreams([badCheckSum]), rpc.ErrStream, "checksum")
+  const badVersion = ping.slice()
+  badVersion[0] = 2
+  expectThrow(() => readStreams([badVersion]), rpc.ErrStream, "version")
+  const badString = rpc.Stream.fromBytes(
+    new Uint8Array([...ping, 0x82, 0xff, 0xfe, 0x00]),
+  )
+  expectThrow(() => badString.read(), rpc.ErrStream, "utf8")
+  check(badString.getReadPos() === rpc.StreamHeadSize, "read pos")
+
+  // the unsupported values
+  const stream = new rpc.Stream()
+  check(
+    stream.write([new Date()]) === "value[0] type(Date) is not supported",
+    "write Date",
+  )
+  check(
+    stream.write({ a: new rpc.Uint64(-1) }) === "value[\"a\"] is not an Uint64",
+    "write Uint64",
+  )
+  check(
+    stream.write(BigInt("18446744073709551616")) ===
+      "value overflows int64 and uint64",
+    "write bigint",
+  )
+  let deep = []
+  for (let i = 0; i < 64; i++) {
+    deep = [deep]
+  }
+  check(stream.write(deep).endsWith(rpc.StreamWriteOverflow), "write depth")
+  check(stream.getWritePos() === rpc.StreamHeadSize, "write pos")
+
+  // the response
+  const response = readStreams([hexToBytes(
+    fixtures.streams.find((fixture) => fixture.name === "response error").hex,
+  )])[0]
+  try {
+    rpc.parseResponseStream(response)
+    check(false, "parse response error")
+  } catch (e) {
+    check(e instanceof rpc.RPCError, "parse response error: " + e)
+    check(e.getCode() === rpc.ErrClientTimeout.getCode(), "response code")
+    check(e.getMessage() === "timeout", "response message")
+  }
+}
+
+function sleep(ms) {
+  return new Promise((resolve) => setTimeout(resolve, ms))
+}
+
+async function expectReject(promise, message) {
+  try {
+    await promise
+  } catch (e) {
+    check(e instanceof rpc.RPCError, message + ": " + e)
+    return e
+  }
+  check(false, message + ": no error")
+}
+
+async function runServer(url) {
+  const states = []
+  const client = new rpc.Client(url, {
+    credentials: { token: "abc" },
+    onConnState: (state) => states.push(state),
+    onError: (err) => {
+      throw err
+    },
+  })
+
+  try {
+    // the args are typed
+    check(
+      await client.send(3000, "#.user:SayHello", "kitty") === "hello kitty",
+      "SayHello",
+    )
+    check(
+      await client.send(
+        3000, "#.user:Add", new rpc.Uint64(1), new rpc.Float64(2.5),
+      ) === 3.5,
+      "Add",
+    )
+    check(
+      await client.send(
+        3000, "#.user:Neg", new rpc.Int64(BigInt("9223372036854775807")),
+      ) === BigInt("-9223372036854775807"),
+      "Neg",
+    )
+    check(await client.send(3000, "#.user:GetIdentity") === "kitty", "identity")
+    const values = [
+      null, true, 1.5, -3, "你好", new Uint8Array([1, 2, 3]),
+      [1, "a"], { a: { b: [null] } }, "x".repeat(2000),
+    ]
+    check(
+      deepEqual(await client.send(3000, "#.user:Echo", values), values),
+      "Echo",
+    )
+
+    // the errors
+    let err = await expectReject(client.send(3000, "#.user:Error"), "Error")
+    check(err.getMessage().startsWith("action error"), "Error: message")
+    await expectReject(client.send(3000, "#.user:Add", 1, 2.5), "Add: args")
+    await expectReject(client.send(3000, "#.user:None"), "None")
+    err = await expectReject(
+      client.send(3000, "#.user:Echo", [new Date()]),
+      "Echo: Date",
+    )
+    check(
+      err.getCode() === rpc.ErrUnsupportedValue.getCode() &&
+        err.getMessage() === "value[0] type(Date) is not supported",
+      "Echo: Date message",
+    )
+    err = await expectReject(
+      client.send(200, "#.user:Sleep", new rpc.Int64(1000000000)),
+      "Sleep",
+    )
+    check(err === rpc.ErrClientTimeout, "Sleep: timeout")
+
+    // the calls wait for the channels
+    const names = Array.from({ length: 20 }, (_, i) => "n" + i)
+    const replies = await Promise.all(
+      names.map((name) => client.send(3000, "#.user:SayHello", name)),
+    )
+    check(
+      replies.every((reply, i) => reply === "hello " + names[i]),
+      "channels",
+    )
+
+    // the boardcasts of the subscribed topic
+    let subscription
+    const message = new Promise((resolve) => {
+      subscription = client.subscribe("#.user", "@Publish", resolve)
+    })
+    check(await client.send(3000, "#.user:Publish", "news") === null, "Publish")
+    check(await message === "news", "subscribe")
+    subscription.close()
+
+    // the pings keep the connection alive after the heartbeat timeout
+    await sleep(1500)
+    check(
+      await client.send(3000, "#.user:SayHello", "ping") === "hello ping",
+      "ping",
+    )
+    check(
+      deepEqual(states, [rpc.ConnStateConnecting, rpc.ConnStateConnected]),
+      "states: " + states,
+    )
+
+    // the calls are canceled when the client is closed
+    const pending = client.send(3000, "#.user:Sleep", new rpc.Int64(100000000))
+    check(client.close() === true, "close")
+    check(client.close() === false, "close again")
+    check(
+      await expectReject(pending, "pending") === rpc.ErrClientCanceled,
+      "pending: canceled",
+    )
+  } finally {
+    client.close()
+  }
+
+  // the server rejects the credentials
+  const rejected = await new Promise((resolve) => {
+    const badClient = new rpc.Client(url, {
+      credentials: { token: "bad" },
+      onError: (err) => {
+        badClient.close()
+        resolve(err)
+      },
+    })
+  })
+  check(rejected instanceof rpc.RPCError, "credentials: " + rejected)
+  check(
+    rejected.getMessage().startsWith("authentication failed"),
+    "credentials: " + rejected.getMessage(),
+  )
+}
+
+async function main() {
+  const [mode, arg] = process.argv.slice(2)
+  if (mode === "fixtures") {
+    runFixtures(arg)
+  } else if (mode === "server") {
+    await runServer(arg)
+  } else {
+    throw new Error("unknown mode " + mode)
+  }
+}
+
+main().then(() => {
+  console.log("ok")
+  process.exit(0)
+}, (e) => {
+  console.log(e && e.stack ? e.stack : String(e))
+  process.exit(1)
+})